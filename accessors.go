@@ -0,0 +1,85 @@
+package mbserver
+
+// The accessors below read and write the memory maps from application code
+// while masters are connected: they hold the memory lock, like the function
+// handlers, instead of racing with them as accessing the exported slices
+// does. Reads return copies and are validated as by ReadAnyRegisters. Writes
+// are all or nothing: an error wrapping ErrAddressOutOfRange is returned, and
+// nothing written, when the range extends beyond the memory map. Unlike
+// WriteHoldingRegistersBatch, they do not fire the OnWrite callbacks.
+
+// ReadCoils returns qty coils from addr.
+func (s *Server) ReadCoils(addr uint16, qty uint16) ([]bool, error) {
+	return s.readBools(Coil, addr, qty)
+}
+
+// ReadDiscreteInputs returns qty discrete inputs from addr.
+func (s *Server) ReadDiscreteInputs(addr uint16, qty uint16) ([]bool, error) {
+	return s.readBools(DiscreteInput, addr, qty)
+}
+
+// ReadHoldingRegisters returns qty holding registers from addr.
+func (s *Server) ReadHoldingRegisters(addr uint16, qty uint16) ([]uint16, error) {
+	return s.ReadAnyRegisters(addr, qty, HoldingRegister)
+}
+
+// ReadInputRegisters returns qty input registers from addr.
+func (s *Server) ReadInputRegisters(addr uint16, qty uint16) ([]uint16, error) {
+	return s.ReadAnyRegisters(addr, qty, InputRegister)
+}
+
+// WriteCoils sets len(values) coils from addr.
+func (s *Server) WriteCoils(addr uint16, values []bool) error {
+	return s.writeAny(Coil, addr, boolValues(values))
+}
+
+// WriteDiscreteInputs sets len(values) discrete inputs from addr.
+func (s *Server) WriteDiscreteInputs(addr uint16, values []bool) error {
+	return s.writeAny(DiscreteInput, addr, boolValues(values))
+}
+
+// WriteHoldingRegisters sets len(values) holding registers from addr.
+func (s *Server) WriteHoldingRegisters(addr uint16, values []uint16) error {
+	return s.writeAny(HoldingRegister, addr, values)
+}
+
+// WriteInputRegisters sets len(values) input registers from addr.
+func (s *Server) WriteInputRegisters(addr uint16, values []uint16) error {
+	return s.writeAny(InputRegister, addr, values)
+}
+
+func (s *Server) readBools(kind RegisterKind, addr uint16, qty uint16) ([]bool, error) {
+	values, err := s.ReadAnyRegisters(addr, qty, kind)
+	if err != nil {
+		return nil, err
+	}
+	bools := make([]bool, len(values))
+	for i, value := range values {
+		bools[i] = value != 0
+	}
+	return bools, nil
+}
+
+// writeAny sets len(values) values of a memory map from addr, once the whole
+// range was checked.
+func (s *Server) writeAny(kind RegisterKind, addr uint16, values []uint16) error {
+	if len(values) == 0 {
+		return nil
+	}
+
+	s.memoryLock.Lock()
+	defer s.memoryLock.Unlock()
+
+	if err := checkRange(int(addr), len(values), s.bankSize(kind), MaxRegisterSize); err != nil {
+		return err
+	}
+	return s.writeRegisters(kind, int(addr), values)
+}
+
+func boolValues(bools []bool) []uint16 {
+	values := make([]uint16, len(bools))
+	for i, on := range bools {
+		values[i] = boolValue(on)
+	}
+	return values
+}
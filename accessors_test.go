@@ -0,0 +1,75 @@
+package mbserver
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/goburrow/modbus"
+)
+
+func TestAccessors(t *testing.T) {
+	s := NewServer()
+	if err := s.WriteHoldingRegisters(65534, []uint16{1, 2}); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if err := s.WriteInputRegisters(0, []uint16{3}); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if err := s.WriteCoils(8, []bool{true, false, true}); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if err := s.WriteDiscreteInputs(65535, []bool{true}); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+
+	holding, _ := s.ReadHoldingRegisters(65534, 2)
+	input, _ := s.ReadInputRegisters(0, 1)
+	coils, _ := s.ReadCoils(8, 3)
+	discrete, _ := s.ReadDiscreteInputs(65535, 1)
+	if !isEqual([]uint16{1, 2}, holding) || !isEqual([]uint16{3}, input) || !isEqual([]bool{true, false, true}, coils) || !isEqual([]bool{true}, discrete) {
+		t.Errorf("expected the written values, got %v %v %v %v", holding, input, coils, discrete)
+	}
+
+	if err := s.WriteHoldingRegisters(65535, []uint16{7, 7}); !errors.Is(err, ErrAddressOutOfRange) {
+		t.Errorf("expected ErrAddressOutOfRange, got %v", err)
+	}
+	if s.HoldingRegisters[65535] != 2 {
+		t.Errorf("expected nothing to be written, got %v", s.HoldingRegisters[65535])
+	}
+	if _, err := s.ReadCoils(65535, 2); !errors.Is(err, ErrAddressOutOfRange) {
+		t.Errorf("expected ErrAddressOutOfRange, got %v", err)
+	}
+}
+
+func TestAccessorsWhileServing(t *testing.T) {
+	s := NewServer()
+	addr, err := s.ListenTCPAny()
+	if err != nil {
+		t.Fatalf("failed to listen, got %v\n", err)
+	}
+	defer s.Close()
+
+	handler := modbus.NewTCPClientHandler(addr.String())
+	handler.SlaveId = 1
+	if err := handler.Connect(); err != nil {
+		t.Fatalf("failed to connect, got %v\n", err)
+	}
+	defer handler.Close()
+	client := modbus.NewClient(handler)
+
+	// Run with -race: the application writes while the master does.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			s.WriteHoldingRegisters(0, []uint16{uint16(i), uint16(i)})
+			s.ReadHoldingRegisters(0, 2)
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		if _, err := client.WriteMultipleRegisters(0, 2, []byte{0, 1, 0, 1}); err != nil {
+			t.Fatalf("expected nil, got %v", err)
+		}
+	}
+	<-done
+}
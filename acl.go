@@ -0,0 +1,308 @@
+package mbserver
+
+import (
+	"fmt"
+	"net"
+)
+
+// SetAllowedCIDRs restricts TCP connections to masters whose address is in
+// one of the networks, given in CIDR notation such as "192.168.1.0/24". Other
+// connections are closed as soon as they are accepted, before any Modbus
+// processing, and counted by RejectedConns. Datagrams received by ListenUDP
+// from other masters are dropped. An empty list (the default) allows every
+// address. The list is left unchanged when one of the networks cannot be
+// parsed.
+func (s *Server) SetAllowedCIDRs(cidrs []string) error {
+	nets, err := parseCIDRs(cidrs)
+	if err != nil {
+		return err
+	}
+	s.hooksLock.Lock()
+	s.allowedNets = nets
+	s.hooksLock.Unlock()
+	return nil
+}
+
+// SetDeniedCIDRs rejects TCP connections from masters whose address is in one
+// of the networks, like SetAllowedCIDRs. Denied networks take precedence over
+// allowed ones.
+func (s *Server) SetDeniedCIDRs(cidrs []string) error {
+	nets, err := parseCIDRs(cidrs)
+	if err != nil {
+		return err
+	}
+	s.hooksLock.Lock()
+	s.deniedNets = nets
+	s.hooksLock.Unlock()
+	return nil
+}
+
+// RejectedConns returns the number of TCP connections closed because of the
+// allowed and denied networks, or of the connection limit (see SetMaxConns).
+func (s *Server) RejectedConns() uint64 {
+	return s.rejectedConns.Load()
+}
+
+func parseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+// acceptConn reports whether a connection from the remote address passes the
+// allowed and denied networks.
+func (s *Server) acceptConn(remote net.Addr) bool {
+	s.hooksLock.RLock()
+	allowed, denied := s.allowedNets, s.deniedNets
+	s.hooksLock.RUnlock()
+	if len(allowed) == 0 && len(denied) == 0 {
+		return true
+	}
+
+	ip := remoteIP(remote)
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range denied {
+		if ipNet.Contains(ip) {
+			return false
+		}
+	}
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, ipNet := range allowed {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// remoteIP returns the IP address of a TCP or UDP master, nil for other
+// addresses.
+func remoteIP(remote net.Addr) net.IP {
+	switch addr := remote.(type) {
+	case *net.TCPAddr:
+		return addr.IP
+	case *net.UDPAddr:
+		return addr.IP
+	}
+	return nil
+}
+
+// AccessRule grants or restricts the requests of some masters, see
+// SetAccessRules.
+type AccessRule struct {
+	// Networks are the addresses of the masters the rule applies to, in
+	// CIDR notation. An empty list matches every master, those of serial
+	// ports included.
+	Networks []string
+	// Units are the unit IDs the rule applies to, an empty list matches
+	// every unit.
+	Units []uint8
+	// Deny rejects every request.
+	Deny bool
+	// Functions, when not empty, are the only function codes allowed.
+	Functions []uint8
+	// ReadOnly only allows the functions that do not change memory, as
+	// WithReadOnly does.
+	ReadOnly bool
+}
+
+type accessRule struct {
+	nets      []*net.IPNet
+	units     *[256]bool
+	functions *[256]bool
+	deny      bool
+	readOnly  bool
+}
+
+// SetAccessRules replaces the access rules applied to every request. The
+// first rule matching the address of the master and the unit ID decides:
+// requests it does not allow return IllegalFunction. Requests no rule
+// matches are allowed. Unlike SetAllowedCIDRs, connections are accepted and
+// only their requests are checked, so that monitoring clients can be given
+// read access without write access. The rules are left unchanged when one of
+// the networks cannot be parsed.
+func (s *Server) SetAccessRules(rules []AccessRule) error {
+	parsed := make([]accessRule, len(rules))
+	for i, rule := range rules {
+		nets, err := parseCIDRs(rule.Networks)
+		if err != nil {
+			return err
+		}
+		parsed[i] = accessRule{nets: nets, units: codeSet(rule.Units), functions: codeSet(rule.Functions), deny: rule.Deny, readOnly: rule.ReadOnly}
+	}
+	s.hooksLock.Lock()
+	s.accessRules = parsed
+	s.hooksLock.Unlock()
+	return nil
+}
+
+// codeSet returns the set of codes, nil when there is none.
+func codeSet(codes []uint8) *[256]bool {
+	if len(codes) == 0 {
+		return nil
+	}
+	set := new([256]bool)
+	for _, code := range codes {
+		set[code] = true
+	}
+	return set
+}
+
+// matches reports whether the rule applies to a request from remote for a
+// unit.
+func (rule accessRule) matches(remote net.Addr, unit uint8) bool {
+	if rule.units != nil && !rule.units[unit] {
+		return false
+	}
+	if len(rule.nets) == 0 {
+		return true
+	}
+	ip := remoteIP(remote)
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range rule.nets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// rulesAllow reports whether the access rules allow a request.
+func (s *Server) rulesAllow(request *Request, unit uint8, funcCode uint8) bool {
+	s.hooksLock.RLock()
+	rules := s.accessRules
+	s.hooksLock.RUnlock()
+
+	remote := request.RemoteAddr()
+	for _, rule := range rules {
+		if !rule.matches(remote, unit) {
+			continue
+		}
+		switch {
+		case rule.deny:
+			return false
+		case rule.functions != nil && !rule.functions[funcCode]:
+			return false
+		}
+		return !rule.readOnly || s.isReadOnly(unit, funcCode)
+	}
+	return true
+}
+
+// SetReadOnlyRange declares the addresses start to end (inclusive) of the
+// coils or holding registers as read-only: the built-in write functions, and
+// the handlers registered for their function codes, return
+// IllegalDataAddress for requests touching the range. The accessors of the
+// server and its exported memory maps are not restricted.
+func (s *Server) SetReadOnlyRange(start, end uint16, kind RegisterKind) error {
+	if end < start {
+		return fmt.Errorf("read-only range end %d before start %d", end, start)
+	}
+	if kind != Coil && kind != HoldingRegister {
+		return fmt.Errorf("%v cannot be written by masters", kind)
+	}
+
+	s.hooksLock.Lock()
+	defer s.hooksLock.Unlock()
+	s.readOnlyRanges = append(s.readOnlyRanges, region{start: int(start), end: int(end), kind: kind})
+	return nil
+}
+
+// ClearReadOnlyRanges removes the ranges set by SetReadOnlyRange.
+func (s *Server) ClearReadOnlyRanges() {
+	s.hooksLock.Lock()
+	s.readOnlyRanges = nil
+	s.hooksLock.Unlock()
+}
+
+// checkReadOnlyRanges returns an error when a write request touches a
+// read-only range.
+func (s *Server) checkReadOnlyRanges(frame Framer) error {
+	s.hooksLock.RLock()
+	ranges := s.readOnlyRanges
+	s.hooksLock.RUnlock()
+	if len(ranges) == 0 {
+		return nil
+	}
+
+	kind, address, quantity, ok := writeRange(frame)
+	if !ok {
+		return nil
+	}
+	address -= s.startAddress
+	for _, r := range ranges {
+		if r.kind == kind && address <= r.end && address+quantity > r.start {
+			return fmt.Errorf("%w: %v %d-%d is read-only", ErrAddressOutOfRange, kind, r.start, r.end)
+		}
+	}
+	return nil
+}
+
+// AccessViolation describes a request rejected by access control, see
+// OnAccessViolation.
+type AccessViolation struct {
+	// RemoteAddr is the address of the master, nil for serial ports.
+	RemoteAddr net.Addr
+	Unit       uint8
+	Function   uint8
+	// Exception is the exception returned to the master.
+	Exception Exception
+	// Reason tells which check rejected the request.
+	Reason string
+}
+
+// OnAccessViolation sets a function called with the requests rejected
+// because of the functions allowed by the listener (see WithReadOnly), the
+// unit (see SetUnitFunctions), the TLS role (see SetTLSRoleAuthorizer) or the
+// access rules, or because they write a read-only range, to audit them. It is
+// called by the goroutine serving the request, before the exception is
+// returned. Passing nil removes it.
+func (s *Server) OnAccessViolation(callback func(AccessViolation)) {
+	s.hooksLock.Lock()
+	s.violationHook = callback
+	s.hooksLock.Unlock()
+}
+
+// checkAccess returns the exception of a request rejected by access control,
+// once reported to the access violation callback, nil when it is allowed.
+func (s *Server) checkAccess(request *Request) *Exception {
+	unit, funcCode := request.frame.GetSlaveId(), request.frame.GetFunction()
+	exception := &IllegalFunction
+	var reason string
+	switch {
+	case !request.policy.allows(s, request.frame):
+		reason = "function not allowed by the listener"
+	case !s.unitAllows(unit, funcCode):
+		reason = "function not allowed for the unit"
+	case !s.roleAllows(request, unit, funcCode):
+		reason = "function not allowed for the TLS role"
+	case !s.rulesAllow(request, unit, funcCode):
+		reason = "denied by the access rules"
+	default:
+		err := s.checkReadOnlyRanges(request.frame)
+		if err == nil {
+			return nil
+		}
+		exception, reason = &IllegalDataAddress, err.Error()
+	}
+
+	s.hooksLock.RLock()
+	callback := s.violationHook
+	s.hooksLock.RUnlock()
+	if callback != nil {
+		callback(AccessViolation{RemoteAddr: request.RemoteAddr(), Unit: unit, Function: funcCode, Exception: *exception, Reason: reason})
+	}
+	return exception
+}
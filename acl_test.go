@@ -0,0 +1,197 @@
+package mbserver
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestSetAllowedCIDRs(t *testing.T) {
+	s := NewServer()
+	if err := s.SetAllowedCIDRs([]string{"10.0.0.0/8"}); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	addr, err := s.ListenTCPAny()
+	if err != nil {
+		t.Fatalf("failed to listen, got %v\n", err)
+	}
+	defer s.Close()
+
+	conn, err := net.Dial("tcp", addr.String())
+	if err != nil {
+		t.Fatalf("failed to connect, got %v\n", err)
+	}
+	defer conn.Close()
+
+	// The loopback address is not allowed, the connection is closed.
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err == nil {
+		t.Errorf("expected the connection to be closed")
+	}
+	if s.RejectedConns() != 1 {
+		t.Errorf("expected 1 rejected connection, got %v", s.RejectedConns())
+	}
+
+	if err := s.SetAllowedCIDRs([]string{"10.0.0.0/8", "bad"}); err == nil {
+		t.Errorf("expected a parse error")
+	}
+}
+
+func TestAcceptConn(t *testing.T) {
+	s := NewServer()
+	s.SetAllowedCIDRs([]string{"192.168.0.0/16", "::1/128"})
+	s.SetDeniedCIDRs([]string{"192.168.1.0/24"})
+
+	tests := []struct {
+		ip     string
+		accept bool
+	}{
+		{"192.168.0.10", true},
+		{"192.168.1.10", false},
+		{"127.0.0.1", false},
+		{"::1", true},
+	}
+	for _, test := range tests {
+		addr := &net.TCPAddr{IP: net.ParseIP(test.ip), Port: 502}
+		if got := s.acceptConn(addr); got != test.accept {
+			t.Errorf("%v: expected %v, got %v", test.ip, test.accept, got)
+		}
+	}
+
+	s.SetAllowedCIDRs(nil)
+	if !s.acceptConn(&net.TCPAddr{IP: net.ParseIP("127.0.0.1")}) {
+		t.Errorf("expected addresses outside the denied networks to be accepted")
+	}
+}
+
+func TestSetAccessRules(t *testing.T) {
+	s := NewServer()
+	err := s.SetAccessRules([]AccessRule{
+		{Networks: []string{"10.0.0.0/8"}, Units: []uint8{2}, Deny: true},
+		{Networks: []string{"10.0.0.0/8"}, ReadOnly: true},
+		{Networks: []string{"192.168.0.0/16"}, Functions: []uint8{ReadInputRegistersFC}},
+	})
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	var violations []AccessViolation
+	s.OnAccessViolation(func(violation AccessViolation) {
+		violations = append(violations, violation)
+	})
+
+	request := func(ip string, unit uint8, function uint8) *Request {
+		client := s.newClientConn(&udpReply{addr: &net.TCPAddr{IP: net.ParseIP(ip), Port: 502}})
+		frame := &TCPFrame{Device: unit, Function: function}
+		SetDataWithRegisterAndNumber(frame, 0, 1)
+		return &Request{conn: client, frame: frame}
+	}
+	tests := []struct {
+		request *Request
+		allowed bool
+	}{
+		{request("10.1.2.3", 1, ReadHoldingRegistersFC), true},
+		{request("10.1.2.3", 1, WriteHoldingRegisterFC), false},
+		{request("10.1.2.3", 2, ReadHoldingRegistersFC), false},
+		{request("192.168.1.1", 1, ReadInputRegistersFC), true},
+		{request("192.168.1.1", 1, ReadHoldingRegistersFC), false},
+		{request("172.16.0.1", 1, WriteHoldingRegisterFC), true},
+		{&Request{frame: &TCPFrame{Device: 1, Function: WriteHoldingRegisterFC, Data: []byte{0, 0, 0, 1}}}, true},
+	}
+	for i, test := range tests {
+		response := s.handle(test.request)
+		if allowed := response.GetFunction()&0x80 == 0; allowed != test.allowed {
+			t.Errorf("%v: expected allowed %v, got %v", i, test.allowed, response.GetData())
+		} else if !allowed && response.GetData()[0] != byte(IllegalFunction) {
+			t.Errorf("%v: expected IllegalFunction, got %v", i, response.GetData())
+		}
+	}
+
+	if len(violations) != 3 {
+		t.Fatalf("expected 3 violations, got %v", violations)
+	}
+	expect := AccessViolation{RemoteAddr: &net.TCPAddr{IP: net.ParseIP("10.1.2.3"), Port: 502}, Unit: 2, Function: ReadHoldingRegistersFC, Exception: IllegalFunction, Reason: "denied by the access rules"}
+	if violations[1].RemoteAddr.String() != expect.RemoteAddr.String() || violations[1].Unit != expect.Unit || violations[1].Function != expect.Function ||
+		violations[1].Exception != expect.Exception || violations[1].Reason != expect.Reason {
+		t.Errorf("expected %+v, got %+v", expect, violations[1])
+	}
+
+	if err := s.SetAccessRules([]AccessRule{{Networks: []string{"bad"}}}); err == nil {
+		t.Errorf("expected a parse error")
+	}
+}
+
+func TestSetReadOnlyRange(t *testing.T) {
+	s := NewServer()
+	if err := s.SetReadOnlyRange(10, 19, HoldingRegister); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if err := s.SetReadOnlyRange(5, 4, Coil); err == nil {
+		t.Errorf("expected an error with end before start")
+	}
+	if err := s.SetReadOnlyRange(0, 4, InputRegister); err == nil {
+		t.Errorf("expected an error for input registers")
+	}
+	var violations []AccessViolation
+	s.OnAccessViolation(func(violation AccessViolation) {
+		violations = append(violations, violation)
+	})
+
+	tests := []struct {
+		function uint8
+		data     []byte
+		allowed  bool
+	}{
+		{WriteHoldingRegisterFC, []byte{0, 9, 0, 1}, true},
+		{WriteHoldingRegisterFC, []byte{0, 10, 0, 1}, false},
+		{WriteHoldingRegistersFC, []byte{0, 8, 0, 2, 4, 0, 1, 0, 2}, true},
+		{WriteHoldingRegistersFC, []byte{0, 8, 0, 3, 6, 0, 1, 0, 2, 0, 3}, false},
+		{ReadWriteMultipleRegistersFC, []byte{0, 10, 0, 1, 0, 20, 0, 1, 2, 0, 1}, true},
+		{ReadWriteMultipleRegistersFC, []byte{0, 0, 0, 1, 0, 19, 0, 1, 2, 0, 1}, false},
+		{MaskWriteRegisterFC, []byte{0, 15, 0, 0, 0, 1}, false},
+		{WriteSingleCoilFC, []byte{0, 10, 0xff, 0}, true},
+		{ReadHoldingRegistersFC, []byte{0, 10, 0, 10}, true},
+	}
+	for _, test := range tests {
+		frame := &TCPFrame{Device: 1, Function: test.function}
+		frame.SetData(test.data)
+		response := s.handle(&Request{frame: frame})
+		if allowed := response.GetFunction()&0x80 == 0; allowed != test.allowed {
+			t.Errorf("function %v %v: expected allowed %v, got %v", test.function, test.data, test.allowed, response.GetData())
+		} else if !allowed && response.GetData()[0] != byte(IllegalDataAddress) {
+			t.Errorf("function %v %v: expected IllegalDataAddress, got %v", test.function, test.data, response.GetData())
+		}
+	}
+	if len(violations) != 4 || violations[0].Exception != IllegalDataAddress || violations[0].RemoteAddr != nil {
+		t.Errorf("expected 4 violations, got %+v", violations)
+	}
+	if s.HoldingRegisters[10] != 0 || s.HoldingRegisters[19] != 0 {
+		t.Errorf("expected the read-only range to be untouched, got %v", s.HoldingRegisters[10:20])
+	}
+
+	s.ClearReadOnlyRanges()
+	frame := &TCPFrame{Device: 1, Function: WriteHoldingRegisterFC}
+	SetDataWithRegisterAndNumber(frame, 10, 1)
+	if response := s.handle(&Request{frame: frame}); response.GetFunction() != WriteHoldingRegisterFC {
+		t.Errorf("expected the write to succeed once cleared, got %v", response.GetData())
+	}
+}
+
+func TestAccessViolationListener(t *testing.T) {
+	s := NewServer()
+	var violations []AccessViolation
+	s.OnAccessViolation(func(violation AccessViolation) {
+		violations = append(violations, violation)
+	})
+	s.SetUnitFunctions(1, []uint8{ReadCoilsFC})
+
+	frame := &TCPFrame{Device: 1, Function: ReadHoldingRegistersFC}
+	SetDataWithRegisterAndNumber(frame, 0, 1)
+	s.handle(&Request{frame: frame})
+	frame = &TCPFrame{Device: 1, Function: ReadCoilsFC}
+	SetDataWithRegisterAndNumber(frame, 0, 1)
+	s.handle(&Request{frame: frame, policy: newListenPolicy([]ListenOption{WithAllowedFunctions([]uint8{ReadInputRegistersFC})})})
+
+	if len(violations) != 2 || violations[0].Reason != "function not allowed for the unit" || violations[1].Reason != "function not allowed by the listener" {
+		t.Errorf("expected the unit then the listener violation, got %+v", violations)
+	}
+}
@@ -0,0 +1,45 @@
+package mbserver
+
+import "time"
+
+// AwaitRequest blocks until the server processes a request or the timeout
+// elapses, and returns the function code of that request. It is meant for
+// integration tests that need to wait until a master connected and polled.
+func (s *Server) AwaitRequest(timeout time.Duration) (uint8, bool) {
+	awaiter := make(chan uint8, 1)
+	s.awaitLock.Lock()
+	s.awaiters = append(s.awaiters, awaiter)
+	s.awaitLock.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case funcCode := <-awaiter:
+		return funcCode, true
+	case <-timer.C:
+	}
+
+	s.awaitLock.Lock()
+	defer s.awaitLock.Unlock()
+	for i, a := range s.awaiters {
+		if a == awaiter {
+			s.awaiters = append(s.awaiters[:i], s.awaiters[i+1:]...)
+			return 0, false
+		}
+	}
+	// The request was processed while timing out.
+	return <-awaiter, true
+}
+
+// requestProcessed wakes up the goroutines waiting in AwaitRequest.
+func (s *Server) requestProcessed(funcCode uint8) {
+	s.awaitLock.Lock()
+	awaiters := s.awaiters
+	s.awaiters = nil
+	s.awaitLock.Unlock()
+
+	for _, awaiter := range awaiters {
+		awaiter <- funcCode
+	}
+}
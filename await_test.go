@@ -0,0 +1,45 @@
+package mbserver
+
+import (
+	"testing"
+	"time"
+
+	"github.com/goburrow/modbus"
+)
+
+func TestAwaitRequest(t *testing.T) {
+	s := NewServer()
+	addr := getFreePort()
+	err := s.ListenTCP(addr)
+	if err != nil {
+		t.Fatalf("failed to listen, got %v\n", err)
+	}
+	defer s.Close()
+
+	_, ok := s.AwaitRequest(10 * time.Millisecond)
+	if ok {
+		t.Fatalf("expected a timeout without requests")
+	}
+
+	handler := modbus.NewTCPClientHandler(addr)
+	handler.SlaveId = 1
+	err = handler.Connect()
+	if err != nil {
+		t.Fatalf("failed to connect, got %v\n", err)
+	}
+	defer handler.Close()
+	client := modbus.NewClient(handler)
+
+	go func() {
+		// Let AwaitRequest start waiting first.
+		time.Sleep(10 * time.Millisecond)
+		client.ReadInputRegisters(0, 1)
+	}()
+	funcCode, ok := s.AwaitRequest(time.Second)
+	if !ok {
+		t.Fatalf("expected a request")
+	}
+	if funcCode != ReadInputRegistersFC {
+		t.Errorf("expected %v, got %v", ReadInputRegistersFC, funcCode)
+	}
+}
@@ -237,3 +237,21 @@ func ExampleServer_RegisterFunctionHandler() {
 	// Output:
 	// results [255 255]
 }
+
+// BenchmarkReadCoils2000 measures the ReadCoils function alone, without the
+// network round trip.
+func BenchmarkReadCoils2000(b *testing.B) {
+	s := NewServer()
+	for i := range s.Coils {
+		s.Coils[i] = byte(i % 3 % 2)
+	}
+	frame := &TCPFrame{Device: 1, Function: ReadCoilsFC}
+	SetDataWithRegisterAndNumber(frame, 3, 2000)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, exception := ReadCoils(s, frame); exception != &Success {
+			b.Fatalf("expected Success, got %v", exception.String())
+		}
+	}
+}
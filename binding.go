@@ -0,0 +1,273 @@
+package mbserver
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Binding ties the fields of a struct to the memory maps, see Bind.
+type Binding struct {
+	lock   sync.Mutex
+	server *Server
+	value  reflect.Value
+	fields []boundField
+}
+
+type boundField struct {
+	name    string
+	index   int
+	kind    RegisterKind
+	address int
+	// size is the number of coils or registers the field occupies.
+	size  int
+	order string
+}
+
+// bindKinds maps the first tag option to a memory map and the offset of its
+// Modicon references.
+var bindKinds = map[string]struct {
+	kind   RegisterKind
+	offset int
+}{
+	"coil":     {Coil, 0},
+	"discrete": {DiscreteInput, 10000},
+	"input":    {InputRegister, 30000},
+	"holding":  {HoldingRegister, 40000},
+}
+
+// Bind maps the fields of the struct v points to onto the memory maps, as
+// described by their modbus tags:
+//
+//	type Meter struct {
+//		Running bool    `modbus:"coil,1"`
+//		Alarm   bool    `modbus:"discrete,10001"`
+//		Setting uint16  `modbus:"holding,40001"`
+//		Flow    float32 `modbus:"input,30001,cdab"`
+//	}
+//
+// The tag holds the memory map (coil, discrete, input or holding) and the
+// Modicon reference of the field, either in 5 digit (40001-49999) or 6 digit
+// (400001-465536) notation. Coils are numbered from 1. bool fields are bound
+// to coils and discrete inputs, uint16 and int16 fields to one register, and
+// uint32, int32 and float32 fields to two registers, in the byte order given
+// by an optional third option: abcd (the default, big endian), cdab, badc or
+// dcba. Fields without a modbus tag are ignored.
+//
+// Sync copies the fields to memory. Writes by masters to bound coils and
+// holding registers update the fields, from the goroutine running the write
+// callbacks, so access the struct between Lock and Unlock once the server
+// serves requests.
+func (s *Server) Bind(v interface{}) (*Binding, error) {
+	value := reflect.ValueOf(v)
+	if value.Kind() != reflect.Pointer || value.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("cannot bind %T, a pointer to a struct is required", v)
+	}
+	value = value.Elem()
+
+	b := &Binding{server: s, value: value}
+	for i := 0; i < value.NumField(); i++ {
+		structField := value.Type().Field(i)
+		tag, ok := structField.Tag.Lookup("modbus")
+		if !ok || tag == "-" {
+			continue
+		}
+		if !structField.IsExported() {
+			return nil, fmt.Errorf("cannot bind unexported field %v", structField.Name)
+		}
+		field, err := parseBinding(structField, tag)
+		if err != nil {
+			return nil, err
+		}
+		field.index = i
+		if err := checkRange(field.address, field.size, s.bankSize(field.kind), MaxRegisterSize); err != nil {
+			return nil, fmt.Errorf("field %v: %w", field.name, err)
+		}
+		for _, other := range b.fields {
+			if other.kind == field.kind && field.address < other.address+other.size && other.address < field.address+field.size {
+				return nil, fmt.Errorf("field %v overlaps field %v", field.name, other.name)
+			}
+		}
+		b.fields = append(b.fields, field)
+	}
+
+	s.OnWrite(b.update)
+	return b, nil
+}
+
+func parseBinding(structField reflect.StructField, tag string) (boundField, error) {
+	field := boundField{name: structField.Name, order: "abcd"}
+	options := strings.Split(tag, ",")
+	if len(options) < 2 || len(options) > 3 {
+		return field, fmt.Errorf("field %v: invalid modbus tag %q", field.name, tag)
+	}
+
+	bank, ok := bindKinds[options[0]]
+	if !ok {
+		return field, fmt.Errorf("field %v: unknown memory map %q", field.name, options[0])
+	}
+	field.kind = bank.kind
+
+	reference, err := strconv.Atoi(options[1])
+	if err != nil {
+		return field, fmt.Errorf("field %v: invalid reference %q", field.name, options[1])
+	}
+	switch {
+	case bank.offset == 0:
+		field.address = reference - 1
+	case reference > bank.offset*10:
+		field.address = reference - bank.offset*10 - 1
+	case reference > bank.offset && reference < bank.offset+10000:
+		field.address = reference - bank.offset - 1
+	default:
+		return field, fmt.Errorf("field %v: reference %v is not a %v", field.name, reference, field.kind)
+	}
+	if field.address < 0 {
+		return field, fmt.Errorf("field %v: reference %v is not a %v", field.name, reference, field.kind)
+	}
+
+	if len(options) == 3 {
+		switch options[2] {
+		case "abcd", "cdab", "badc", "dcba":
+			field.order = options[2]
+		default:
+			return field, fmt.Errorf("field %v: unknown byte order %q", field.name, options[2])
+		}
+	}
+
+	field.size, err = bindSize(field.name, field.kind, structField.Type)
+	return field, err
+}
+
+// bindSize returns the number of coils or registers of kind a value of typ
+// occupies.
+func bindSize(name string, kind RegisterKind, typ reflect.Type) (int, error) {
+	isBit := kind == Coil || kind == DiscreteInput
+	size := 0
+	switch typ.Kind() {
+	case reflect.Bool:
+		if !isBit {
+			return 0, fmt.Errorf("field %v: bool fields must be bound to coils or discrete inputs", name)
+		}
+		size = 1
+	case reflect.Uint16, reflect.Int16:
+		size = 1
+	case reflect.Uint32, reflect.Int32, reflect.Float32:
+		size = 2
+	default:
+		return 0, fmt.Errorf("field %v: cannot bind type %v", name, typ)
+	}
+	if isBit && typ.Kind() != reflect.Bool {
+		return 0, fmt.Errorf("field %v: only bool fields can be bound to a %v", name, kind)
+	}
+	return size, nil
+}
+
+// Lock locks the bound struct against updates from register writes.
+func (b *Binding) Lock() {
+	b.lock.Lock()
+}
+
+// Unlock unlocks the bound struct.
+func (b *Binding) Unlock() {
+	b.lock.Unlock()
+}
+
+// Sync copies the values of the bound fields to memory.
+func (b *Binding) Sync() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.server.memoryLock.Lock()
+	defer b.server.memoryLock.Unlock()
+
+	for _, field := range b.fields {
+		if err := b.server.writeRegisters(field.kind, field.address, field.encode(b.value.Field(field.index))); err != nil {
+			b.server.logger.Printf("failed to sync field %v: %v\n", field.name, err)
+		}
+	}
+}
+
+// update copies the values written by a master to the bound fields.
+func (b *Binding) update(event WriteEvent) {
+	start, end := int(event.Address), int(event.Address)+len(event.Values)
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.server.memoryLock.RLock()
+	defer b.server.memoryLock.RUnlock()
+
+	for _, field := range b.fields {
+		if field.kind != event.Kind || field.address >= end || start >= field.address+field.size {
+			continue
+		}
+		values, err := b.server.readRegisters(field.kind, field.address, field.size)
+		if err != nil {
+			b.server.logger.Printf("failed to update field %v: %v\n", field.name, err)
+			continue
+		}
+		field.decode(b.value.Field(field.index), values)
+	}
+}
+
+func (field boundField) encode(value reflect.Value) []uint16 {
+	switch value.Kind() {
+	case reflect.Bool:
+		if value.Bool() {
+			return []uint16{1}
+		}
+		return []uint16{0}
+	case reflect.Uint16:
+		return []uint16{uint16(value.Uint())}
+	case reflect.Int16:
+		return []uint16{uint16(value.Int())}
+	}
+
+	var raw uint32
+	switch value.Kind() {
+	case reflect.Uint32:
+		raw = uint32(value.Uint())
+	case reflect.Int32:
+		raw = uint32(value.Int())
+	case reflect.Float32:
+		raw = math.Float32bits(float32(value.Float()))
+	}
+	var abcd, ordered [4]byte
+	binary.BigEndian.PutUint32(abcd[:], raw)
+	for i, letter := range field.order {
+		ordered[i] = abcd[letter-'a']
+	}
+	return BytesToUint16(ordered[:])
+}
+
+func (field boundField) decode(value reflect.Value, values []uint16) {
+	switch value.Kind() {
+	case reflect.Bool:
+		value.SetBool(values[0] != 0)
+		return
+	case reflect.Uint16:
+		value.SetUint(uint64(values[0]))
+		return
+	case reflect.Int16:
+		value.SetInt(int64(int16(values[0])))
+		return
+	}
+
+	var abcd [4]byte
+	ordered := Uint16ToBytes(values)
+	for i, letter := range field.order {
+		abcd[letter-'a'] = ordered[i]
+	}
+	raw := binary.BigEndian.Uint32(abcd[:])
+	switch value.Kind() {
+	case reflect.Uint32:
+		value.SetUint(uint64(raw))
+	case reflect.Int32:
+		value.SetInt(int64(int32(raw)))
+	case reflect.Float32:
+		value.SetFloat(float64(math.Float32frombits(raw)))
+	}
+}
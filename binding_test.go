@@ -0,0 +1,95 @@
+package mbserver
+
+import "testing"
+
+type boundMeter struct {
+	Running bool    `modbus:"coil,1"`
+	Alarm   bool    `modbus:"discrete,10002"`
+	Setting uint16  `modbus:"holding,40001"`
+	Offset  int16   `modbus:"holding,400002"`
+	Flow    float32 `modbus:"input,30001,cdab"`
+	Total   uint32  `modbus:"holding,40003"`
+	Comment string
+}
+
+func TestBindSync(t *testing.T) {
+	s := NewServer()
+	meter := &boundMeter{Running: true, Alarm: true, Setting: 7, Offset: -2, Flow: 1.5, Total: 0x00010002}
+	b, err := s.Bind(meter)
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	b.Sync()
+
+	if s.Coils[0] != 1 || s.DiscreteInputs[1] != 1 {
+		t.Errorf("expected the coil and discrete input to be set")
+	}
+	expect := []uint16{7, 0xfffe, 1, 2}
+	if !isEqual(expect, s.HoldingRegisters[0:4]) {
+		t.Errorf("expected %v, got %v", expect, s.HoldingRegisters[0:4])
+	}
+	// 1.5 is 0x3fc00000, word swapped.
+	expect = []uint16{0x0000, 0x3fc0}
+	if !isEqual(expect, s.InputRegisters[0:2]) {
+		t.Errorf("expected %v, got %v", expect, s.InputRegisters[0:2])
+	}
+}
+
+func TestBindWrites(t *testing.T) {
+	s := NewServer()
+	meter := &boundMeter{}
+	b, err := s.Bind(meter)
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+
+	frame := &TCPFrame{Device: 1, Function: WriteHoldingRegistersFC}
+	frame.SetData([]byte{0, 1, 0, 3, 6, 0xff, 0xfd, 0, 3, 0, 4})
+	s.handle(&Request{frame: frame})
+	frame = &TCPFrame{Device: 1, Function: WriteSingleCoilFC}
+	SetDataWithRegisterAndNumber(frame, 0, 0xff00)
+	s.handle(&Request{frame: frame})
+
+	b.Lock()
+	defer b.Unlock()
+	if meter.Offset != -3 || meter.Total != 0x00030004 || !meter.Running {
+		t.Errorf("expected the fields to be updated, got %+v", meter)
+	}
+	if meter.Setting != 0 {
+		t.Errorf("expected Setting to be left alone, got %v", meter.Setting)
+	}
+}
+
+func TestBindErrors(t *testing.T) {
+	s := NewServer()
+	tests := []interface{}{
+		boundMeter{},
+		&struct {
+			A uint16 `modbus:"holding,30001"`
+		}{},
+		&struct {
+			A bool `modbus:"holding,40001"`
+		}{},
+		&struct {
+			A uint16 `modbus:"coil,1"`
+		}{},
+		&struct {
+			A uint32 `modbus:"holding,40001,abdc"`
+		}{},
+		&struct {
+			A uint32 `modbus:"holding,465536"`
+		}{},
+		&struct {
+			A uint32 `modbus:"holding,40001"`
+			B uint16 `modbus:"holding,40002"`
+		}{},
+		&struct {
+			A uint64 `modbus:"holding,40001"`
+		}{},
+	}
+	for i, v := range tests {
+		if _, err := s.Bind(v); err == nil {
+			t.Errorf("%v: expected an error binding %T", i, v)
+		}
+	}
+}
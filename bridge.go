@@ -0,0 +1,150 @@
+package mbserver
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/goburrow/serial"
+)
+
+// DefaultBridgeTimeout is how long the bridge waits for the downstream device
+// to respond.
+const DefaultBridgeTimeout = 1 * time.Second
+
+type bridge struct {
+	// lock serializes the requests forwarded downstream.
+	lock       sync.Mutex
+	downstream io.ReadWriteCloser
+	chunks     chan []byte
+}
+
+// Bridge turns the server into a Modbus TCP to RTU gateway. Requests received
+// on TCP listeners are no longer served from internal memory; they are
+// forwarded as RTU frames to downstream (typically a serial port), with the
+// MBAP unit identifier as the RTU slave address, and the downstream response
+// is relayed back to the master. Serial requests are still served locally.
+//
+// A downstream that does not respond within the bridge timeout results in a
+// GatewayTargetDeviceFailedtoRespond exception, and a failure to write to it
+// in GatewayPathUnavailable. Broadcasts (unit 0) are forwarded without a
+// response. Requests are forwarded one at a time, and only once they passed
+// the rate limit, the access checks of the server and its middleware. Close
+// closes downstream.
+func (s *Server) Bridge(downstream io.ReadWriteCloser) {
+	b := &bridge{
+		downstream: downstream,
+		chunks:     make(chan []byte, 16),
+	}
+	go b.read(s)
+
+	s.hooksLock.Lock()
+	s.bridge = b
+	s.hooksLock.Unlock()
+}
+
+// SetBridgeTimeout sets how long the bridge waits for a downstream response.
+// The default is DefaultBridgeTimeout.
+func (s *Server) SetBridgeTimeout(timeout time.Duration) {
+	s.bridgeTimeout.Store(int64(timeout))
+}
+
+func (s *Server) currentBridge() *bridge {
+	s.hooksLock.RLock()
+	defer s.hooksLock.RUnlock()
+	return s.bridge
+}
+
+// read pumps the bytes received from downstream to the forwarding requests.
+func (b *bridge) read(s *Server) {
+	defer close(b.chunks)
+	for {
+		buffer := make([]byte, 512)
+		bytesRead, err := b.downstream.Read(buffer)
+		if bytesRead > 0 {
+			select {
+			case b.chunks <- buffer[:bytesRead]:
+			default:
+				// Nobody is waiting for a response, drop the bytes.
+			}
+		}
+		if err == serial.ErrTimeout {
+			continue
+		}
+		if err != nil {
+			if err != io.EOF {
+				s.logger.Printf("bridge read error %v\n", err)
+			}
+			return
+		}
+	}
+}
+
+// forward sends the request downstream and returns the relayed response, or
+// nil when no response is expected.
+func (s *Server) forward(b *bridge, frame *TCPFrame) Framer {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	response := frame.Copy().(*TCPFrame)
+
+	// Discard anything received since the last response.
+	for drained := false; !drained; {
+		select {
+		case <-b.chunks:
+		default:
+			drained = true
+		}
+	}
+
+	rtu := &RTUFrame{
+		Address:  frame.Device,
+		Function: frame.Function,
+		Data:     frame.Data,
+	}
+	_, err := b.downstream.Write(rtu.Bytes())
+	if err != nil {
+		s.logger.Printf("bridge write error %v\n", err)
+		response.SetException(&GatewayPathUnavailable)
+		return response
+	}
+	if frame.Device == 0 {
+		return nil
+	}
+
+	timeout := time.Duration(s.bridgeTimeout.Load())
+	if timeout <= 0 {
+		timeout = DefaultBridgeTimeout
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	// RTU frames carry no length, so bytes are accumulated until they form a
+	// frame with a valid CRC.
+	var packet []byte
+	for {
+		select {
+		case chunk, ok := <-b.chunks:
+			if !ok {
+				response.SetException(&GatewayPathUnavailable)
+				return response
+			}
+			packet = append(packet, chunk...)
+			reply, err := NewRTUFrame(packet)
+			if err != nil {
+				continue
+			}
+			if reply.Address != frame.Device {
+				packet = nil
+				continue
+			}
+			response.Function = reply.Function
+			response.SetData(append([]byte(nil), reply.Data...))
+			return response
+		case <-timer.C:
+			s.logger.Printf("bridge timeout waiting for unit %d\n", frame.Device)
+			response.SetException(&GatewayTargetDeviceFailedtoRespond)
+			return response
+		}
+	}
+}
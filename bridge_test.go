@@ -0,0 +1,111 @@
+package mbserver
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/goburrow/modbus"
+)
+
+// rtuDevice answers RTU requests read from conn with respond.
+func rtuDevice(conn net.Conn, respond func(request *RTUFrame) *RTUFrame) {
+	for {
+		buffer := make([]byte, 512)
+		bytesRead, err := conn.Read(buffer)
+		if err != nil {
+			return
+		}
+		request, err := NewRTUFrame(buffer[:bytesRead])
+		if err != nil {
+			continue
+		}
+		if response := respond(request); response != nil {
+			conn.Write(response.Bytes())
+		}
+	}
+}
+
+func TestBridge(t *testing.T) {
+	upstream, downstream := net.Pipe()
+	defer upstream.Close()
+	go rtuDevice(upstream, func(request *RTUFrame) *RTUFrame {
+		if request.Address != 7 || request.Function != ReadHoldingRegistersFC {
+			return nil
+		}
+		return &RTUFrame{Address: 7, Function: ReadHoldingRegistersFC, Data: []byte{2, 0x12, 0x34}}
+	})
+
+	s := NewServer()
+	s.Bridge(downstream)
+	s.SetBridgeTimeout(100 * time.Millisecond)
+	addr := getFreePort()
+	err := s.ListenTCP(addr)
+	if err != nil {
+		t.Fatalf("failed to listen, got %v\n", err)
+	}
+	defer s.Close()
+
+	handler := modbus.NewTCPClientHandler(addr)
+	handler.SlaveId = 7
+	err = handler.Connect()
+	if err != nil {
+		t.Fatalf("failed to connect, got %v\n", err)
+	}
+	defer handler.Close()
+	client := modbus.NewClient(handler)
+
+	results, err := client.ReadHoldingRegisters(0, 1)
+	if err != nil {
+		t.Fatalf("expected nil, got %v\n", err)
+	}
+	expect := []byte{0x12, 0x34}
+	if !isEqual(expect, results) {
+		t.Errorf("expected %v, got %v", expect, results)
+	}
+
+	// The device does not answer coil reads.
+	_, err = client.ReadCoils(0, 1)
+	modbusErr, ok := err.(*modbus.ModbusError)
+	if !ok || modbusErr.ExceptionCode != byte(GatewayTargetDeviceFailedtoRespond) {
+		t.Errorf("expected GatewayTargetDeviceFailedtoRespond, got %v", err)
+	}
+}
+
+func TestBridgeAccessChecks(t *testing.T) {
+	upstream, downstream := net.Pipe()
+	defer upstream.Close()
+	requests := make(chan *RTUFrame, 1)
+	go rtuDevice(upstream, func(request *RTUFrame) *RTUFrame {
+		requests <- request
+		return &RTUFrame{Address: request.Address, Function: request.Function, Data: request.Data}
+	})
+
+	s := NewServer(WithLogger(discardLogger{}))
+	s.Bridge(downstream)
+	s.SetBridgeTimeout(100 * time.Millisecond)
+	addr, err := s.ListenTCPAny(WithReadOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	handler := modbus.NewTCPClientHandler(addr.String())
+	handler.SlaveId = 7
+	if err := handler.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer handler.Close()
+	client := modbus.NewClient(handler)
+
+	_, err = client.WriteSingleRegister(0, 1)
+	modbusErr, ok := err.(*modbus.ModbusError)
+	if !ok || modbusErr.ExceptionCode != byte(IllegalFunction) {
+		t.Errorf("expected IllegalFunction for a write through a read-only listener, got %v", err)
+	}
+	select {
+	case request := <-requests:
+		t.Errorf("expected the write not to reach the device, got %v", request)
+	default:
+	}
+}
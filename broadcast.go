@@ -0,0 +1,74 @@
+package mbserver
+
+import "sort"
+
+// BroadcastUnitID is the unit ID of broadcast requests.
+const BroadcastUnitID = 0
+
+// BroadcastReadBehavior is the handling of reads sent to the broadcast unit
+// ID, see SetBroadcastReadBehavior.
+type BroadcastReadBehavior uint8
+
+const (
+	// BroadcastReadDrop ignores the request, as the specification requires:
+	// broadcasts are never answered.
+	BroadcastReadDrop BroadcastReadBehavior = iota
+	// BroadcastReadException answers with IllegalFunction, which is not
+	// standard but points out a misbehaving master on a test bench.
+	BroadcastReadException
+)
+
+// SetBroadcastReadBehavior sets how requests sent to unit 0 for a read-only
+// function (FC 1-4, 24 and 43 by default, see RegisterReadOnlyFunctionHandler)
+// are handled. The default is BroadcastReadDrop. Servers whose slave ID is 0
+// answer these requests as any other.
+func (s *Server) SetBroadcastReadBehavior(behavior BroadcastReadBehavior) {
+	s.broadcastRead.Store(int32(behavior))
+}
+
+// broadcastReadException returns the exception response to a broadcast read
+// not addressed to the server, nil when it is to be dropped.
+func (s *Server) broadcastReadException(frame Framer) Framer {
+	if frame.GetSlaveId() != BroadcastUnitID || BroadcastReadBehavior(s.broadcastRead.Load()) != BroadcastReadException {
+		return nil
+	}
+	if !s.isReadOnly(BroadcastUnitID, frame.GetFunction()) || frame.GetFunction() == DiagnosticsFC {
+		return nil
+	}
+	response := frame.Copy()
+	response.SetException(&IllegalFunction)
+	s.recordException(frame.GetFunction(), &IllegalFunction)
+	return response
+}
+
+// isBroadcastWrite reports whether a request is a broadcast applied without
+// an answer: one read from a serial port for unit 0, for a function that is
+// not read-only, or for Diagnostics (such as Force Listen Only Mode). Modbus
+// TCP has no broadcast, requests for unit 0 are dropped there as for any
+// other unit ID than SlaveID.
+func (s *Server) isBroadcastWrite(frame Framer) bool {
+	if frame.GetSlaveId() != BroadcastUnitID {
+		return false
+	}
+	if _, ok := frame.(*TCPFrame); ok {
+		return false
+	}
+	return !s.isReadOnly(BroadcastUnitID, frame.GetFunction()) || frame.GetFunction() == DiagnosticsFC
+}
+
+// serveBroadcast runs a broadcast write on the server, then on its units in
+// the order of their IDs, and never answers it.
+func (s *Server) serveBroadcast(request *Request) {
+	s.unitsLock.RLock()
+	units := make([]*Unit, 0, len(s.units))
+	for _, unit := range s.units {
+		units = append(units, unit)
+	}
+	s.unitsLock.RUnlock()
+	sort.Slice(units, func(i, j int) bool { return units[i].SlaveID() < units[j].SlaveID() })
+
+	s.sendResponse(request, s.handle(request), false)
+	for _, unit := range units {
+		unit.sendResponse(request, unit.handle(request), false)
+	}
+}
@@ -0,0 +1,84 @@
+package mbserver
+
+import (
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestBroadcastReadBehavior(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	read := []byte{0, 1, 0, 0, 0, 6, 0, 0x03, 0x00, 0x00, 0x00, 0x01}
+	if _, err := s.RoundTrip(read); !errors.Is(err, ErrNoResponse) {
+		t.Errorf("expected broadcast reads to be dropped by default, got %v", err)
+	}
+
+	s.SetBroadcastReadBehavior(BroadcastReadException)
+	response, err := s.RoundTrip(read)
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	expect := []byte{0, 1, 0, 0, 0, 3, 0, 0x83, 0x01}
+	if !isEqual(expect, response) {
+		t.Errorf("expected %v, got %v", expect, response)
+	}
+
+	// Writes and requests for other units are still dropped.
+	write := []byte{0, 2, 0, 0, 0, 6, 0, 0x06, 0x00, 0x01, 0x00, 0x03}
+	if _, err := s.RoundTrip(write); !errors.Is(err, ErrNoResponse) {
+		t.Errorf("expected broadcast writes to be dropped, got %v", err)
+	}
+	other := []byte{0, 3, 0, 0, 0, 6, 2, 0x03, 0x00, 0x00, 0x00, 0x01}
+	if _, err := s.RoundTrip(other); !errors.Is(err, ErrNoResponse) {
+		t.Errorf("expected requests for another unit to be dropped, got %v", err)
+	}
+}
+
+func TestBroadcastWrite(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	pump := s.AddUnit(2)
+	var writes []WriteEvent
+	pump.OnWrite(func(event WriteEvent) {
+		writes = append(writes, event)
+	})
+
+	conn, line := net.Pipe()
+	defer line.Close()
+	go s.ServeConn(conn, FramingRTU)
+
+	// The broadcast is not answered: the first response is the one of the
+	// read sent next.
+	line.Write(BuildRTUFrame(BroadcastUnitID, WriteHoldingRegisterFC, []byte{0, 4, 0, 7}).Bytes())
+	line.Write(BuildRTUFrame(1, ReadHoldingRegistersFC, []byte{0, 4, 0, 1}).Bytes())
+	expect := BuildRTUFrame(1, ReadHoldingRegistersFC, []byte{2, 0, 7}).Bytes()
+	line.SetReadDeadline(time.Now().Add(time.Second))
+	response := make([]byte, len(expect))
+	if _, err := io.ReadFull(line, response); err != nil {
+		t.Fatalf("expected a response, got %v", err)
+	}
+	if !isEqual(expect, response) {
+		t.Errorf("expected %v, got %v", expect, response)
+	}
+
+	values, _ := pump.ReadHoldingRegisters(4, 1)
+	if values[0] != 7 || len(writes) != 1 || writes[0].Unit != BroadcastUnitID {
+		t.Errorf("expected the unit to apply the broadcast, got %v, %+v", values, writes)
+	}
+
+	// Diagnostics are applied too, reads are not.
+	frame := BuildRTUFrame(BroadcastUnitID, DiagnosticsFC, []byte{0, ForceListenOnlyMode, 0, 0})
+	if response, ok := s.Dispatch(frame); response != nil || ok {
+		t.Errorf("expected no response, got %v", response)
+	}
+	if !s.ListenOnly() || !pump.ListenOnly() {
+		t.Errorf("expected the server and the unit to be in listen only mode")
+	}
+	if response, ok := s.Dispatch(BuildRTUFrame(BroadcastUnitID, ReadHoldingRegistersFC, []byte{0, 4, 0, 1})); response != nil || ok {
+		t.Errorf("expected broadcast reads to be dropped, got %v", response)
+	}
+}
@@ -0,0 +1,43 @@
+package mbserver
+
+import "encoding/binary"
+
+// SetWireByteOrder sets the byte order of the register values carried in the
+// PDUs of functions 3, 4, 6 and 16, for interoperability with masters that
+// send little endian words. Addresses, quantities and byte counts stay big
+// endian. The default, and a nil order, is binary.BigEndian as required by
+// the Modbus specification.
+func (s *Server) SetWireByteOrder(order binary.ByteOrder) {
+	s.memoryLock.Lock()
+	s.wireOrder = order
+	s.memoryLock.Unlock()
+}
+
+// wireByteOrder returns the byte order of register values, it is called with
+// the memory lock held.
+func (s *Server) wireByteOrder() binary.ByteOrder {
+	if s.wireOrder == nil {
+		return binary.BigEndian
+	}
+	return s.wireOrder
+}
+
+// encodeRegisters converts register values to bytes in the wire byte order.
+func (s *Server) encodeRegisters(values []uint16) []byte {
+	order := s.wireByteOrder()
+	bytes := make([]byte, len(values)*2)
+	for i, value := range values {
+		order.PutUint16(bytes[i*2:(i+1)*2], value)
+	}
+	return bytes
+}
+
+// decodeRegisters converts bytes in the wire byte order to register values.
+func (s *Server) decodeRegisters(bytes []byte) []uint16 {
+	order := s.wireByteOrder()
+	values := make([]uint16, len(bytes)/2)
+	for i := range values {
+		values[i] = order.Uint16(bytes[i*2 : (i+1)*2])
+	}
+	return values
+}
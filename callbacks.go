@@ -0,0 +1,210 @@
+package mbserver
+
+import (
+	"log/slog"
+	"sync"
+	"sync/atomic"
+)
+
+// WriteEvent describes a change made by a master through one of the
+// built-in write functions.
+type WriteEvent struct {
+	// Function is the Modbus function code of the request, 0 for writes
+	// made with WriteHoldingRegistersBatch.
+	Function uint8
+	// Unit is the unit ID (slave ID) the request was addressed to.
+	Unit uint8
+	// Kind is the memory map written.
+	Kind RegisterKind
+	// Address is the first address written.
+	Address uint16
+	// Values are the new values, 0 or 1 for coils.
+	Values []uint16
+}
+
+// CallbackTiming selects when write callbacks run relative to the response.
+type CallbackTiming int32
+
+const (
+	// BeforeResponse runs the callbacks synchronously before the response is
+	// sent, so the master only sees the response once they returned.
+	BeforeResponse CallbackTiming = iota
+	// AfterResponse sends the response first and then runs the callbacks in
+	// their own goroutine, lowering the write latency seen by the master.
+	AfterResponse
+)
+
+// OnWrite registers a callback fired after a built-in write function
+// (5, 6, 15 or 16) changed memory, or WriteHoldingRegistersBatch was called.
+// Callbacks run in registration order.
+func (s *Server) OnWrite(callback func(WriteEvent)) {
+	s.hooksLock.Lock()
+	s.writeCallbacks = append(s.writeCallbacks, callback)
+	s.hooksLock.Unlock()
+}
+
+// WriteEvents returns a channel receiving the events of the writes described
+// by OnWrite, for code that prefers selecting on a channel to a callback. The
+// channel is buffered with size events; events are dropped, and logged, when
+// it is full, so that a slow reader never stalls the server. cancel stops
+// the events and closes the channel.
+func (s *Server) WriteEvents(size int) (events <-chan WriteEvent, cancel func()) {
+	ch := make(chan WriteEvent, size)
+	s.hooksLock.Lock()
+	if s.writeSubs == nil {
+		s.writeSubs = make(map[chan WriteEvent]struct{})
+	}
+	s.writeSubs[ch] = struct{}{}
+	s.hooksLock.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			s.hooksLock.Lock()
+			delete(s.writeSubs, ch)
+			close(ch)
+			s.hooksLock.Unlock()
+		})
+	}
+}
+
+// SetCallbackTiming sets when write callbacks run. The default is
+// BeforeResponse. A panicking callback is recovered and logged, and never
+// affects a response that was already sent.
+func (s *Server) SetCallbackTiming(timing CallbackTiming) {
+	atomic.StoreInt32(&s.callbackTiming, int32(timing))
+}
+
+// notifyWrite is called by the write functions once memory was changed.
+func (s *Server) notifyWrite(frame Framer, kind RegisterKind, address int, values []uint16) {
+	s.markWritten(kind, address, len(values))
+
+	s.hooksLock.RLock()
+	hasCallbacks := len(s.writeCallbacks) != 0 || len(s.writeSubs) != 0
+	s.hooksLock.RUnlock()
+	if !hasCallbacks {
+		return
+	}
+
+	event := WriteEvent{
+		Function: frame.GetFunction(),
+		Unit:     frame.GetSlaveId(),
+		Kind:     kind,
+		Address:  uint16(address),
+		Values:   append([]uint16(nil), values...),
+	}
+
+	// Held until the function handler returned, or the response to the
+	// request has been written.
+	s.hooksLock.Lock()
+	if s.deferredWrites == nil {
+		s.deferredWrites = make(map[Framer][]WriteEvent)
+	}
+	s.deferredWrites[frame] = append(s.deferredWrites[frame], event)
+	s.hooksLock.Unlock()
+}
+
+// takeWriteEvents removes and returns the events deferred for a request.
+func (s *Server) takeWriteEvents(frame Framer) ([]WriteEvent, bool) {
+	s.hooksLock.Lock()
+	defer s.hooksLock.Unlock()
+
+	events, ok := s.deferredWrites[frame]
+	delete(s.deferredWrites, frame)
+	return events, ok
+}
+
+// beforeResponse runs the callbacks of a request once its function handler
+// returned, while the callback timing is BeforeResponse. The memory lock is
+// not held, so callbacks may access memory through the server methods.
+func (s *Server) beforeResponse(frame Framer) {
+	if CallbackTiming(atomic.LoadInt32(&s.callbackTiming)) != BeforeResponse {
+		return
+	}
+	if events, ok := s.takeWriteEvents(frame); ok {
+		s.runWriteCallbacks(events)
+	}
+}
+
+// flushWriteEvents runs the callbacks deferred for a request after its
+// response was sent.
+func (s *Server) flushWriteEvents(frame Framer) {
+	if events, ok := s.takeWriteEvents(frame); ok {
+		go s.runWriteCallbacks(events)
+	}
+}
+
+func (s *Server) runWriteCallbacks(events []WriteEvent) {
+	s.hooksLock.RLock()
+	callbacks := s.writeCallbacks
+	s.hooksLock.RUnlock()
+
+	for _, event := range events {
+		for _, callback := range callbacks {
+			s.safeWriteCallback(callback, event)
+		}
+		s.publishWriteEvent(event)
+	}
+}
+
+// publishWriteEvent sends an event to the WriteEvents channels. The lock is
+// held while sending so that cancel does not close a channel in use.
+func (s *Server) publishWriteEvent(event WriteEvent) {
+	s.hooksLock.RLock()
+	defer s.hooksLock.RUnlock()
+
+	for ch := range s.writeSubs {
+		select {
+		case ch <- event:
+		default:
+			s.logger.Printf("write event dropped, channel full\n")
+		}
+	}
+}
+
+func (s *Server) safeWriteCallback(callback func(WriteEvent), event WriteEvent) {
+	defer func() {
+		if r := recover(); r != nil {
+			s.logger.Printf("write callback panic %v\n", r)
+		}
+	}()
+	callback(event)
+}
+
+// OnResponse registers a callback fired once the response to each request
+// addressed to the server was written, or not, for auditing. sent is false
+// when no response was written: in listen only mode, when the handler sent
+// none (resp is then nil), or when the write failed. Responses of injected
+// errors and of the TCP to RTU gateway are reported too; the CRC corruption
+// of RTU responses is applied to the bytes written only, not to resp.
+// Callbacks run in registration order, on the goroutine handling requests, or
+// on the one writing the response once the jitter set by SetResponseJitter
+// elapsed. A panicking callback is logged, and the next callbacks still run.
+func (s *Server) OnResponse(callback func(req *Request, resp Framer, sent bool)) {
+	s.hooksLock.Lock()
+	s.responseHooks = append(s.responseHooks, callback)
+	s.hooksLock.Unlock()
+}
+
+func (s *Server) notifyResponse(request *Request, response Framer, sent bool) {
+	if sent {
+		s.logFrame(slog.LevelDebug, "frame sent", request, response)
+	}
+
+	s.hooksLock.RLock()
+	hooks := s.responseHooks
+	s.hooksLock.RUnlock()
+
+	for _, hook := range hooks {
+		s.safeResponseHook(hook, request, response, sent)
+	}
+}
+
+func (s *Server) safeResponseHook(hook func(*Request, Framer, bool), request *Request, response Framer, sent bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			s.logger.Printf("response callback panic %v\n", r)
+		}
+	}()
+	hook(request, response, sent)
+}
@@ -0,0 +1,168 @@
+package mbserver
+
+import (
+	"testing"
+	"time"
+
+	"github.com/goburrow/modbus"
+)
+
+func TestOnWriteBeforeResponse(t *testing.T) {
+	s := NewServer()
+	var events []WriteEvent
+	s.OnWrite(func(event WriteEvent) {
+		events = append(events, event)
+	})
+
+	frame := &TCPFrame{Device: 1, Function: WriteHoldingRegistersFC}
+	SetDataWithRegisterAndNumberAndValues(frame, 3, 2, []uint16{7, 8})
+	s.handle(&Request{frame: frame})
+
+	expect := []WriteEvent{{Function: WriteHoldingRegistersFC, Unit: 1, Kind: HoldingRegister, Address: 3, Values: []uint16{7, 8}}}
+	if !isEqual(expect, events) {
+		t.Errorf("expected %v, got %v", expect, events)
+	}
+}
+
+func TestOnWriteAfterResponse(t *testing.T) {
+	s := NewServer()
+	s.SetCallbackTiming(AfterResponse)
+	events := make(chan WriteEvent, 1)
+	s.OnWrite(func(event WriteEvent) {
+		events <- event
+	})
+
+	frame := &TCPFrame{Device: 1, Function: WriteSingleCoilFC}
+	SetDataWithRegisterAndNumber(frame, 9, 0xFF00)
+	s.handle(&Request{frame: frame})
+
+	select {
+	case event := <-events:
+		t.Fatalf("expected no event before the response, got %v", event)
+	default:
+	}
+
+	s.flushWriteEvents(frame)
+	select {
+	case event := <-events:
+		expect := WriteEvent{Function: WriteSingleCoilFC, Unit: 1, Kind: Coil, Address: 9, Values: []uint16{1}}
+		if !isEqual(expect, event) {
+			t.Errorf("expected %v, got %v", expect, event)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected an event after the response")
+	}
+}
+
+func TestOnWriteAfterResponsePanic(t *testing.T) {
+	s := NewServer()
+	s.SetCallbackTiming(AfterResponse)
+	s.OnWrite(func(event WriteEvent) {
+		panic("callback failure")
+	})
+
+	addr := getFreePort()
+	err := s.ListenTCP(addr)
+	if err != nil {
+		t.Fatalf("failed to listen, got %v\n", err)
+	}
+	defer s.Close()
+
+	handler := modbus.NewTCPClientHandler(addr)
+	handler.SlaveId = 1
+	err = handler.Connect()
+	if err != nil {
+		t.Fatalf("failed to connect, got %v\n", err)
+	}
+	defer handler.Close()
+	client := modbus.NewClient(handler)
+
+	for i := 0; i < 2; i++ {
+		_, err = client.WriteSingleRegister(1, 5)
+		if err != nil {
+			t.Fatalf("expected nil, got %v\n", err)
+		}
+	}
+}
+
+func TestOnResponse(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	type observed struct {
+		Function uint8
+		Response []byte
+		Sent     bool
+	}
+	var responses []observed
+	s.OnResponse(func(req *Request, resp Framer, sent bool) {
+		responses = append(responses, observed{req.Frame().GetFunction(), resp.Bytes(), sent})
+	})
+	s.SetErrorInjection(ReadCoilsFC, 1, &SlaveDeviceBusy)
+
+	s.RoundTrip([]byte{0, 1, 0, 0, 0, 6, 1, 0x03, 0, 0, 0, 1})
+	s.RoundTrip([]byte{0, 2, 0, 0, 0, 6, 1, 0x01, 0, 0, 0, 1})
+	// Force Listen Only Mode is not answered.
+	s.RoundTrip([]byte{0, 3, 0, 0, 0, 6, 1, 0x08, 0, 4, 0, 0})
+	// Another unit is ignored.
+	s.RoundTrip([]byte{0, 4, 0, 0, 0, 6, 2, 0x03, 0, 0, 0, 1})
+
+	expect := []observed{
+		{ReadHoldingRegistersFC, []byte{0, 1, 0, 0, 0, 5, 1, 0x03, 2, 0, 0}, true},
+		{ReadCoilsFC, []byte{0, 2, 0, 0, 0, 3, 1, 0x81, 6}, true},
+		{DiagnosticsFC, []byte{0, 3, 0, 0, 0, 6, 1, 0x08, 0, 4, 0, 0}, false},
+	}
+	if !isEqual(expect, responses) {
+		t.Errorf("expected %v, got %v", expect, responses)
+	}
+}
+
+func TestOnResponsePanic(t *testing.T) {
+	s := NewServer(WithLogger(discardLogger{}))
+	defer s.Close()
+	var calls int
+	s.OnResponse(func(req *Request, resp Framer, sent bool) {
+		panic("callback failure")
+	})
+	s.OnResponse(func(req *Request, resp Framer, sent bool) {
+		calls++
+	})
+
+	// The worker survives the panic and serves the next request.
+	for i := 0; i < 2; i++ {
+		if _, err := s.RoundTrip([]byte{0, 1, 0, 0, 0, 6, 1, 0x03, 0, 0, 0, 1}); err != nil {
+			t.Fatalf("expected nil, got %v", err)
+		}
+	}
+	if calls != 2 {
+		t.Errorf("expected the next callback to run twice, got %v", calls)
+	}
+}
+
+func TestWriteEvents(t *testing.T) {
+	s := NewServer(WithLogger(discardLogger{}))
+	events, cancel := s.WriteEvents(1)
+
+	frame := &TCPFrame{Device: 1, Function: WriteHoldingRegisterFC}
+	SetDataWithRegisterAndNumber(frame, 4, 42)
+	s.handle(&Request{frame: frame})
+	// The channel is full, this event is dropped.
+	s.handle(&Request{frame: frame})
+
+	expect := WriteEvent{Function: WriteHoldingRegisterFC, Unit: 1, Kind: HoldingRegister, Address: 4, Values: []uint16{42}}
+	select {
+	case event := <-events:
+		if !isEqual(expect, event) {
+			t.Errorf("expected %v, got %v", expect, event)
+		}
+	default:
+		t.Fatalf("expected a write event")
+	}
+
+	cancel()
+	cancel()
+	s.handle(&Request{frame: frame})
+	if event, ok := <-events; ok {
+		t.Errorf("expected the channel to be closed, got %v", event)
+	}
+}
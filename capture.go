@@ -0,0 +1,61 @@
+package mbserver
+
+import (
+	"net"
+	"sync/atomic"
+)
+
+// SetCaptureDepth keeps the raw bytes of the last n requests and responses of
+// every connection in memory, retrievable with ConnTraffic. 0 (the default)
+// disables capturing and discards what was captured.
+func (s *Server) SetCaptureDepth(n int) {
+	if n < 0 {
+		n = 0
+	}
+	atomic.StoreInt32(&s.captureDepth, int32(n))
+}
+
+// ConnTraffic returns copies of the last captured requests and responses of
+// the TCP connection from the remote address, oldest first.
+func (s *Server) ConnTraffic(remote net.Addr) [][]byte {
+	s.connsLock.Lock()
+	defer s.connsLock.Unlock()
+
+	for _, client := range s.conns {
+		addr := client.info.RemoteAddr
+		if addr != nil && addr.Network() == remote.Network() && addr.String() == remote.String() {
+			return client.traffic()
+		}
+	}
+	return nil
+}
+
+// capture records a copy of a request or response.
+func (c *clientConn) capture(p []byte) {
+	depth := int(atomic.LoadInt32(&c.server.captureDepth))
+
+	c.captureLock.Lock()
+	defer c.captureLock.Unlock()
+
+	if depth == 0 {
+		c.captured = nil
+		return
+	}
+	c.captured = append(c.captured, append([]byte(nil), p...))
+	if len(c.captured) > depth {
+		// Shift down rather than reslice so the backing array does not grow.
+		n := copy(c.captured, c.captured[len(c.captured)-depth:])
+		c.captured = c.captured[:n]
+	}
+}
+
+func (c *clientConn) traffic() [][]byte {
+	c.captureLock.Lock()
+	defer c.captureLock.Unlock()
+
+	traffic := make([][]byte, len(c.captured))
+	for i, p := range c.captured {
+		traffic[i] = append([]byte(nil), p...)
+	}
+	return traffic
+}
@@ -0,0 +1,59 @@
+package mbserver
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestConnTraffic(t *testing.T) {
+	s := NewServer()
+	s.SetCaptureDepth(3)
+	addr := getFreePort()
+	err := s.ListenTCP(addr)
+	if err != nil {
+		t.Fatalf("failed to listen, got %v\n", err)
+	}
+	defer s.Close()
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("failed to connect, got %v\n", err)
+	}
+	defer conn.Close()
+
+	var requests, responses [][]byte
+	for i := 0; i < 2; i++ {
+		frame := &TCPFrame{TransactionIdentifier: uint16(i), Device: 1, Function: ReadHoldingRegistersFC}
+		SetDataWithRegisterAndNumber(frame, 0, 1)
+		request := frame.Bytes()
+		requests = append(requests, request)
+
+		_, err = conn.Write(request)
+		if err != nil {
+			t.Fatalf("expected nil, got %v", err)
+		}
+		response := make([]byte, 11)
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		_, err = io.ReadFull(conn, response)
+		if err != nil {
+			t.Fatalf("expected nil, got %v", err)
+		}
+		responses = append(responses, response)
+	}
+
+	// Only the last three frames are kept.
+	expect := [][]byte{responses[0], requests[1], responses[1]}
+	got := s.ConnTraffic(conn.LocalAddr())
+	if !isEqual(expect, got) {
+		t.Errorf("expected %v, got %v", expect, got)
+	}
+
+	// Captured bytes are copies.
+	got[0][0] = 0xFF
+	got = s.ConnTraffic(conn.LocalAddr())
+	if !isEqual(expect, got) {
+		t.Errorf("expected %v, got %v", expect, got)
+	}
+}
@@ -0,0 +1,72 @@
+package mbserver
+
+import "time"
+
+// SetCoil sets a coil. Addresses beyond the allocated coils, and errors of a
+// Store, are ignored.
+func (s *Server) SetCoil(address uint16, on bool) {
+	s.setRegister(Coil, address, boolValue(on))
+}
+
+// GetCoil returns a coil. Addresses beyond the allocated coils, and errors of
+// a Store, read false.
+func (s *Server) GetCoil(address uint16) bool {
+	return s.getRegister(Coil, address) != 0
+}
+
+// ToggleCoil inverts a coil and returns its new value, like SetCoil.
+func (s *Server) ToggleCoil(address uint16) bool {
+	s.memoryLock.Lock()
+	defer s.memoryLock.Unlock()
+
+	if int(address) >= s.bankSize(Coil) {
+		return false
+	}
+	values, err := s.readRegisters(Coil, int(address), 1)
+	if err != nil {
+		return false
+	}
+	on := values[0] == 0
+	s.writeRegisters(Coil, int(address), []uint16{boolValue(on)})
+	return on
+}
+
+// PulseCoil sets a coil, then resets it after d, which simulates a push
+// button. Pulsing a coil again before it was reset restarts the pulse, pulses
+// of different coils are independent. Close cancels the pending pulses,
+// leaving their coils set.
+func (s *Server) PulseCoil(address uint16, d time.Duration) {
+	s.SetCoil(address, true)
+
+	s.pulseLock.Lock()
+	defer s.pulseLock.Unlock()
+	if s.pulses == nil {
+		s.pulses = make(map[uint16]*time.Timer)
+	}
+	if timer, ok := s.pulses[address]; ok {
+		timer.Stop()
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(d, func() {
+		s.pulseLock.Lock()
+		current := s.pulses[address] == timer
+		if current {
+			delete(s.pulses, address)
+		}
+		s.pulseLock.Unlock()
+		if current {
+			s.SetCoil(address, false)
+		}
+	})
+	s.pulses[address] = timer
+}
+
+// stopPulses cancels the pending pulses.
+func (s *Server) stopPulses() {
+	s.pulseLock.Lock()
+	defer s.pulseLock.Unlock()
+	for address, timer := range s.pulses {
+		timer.Stop()
+		delete(s.pulses, address)
+	}
+}
@@ -0,0 +1,48 @@
+package mbserver
+
+import (
+	"testing"
+	"time"
+)
+
+func TestToggleCoil(t *testing.T) {
+	s := NewServer()
+	if !s.ToggleCoil(3) || !s.GetCoil(3) {
+		t.Errorf("expected the coil to be set")
+	}
+	if s.ToggleCoil(3) || s.Coils[3] != 0 {
+		t.Errorf("expected the coil to be reset, got %v", s.Coils[3])
+	}
+	s.SetCoil(4, true)
+	if s.Coils[4] != 1 {
+		t.Errorf("expected 1, got %v", s.Coils[4])
+	}
+}
+
+func TestPulseCoil(t *testing.T) {
+	s := NewServer()
+	s.PulseCoil(1, 20*time.Millisecond)
+	s.PulseCoil(2, time.Hour)
+	if !s.GetCoil(1) || !s.GetCoil(2) {
+		t.Fatalf("expected the coils to be set")
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for s.GetCoil(1) && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if s.GetCoil(1) {
+		t.Errorf("expected coil 1 to be reset")
+	}
+	if !s.GetCoil(2) {
+		t.Errorf("expected coil 2 to still be set")
+	}
+
+	// Close cancels the pending pulses.
+	s.PulseCoil(3, 20*time.Millisecond)
+	s.Close()
+	time.Sleep(50 * time.Millisecond)
+	if !s.GetCoil(3) {
+		t.Errorf("expected the pulse to be cancelled")
+	}
+}
@@ -0,0 +1,64 @@
+package mbserver
+
+import "fmt"
+
+// ServerConfig configures a Server created by NewServerWithConfig.
+type ServerConfig struct {
+	// SlaveID is the slave ID (unit identifier) the server responds to,
+	// 1 to 247.
+	SlaveID uint8
+	// The number of items allocated in each memory map, 1 to
+	// MaxRegisterSize.
+	CoilCount            int
+	DiscreteInputCount   int
+	HoldingRegisterCount int
+	InputRegisterCount   int
+	// StartAddress is the address of the first item of each memory map in
+	// requests, see WithStartAddress. The memory maps must end by address
+	// 65535.
+	StartAddress uint16
+	// Store, if set, holds the memory maps, see NewServerWithStore.
+	Store Store
+	// Options configure the server further. They are applied first, so
+	// the fields above take precedence over options setting the same.
+	Options []Option
+}
+
+// NewServerWithConfig creates a new Modbus server (slave) like NewServer,
+// but validates the configuration first and returns an error instead of a
+// server when it is invalid. The Store, if any, must answer a read of the
+// first holding register.
+func NewServerWithConfig(cfg ServerConfig) (*Server, error) {
+	if cfg.SlaveID < 1 || cfg.SlaveID > 247 {
+		return nil, fmt.Errorf("invalid slave ID %d, 1 to 247 is required", cfg.SlaveID)
+	}
+	counts := []struct {
+		name  string
+		count int
+	}{
+		{"coil", cfg.CoilCount},
+		{"discrete input", cfg.DiscreteInputCount},
+		{"holding register", cfg.HoldingRegisterCount},
+		{"input register", cfg.InputRegisterCount},
+	}
+	for _, c := range counts {
+		if c.count < 1 || c.count > MaxRegisterSize-int(cfg.StartAddress) {
+			return nil, fmt.Errorf("invalid %s count %d, 1 to %d is required", c.name, c.count, MaxRegisterSize-int(cfg.StartAddress))
+		}
+	}
+	if cfg.Store != nil {
+		if _, err := cfg.Store.ReadRegisters(HoldingRegister, 0, 1); err != nil {
+			return nil, fmt.Errorf("store unreachable: %w", err)
+		}
+	}
+
+	opts := append(append([]Option(nil), cfg.Options...),
+		WithSlaveID(cfg.SlaveID),
+		WithCoilCount(cfg.CoilCount),
+		WithDiscreteInputCount(cfg.DiscreteInputCount),
+		WithHoldingRegisterCount(cfg.HoldingRegisterCount),
+		WithInputRegisterCount(cfg.InputRegisterCount),
+		WithStartAddress(cfg.StartAddress),
+	)
+	return newServer(cfg.Store, opts), nil
+}
@@ -0,0 +1,95 @@
+package mbserver
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNewServerWithConfig(t *testing.T) {
+	valid := ServerConfig{
+		SlaveID:              5,
+		CoilCount:            10,
+		DiscreteInputCount:   20,
+		HoldingRegisterCount: 30,
+		InputRegisterCount:   40,
+		Options:              []Option{WithSlaveID(9), WithHoldingRegisterCount(1), WithHoldingRegisterFill(7)},
+	}
+	s, err := NewServerWithConfig(valid)
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	defer s.Close()
+	if s.SlaveID() != 5 || len(s.Coils) != 10 || len(s.DiscreteInputs) != 20 || len(s.HoldingRegisters) != 30 || len(s.InputRegisters) != 40 {
+		t.Errorf("unexpected slave ID %v or sizes %v %v %v %v", s.SlaveID(), len(s.Coils), len(s.DiscreteInputs), len(s.HoldingRegisters), len(s.InputRegisters))
+	}
+	if s.HoldingRegisters[29] != 7 {
+		t.Errorf("expected the options to be applied, got %v", s.HoldingRegisters[29])
+	}
+
+	store := newMapStore()
+	store.err = errors.New("connection refused")
+	invalid := []func(*ServerConfig){
+		func(c *ServerConfig) { c.SlaveID = 0 },
+		func(c *ServerConfig) { c.SlaveID = 248 },
+		func(c *ServerConfig) { c.CoilCount = 0 },
+		func(c *ServerConfig) { c.InputRegisterCount = MaxRegisterSize + 1 },
+		func(c *ServerConfig) { c.Store = store },
+		func(c *ServerConfig) { c.StartAddress = MaxRegisterSize - 39 },
+	}
+	for i, modify := range invalid {
+		cfg := valid
+		modify(&cfg)
+		if s, err := NewServerWithConfig(cfg); err == nil || s != nil {
+			t.Errorf("%v: expected an error, got %v", i, err)
+		}
+	}
+
+	store.err = nil
+	cfg := valid
+	cfg.Store = store
+	s, err = NewServerWithConfig(cfg)
+	if err != nil {
+		t.Fatalf("expected nil with a reachable store, got %v", err)
+	}
+	s.Close()
+}
+
+func TestServerConfigStartAddress(t *testing.T) {
+	s, err := NewServerWithConfig(ServerConfig{
+		SlaveID:              1,
+		CoilCount:            8,
+		DiscreteInputCount:   8,
+		HoldingRegisterCount: 10,
+		InputRegisterCount:   10,
+		StartAddress:         1000,
+	})
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	defer s.Close()
+	s.InputRegisters[9] = 3
+
+	for _, test := range []struct {
+		function uint8
+		data     []byte
+		expect   []byte
+	}{
+		{ReadInputRegistersFC, []byte{0x03, 0xf1, 0, 1}, []byte{2, 0, 3}},
+		{ReadInputRegistersFC, []byte{0x03, 0xe7, 0, 2}, []byte{byte(IllegalDataAddress)}},
+		{ReadInputRegistersFC, []byte{0x03, 0xf1, 0, 2}, []byte{byte(IllegalDataAddress)}},
+		{ReadInputRegistersFC, []byte{0, 0, 0, 1}, []byte{byte(IllegalDataAddress)}},
+		{WriteHoldingRegisterFC, []byte{0x03, 0xe8, 0, 5}, []byte{0x03, 0xe8, 0, 5}},
+		{WriteMultipleCoilsFC, []byte{0x03, 0xef, 0, 1, 1, 1}, []byte{0x03, 0xef, 0, 1}},
+		{WriteMultipleCoilsFC, []byte{0x03, 0xf0, 0, 1, 1, 1}, []byte{byte(IllegalDataAddress)}},
+		{ReadWriteMultipleRegistersFC, []byte{0x03, 0xe8, 0, 1, 0x03, 0xe9, 0, 1, 2, 0, 9}, []byte{2, 0, 5}},
+	} {
+		frame := &TCPFrame{Device: 1, Function: test.function}
+		frame.SetData(test.data)
+		if response := s.handle(&Request{frame: frame}); !isEqual(test.expect, response.GetData()) {
+			t.Errorf("function %v %v: expected %v, got %v", test.function, test.data, test.expect, response.GetData())
+		}
+	}
+	if s.HoldingRegisters[0] != 5 || s.HoldingRegisters[1] != 9 || s.Coils[7] != 1 {
+		t.Errorf("expected the writes from item 0, got %v, coils %v", s.HoldingRegisters[0:2], s.Coils)
+	}
+}
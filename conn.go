@@ -0,0 +1,192 @@
+package mbserver
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ClientInfo describes a connection (TCP client or serial port) currently
+// served by the server.
+type ClientInfo struct {
+	// Conn is the underlying connection or serial port.
+	Conn io.ReadWriteCloser
+	// RemoteAddr is the address of the master, nil for serial ports.
+	RemoteAddr net.Addr
+	// ConnectedAt is the time the connection was accepted or the port opened.
+	ConnectedAt time.Time
+	// BytesRead is the number of bytes received from the master.
+	BytesRead uint64
+	// BytesWritten is the number of bytes sent to the master.
+	BytesWritten uint64
+	// LastActivity is the time data was last received from the master, or
+	// ConnectedAt if none was.
+	LastActivity time.Time
+}
+
+// clientConn wraps a served connection so that responses and unsolicited
+// frames written to it never interleave.
+type clientConn struct {
+	io.ReadWriteCloser
+	server       *Server
+	info         ClientInfo
+	writeLock    sync.Mutex
+	captureLock  sync.Mutex
+	captured     [][]byte
+	bytesRead    atomic.Uint64
+	bytesWritten atomic.Uint64
+	lastActivity atomic.Int64
+	// failed is set once a write to the connection failed.
+	failed atomic.Bool
+	// deadlineSet is set while a read deadline is set on the connection, it
+	// is only used by the goroutine serving the connection.
+	deadlineSet bool
+	// worker is the index of the worker handling the requests.
+	worker int
+}
+
+// Read is only used by the goroutine serving the connection.
+func (c *clientConn) Read(p []byte) (int, error) {
+	n, err := c.ReadWriteCloser.Read(p)
+	c.bytesRead.Add(uint64(n))
+	c.server.bytesIn.Add(uint64(n))
+	if n > 0 {
+		c.lastActivity.Store(time.Now().UnixNano())
+	}
+	return n, err
+}
+
+// Write writes a whole response at once: responses written concurrently, for
+// instance once their jitter elapsed, never interleave on the wire, and are
+// captured in the order they are written.
+func (c *clientConn) Write(p []byte) (int, error) {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	c.capture(p)
+	n, err := c.ReadWriteCloser.Write(p)
+	c.bytesWritten.Add(uint64(n))
+	c.server.bytesOut.Add(uint64(n))
+	return n, err
+}
+
+// fail marks the connection as broken after a write error. TCP connections
+// are closed, which ends the goroutine serving them; serial ports are kept
+// open as write errors on them are usually transient.
+func (c *clientConn) fail() {
+	if c.info.RemoteAddr == nil {
+		return
+	}
+	if !c.failed.Swap(true) {
+		c.ReadWriteCloser.Close()
+	}
+}
+
+func (c *clientConn) clientInfo() ClientInfo {
+	info := c.info
+	info.BytesRead = c.bytesRead.Load()
+	info.BytesWritten = c.bytesWritten.Load()
+	info.LastActivity = time.Unix(0, c.lastActivity.Load())
+	return info
+}
+
+// writeResponse sends a response, logging write errors, and reports whether
+// it was written. Requests still queued for a TCP connection that failed are
+// dropped.
+func (s *Server) writeResponse(conn io.ReadWriteCloser, p []byte) bool {
+	if _, err := conn.Write(p); err != nil {
+		s.logger.Printf("write error %v\n", err)
+		if client, ok := conn.(*clientConn); ok {
+			client.fail()
+		}
+		return false
+	}
+	return true
+}
+
+// isFailed reports whether a write to the connection failed.
+func isFailed(conn io.ReadWriteCloser) bool {
+	client, ok := conn.(*clientConn)
+	return ok && client.failed.Load()
+}
+
+func (s *Server) trackConn(conn io.ReadWriteCloser) *clientConn {
+	client := s.newClientConn(conn)
+	s.connsLock.Lock()
+	s.conns[conn] = client
+	s.connsLock.Unlock()
+	return client
+}
+
+// newClientConn wraps a connection without tracking it, see trackConn.
+func (s *Server) newClientConn(conn io.ReadWriteCloser) *clientConn {
+	client := &clientConn{
+		ReadWriteCloser: conn,
+		server:          s,
+		info: ClientInfo{
+			Conn:        conn,
+			ConnectedAt: time.Now(),
+		},
+	}
+	if remote, ok := conn.(interface{ RemoteAddr() net.Addr }); ok {
+		client.info.RemoteAddr = remote.RemoteAddr()
+	}
+	client.lastActivity.Store(client.info.ConnectedAt.UnixNano())
+	client.worker = int(s.nextWorker.Add(1)-1) % len(s.requestChans)
+	return client
+}
+
+func (s *Server) untrackConn(client *clientConn) {
+	s.connsLock.Lock()
+	delete(s.conns, client.ReadWriteCloser)
+	s.connsLock.Unlock()
+}
+
+// Clients returns the connections currently served by the server.
+func (s *Server) Clients() []ClientInfo {
+	s.connsLock.Lock()
+	defer s.connsLock.Unlock()
+
+	clients := make([]ClientInfo, 0, len(s.conns))
+	for _, client := range s.conns {
+		clients = append(clients, client.clientInfo())
+	}
+	return clients
+}
+
+// LastActivity returns the time data was last received on the TCP connection
+// from the remote address, and false if no such connection is served. It lets
+// monitoring tools spot stale connections without closing them.
+func (s *Server) LastActivity(remote net.Addr) (time.Time, bool) {
+	s.connsLock.Lock()
+	defer s.connsLock.Unlock()
+
+	for _, client := range s.conns {
+		addr := client.info.RemoteAddr
+		if addr != nil && addr.Network() == remote.Network() && addr.String() == remote.String() {
+			return time.Unix(0, client.lastActivity.Load()), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// PushToConn writes an unsolicited frame to a connection returned by Clients.
+// The write is serialized with the responses sent on that connection.
+//
+// Unsolicited frames are not part of the Modbus specification. Standard
+// masters ignore or discard them, or may mistake them for the response to
+// their next request; only use this with masters built to expect them.
+func (s *Server) PushToConn(conn io.ReadWriteCloser, frame Framer) error {
+	s.connsLock.Lock()
+	client, ok := s.conns[conn]
+	s.connsLock.Unlock()
+	if !ok {
+		return fmt.Errorf("connection is not served by this server")
+	}
+
+	_, err := client.Write(frame.Bytes())
+	return err
+}
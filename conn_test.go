@@ -0,0 +1,255 @@
+package mbserver
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// waitForClients polls until the server tracks n connections.
+func waitForClients(t *testing.T, s *Server, n int) []ClientInfo {
+	for i := 0; i < 100; i++ {
+		clients := s.Clients()
+		if len(clients) == n {
+			return clients
+		}
+		time.Sleep(1 * time.Millisecond)
+	}
+	t.Fatalf("expected %v clients, got %v", n, len(s.Clients()))
+	return nil
+}
+
+func TestPushToConn(t *testing.T) {
+	s := NewServer()
+	addr := getFreePort()
+	err := s.ListenTCP(addr)
+	if err != nil {
+		t.Fatalf("failed to listen, got %v\n", err)
+	}
+	defer s.Close()
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("failed to connect, got %v\n", err)
+	}
+	defer conn.Close()
+
+	clients := waitForClients(t, s, 1)
+	if clients[0].RemoteAddr.String() != conn.LocalAddr().String() {
+		t.Errorf("expected remote address %v, got %v", conn.LocalAddr(), clients[0].RemoteAddr)
+	}
+
+	frame := &TCPFrame{Device: 1, Function: ReadHoldingRegistersFC}
+	frame.SetData([]byte{2, 0, 42})
+	err = s.PushToConn(clients[0].Conn, frame)
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+
+	expect := frame.Bytes()
+	got := make([]byte, len(expect))
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = io.ReadFull(conn, got)
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if !isEqual(expect, got) {
+		t.Errorf("expected %v, got %v", expect, got)
+	}
+}
+
+func TestPushToUnknownConn(t *testing.T) {
+	s := NewServer()
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	err := s.PushToConn(server, &TCPFrame{})
+	if err == nil {
+		t.Errorf("expected error, got nil")
+	}
+}
+
+func TestClientByteCounters(t *testing.T) {
+	s := NewServer()
+	addr := getFreePort()
+	err := s.ListenTCP(addr)
+	if err != nil {
+		t.Fatalf("failed to listen, got %v\n", err)
+	}
+	defer s.Close()
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("failed to connect, got %v\n", err)
+	}
+	defer conn.Close()
+
+	frame := &TCPFrame{Device: 1, Function: ReadHoldingRegistersFC}
+	SetDataWithRegisterAndNumber(frame, 0, 2)
+	request := frame.Bytes()
+	_, err = conn.Write(request)
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	response := make([]byte, 13)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = io.ReadFull(conn, response)
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+
+	clients := waitForClients(t, s, 1)
+	if clients[0].BytesRead != uint64(len(request)) {
+		t.Errorf("expected %v bytes read, got %v", len(request), clients[0].BytesRead)
+	}
+	if clients[0].BytesWritten != uint64(len(response)) {
+		t.Errorf("expected %v bytes written, got %v", len(response), clients[0].BytesWritten)
+	}
+}
+
+func TestLastActivity(t *testing.T) {
+	s := NewServer()
+	addr, err := s.ListenTCPAny()
+	if err != nil {
+		t.Fatalf("failed to listen, got %v\n", err)
+	}
+	defer s.Close()
+
+	conn, err := net.Dial("tcp", addr.String())
+	if err != nil {
+		t.Fatalf("failed to connect, got %v\n", err)
+	}
+	defer conn.Close()
+
+	clients := waitForClients(t, s, 1)
+	connected, ok := s.LastActivity(conn.LocalAddr())
+	if !ok || !connected.Equal(clients[0].ConnectedAt) {
+		t.Errorf("expected the connection time %v, got %v %v", clients[0].ConnectedAt, connected, ok)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	frame := &TCPFrame{Device: 1, Function: ReadHoldingRegistersFC}
+	SetDataWithRegisterAndNumber(frame, 0, 1)
+	conn.Write(frame.Bytes())
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := io.ReadFull(conn, make([]byte, 11)); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+
+	active, ok := s.LastActivity(conn.LocalAddr())
+	if !ok || !active.After(connected) {
+		t.Errorf("expected a time after %v, got %v %v", connected, active, ok)
+	}
+	if clients := s.Clients(); !clients[0].LastActivity.Equal(active) {
+		t.Errorf("expected ClientInfo to report %v, got %v", active, clients[0].LastActivity)
+	}
+
+	if _, ok := s.LastActivity(&net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1}); ok {
+		t.Errorf("expected an unknown address to be reported")
+	}
+}
+
+type chanLogger chan string
+
+func (l chanLogger) Printf(format string, v ...interface{}) {
+	l <- fmt.Sprintf(format, v...)
+}
+
+func TestWriteErrorDropsConn(t *testing.T) {
+	logs := make(chanLogger, 10)
+	s := NewServer(WithLogger(logs))
+	defer s.Close()
+
+	broken, peer := net.Pipe()
+	peer.Close()
+	client := s.trackConn(broken)
+
+	frame := &TCPFrame{Device: 1, Function: ReadHoldingRegistersFC}
+	SetDataWithRegisterAndNumber(frame, 0, 1)
+	s.requestChans[0] <- &Request{conn: client, frame: frame}
+
+	select {
+	case log := <-logs:
+		if !strings.Contains(log, "write error") {
+			t.Errorf("expected a write error to be logged, got %q", log)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected the write error to be logged")
+	}
+	if !client.failed.Load() {
+		t.Errorf("expected the connection to be marked as failed")
+	}
+
+	// Further requests for the connection are dropped without writing.
+	s.requestChans[0] <- &Request{conn: client, frame: frame}
+
+	healthy, master := net.Pipe()
+	defer master.Close()
+	s.requestChans[0] <- &Request{conn: s.trackConn(healthy), frame: frame}
+	master.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := io.ReadFull(master, make([]byte, 11)); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	select {
+	case log := <-logs:
+		t.Errorf("expected no other log, got %q", log)
+	default:
+	}
+}
+
+func TestPipelinedResponsesDoNotInterleave(t *testing.T) {
+	s := NewServer()
+	for i := range s.HoldingRegisters[:500] {
+		s.HoldingRegisters[i] = uint16(i)
+	}
+	// Jittered responses are written concurrently, and out of order.
+	s.SetResponseJitter(0, 2*time.Millisecond)
+	s.SetResponseJitterSeed(1)
+	addr, err := s.ListenTCPAny()
+	if err != nil {
+		t.Fatalf("failed to listen, got %v\n", err)
+	}
+	defer s.Close()
+
+	conn, err := net.Dial("tcp", addr.String())
+	if err != nil {
+		t.Fatalf("failed to connect, got %v\n", err)
+	}
+	defer conn.Close()
+
+	// Every request reads the register whose address is its transaction ID,
+	// all sent at once.
+	const count = 500
+	var requests []byte
+	for i := 0; i < count; i++ {
+		frame := &TCPFrame{TransactionIdentifier: uint16(i), Device: 1, Function: ReadHoldingRegistersFC}
+		SetDataWithRegisterAndNumber(frame, uint16(i), 1)
+		requests = append(requests, frame.Bytes()...)
+	}
+	if _, err := conn.Write(requests); err != nil {
+		t.Fatalf("failed to write, got %v", err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	seen := make(map[uint16]bool)
+	for i := 0; i < count; i++ {
+		packet, err := readTCPPacket(conn)
+		if err != nil {
+			t.Fatalf("failed to read response %d, got %v", i, err)
+		}
+		frame, err := NewTCPFrame(packet)
+		if err != nil {
+			t.Fatalf("corrupted response %v: %v", packet, err)
+		}
+		id := frame.TransactionIdentifier
+		expect := []byte{2, byte(id >> 8), byte(id)}
+		if frame.Function != ReadHoldingRegistersFC || !isEqual(expect, frame.Data) || seen[id] {
+			t.Fatalf("corrupted response %v", packet)
+		}
+		seen[id] = true
+	}
+}
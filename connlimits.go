@@ -0,0 +1,142 @@
+package mbserver
+
+import (
+	"errors"
+	"io"
+	"net"
+	"time"
+)
+
+// OnConnect sets a callback fired from the goroutine serving a TCP or TLS
+// connection once it is accepted, and authorized for TLS, before any request
+// is read. The ClientInfo holds the remote address of the master. A nil
+// callback removes it.
+func (s *Server) OnConnect(callback func(ClientInfo)) {
+	s.hooksLock.Lock()
+	s.connectHook = callback
+	s.hooksLock.Unlock()
+}
+
+// OnDisconnect sets a callback fired once a connection reported to OnConnect
+// is closed, by the master, the server or a timeout, with its final byte
+// counts. A nil callback removes it.
+func (s *Server) OnDisconnect(callback func(ClientInfo)) {
+	s.hooksLock.Lock()
+	s.disconnectHook = callback
+	s.hooksLock.Unlock()
+}
+
+func (s *Server) notifyConnect(client *clientConn) {
+	s.logConn("connection accepted", client)
+	s.hooksLock.RLock()
+	callback := s.connectHook
+	s.hooksLock.RUnlock()
+	if callback != nil {
+		callback(client.clientInfo())
+	}
+}
+
+func (s *Server) notifyDisconnect(client *clientConn) {
+	s.logConn("connection closed", client)
+	s.hooksLock.RLock()
+	callback := s.disconnectHook
+	s.hooksLock.RUnlock()
+	if callback != nil {
+		callback(client.clientInfo())
+	}
+}
+
+// SetMaxConns limits the number of TCP and TLS connections served at once.
+// Connections accepted above the limit are closed at once and counted by
+// RejectedConns. A limit of 0 (the default) allows any number.
+func (s *Server) SetMaxConns(n int) {
+	if n < 0 {
+		n = 0
+	}
+	s.maxConns.Store(int32(n))
+}
+
+// reserveConn counts a new connection, false when that would exceed the
+// connection limit.
+func (s *Server) reserveConn() bool {
+	n := s.activeConns.Add(1)
+	if max := s.maxConns.Load(); max > 0 && n > max {
+		s.activeConns.Add(-1)
+		return false
+	}
+	return true
+}
+
+// SetIdleTimeout closes TCP and TLS connections on which no request started
+// for d, to drop the sessions of masters that went away without closing
+// them. A duration of 0 (the default) keeps idle connections open.
+func (s *Server) SetIdleTimeout(d time.Duration) {
+	s.idleTimeout.Store(int64(d))
+}
+
+// SetReadTimeout bounds the time a master has, once the first byte of a
+// request arrived on a TCP or TLS connection, to send the rest of it. The
+// connection is closed when it does not. A duration of 0 (the default)
+// waits for ever.
+func (s *Server) SetReadTimeout(d time.Duration) {
+	s.readTimeout.Store(int64(d))
+}
+
+// requestReader reads the next request of a connection, with the idle
+// timeout and read timeout in effect.
+// Connections without read deadlines are read without timeouts.
+func (s *Server) requestReader(client *clientConn, rwc io.ReadWriteCloser) io.Reader {
+	conn, ok := rwc.(readDeadliner)
+	if !ok {
+		return client
+	}
+	idle := time.Duration(s.idleTimeout.Load())
+	readTimeout := time.Duration(s.readTimeout.Load())
+	if idle <= 0 && readTimeout <= 0 {
+		if client.deadlineSet {
+			conn.SetReadDeadline(time.Time{})
+			client.deadlineSet = false
+		}
+		return client
+	}
+
+	deadline := time.Time{}
+	if idle > 0 {
+		deadline = time.Now().Add(idle)
+	}
+	conn.SetReadDeadline(deadline)
+	client.deadlineSet = true
+	return &timeoutReader{Reader: client, conn: conn, timeout: readTimeout}
+}
+
+type readDeadliner interface {
+	SetReadDeadline(t time.Time) error
+}
+
+// timeoutReader moves the read deadline of a connection to the read timeout
+// once the first byte of a request was read.
+type timeoutReader struct {
+	io.Reader
+	conn    readDeadliner
+	timeout time.Duration
+	started bool
+}
+
+func (r *timeoutReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if n > 0 && !r.started {
+		r.started = true
+		deadline := time.Time{}
+		if r.timeout > 0 {
+			deadline = time.Now().Add(r.timeout)
+		}
+		r.conn.SetReadDeadline(deadline)
+	}
+	return n, err
+}
+
+// isTimeout reports whether err is a read deadline expiring.
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
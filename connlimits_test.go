@@ -0,0 +1,147 @@
+package mbserver
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestOnConnectAndDisconnect(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	connected := make(chan ClientInfo, 1)
+	disconnected := make(chan ClientInfo, 1)
+	s.OnConnect(func(info ClientInfo) { connected <- info })
+	s.OnDisconnect(func(info ClientInfo) { disconnected <- info })
+	addr, err := s.ListenTCPAny()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := net.Dial("tcp", addr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case info := <-connected:
+		if info.RemoteAddr.String() != conn.LocalAddr().String() {
+			t.Errorf("expected remote address %v, got %v", conn.LocalAddr(), info.RemoteAddr)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected OnConnect to be called")
+	}
+
+	frame := &TCPFrame{Device: 1, Function: ReadCoilsFC}
+	SetDataWithRegisterAndNumber(frame, 0, 8)
+	conn.Write(frame.Bytes())
+	io.ReadFull(conn, make([]byte, 10))
+	conn.Close()
+	select {
+	case info := <-disconnected:
+		if info.BytesRead != 12 || info.BytesWritten != 10 {
+			t.Errorf("expected 12 bytes read and 10 written, got %v and %v", info.BytesRead, info.BytesWritten)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected OnDisconnect to be called")
+	}
+}
+
+// expectClosed reports whether the server closed the connection within a
+// second.
+func expectClosed(conn net.Conn) bool {
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, err := conn.Read(make([]byte, 1))
+	return err == io.EOF
+}
+
+func TestSetMaxConns(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.SetMaxConns(1)
+	addr, err := s.ListenTCPAny()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := net.Dial("tcp", addr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForClients(t, s, 1)
+	second, err := net.Dial("tcp", addr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+	if !expectClosed(second) {
+		t.Errorf("expected the connection above the limit to be closed")
+	}
+	if s.RejectedConns() != 1 {
+		t.Errorf("expected 1 rejected connection, got %v", s.RejectedConns())
+	}
+
+	first.Close()
+	waitForClients(t, s, 0)
+	third, err := net.Dial("tcp", addr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer third.Close()
+	waitForClients(t, s, 1)
+}
+
+func TestSetIdleTimeout(t *testing.T) {
+	s := NewServer(WithLogger(discardLogger{}))
+	defer s.Close()
+	s.SetIdleTimeout(50 * time.Millisecond)
+	addr, err := s.ListenTCPAny()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := net.Dial("tcp", addr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	start := time.Now()
+	if !expectClosed(conn) {
+		t.Fatalf("expected the idle connection to be closed")
+	}
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("expected the connection to be closed after the idle timeout, got %v", elapsed)
+	}
+}
+
+func TestSetReadTimeout(t *testing.T) {
+	s := NewServer(WithLogger(discardLogger{}))
+	defer s.Close()
+	s.SetReadTimeout(50 * time.Millisecond)
+	addr, err := s.ListenTCPAny()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := net.Dial("tcp", addr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// Idle connections are kept open.
+	time.Sleep(100 * time.Millisecond)
+	frame := &TCPFrame{Device: 1, Function: ReadCoilsFC}
+	SetDataWithRegisterAndNumber(frame, 0, 8)
+	conn.Write(frame.Bytes())
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := io.ReadFull(conn, make([]byte, 10)); err != nil {
+		t.Fatalf("expected a response, got %v", err)
+	}
+
+	// A request that never completes is not.
+	conn.Write(frame.Bytes()[:8])
+	if !expectClosed(conn) {
+		t.Errorf("expected the connection to be closed")
+	}
+}
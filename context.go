@@ -0,0 +1,56 @@
+package mbserver
+
+import (
+	"context"
+	"net"
+)
+
+// SetConnContextFunc sets a function called when a TCP connection is
+// accepted. The returned context is passed to the context-aware handlers
+// (see RegisterContextFunctionHandler) of every request on that connection.
+// By default, and for serial ports, the context is context.Background().
+func (s *Server) SetConnContextFunc(connContext func(conn net.Conn) context.Context) {
+	s.hooksLock.Lock()
+	s.connContext = connContext
+	s.hooksLock.Unlock()
+}
+
+// RegisterContextFunctionHandler overrides the default behavior for a given
+// Modbus function with a handler that receives the context of the connection
+// the request arrived on. It replaces any handler registered with
+// RegisterFunctionHandler for the function code.
+func (s *Server) RegisterContextFunctionHandler(funcCode uint8, function func(context.Context, *Server, Framer) ([]byte, *Exception)) {
+	s.rawFunction[funcCode] = nil
+	s.function[funcCode] = nil
+	s.contextFunction[funcCode] = function
+	s.readOnlyFunction[funcCode] = false
+}
+
+// Context returns the context of the connection the request arrived on.
+func (r *Request) Context() context.Context {
+	if r.ctx == nil {
+		return context.Background()
+	}
+	return r.ctx
+}
+
+func (s *Server) newConnContext(conn net.Conn) context.Context {
+	s.hooksLock.RLock()
+	connContext := s.connContext
+	s.hooksLock.RUnlock()
+
+	if connContext == nil {
+		return context.Background()
+	}
+	if ctx := connContext(conn); ctx != nil {
+		return ctx
+	}
+	return context.Background()
+}
+
+// withoutContext adapts a handler that does not use the request context.
+func withoutContext(function func(*Server, Framer) ([]byte, *Exception)) func(context.Context, *Server, Framer) ([]byte, *Exception) {
+	return func(_ context.Context, s *Server, frame Framer) ([]byte, *Exception) {
+		return function(s, frame)
+	}
+}
@@ -0,0 +1,84 @@
+package mbserver
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/goburrow/modbus"
+)
+
+type traceKey struct{}
+
+func TestConnContextFunc(t *testing.T) {
+	s := NewServer()
+	s.SetConnContextFunc(func(conn net.Conn) context.Context {
+		return context.WithValue(context.Background(), traceKey{}, conn.RemoteAddr().String())
+	})
+
+	traces := make(chan string, 1)
+	s.RegisterContextFunctionHandler(ReadHoldingRegistersFC,
+		func(ctx context.Context, s *Server, frame Framer) ([]byte, *Exception) {
+			trace, _ := ctx.Value(traceKey{}).(string)
+			traces <- trace
+			return ReadHoldingRegisters(s, frame)
+		})
+
+	addr := getFreePort()
+	err := s.ListenTCP(addr)
+	if err != nil {
+		t.Fatalf("failed to listen, got %v\n", err)
+	}
+	defer s.Close()
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("failed to connect, got %v\n", err)
+	}
+	defer conn.Close()
+
+	frame := &TCPFrame{Device: 1, Function: ReadHoldingRegistersFC}
+	SetDataWithRegisterAndNumber(frame, 0, 1)
+	_, err = conn.Write(frame.Bytes())
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+
+	expect := conn.LocalAddr().String()
+	got := <-traces
+	if expect != got {
+		t.Errorf("expected %v, got %v", expect, got)
+	}
+}
+
+func TestDefaultContext(t *testing.T) {
+	s := NewServer()
+	var got context.Context
+	s.RegisterContextFunctionHandler(ReadCoilsFC,
+		func(ctx context.Context, s *Server, frame Framer) ([]byte, *Exception) {
+			got = ctx
+			return ReadCoils(s, frame)
+		})
+
+	addr := getFreePort()
+	err := s.ListenTCP(addr)
+	if err != nil {
+		t.Fatalf("failed to listen, got %v\n", err)
+	}
+	defer s.Close()
+
+	handler := modbus.NewTCPClientHandler(addr)
+	handler.SlaveId = 1
+	err = handler.Connect()
+	if err != nil {
+		t.Fatalf("failed to connect, got %v\n", err)
+	}
+	defer handler.Close()
+	_, err = modbus.NewClient(handler).ReadCoils(0, 1)
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if got != context.Background() {
+		t.Errorf("expected context.Background(), got %v", got)
+	}
+}
@@ -0,0 +1,59 @@
+package mbserver
+
+import (
+	"context"
+	"time"
+)
+
+// SetRequestDeadline bounds the time the server has, from the moment a
+// request was read, to process it and write the response. A request whose
+// handler returns after the deadline is answered with a SlaveDeviceFailure
+// exception. Context-aware handlers (see RegisterContextFunctionHandler) see
+// the deadline on their context and should return early: handlers are never
+// abandoned, as they hold the memory lock, so a handler ignoring the deadline
+// still delays the requests behind it. Changes made to memory by a handler
+// missing the deadline are kept. Writing the response is bounded by the same
+// deadline on TCP connections, which are closed if it is missed. A duration
+// of 0 (the default) disables the deadline.
+func (s *Server) SetRequestDeadline(d time.Duration) {
+	s.requestDeadline.Store(int64(d))
+}
+
+// callWithDeadline runs a function handler with the request deadline on its
+// context, and fails the request when the handler returned too late.
+func (s *Server) callWithDeadline(function func(context.Context, *Server, Framer) ([]byte, *Exception), request *Request, readOnly bool, d time.Duration) ([]byte, *Exception) {
+	ctx, cancel := context.WithDeadline(request.Context(), request.receivedAt().Add(d))
+	defer cancel()
+
+	data, exception := s.callLocked(ctx, function, request, readOnly)
+	if err := ctx.Err(); err != nil {
+		s.logger.Printf("function %v missed the request deadline: %v\n", request.frame.GetFunction(), err)
+		return []byte{}, &SlaveDeviceFailure
+	}
+	return data, exception
+}
+
+// setWriteDeadline bounds the write of the response to a TCP connection by
+// the request deadline.
+func (s *Server) setWriteDeadline(request *Request) {
+	d := time.Duration(s.requestDeadline.Load())
+	if d <= 0 {
+		return
+	}
+	client, ok := request.conn.(*clientConn)
+	if !ok {
+		return
+	}
+	if conn, ok := client.ReadWriteCloser.(interface{ SetWriteDeadline(time.Time) error }); ok {
+		conn.SetWriteDeadline(request.receivedAt().Add(d))
+	}
+}
+
+// receivedAt returns the time the request was read, now for requests built
+// without it.
+func (r *Request) receivedAt() time.Time {
+	if r.received.IsZero() {
+		return time.Now()
+	}
+	return r.received
+}
@@ -0,0 +1,59 @@
+package mbserver
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSetRequestDeadline(t *testing.T) {
+	s := NewServer(WithLogger(discardLogger{}))
+	s.SetRequestDeadline(20 * time.Millisecond)
+
+	s.RegisterFunctionHandler(0x41, func(s *Server, frame Framer) ([]byte, *Exception) {
+		time.Sleep(50 * time.Millisecond)
+		return []byte{}, &Success
+	})
+	var deadline time.Time
+	s.RegisterContextFunctionHandler(0x42, func(ctx context.Context, s *Server, frame Framer) ([]byte, *Exception) {
+		deadline, _ = ctx.Deadline()
+		return []byte{1}, &Success
+	})
+	s.RegisterContextFunctionHandler(0x43, func(ctx context.Context, s *Server, frame Framer) ([]byte, *Exception) {
+		<-ctx.Done()
+		return []byte{}, &Success
+	})
+
+	received := time.Now()
+	frame := &TCPFrame{Device: 1, Function: 0x42}
+	response := s.handle(&Request{frame: frame, received: received})
+	if exception := GetException(response); exception != Success {
+		t.Errorf("expected Success, got %v", exception.String())
+	}
+	if !deadline.Equal(received.Add(20 * time.Millisecond)) {
+		t.Errorf("expected the deadline %v, got %v", received.Add(20*time.Millisecond), deadline)
+	}
+
+	start := time.Now()
+	frame = &TCPFrame{Device: 1, Function: 0x43}
+	response = s.handle(&Request{frame: frame, received: start})
+	if exception := GetException(response); exception != SlaveDeviceFailure {
+		t.Errorf("expected SlaveDeviceFailure, got %v", exception.String())
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected the handler to return at the deadline, took %v", elapsed)
+	}
+
+	frame = &TCPFrame{Device: 1, Function: 0x41}
+	response = s.handle(&Request{frame: frame, received: time.Now()})
+	if exception := GetException(response); exception != SlaveDeviceFailure {
+		t.Errorf("expected SlaveDeviceFailure, got %v", exception.String())
+	}
+
+	// The slow handlers do not hold the memory lock past their requests.
+	frame = &TCPFrame{Device: 1, Function: WriteHoldingRegisterFC, Data: []byte{0, 2, 0, 3}}
+	response = s.handle(&Request{frame: frame, received: time.Now()})
+	if exception := GetException(response); exception != Success {
+		t.Errorf("expected the next request to succeed, got %v", exception.String())
+	}
+}
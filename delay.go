@@ -0,0 +1,61 @@
+package mbserver
+
+import (
+	"math/rand"
+	"time"
+)
+
+// SetResponseDelayForUnit delays the responses to the requests addressed to
+// one unit ID by d, to simulate a slow device among fast ones. The delay is
+// applied once the request was processed, before the response is written,
+// and on the goroutine handling requests: like on a serial line, requests
+// queued meanwhile wait too. A duration of 0 (the default) removes the delay.
+func (s *Server) SetResponseDelayForUnit(id uint8, d time.Duration) {
+	s.unitDelays[id].Store(int64(d))
+}
+
+// delayResponse waits for the response delay of the unit a request is
+// addressed to, and the delay injected for its function, see SetFaults.
+func (s *Server) delayResponse(frame Framer) {
+	d := time.Duration(s.unitDelays[frame.GetSlaveId()].Load()) + s.faultDelay(frame.GetFunction())
+	if d > 0 {
+		time.Sleep(d)
+	}
+}
+
+// SetResponseJitter delays every response by a uniformly random duration
+// between min and max, to model the processing time of a real device in
+// master performance tests. Unlike SetResponseDelayForUnit, the wait does not
+// hold up the goroutine handling requests: the next request is processed
+// meanwhile, so responses to pipelined TCP requests may be written out of
+// order. A max of 0 (the default) disables the jitter.
+func (s *Server) SetResponseJitter(min, max time.Duration) {
+	if max < min {
+		min, max = max, min
+	}
+	s.jitterLock.Lock()
+	s.jitterMin, s.jitterMax = min, max
+	s.jitterLock.Unlock()
+}
+
+// SetResponseJitterSeed seeds the random number generator choosing the
+// response jitter, making it reproducible.
+func (s *Server) SetResponseJitterSeed(seed int64) {
+	s.jitterLock.Lock()
+	s.jitterRand = rand.New(rand.NewSource(seed))
+	s.jitterLock.Unlock()
+}
+
+// responseJitter returns the jitter of the next response, 0 if disabled.
+func (s *Server) responseJitter() time.Duration {
+	s.jitterLock.Lock()
+	defer s.jitterLock.Unlock()
+
+	if s.jitterMax <= 0 {
+		return 0
+	}
+	if s.jitterRand == nil {
+		s.jitterRand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	return s.jitterMin + time.Duration(s.jitterRand.Int63n(int64(s.jitterMax-s.jitterMin)+1))
+}
@@ -0,0 +1,73 @@
+package mbserver
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSetResponseDelayForUnit(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.SetResponseDelayForUnit(1, 50*time.Millisecond)
+
+	request := []byte{0, 1, 0, 0, 0, 6, 1, 0x03, 0x00, 0x00, 0x00, 0x01}
+	start := time.Now()
+	if _, err := s.RoundTrip(request); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("expected the response to unit 1 to be delayed, got it after %v", elapsed)
+	}
+
+	// Other units are not delayed.
+	s.SetSlaveID(2)
+	request[6] = 2
+	start = time.Now()
+	if _, err := s.RoundTrip(request); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed >= 50*time.Millisecond {
+		t.Errorf("expected the response to unit 2 not to be delayed, got it after %v", elapsed)
+	}
+}
+
+func TestSetResponseJitter(t *testing.T) {
+	jitters := func(seed int64) []time.Duration {
+		s := NewServer()
+		defer s.Close()
+		s.SetResponseJitter(time.Millisecond, 5*time.Millisecond)
+		s.SetResponseJitterSeed(seed)
+		values := make([]time.Duration, 20)
+		for i := range values {
+			values[i] = s.responseJitter()
+			if values[i] < time.Millisecond || values[i] > 5*time.Millisecond {
+				t.Errorf("expected a jitter between 1ms and 5ms, got %v", values[i])
+			}
+		}
+		return values
+	}
+	if a, b := jitters(1), jitters(1); !isEqual(a, b) {
+		t.Errorf("expected the same jitters with the same seed, got %v and %v", a, b)
+	}
+
+	// Jittered responses do not hold up the other requests.
+	s := NewServer()
+	defer s.Close()
+	s.SetResponseJitter(100*time.Millisecond, 100*time.Millisecond)
+	start := time.Now()
+	done := make(chan error)
+	for i := 0; i < 4; i++ {
+		go func() {
+			_, err := s.RoundTrip([]byte{0, 1, 0, 0, 0, 6, 1, 0x03, 0x00, 0x00, 0x00, 0x01})
+			done <- err
+		}()
+	}
+	for i := 0; i < 4; i++ {
+		if err := <-done; err != nil {
+			t.Errorf("expected nil, got %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond || elapsed >= 300*time.Millisecond {
+		t.Errorf("expected the responses to be delayed concurrently, got them after %v", elapsed)
+	}
+}
@@ -0,0 +1,203 @@
+package mbserver
+
+import (
+	"fmt"
+	"sort"
+)
+
+const (
+	// EncapsulatedInterfaceTransportFC is function 43, which carries Read
+	// Device Identification.
+	EncapsulatedInterfaceTransportFC = 43
+	// ReadDeviceIdentificationMEI is the MEI type of Read Device
+	// Identification.
+	ReadDeviceIdentificationMEI = 0x0E
+)
+
+// Read Device ID codes of Read Device Identification requests.
+const (
+	ReadDeviceIDBasic      = 0x01
+	ReadDeviceIDRegular    = 0x02
+	ReadDeviceIDExtended   = 0x03
+	ReadDeviceIDIndividual = 0x04
+)
+
+// Object IDs of the basic and regular device identification objects.
+// Extended objects use IDs 0x80 to 0xFF.
+const (
+	VendorNameObject          = 0x00
+	ProductCodeObject         = 0x01
+	MajorMinorRevisionObject  = 0x02
+	VendorURLObject           = 0x03
+	ProductNameObject         = 0x04
+	ModelNameObject           = 0x05
+	UserApplicationNameObject = 0x06
+)
+
+const (
+	// maxDeviceIDData is the size of a response PDU without the function code.
+	maxDeviceIDData = 252
+	// deviceIDHeader is the size of the response fields before the objects.
+	deviceIDHeader = 6
+	// MaxDeviceIDObjectLength is the longest object value, which fills a
+	// response on its own.
+	MaxDeviceIDObjectLength = maxDeviceIDData - deviceIDHeader - 2
+)
+
+// SetDeviceIdentificationObject sets the value of a device identification
+// object served by Read Device Identification (function 43, MEI type 14).
+// An empty value removes the object. Until an object is set, requests return
+// IllegalFunction as for a device without device identification.
+func (s *Server) SetDeviceIdentificationObject(id uint8, value string) error {
+	if len(value) > MaxDeviceIDObjectLength {
+		return fmt.Errorf("device identification object 0x%02x is %d bytes long, at most %d are allowed", id, len(value), MaxDeviceIDObjectLength)
+	}
+
+	s.deviceIDLock.Lock()
+	defer s.deviceIDLock.Unlock()
+
+	if value == "" {
+		delete(s.deviceObjects, id)
+		return nil
+	}
+	if s.deviceObjects == nil {
+		s.deviceObjects = make(map[uint8]string)
+	}
+	s.deviceObjects[id] = value
+	return nil
+}
+
+// DeviceIdentification holds the device identification objects served by
+// Read Device Identification, see SetDeviceIdentification. Empty fields are
+// not served.
+type DeviceIdentification struct {
+	VendorName          string
+	ProductCode         string
+	MajorMinorRevision  string
+	VendorURL           string
+	ProductName         string
+	ModelName           string
+	UserApplicationName string
+	// Extended holds private objects, with IDs 0x80 to 0xFF.
+	Extended map[uint8]string
+}
+
+// SetDeviceIdentification replaces every device identification object with
+// the fields of identification. Nothing is changed when a value is too long
+// or an extended object ID is below 0x80.
+func (s *Server) SetDeviceIdentification(identification DeviceIdentification) error {
+	objects := map[uint8]string{
+		VendorNameObject:          identification.VendorName,
+		ProductCodeObject:         identification.ProductCode,
+		MajorMinorRevisionObject:  identification.MajorMinorRevision,
+		VendorURLObject:           identification.VendorURL,
+		ProductNameObject:         identification.ProductName,
+		ModelNameObject:           identification.ModelName,
+		UserApplicationNameObject: identification.UserApplicationName,
+	}
+	for id, value := range identification.Extended {
+		if id < 0x80 {
+			return fmt.Errorf("extended device identification object 0x%02x is not in 0x80-0xFF", id)
+		}
+		objects[id] = value
+	}
+	for id, value := range objects {
+		if len(value) > MaxDeviceIDObjectLength {
+			return fmt.Errorf("device identification object 0x%02x is %d bytes long, at most %d are allowed", id, len(value), MaxDeviceIDObjectLength)
+		}
+		if value == "" {
+			delete(objects, id)
+		}
+	}
+
+	s.deviceIDLock.Lock()
+	s.deviceObjects = objects
+	s.deviceIDLock.Unlock()
+	return nil
+}
+
+// ReadDeviceIdentification function 43 MEI type 14, reads the objects set
+// with SetDeviceIdentificationObject. Stream access (Read Device ID codes 1
+// to 3) returns the basic (0x00-0x02), regular (up to 0x7F) or extended (up
+// to 0xFF) objects from the requested object ID on, or from the first one
+// when the object ID is unknown. Objects that do not fit in the response are
+// left for a follow-up request: More Follows is then 0xFF and Next Object ID
+// the object to request. Individual access (code 4) returns a single object,
+// or IllegalDataAddress for an unknown one.
+func ReadDeviceIdentification(s *Server, frame Framer) ([]byte, *Exception) {
+	data := frame.GetData()
+	if len(data) < 3 {
+		return []byte{}, &IllegalDataValue
+	}
+	if data[0] != ReadDeviceIdentificationMEI {
+		return []byte{}, &IllegalFunction
+	}
+	code, objectID := data[1], data[2]
+
+	s.deviceIDLock.RLock()
+	objects := make(map[uint8]string, len(s.deviceObjects))
+	for id, value := range s.deviceObjects {
+		objects[id] = value
+	}
+	s.deviceIDLock.RUnlock()
+	if len(objects) == 0 {
+		return []byte{}, &IllegalFunction
+	}
+
+	var last uint8
+	switch code {
+	case ReadDeviceIDBasic:
+		last = MajorMinorRevisionObject
+	case ReadDeviceIDRegular:
+		last = 0x7F
+	case ReadDeviceIDExtended:
+		last = 0xFF
+	case ReadDeviceIDIndividual:
+		value, ok := objects[objectID]
+		if !ok {
+			return []byte{}, &IllegalDataAddress
+		}
+		response := []byte{ReadDeviceIdentificationMEI, code, conformityLevel(objects), 0x00, 0x00, 1}
+		return append(append(response, objectID, byte(len(value))), value...), &Success
+	default:
+		return []byte{}, &IllegalDataValue
+	}
+
+	if _, ok := objects[objectID]; !ok || objectID > last {
+		objectID = VendorNameObject
+	}
+	var ids []int
+	for id := range objects {
+		if id >= objectID && id <= last {
+			ids = append(ids, int(id))
+		}
+	}
+	sort.Ints(ids)
+
+	response := []byte{ReadDeviceIdentificationMEI, code, conformityLevel(objects), 0x00, 0x00, 0}
+	for _, id := range ids {
+		value := objects[uint8(id)]
+		if len(response)+2+len(value) > maxDeviceIDData {
+			response[3], response[4] = 0xFF, uint8(id)
+			break
+		}
+		response = append(append(response, uint8(id), byte(len(value))), value...)
+		response[5]++
+	}
+	return response, &Success
+}
+
+// conformityLevel returns the conformity level of the objects: the highest
+// category set, with individual access supported.
+func conformityLevel(objects map[uint8]string) byte {
+	level := byte(ReadDeviceIDBasic)
+	for id := range objects {
+		switch {
+		case id >= 0x80:
+			return 0x80 | ReadDeviceIDExtended
+		case id > MajorMinorRevisionObject:
+			level = ReadDeviceIDRegular
+		}
+	}
+	return 0x80 | level
+}
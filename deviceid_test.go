@@ -0,0 +1,132 @@
+package mbserver
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func readDeviceID(s *Server, code, objectID uint8) Framer {
+	frame := &TCPFrame{Device: 1, Function: EncapsulatedInterfaceTransportFC}
+	frame.SetData([]byte{ReadDeviceIdentificationMEI, code, objectID})
+	return s.handle(&Request{frame: frame})
+}
+
+func TestReadDeviceIdentification(t *testing.T) {
+	s := NewServer()
+	if exception := GetException(readDeviceID(s, ReadDeviceIDBasic, 0)); exception != IllegalFunction {
+		t.Errorf("expected IllegalFunction without objects, got %v", exception.String())
+	}
+
+	s.SetDeviceIdentificationObject(VendorNameObject, "ACME")
+	s.SetDeviceIdentificationObject(ProductCodeObject, "P1")
+	s.SetDeviceIdentificationObject(MajorMinorRevisionObject, "1.0")
+	s.SetDeviceIdentificationObject(ProductNameObject, "Pump")
+
+	tests := []struct {
+		code, objectID uint8
+		expect         []byte
+	}{
+		// Basic objects only, conformity level regular.
+		{ReadDeviceIDBasic, 0, []byte{0x0e, 1, 0x82, 0, 0, 3, 0, 4, 'A', 'C', 'M', 'E', 1, 2, 'P', '1', 2, 3, '1', '.', '0'}},
+		// From object 2 on.
+		{ReadDeviceIDRegular, 2, []byte{0x0e, 2, 0x82, 0, 0, 2, 2, 3, '1', '.', '0', 4, 4, 'P', 'u', 'm', 'p'}},
+		// An unknown object ID restarts at the first object.
+		{ReadDeviceIDBasic, 3, []byte{0x0e, 1, 0x82, 0, 0, 3, 0, 4, 'A', 'C', 'M', 'E', 1, 2, 'P', '1', 2, 3, '1', '.', '0'}},
+		{ReadDeviceIDIndividual, 4, []byte{0x0e, 4, 0x82, 0, 0, 1, 4, 4, 'P', 'u', 'm', 'p'}},
+	}
+	for _, test := range tests {
+		response := readDeviceID(s, test.code, test.objectID)
+		if exception := GetException(response); exception != Success {
+			t.Errorf("code %v object %v: expected Success, got %v", test.code, test.objectID, exception.String())
+			continue
+		}
+		if !isEqual(test.expect, response.GetData()) {
+			t.Errorf("code %v object %v: expected %v, got %v", test.code, test.objectID, test.expect, response.GetData())
+		}
+	}
+
+	if exception := GetException(readDeviceID(s, ReadDeviceIDIndividual, 0x80)); exception != IllegalDataAddress {
+		t.Errorf("expected IllegalDataAddress, got %v", exception.String())
+	}
+	if exception := GetException(readDeviceID(s, 5, 0)); exception != IllegalDataValue {
+		t.Errorf("expected IllegalDataValue, got %v", exception.String())
+	}
+	if err := s.SetDeviceIdentificationObject(0x80, strings.Repeat("x", MaxDeviceIDObjectLength+1)); err == nil {
+		t.Errorf("expected an error for a too long object")
+	}
+}
+
+func TestReadDeviceIdentificationContinuation(t *testing.T) {
+	s := NewServer()
+	s.SetDeviceIdentificationObject(VendorNameObject, "ACME")
+	s.SetDeviceIdentificationObject(ProductCodeObject, "P1")
+	s.SetDeviceIdentificationObject(MajorMinorRevisionObject, "1.0")
+	// 20 extended objects of 40 bytes, more than fit in one response.
+	for i := 0; i < 20; i++ {
+		s.SetDeviceIdentificationObject(uint8(0x80+i), fmt.Sprintf("%-40d", i))
+	}
+
+	objects := make(map[uint8]string)
+	objectID, requests := uint8(0), 0
+	for {
+		requests++
+		response := readDeviceID(s, ReadDeviceIDExtended, objectID)
+		if exception := GetException(response); exception != Success {
+			t.Fatalf("expected Success, got %v", exception.String())
+		}
+		data := response.GetData()
+		if len(data) > maxDeviceIDData {
+			t.Fatalf("expected a response of at most %d bytes, got %d", maxDeviceIDData, len(data))
+		}
+		if data[2] != 0x83 {
+			t.Errorf("expected conformity level 0x83, got 0x%02x", data[2])
+		}
+		object := data[6:]
+		for i := 0; i < int(data[5]); i++ {
+			objects[object[0]] = string(object[2 : 2+object[1]])
+			object = object[2+object[1]:]
+		}
+		if data[3] == 0x00 {
+			break
+		}
+		if data[3] != 0xFF || data[4] <= objectID {
+			t.Fatalf("expected More Follows and a next object ID, got %v", data[:6])
+		}
+		objectID = data[4]
+	}
+
+	if requests < 2 {
+		t.Errorf("expected the objects to be split across requests, got %d", requests)
+	}
+	if len(objects) != 23 || objects[0x93] != fmt.Sprintf("%-40d", 19) {
+		t.Errorf("expected every object to be read once, got %v", objects)
+	}
+}
+
+func TestSetDeviceIdentification(t *testing.T) {
+	s := NewServer()
+	s.SetDeviceIdentificationObject(ProductNameObject, "Old")
+	err := s.SetDeviceIdentification(DeviceIdentification{
+		VendorName:         "ACME",
+		ProductCode:        "P1",
+		MajorMinorRevision: "1.0",
+		Extended:           map[uint8]string{0x80: "x"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response := readDeviceID(s, ReadDeviceIDExtended, 0)
+	expect := []byte{0x0e, 3, 0x83, 0, 0, 4, 0, 4, 'A', 'C', 'M', 'E', 1, 2, 'P', '1', 2, 3, '1', '.', '0', 0x80, 1, 'x'}
+	if !isEqual(expect, response.GetData()) {
+		t.Errorf("expected %v, got %v", expect, response.GetData())
+	}
+
+	if err := s.SetDeviceIdentification(DeviceIdentification{Extended: map[uint8]string{0x10: "x"}}); err == nil {
+		t.Errorf("expected an error for a non extended object ID")
+	}
+	if response := readDeviceID(s, ReadDeviceIDIndividual, 0x80); !isEqual([]byte{0x0e, 4, 0x83, 0, 0, 1, 0x80, 1, 'x'}, response.GetData()) {
+		t.Errorf("expected the objects unchanged after an error, got %v", response.GetData())
+	}
+}
@@ -0,0 +1,117 @@
+package mbserver
+
+import "encoding/binary"
+
+// Diagnostics sub-function codes returning the communication counters, and
+// clearing them.
+const (
+	ClearCounters              = 0x0A
+	ReturnBusMessageCount      = 0x0B
+	ReturnBusCommErrorCount    = 0x0C
+	ReturnBusExceptionCount    = 0x0D
+	ReturnSlaveMessageCount    = 0x0E
+	ReturnSlaveNoResponseCount = 0x0F
+	ReturnSlaveNAKCount        = 0x10
+	ReturnSlaveBusyCount       = 0x11
+	ReturnBusOverrunCount      = 0x12
+	ClearOverrunCounter        = 0x14
+)
+
+// diagnosticCounters is the number of counters, from ReturnBusMessageCount to
+// ReturnBusOverrunCount.
+const diagnosticCounters = ReturnBusOverrunCount - ReturnBusMessageCount + 1
+
+// Counters are the communication counters of a server, as returned to
+// masters by the Diagnostics sub-functions 11 to 18. They count from the
+// creation of the server, Restart Communications, Clear Counters or
+// ResetCounters, and wrap around at 65535 as on a device.
+type Counters struct {
+	// BusMessages are the requests read from connections and serial ports,
+	// whatever their unit ID.
+	BusMessages uint16
+	// BusCommErrors are the frames discarded by serial ports, see
+	// OnSerialFrameError.
+	BusCommErrors uint16
+	// BusExceptions are the exception responses.
+	BusExceptions uint16
+	// SlaveMessages are the requests addressed to the server, broadcasts
+	// included.
+	SlaveMessages uint16
+	// SlaveNoResponses are the requests addressed to the server that were
+	// not answered, such as broadcasts or requests in listen only mode.
+	SlaveNoResponses uint16
+	// SlaveNAKs are the NegativeAcknowledge exception responses.
+	SlaveNAKs uint16
+	// SlaveBusy are the SlaveDeviceBusy exception responses.
+	SlaveBusy uint16
+	// BusOverruns are the character overruns, which the server cannot
+	// detect: it is always 0.
+	BusOverruns uint16
+}
+
+// Counters returns the communication counters.
+func (s *Server) Counters() Counters {
+	count := func(sub uint16) uint16 {
+		return uint16(s.diagCounters[sub-ReturnBusMessageCount].Load())
+	}
+	return Counters{
+		BusMessages:      count(ReturnBusMessageCount),
+		BusCommErrors:    count(ReturnBusCommErrorCount),
+		BusExceptions:    count(ReturnBusExceptionCount),
+		SlaveMessages:    count(ReturnSlaveMessageCount),
+		SlaveNoResponses: count(ReturnSlaveNoResponseCount),
+		SlaveNAKs:        count(ReturnSlaveNAKCount),
+		SlaveBusy:        count(ReturnSlaveBusyCount),
+		BusOverruns:      count(ReturnBusOverrunCount),
+	}
+}
+
+// ResetCounters clears the communication counters, as Clear Counters does.
+// The counters of Stats are not affected, see ResetStats.
+func (s *Server) ResetCounters() {
+	for i := range s.diagCounters {
+		s.diagCounters[i].Store(0)
+	}
+}
+
+// countDiagnostic increments the counter returned by a sub-function.
+func (s *Server) countDiagnostic(sub uint16) {
+	s.diagCounters[sub-ReturnBusMessageCount].Add(1)
+}
+
+// countException counts an exception response.
+func (s *Server) countException(exception *Exception) {
+	s.countDiagnostic(ReturnBusExceptionCount)
+	switch *exception {
+	case NegativeAcknowledge:
+		s.countDiagnostic(ReturnSlaveNAKCount)
+	case SlaveDeviceBusy:
+		s.countDiagnostic(ReturnSlaveBusyCount)
+	}
+}
+
+// returnCounter returns the sub-function answering a counter.
+func returnCounter(sub uint16) func(*Server, []byte) ([]byte, *Exception) {
+	return func(s *Server, data []byte) ([]byte, *Exception) {
+		if len(data) < 2 || binary.BigEndian.Uint16(data[0:2]) != 0 {
+			return []byte{}, &IllegalDataValue
+		}
+		return binary.BigEndian.AppendUint16(nil, uint16(s.diagCounters[sub-ReturnBusMessageCount].Load())), &Success
+	}
+}
+
+func clearCounters(s *Server, data []byte) ([]byte, *Exception) {
+	if len(data) < 2 || binary.BigEndian.Uint16(data[0:2]) != 0 {
+		return []byte{}, &IllegalDataValue
+	}
+	s.ResetCounters()
+	return append([]byte(nil), data[0:2]...), &Success
+}
+
+func clearOverrunCounter(s *Server, data []byte) ([]byte, *Exception) {
+	if len(data) < 2 || binary.BigEndian.Uint16(data[0:2]) != 0 {
+		return []byte{}, &IllegalDataValue
+	}
+	s.diagCounters[ReturnBusOverrunCount-ReturnBusMessageCount].Store(0)
+	return append([]byte(nil), data[0:2]...), &Success
+}
@@ -0,0 +1,86 @@
+package mbserver
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestCounters(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.SetStartupBusy(1)
+
+	conn, line := net.Pipe()
+	defer line.Close()
+	go s.ServeConn(conn, FramingRTU)
+
+	exchange := func(request *RTUFrame) []byte {
+		t.Helper()
+		line.Write(request.Bytes())
+		if request.Address == BroadcastUnitID || request.Address == 2 {
+			return nil
+		}
+		line.SetReadDeadline(time.Now().Add(time.Second))
+		response := make([]byte, 256)
+		n, err := line.Read(response)
+		if err != nil && err != io.EOF {
+			t.Fatalf("expected a response, got %v", err)
+		}
+		return response[:n]
+	}
+
+	exchange(BuildRTUFrame(1, ReadHoldingRegistersFC, []byte{0, 0, 0, 1}))
+	exchange(BuildRTUFrame(1, ReadHoldingRegistersFC, []byte{0xff, 0xff, 0, 2}))
+	exchange(BuildRTUFrame(2, ReadHoldingRegistersFC, []byte{0, 0, 0, 1}))
+	exchange(BuildRTUFrame(BroadcastUnitID, WriteHoldingRegisterFC, []byte{0, 0, 0, 1}))
+	line.Write([]byte{1, 3, 0, 0, 0, 1, 0, 0})
+	exchange(BuildRTUFrame(1, ReadHoldingRegistersFC, []byte{0, 0, 0, 1}))
+
+	expect := Counters{BusMessages: 5, BusCommErrors: 1, BusExceptions: 2, SlaveMessages: 4, SlaveNoResponses: 1, SlaveBusy: 1}
+	if counters := s.Counters(); counters != expect {
+		t.Errorf("expected %+v, got %+v", expect, counters)
+	}
+
+	// The Diagnostics request is counted before it is answered.
+	response := exchange(BuildRTUFrame(1, DiagnosticsFC, []byte{0, ReturnSlaveMessageCount, 0, 0}))
+	if expect := BuildRTUFrame(1, DiagnosticsFC, []byte{0, ReturnSlaveMessageCount, 0, 5}).Bytes(); !isEqual(expect, response) {
+		t.Errorf("expected %v, got %v", expect, response)
+	}
+	response = exchange(BuildRTUFrame(1, DiagnosticsFC, []byte{0, ReturnBusExceptionCount, 0, 1}))
+	if expect := BuildRTUFrame(1, DiagnosticsFC|0x80, []byte{byte(IllegalDataValue)}).Bytes(); !isEqual(expect, response) {
+		t.Errorf("expected IllegalDataValue, got %v", response)
+	}
+
+	response = exchange(BuildRTUFrame(1, DiagnosticsFC, []byte{0, ClearCounters, 0, 0}))
+	if expect := BuildRTUFrame(1, DiagnosticsFC, []byte{0, ClearCounters, 0, 0}).Bytes(); !isEqual(expect, response) {
+		t.Errorf("expected %v, got %v", expect, response)
+	}
+	if counters := s.Counters(); counters != (Counters{}) {
+		t.Errorf("expected the counters to be cleared, got %+v", counters)
+	}
+}
+
+func TestResetCounters(t *testing.T) {
+	s := NewServer()
+	frame := &TCPFrame{Device: 1, Function: ReadHoldingRegistersFC}
+	SetDataWithRegisterAndNumber(frame, 0xffff, 2)
+	s.handle(&Request{frame: frame})
+	if s.Counters().BusExceptions != 1 {
+		t.Fatalf("expected 1 exception, got %+v", s.Counters())
+	}
+
+	s.ResetCounters()
+	if counters := s.Counters(); counters != (Counters{}) {
+		t.Errorf("expected the counters to be cleared, got %+v", counters)
+	}
+
+	s.handle(&Request{frame: frame})
+	frame = &TCPFrame{Device: 1, Function: DiagnosticsFC}
+	frame.SetData([]byte{0, RestartCommunications, 0, 0})
+	s.handle(&Request{frame: frame})
+	if counters := s.Counters(); counters != (Counters{}) {
+		t.Errorf("expected Restart Communications to clear the counters, got %+v", counters)
+	}
+}
@@ -0,0 +1,148 @@
+package mbserver
+
+import (
+	"encoding/binary"
+)
+
+// Default range of the Enron (Daniel) 32-bit holding registers, protocol
+// addresses 7000-7999 (registers 7001-8000 in one-based notation).
+const (
+	DefaultEnronStart = 7000
+	DefaultEnronEnd   = 7999
+
+	// MaxReadEnronRegisters is the maximum number of 32-bit values a Read
+	// Holding Registers response may hold.
+	MaxReadEnronRegisters = MaxReadRegisters / 2
+	// MaxWriteEnronRegisters is the maximum number of 32-bit values a Write
+	// Multiple Registers request may hold.
+	MaxWriteEnronRegisters = MaxWriteRegisters / 2
+)
+
+// SetEnronMode enables or disables the Enron Modbus convention used by some
+// flow computers, where each holding register address in the Enron range (see
+// SetEnronRange) holds a 32-bit value instead of a 16-bit one.
+//
+// While enabled, Read Holding Registers (function 3), Write Single Register
+// (function 6) and Write Multiple Registers (function 16) requests starting in
+// the range count quantities in 32-bit values and carry 4 bytes per value,
+// most significant word first. Requests that cross the bounds of the range
+// return an IllegalDataAddress exception. The 32-bit values are kept apart
+// from HoldingRegisters and accessed with EnronRegister and SetEnronRegister.
+// Write validators and callbacks see each value as two registers, most
+// significant word first.
+//
+// Enron mode is disabled by default.
+func (s *Server) SetEnronMode(enabled bool) {
+	s.memoryLock.Lock()
+	defer s.memoryLock.Unlock()
+
+	s.enronMode = enabled
+	if s.enronEnd == 0 {
+		s.enronStart, s.enronEnd = DefaultEnronStart, DefaultEnronEnd
+	}
+}
+
+// SetEnronRange sets the first and last holding register addresses holding
+// 32-bit values in Enron mode. The default range is DefaultEnronStart to
+// DefaultEnronEnd.
+func (s *Server) SetEnronRange(start, end uint16) {
+	s.memoryLock.Lock()
+	s.enronStart, s.enronEnd = start, end
+	s.memoryLock.Unlock()
+}
+
+// EnronRegister returns the 32-bit value at an Enron register address.
+func (s *Server) EnronRegister(address uint16) uint32 {
+	s.memoryLock.RLock()
+	defer s.memoryLock.RUnlock()
+	return s.enronValues[address]
+}
+
+// SetEnronRegister sets the 32-bit value at an Enron register address.
+func (s *Server) SetEnronRegister(address uint16, value uint32) {
+	s.memoryLock.Lock()
+	defer s.memoryLock.Unlock()
+	s.setEnronValue(address, value)
+}
+
+func (s *Server) setEnronValue(address uint16, value uint32) {
+	if s.enronValues == nil {
+		s.enronValues = make(map[uint16]uint32)
+	}
+	s.enronValues[address] = value
+}
+
+// inEnronRange reports whether a request starting at the register address is
+// handled by the Enron convention. It is called with the memory lock held.
+func (s *Server) inEnronRange(register int) bool {
+	return s.enronMode && register >= int(s.enronStart) && register <= int(s.enronEnd)
+}
+
+// checkEnronRange checks a request for quantity 32-bit values starting at
+// register.
+func (s *Server) checkEnronRange(register, quantity, limit int) *Exception {
+	if quantity == 0 || quantity > limit {
+		return &IllegalDataValue
+	}
+	if register+quantity-1 > int(s.enronEnd) {
+		return &IllegalDataAddress
+	}
+	return nil
+}
+
+// enronWords splits 32-bit values into their most and least significant words.
+func enronWords(values []uint32) []uint16 {
+	words := make([]uint16, 0, len(values)*2)
+	for _, value := range values {
+		words = append(words, uint16(value>>16), uint16(value))
+	}
+	return words
+}
+
+func readEnronRegisters(s *Server, register, numRegs int) ([]byte, *Exception) {
+	if exception := s.checkEnronRange(register, numRegs, MaxReadEnronRegisters); exception != nil {
+		return []byte{}, exception
+	}
+	data := make([]byte, 1+numRegs*4)
+	data[0] = byte(numRegs * 4)
+	for i := 0; i < numRegs; i++ {
+		binary.BigEndian.PutUint32(data[1+i*4:], s.enronValues[uint16(register+i)])
+	}
+	return data, &Success
+}
+
+func writeEnronRegister(s *Server, frame Framer, register int) ([]byte, *Exception) {
+	data := frame.GetData()
+	if len(data) < 6 {
+		return []byte{}, &IllegalDataValue
+	}
+	value := binary.BigEndian.Uint32(data[2:6])
+	return writeEnronValues(s, frame, register, []uint32{value}, data[0:6])
+}
+
+func writeEnronRegisters(s *Server, frame Framer, register, numRegs int) ([]byte, *Exception) {
+	if exception := s.checkEnronRange(register, numRegs, MaxWriteEnronRegisters); exception != nil {
+		return []byte{}, exception
+	}
+	data := frame.GetData()
+	if len(data) < 5 || int(data[4]) != numRegs*4 || len(data[5:]) < numRegs*4 {
+		return []byte{}, &IllegalDataValue
+	}
+	values := make([]uint32, numRegs)
+	for i := range values {
+		values[i] = binary.BigEndian.Uint32(data[5+i*4:])
+	}
+	return writeEnronValues(s, frame, register, values, data[0:4])
+}
+
+func writeEnronValues(s *Server, frame Framer, register int, values []uint32, response []byte) ([]byte, *Exception) {
+	words := enronWords(values)
+	if exception := s.validateWrite(register, words, HoldingRegister); exception != nil {
+		return []byte{}, exception
+	}
+	for i, value := range values {
+		s.setEnronValue(uint16(register+i), value)
+	}
+	s.notifyWrite(frame, HoldingRegister, register, words)
+	return response, &Success
+}
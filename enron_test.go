@@ -0,0 +1,82 @@
+package mbserver
+
+import "testing"
+
+func TestEnronMode(t *testing.T) {
+	s := NewServer()
+	s.SetEnronMode(true)
+	s.SetEnronRegister(7000, 0x12345678)
+
+	frame := &TCPFrame{Device: 1, Function: ReadHoldingRegistersFC}
+	SetDataWithRegisterAndNumber(frame, 7000, 2)
+	response := s.handle(&Request{frame: frame})
+	if exception := GetException(response); exception != Success {
+		t.Fatalf("expected Success, got %v", exception.String())
+	}
+	expect := []byte{8, 0x12, 0x34, 0x56, 0x78, 0, 0, 0, 0}
+	if !isEqual(expect, response.GetData()) {
+		t.Errorf("expected %v, got %v", expect, response.GetData())
+	}
+
+	// Function 6 carries a 32-bit value.
+	frame = &TCPFrame{Device: 1, Function: WriteHoldingRegisterFC}
+	frame.SetData([]byte{0x1b, 0x59, 0xde, 0xad, 0xbe, 0xef})
+	response = s.handle(&Request{frame: frame})
+	if exception := GetException(response); exception != Success {
+		t.Fatalf("expected Success, got %v", exception.String())
+	}
+	if !isEqual(frame.Data, response.GetData()) {
+		t.Errorf("expected the request to be echoed, got %v", response.GetData())
+	}
+	if s.EnronRegister(7001) != 0xdeadbeef {
+		t.Errorf("expected 0xdeadbeef, got %#x", s.EnronRegister(7001))
+	}
+	if s.HoldingRegisters[7001] != 0 || s.HoldingRegisters[7002] != 0 {
+		t.Errorf("expected the 16-bit holding registers to be left alone")
+	}
+
+	// Registers outside the range keep 16-bit semantics.
+	frame = &TCPFrame{Device: 1, Function: ReadHoldingRegistersFC}
+	SetDataWithRegisterAndNumber(frame, 6999, 2)
+	response = s.handle(&Request{frame: frame})
+	if !isEqual([]byte{4, 0, 0, 0, 0}, response.GetData()) {
+		t.Errorf("expected 16-bit registers, got %v", response.GetData())
+	}
+
+	// Crossing the end of the range.
+	SetDataWithRegisterAndNumber(frame, 7999, 2)
+	response = s.handle(&Request{frame: frame})
+	if exception := GetException(response); exception != IllegalDataAddress {
+		t.Errorf("expected IllegalDataAddress, got %v", exception.String())
+	}
+}
+
+func TestEnronWriteMultipleRegisters(t *testing.T) {
+	s := NewServer()
+	s.SetEnronMode(true)
+	s.SetEnronRange(5000, 5099)
+
+	frame := &TCPFrame{Device: 1, Function: WriteHoldingRegistersFC}
+	frame.SetData([]byte{0x13, 0x88, 0, 2, 8, 0, 0, 0, 1, 0xff, 0xff, 0xff, 0xfe})
+	response := s.handle(&Request{frame: frame})
+	if exception := GetException(response); exception != Success {
+		t.Fatalf("expected Success, got %v", exception.String())
+	}
+	if s.EnronRegister(5000) != 1 || s.EnronRegister(5001) != 0xfffffffe {
+		t.Errorf("expected 1 and 0xfffffffe, got %v and %#x", s.EnronRegister(5000), s.EnronRegister(5001))
+	}
+
+	// A byte count for 16-bit registers is rejected.
+	frame.SetData([]byte{0x13, 0x88, 0, 2, 4, 0, 0, 0, 1})
+	response = s.handle(&Request{frame: frame})
+	if exception := GetException(response); exception != IllegalDataValue {
+		t.Errorf("expected IllegalDataValue, got %v", exception.String())
+	}
+
+	s.SetEnronMode(false)
+	frame.SetData([]byte{0x13, 0x88, 0, 2, 4, 0, 3, 0, 4})
+	s.handle(&Request{frame: frame})
+	if !isEqual([]uint16{3, 4}, s.HoldingRegisters[5000:5002]) {
+		t.Errorf("expected 16-bit writes when disabled, got %v", s.HoldingRegisters[5000:5002])
+	}
+}
@@ -0,0 +1,47 @@
+package mbserver
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrAddressOutOfRange is returned when an address range extends beyond
+	// the allocated memory.
+	ErrAddressOutOfRange = errors.New("address out of range")
+	// ErrQuantityExceedsLimit is returned when the number of coils or
+	// registers requested is zero or above the limit for the operation.
+	ErrQuantityExceedsLimit = errors.New("quantity exceeds limit")
+	// ErrNoResponse is returned by RoundTrip when the server did not answer
+	// the request.
+	ErrNoResponse = errors.New("no response")
+	// ErrServerClosed is returned by RoundTrip once the server was shut down.
+	ErrServerClosed = errors.New("server closed")
+)
+
+// checkRange validates quantity items from address against a memory map of
+// size items and a per request limit.
+func checkRange(address int, quantity int, size int, limit int) error {
+	if quantity < 1 || quantity > limit {
+		return fmt.Errorf("%w: quantity %d, limit %d", ErrQuantityExceedsLimit, quantity, limit)
+	}
+	if address < 0 || address+quantity > size {
+		return fmt.Errorf("%w: %d-%d, size %d", ErrAddressOutOfRange, address, address+quantity-1, size)
+	}
+	return nil
+}
+
+// exceptionFromError translates an error into the Modbus exception returned
+// to the master.
+func exceptionFromError(err error) *Exception {
+	switch {
+	case err == nil:
+		return &Success
+	case errors.Is(err, ErrQuantityExceedsLimit):
+		return &IllegalDataValue
+	case errors.Is(err, ErrAddressOutOfRange):
+		return &IllegalDataAddress
+	default:
+		return &SlaveDeviceFailure
+	}
+}
@@ -0,0 +1,31 @@
+package mbserver
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckRange(t *testing.T) {
+	tests := []struct {
+		address, quantity, size, limit int
+		err                            error
+		exception                      Exception
+	}{
+		{0, 125, MaxRegisterSize, MaxReadRegisters, nil, Success},
+		{0, 126, MaxRegisterSize, MaxReadRegisters, ErrQuantityExceedsLimit, IllegalDataValue},
+		{0, 0, MaxRegisterSize, MaxReadRegisters, ErrQuantityExceedsLimit, IllegalDataValue},
+		{65535, 2, MaxRegisterSize, MaxReadRegisters, ErrAddressOutOfRange, IllegalDataAddress},
+		{99, 1, 100, 1, nil, Success},
+		{100, 1, 100, 1, ErrAddressOutOfRange, IllegalDataAddress},
+	}
+	for _, test := range tests {
+		err := checkRange(test.address, test.quantity, test.size, test.limit)
+		if !errors.Is(err, test.err) {
+			t.Errorf("%+v: expected %v, got %v", test, test.err, err)
+		}
+		exception := exceptionFromError(err)
+		if *exception != test.exception {
+			t.Errorf("%+v: expected %v, got %v", test, test.exception.String(), exception.String())
+		}
+	}
+}
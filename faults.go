@@ -0,0 +1,171 @@
+package mbserver
+
+import (
+	"math/rand"
+	"strings"
+	"time"
+)
+
+type errorInjection struct {
+	rate      float64
+	exception *Exception
+}
+
+// SetErrorInjection makes requests for a function code fail with exception
+// instead of being processed, with probability rate (0 to 1). A rate of 0 or
+// a nil exception disables injection for the function code.
+func (s *Server) SetErrorInjection(funcCode uint8, rate float64, exception *Exception) {
+	s.faultsLock.Lock()
+	defer s.faultsLock.Unlock()
+
+	if rate <= 0 || exception == nil {
+		delete(s.errorInjections, funcCode)
+		return
+	}
+	if s.errorInjections == nil {
+		s.errorInjections = make(map[uint8]errorInjection)
+	}
+	s.errorInjections[funcCode] = errorInjection{rate: rate, exception: exception}
+}
+
+// SetErrorInjectionSeed seeds the random number generator deciding which
+// requests fail, making error injection reproducible.
+func (s *Server) SetErrorInjectionSeed(seed int64) {
+	s.faultsLock.Lock()
+	s.faultsRand = rand.New(rand.NewSource(seed))
+	s.faultsLock.Unlock()
+}
+
+// SetRTUCRCCorruption makes responses sent over serial ports carry a wrong
+// CRC, or a wrong LRC with ASCII framing, with probability rate (0 to 1), so
+// that masters can be tested for discarding damaged frames and retrying. A
+// rate of 0 (the default) disables corruption. Responses on TCP connections
+// are never altered.
+func (s *Server) SetRTUCRCCorruption(rate float64) {
+	s.faultsLock.Lock()
+	s.crcCorruption = rate
+	s.faultsLock.Unlock()
+}
+
+// FaultConfig describes the faults injected into the requests for a
+// function code, see SetFaults.
+type FaultConfig struct {
+	// Delay delays the responses, on top of SetResponseDelayForUnit.
+	Delay time.Duration
+	// ExceptionRate is the probability (0 to 1) of answering with Exception
+	// instead of processing the request, as set by SetErrorInjection.
+	ExceptionRate float64
+	// Exception is the injected exception, SlaveDeviceFailure when nil.
+	Exception *Exception
+	// DropRate is the probability (0 to 1) of not answering a processed
+	// request, as if the response was lost, to test master timeouts and
+	// retries.
+	DropRate float64
+}
+
+type functionFault struct {
+	delay    time.Duration
+	dropRate float64
+}
+
+// SetFaults sets the faults injected into the requests for a function code,
+// replacing those set before, including by SetErrorInjection. The zero
+// FaultConfig removes them. Corrupted CRCs on serial ports are set for every
+// function with SetRTUCRCCorruption.
+//
+//	s.SetFaults(mbserver.ReadHoldingRegistersFC, mbserver.FaultConfig{Delay: 500 * time.Millisecond, ExceptionRate: 0.1})
+func (s *Server) SetFaults(funcCode uint8, config FaultConfig) {
+	exception := config.Exception
+	if exception == nil {
+		exception = &SlaveDeviceFailure
+	}
+	s.SetErrorInjection(funcCode, config.ExceptionRate, exception)
+
+	s.faultsLock.Lock()
+	defer s.faultsLock.Unlock()
+
+	if config.Delay <= 0 && config.DropRate <= 0 {
+		delete(s.functionFaults, funcCode)
+		return
+	}
+	if s.functionFaults == nil {
+		s.functionFaults = make(map[uint8]functionFault)
+	}
+	s.functionFaults[funcCode] = functionFault{delay: config.Delay, dropRate: config.DropRate}
+}
+
+// faultDelay returns the injected delay of the responses for a function code.
+func (s *Server) faultDelay(funcCode uint8) time.Duration {
+	s.faultsLock.Lock()
+	defer s.faultsLock.Unlock()
+	return s.functionFaults[funcCode].delay
+}
+
+// dropResponse reports whether the response to a request for a function
+// code is to be dropped.
+func (s *Server) dropResponse(funcCode uint8) bool {
+	s.faultsLock.Lock()
+	defer s.faultsLock.Unlock()
+
+	fault, ok := s.functionFaults[funcCode]
+	if !ok || fault.dropRate <= 0 {
+		return false
+	}
+	if s.faultsRand == nil {
+		s.faultsRand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	return s.faultsRand.Float64() < fault.dropRate
+}
+
+// responseBytes returns the byte stream of a response, with the CRC or LRC
+// corrupted when CRC corruption triggers.
+func (s *Server) responseBytes(response Framer) []byte {
+	bytes := response.Bytes()
+	_, rtu := response.(*RTUFrame)
+	_, ascii := response.(*ASCIIFrame)
+	if !rtu && !ascii {
+		return bytes
+	}
+
+	s.faultsLock.Lock()
+	defer s.faultsLock.Unlock()
+
+	if s.crcCorruption <= 0 {
+		return bytes
+	}
+	if s.faultsRand == nil {
+		s.faultsRand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	if s.faultsRand.Float64() >= s.crcCorruption {
+		return bytes
+	}
+	if rtu {
+		// Flipping every bit of the low byte always yields an invalid CRC.
+		bytes[len(bytes)-2] ^= 0xff
+		return bytes
+	}
+	// Likewise for the LRC, written as two hexadecimal digits before CRLF.
+	for i := len(bytes) - 4; i < len(bytes)-2; i++ {
+		bytes[i] = upperHex[15-strings.IndexByte(upperHex, bytes[i])]
+	}
+	return bytes
+}
+
+// injectedError returns the exception to answer a request with, nil when the
+// request should be processed.
+func (s *Server) injectedError(funcCode uint8) *Exception {
+	s.faultsLock.Lock()
+	defer s.faultsLock.Unlock()
+
+	injection, ok := s.errorInjections[funcCode]
+	if !ok {
+		return nil
+	}
+	if s.faultsRand == nil {
+		s.faultsRand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	if s.faultsRand.Float64() < injection.rate {
+		return injection.exception
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package mbserver
+
+import (
+	"testing"
+	"time"
+)
+
+func injectedFailures(s *Server, n int) []bool {
+	frame := &TCPFrame{Device: 1, Function: ReadHoldingRegistersFC}
+	SetDataWithRegisterAndNumber(frame, 0, 1)
+
+	failures := make([]bool, n)
+	for i := range failures {
+		response := s.handle(&Request{frame: frame})
+		failures[i] = GetException(response) == SlaveDeviceBusy
+	}
+	return failures
+}
+
+func TestErrorInjection(t *testing.T) {
+	s := NewServer()
+	s.SetErrorInjectionSeed(42)
+	s.SetErrorInjection(ReadHoldingRegistersFC, 0.5, &SlaveDeviceBusy)
+
+	first := injectedFailures(s, 100)
+	failed := 0
+	for _, f := range first {
+		if f {
+			failed++
+		}
+	}
+	if failed < 25 || failed > 75 {
+		t.Errorf("expected about half of the requests to fail, got %v", failed)
+	}
+
+	// The same seed produces the same failures.
+	s.SetErrorInjectionSeed(42)
+	second := injectedFailures(s, 100)
+	if !isEqual(first, second) {
+		t.Errorf("expected reproducible failures, got %v and %v", first, second)
+	}
+
+	// Other function codes are not affected.
+	frame := &TCPFrame{Device: 1, Function: ReadInputRegistersFC}
+	SetDataWithRegisterAndNumber(frame, 0, 1)
+	for i := 0; i < 20; i++ {
+		if exception := GetException(s.handle(&Request{frame: frame})); exception != Success {
+			t.Fatalf("expected Success, got %v", exception.String())
+		}
+	}
+
+	s.SetErrorInjection(ReadHoldingRegistersFC, 0, nil)
+	for _, f := range injectedFailures(s, 20) {
+		if f {
+			t.Fatalf("expected no failures once disabled")
+		}
+	}
+}
+
+func TestRTUCRCCorruption(t *testing.T) {
+	s := NewServer()
+	response := &RTUFrame{Address: 1, Function: ReadHoldingRegistersFC, Data: []byte{2, 0, 7}}
+
+	if _, err := NewRTUFrame(s.responseBytes(response)); err != nil {
+		t.Errorf("expected a valid CRC by default, got %v", err)
+	}
+
+	s.SetRTUCRCCorruption(1)
+	if _, err := NewRTUFrame(s.responseBytes(response)); err == nil {
+		t.Errorf("expected a corrupted CRC")
+	}
+	ascii := &ASCIIFrame{Address: 1, Function: ReadHoldingRegistersFC, Data: []byte{2, 0, 7}}
+	if _, err := NewASCIIFrame(s.responseBytes(ascii)); err == nil {
+		t.Errorf("expected a corrupted LRC")
+	}
+
+	tcp := &TCPFrame{Device: 1, Function: ReadHoldingRegistersFC, Data: []byte{2, 0, 7}}
+	if !isEqual(tcp.Bytes(), s.responseBytes(tcp)) {
+		t.Errorf("expected TCP responses to be left alone")
+	}
+}
+
+func TestSetFaults(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	frame := &TCPFrame{Device: 1, Function: ReadHoldingRegistersFC}
+	SetDataWithRegisterAndNumber(frame, 0, 1)
+
+	s.SetFaults(ReadHoldingRegistersFC, FaultConfig{ExceptionRate: 1})
+	if response, _ := s.Dispatch(frame); GetException(response) != SlaveDeviceFailure {
+		t.Errorf("expected SlaveDeviceFailure, got %v", GetException(response).String())
+	}
+
+	s.SetFaults(ReadHoldingRegistersFC, FaultConfig{DropRate: 1})
+	if response, send := s.Dispatch(frame); send || GetException(response) != Success {
+		t.Errorf("expected the processed request not to be answered, got %v", send)
+	}
+
+	s.SetFaults(ReadHoldingRegistersFC, FaultConfig{Delay: 50 * time.Millisecond})
+	start := time.Now()
+	if _, err := s.RoundTrip(frame.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("expected the response to be delayed, got %v", elapsed)
+	}
+
+	s.SetFaults(ReadHoldingRegistersFC, FaultConfig{})
+	start = time.Now()
+	if response, send := s.Dispatch(frame); !send || GetException(response) != Success {
+		t.Errorf("expected the faults to be removed")
+	}
+	if _, err := s.RoundTrip(frame.Bytes()); err != nil || time.Since(start) >= 50*time.Millisecond {
+		t.Errorf("expected an immediate response, got %v after %v", err, time.Since(start))
+	}
+}
@@ -0,0 +1,31 @@
+package mbserver
+
+// MaxFIFOCount is the maximum number of values a Read FIFO Queue response may
+// hold.
+const MaxFIFOCount = 31
+
+// SetFIFOQueue sets the values returned by Read FIFO Queue (function 24) for
+// the FIFO pointer address. The values are copied. Passing nil values removes
+// the queue.
+func (s *Server) SetFIFOQueue(address uint16, values []uint16) {
+	s.fifoLock.Lock()
+	defer s.fifoLock.Unlock()
+
+	if values == nil {
+		delete(s.fifoQueues, address)
+		return
+	}
+	if s.fifoQueues == nil {
+		s.fifoQueues = make(map[uint16][]uint16)
+	}
+	s.fifoQueues[address] = append([]uint16(nil), values...)
+}
+
+// fifoQueue returns the values of the queue at the FIFO pointer address.
+func (s *Server) fifoQueue(address uint16) ([]uint16, bool) {
+	s.fifoLock.Lock()
+	defer s.fifoLock.Unlock()
+
+	values, ok := s.fifoQueues[address]
+	return values, ok
+}
@@ -0,0 +1,93 @@
+package mbserver
+
+// FillCoils sets every coil on or off.
+func (s *Server) FillCoils(on bool) {
+	s.fillBank(Coil, boolValue(on))
+}
+
+// FillDiscreteInputs sets every discrete input on or off.
+func (s *Server) FillDiscreteInputs(on bool) {
+	s.fillBank(DiscreteInput, boolValue(on))
+}
+
+// FillHoldingRegisters sets every holding register to value.
+func (s *Server) FillHoldingRegisters(value uint16) {
+	s.fillBank(HoldingRegister, value)
+}
+
+// FillInputRegisters sets every input register to value.
+func (s *Server) FillInputRegisters(value uint16) {
+	s.fillBank(InputRegister, value)
+}
+
+// fillBank sets a whole memory map to value. It waits for the request being
+// processed, so it is safe to call while serving but not from a function
+// handler.
+func (s *Server) fillBank(kind RegisterKind, value uint16) {
+	s.memoryLock.Lock()
+	defer s.memoryLock.Unlock()
+	s.fill(kind, value)
+}
+
+// fill sets a whole memory map to value, with the memory lock held.
+func (s *Server) fill(kind RegisterKind, value uint16) {
+	if s.store != nil {
+		s.fillStore(kind, value)
+		return
+	}
+	if s.sparse != nil {
+		values := make(map[uint16]uint16)
+		if value != 0 {
+			for i := 0; i < s.sparse.size[kind]; i++ {
+				values[uint16(i)] = value
+			}
+		}
+		s.sparse.values[kind] = values
+		return
+	}
+	var bits []byte
+	var registers []uint16
+	switch kind {
+	case Coil:
+		bits = s.Coils
+	case DiscreteInput:
+		bits = s.DiscreteInputs
+	case HoldingRegister:
+		registers = s.HoldingRegisters
+	case InputRegister:
+		registers = s.InputRegisters
+	}
+	for i := range bits {
+		bits[i] = byte(value)
+	}
+	for i := range registers {
+		registers[i] = value
+	}
+}
+
+// fillStore writes value to a whole memory map of a store, in chunks.
+func (s *Server) fillStore(kind RegisterKind, value uint16) {
+	const chunk = 1024
+	values := make([]uint16, chunk)
+	for i := range values {
+		values[i] = value
+	}
+	size := s.bankSize(kind)
+	for address := 0; address < size; address += chunk {
+		n := size - address
+		if n > chunk {
+			n = chunk
+		}
+		if err := s.writeRegisters(kind, address, values[:n]); err != nil {
+			s.logger.Printf("failed to fill %v: %v\n", kind, err)
+			return
+		}
+	}
+}
+
+func boolValue(on bool) uint16 {
+	if on {
+		return 1
+	}
+	return 0
+}
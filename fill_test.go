@@ -0,0 +1,54 @@
+package mbserver
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestFill(t *testing.T) {
+	s := NewServer(WithCoilCount(10))
+	s.FillCoils(true)
+	s.FillHoldingRegisters(0xffff)
+	if !isEqual([]byte{1, 1, 1, 1, 1, 1, 1, 1, 1, 1}, s.Coils) {
+		t.Errorf("expected all coils on, got %v", s.Coils)
+	}
+	if s.HoldingRegisters[0] != 0xffff || s.HoldingRegisters[65535] != 0xffff {
+		t.Errorf("expected all holding registers set")
+	}
+	if s.InputRegisters[0] != 0 || s.DiscreteInputs[0] != 0 {
+		t.Errorf("expected the other memory maps to be left alone")
+	}
+
+	s.FillCoils(false)
+	if !isEqual(make([]byte, 10), s.Coils) {
+		t.Errorf("expected all coils off, got %v", s.Coils)
+	}
+}
+
+func TestFillOptions(t *testing.T) {
+	for _, sparse := range []bool{false, true} {
+		opts := []Option{
+			WithDiscreteInputCount(16),
+			WithInputRegisterCount(16),
+			WithDiscreteInputFill(true),
+			WithInputRegisterFill(100),
+			WithInputRegisters(map[uint16]uint16{3: 7}),
+		}
+		if sparse {
+			opts = append(opts, WithSparse())
+		}
+		s := NewServer(opts...)
+
+		if got, _ := s.readBits(DiscreteInput, 0, 16); !isEqual(bytes.Repeat([]byte{1}, 16), got) {
+			t.Errorf("sparse %v: expected all discrete inputs on, got %v", sparse, got)
+		}
+		expect := make([]uint16, 16)
+		for i := range expect {
+			expect[i] = 100
+		}
+		expect[3] = 7
+		if got, _ := s.readRegisters(InputRegister, 0, 16); !isEqual(expect, got) {
+			t.Errorf("sparse %v: expected %v, got %v", sparse, expect, got)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package mbserver
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+
+	"github.com/goburrow/modbus"
+	"github.com/goburrow/serial"
+)
+
+// Forwarder sends the PDU (function code and data) of a request to the
+// downstream device with a unit ID and returns the PDU of its response, see
+// SetForwarder.
+type Forwarder interface {
+	Forward(unit uint8, pdu []byte) ([]byte, error)
+}
+
+// ForwarderFunc adapts a function to the Forwarder interface.
+type ForwarderFunc func(unit uint8, pdu []byte) ([]byte, error)
+
+// Forward calls f(unit, pdu).
+func (f ForwarderFunc) Forward(unit uint8, pdu []byte) ([]byte, error) {
+	return f(unit, pdu)
+}
+
+// SetForwarder makes the server a gateway for the unit IDs it does not own:
+// requests for other unit IDs than SlaveID and the units added with AddUnit
+// are forwarded, from any transport, and the response of the downstream
+// device is relayed to the master, with the transaction ID of the request.
+// Broadcasts (unit 0) are not forwarded. A forwarder error that is a timeout
+// results in a GatewayTargetDeviceFailedtoRespond exception, other errors in
+// GatewayPathUnavailable. A nil forwarder (the default) drops the requests
+// again. Unlike Bridge, requests for the server itself are still served from
+// memory. Requests are only forwarded once they passed the rate limit, the
+// access checks of the server and its middleware.
+//
+// Requests are forwarded from the goroutines handling requests, so Forward is
+// called concurrently when the server has several workers (see WithWorkers).
+// The forwarders of NewClientForwarder send one request at a time: a slow
+// downstream device delays every forwarded request.
+func (s *Server) SetForwarder(forwarder Forwarder) {
+	s.hooksLock.Lock()
+	s.forwarder = forwarder
+	s.hooksLock.Unlock()
+}
+
+func (s *Server) currentForwarder() Forwarder {
+	s.hooksLock.RLock()
+	defer s.hooksLock.RUnlock()
+	return s.forwarder
+}
+
+// forwardRequest forwards a request and returns the response to relay.
+func (s *Server) forwardRequest(forwarder Forwarder, frame Framer) Framer {
+	unit := frame.GetSlaveId()
+	response := frame.Copy()
+	pdu, err := forwarder.Forward(unit, append([]byte{frame.GetFunction()}, frame.GetData()...))
+	if err == nil && len(pdu) == 0 {
+		err = fmt.Errorf("empty response")
+	}
+	if err != nil {
+		s.logger.Printf("forwarding to unit %d failed: %v\n", unit, err)
+		if isForwardTimeout(err) {
+			response.SetException(&GatewayTargetDeviceFailedtoRespond)
+		} else {
+			response.SetException(&GatewayPathUnavailable)
+		}
+		return response
+	}
+
+	switch frame := response.(type) {
+	case *TCPFrame:
+		frame.Function = pdu[0]
+	case *RTUFrame:
+		frame.Function = pdu[0]
+	case *ASCIIFrame:
+		frame.Function = pdu[0]
+	}
+	response.SetData(append([]byte(nil), pdu[1:]...))
+	return response
+}
+
+func isForwardTimeout(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, os.ErrDeadlineExceeded) || errors.Is(err, serial.ErrTimeout) || (errors.As(err, &netErr) && netErr.Timeout())
+}
+
+// NewClientForwarder returns a Forwarder sending requests through a
+// github.com/goburrow/modbus client handler, such as a TCPClientHandler for
+// a downstream Modbus TCP device or an RTUClientHandler for a serial bus. The
+// slave ID of the handler is set to the unit ID of each request, and requests
+// are sent one at a time, so the handler must not be used elsewhere.
+// Handlers of other types than the TCP, RTU and ASCII handlers of the
+// package are not supported.
+func NewClientForwarder(handler modbus.ClientHandler) (Forwarder, error) {
+	var setSlaveID func(uint8)
+	switch h := handler.(type) {
+	case *modbus.TCPClientHandler:
+		setSlaveID = func(id uint8) { h.SlaveId = id }
+	case *modbus.RTUClientHandler:
+		setSlaveID = func(id uint8) { h.SlaveId = id }
+	case *modbus.ASCIIClientHandler:
+		setSlaveID = func(id uint8) { h.SlaveId = id }
+	default:
+		return nil, fmt.Errorf("unsupported client handler %T", handler)
+	}
+
+	var lock sync.Mutex
+	return ForwarderFunc(func(unit uint8, pdu []byte) ([]byte, error) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		setSlaveID(unit)
+		request, err := handler.Encode(&modbus.ProtocolDataUnit{FunctionCode: pdu[0], Data: pdu[1:]})
+		if err != nil {
+			return nil, err
+		}
+		reply, err := handler.Send(request)
+		if err != nil {
+			return nil, err
+		}
+		if err := handler.Verify(request, reply); err != nil {
+			return nil, err
+		}
+		response, err := handler.Decode(reply)
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte{response.FunctionCode}, response.Data...), nil
+	}), nil
+}
@@ -0,0 +1,176 @@
+package mbserver
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/goburrow/modbus"
+)
+
+func TestNewClientForwarder(t *testing.T) {
+	device := NewServer(WithSlaveID(5))
+	defer device.Close()
+	device.HoldingRegisters[2] = 0x1234
+	deviceAddr, err := device.ListenTCPAny()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gateway := NewServer()
+	defer gateway.Close()
+	forwarder, err := NewClientForwarder(modbus.NewTCPClientHandler(deviceAddr.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gateway.SetForwarder(forwarder)
+	gatewayAddr, err := gateway.ListenTCPAny()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := modbus.NewTCPClientHandler(gatewayAddr.String())
+	handler.SlaveId = 5
+	if err := handler.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer handler.Close()
+	client := modbus.NewClient(handler)
+
+	results, err := client.ReadHoldingRegisters(2, 1)
+	if err != nil || !isEqual([]byte{0x12, 0x34}, results) {
+		t.Errorf("expected the register of the downstream device, got %v, %v", results, err)
+	}
+	// Exceptions of the downstream device are relayed.
+	if _, err := client.ReadHoldingRegisters(0xffff, 2); err == nil {
+		t.Errorf("expected the exception of the downstream device")
+	}
+
+	// Requests for the gateway itself are served locally.
+	gateway.HoldingRegisters[2] = 0x5678
+	handler.SlaveId = 1
+	results, err = client.ReadHoldingRegisters(2, 1)
+	if err != nil || !isEqual([]byte{0x56, 0x78}, results) {
+		t.Errorf("expected the register of the gateway, got %v, %v", results, err)
+	}
+
+	if _, err := NewClientForwarder(nil); err == nil {
+		t.Errorf("expected an error for an unsupported handler")
+	}
+}
+
+func TestForwarderErrors(t *testing.T) {
+	s := NewServer(WithLogger(discardLogger{}))
+	defer s.Close()
+	request := (&TCPFrame{TransactionIdentifier: 9, Device: 7, Function: ReadCoilsFC, Data: []byte{0, 0, 0, 1}}).Bytes()
+
+	tests := []struct {
+		err    error
+		expect Exception
+	}{
+		{os.ErrDeadlineExceeded, GatewayTargetDeviceFailedtoRespond},
+		{errors.New("connection refused"), GatewayPathUnavailable},
+	}
+	for _, test := range tests {
+		s.SetForwarder(ForwarderFunc(func(unit uint8, pdu []byte) ([]byte, error) {
+			return nil, test.err
+		}))
+		response, err := s.RoundTrip(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expect := []byte{0, 9, 0, 0, 0, 3, 7, ReadCoilsFC | 0x80, byte(test.expect)}; !isEqual(expect, response) {
+			t.Errorf("%v: expected %v, got %v", test.err, expect, response)
+		}
+	}
+
+	s.SetForwarder(nil)
+	if _, err := s.RoundTrip(request); err != ErrNoResponse {
+		t.Errorf("expected ErrNoResponse without a forwarder, got %v", err)
+	}
+}
+
+func TestForwarderAccessChecks(t *testing.T) {
+	s := NewServer(WithLogger(discardLogger{}))
+	defer s.Close()
+	forwarded := 0
+	s.SetForwarder(ForwarderFunc(func(unit uint8, pdu []byte) ([]byte, error) {
+		forwarded++
+		return []byte{pdu[0], 1, 0}, nil
+	}))
+	addr, err := s.ListenTCPAny(WithReadOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := modbus.NewTCPClientHandler(addr.String())
+	handler.SlaveId = 7
+	if err := handler.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer handler.Close()
+	client := modbus.NewClient(handler)
+
+	_, err = client.WriteSingleRegister(0, 1)
+	modbusErr, ok := err.(*modbus.ModbusError)
+	if !ok || modbusErr.ExceptionCode != byte(IllegalFunction) {
+		t.Errorf("expected IllegalFunction for a write through a read-only listener, got %v", err)
+	}
+	if forwarded != 0 {
+		t.Errorf("expected the write not to be forwarded")
+	}
+
+	s.SetAccessRules([]AccessRule{{Units: []uint8{7}, Functions: []uint8{ReadDiscreteInputsFC}}})
+	if _, err := client.ReadCoils(0, 1); err == nil {
+		t.Errorf("expected the access rules to deny the read")
+	}
+	if _, err := client.ReadDiscreteInputs(0, 1); err != nil {
+		t.Errorf("expected the read to be forwarded, got %v", err)
+	}
+	if forwarded != 1 {
+		t.Errorf("expected 1 request forwarded, got %v", forwarded)
+	}
+}
+
+func TestClientForwarderWorkers(t *testing.T) {
+	device := NewServer(WithSlaveID(5))
+	defer device.Close()
+	device.HoldingRegisters[2] = 0x1234
+	deviceAddr, err := device.ListenTCPAny()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gateway := NewServer(WithWorkers(4))
+	defer gateway.Close()
+	forwarder, err := NewClientForwarder(modbus.NewTCPClientHandler(deviceAddr.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gateway.SetForwarder(forwarder)
+	gatewayAddr, err := gateway.ListenTCPAny()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			handler := modbus.NewTCPClientHandler(gatewayAddr.String())
+			handler.SlaveId = 5
+			defer handler.Close()
+			client := modbus.NewClient(handler)
+			for j := 0; j < 20; j++ {
+				results, err := client.ReadHoldingRegisters(2, 1)
+				if err != nil || !isEqual([]byte{0x12, 0x34}, results) {
+					t.Errorf("expected the register of the downstream device, got %v, %v", results, err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
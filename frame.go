@@ -37,6 +37,50 @@ func registerAddressAndValue(frame Framer) (int, uint16) {
 	return register, value
 }
 
+// requestRange returns the address and quantity of the read and write
+// functions, the read range for Read/Write Multiple Registers, false for
+// other functions and short requests.
+func requestRange(frame Framer) (address int, quantity int, ok bool) {
+	if len(frame.GetData()) < 4 {
+		return 0, 0, false
+	}
+	switch frame.GetFunction() {
+	case ReadCoilsFC, ReadDiscreteInputsFC, ReadHoldingRegistersFC, ReadInputRegistersFC, WriteMultipleCoilsFC, WriteHoldingRegistersFC, ReadWriteMultipleRegistersFC:
+		address, quantity, _ = registerAddressAndNumber(frame)
+		return address, quantity, true
+	case WriteSingleCoilFC, WriteHoldingRegisterFC, MaskWriteRegisterFC:
+		address, _ = registerAddressAndValue(frame)
+		return address, 1, true
+	}
+	return 0, 0, false
+}
+
+// writeRange returns the memory map, address and quantity written by the
+// write functions, false for other functions and short requests.
+func writeRange(frame Framer) (kind RegisterKind, address int, quantity int, ok bool) {
+	data := frame.GetData()
+	if len(data) < 4 {
+		return 0, 0, 0, false
+	}
+	address, quantity = int(binary.BigEndian.Uint16(data[0:2])), int(binary.BigEndian.Uint16(data[2:4]))
+	switch frame.GetFunction() {
+	case WriteSingleCoilFC:
+		return Coil, address, 1, true
+	case WriteMultipleCoilsFC:
+		return Coil, address, quantity, true
+	case WriteHoldingRegisterFC, MaskWriteRegisterFC:
+		return HoldingRegister, address, 1, true
+	case WriteHoldingRegistersFC:
+		return HoldingRegister, address, quantity, true
+	case ReadWriteMultipleRegistersFC:
+		if len(data) < 8 {
+			return 0, 0, 0, false
+		}
+		return HoldingRegister, int(binary.BigEndian.Uint16(data[4:6])), int(binary.BigEndian.Uint16(data[6:8])), true
+	}
+	return 0, 0, 0, false
+}
+
 // SetDataWithRegisterAndNumber sets the RTUFrame Data byte field to hold a register and number of registers
 func SetDataWithRegisterAndNumber(frame Framer, register uint16, number uint16) {
 	data := make([]byte, 4)
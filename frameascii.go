@@ -0,0 +1,107 @@
+package mbserver
+
+import (
+	"encoding/hex"
+	"fmt"
+)
+
+// ASCIIFrame is the Modbus ASCII frame.
+type ASCIIFrame struct {
+	Address  uint8
+	Function uint8
+	Data     []byte
+}
+
+// NewASCIIFrame converts a packet, from the ':' start character to the CRLF
+// terminator, to a Modbus ASCII frame.
+func NewASCIIFrame(packet []byte) (*ASCIIFrame, error) {
+	// Check the start and end of the packet.
+	pLen := len(packet)
+	if pLen < 9 {
+		return nil, fmt.Errorf("ASCII Frame error: packet less than 9 bytes: %q", packet)
+	}
+	if packet[0] != ':' || packet[pLen-2] != '\r' || packet[pLen-1] != '\n' {
+		return nil, fmt.Errorf("ASCII Frame error: missing start or end characters: %q", packet)
+	}
+
+	bytes := make([]byte, hex.DecodedLen(pLen-3))
+	if _, err := hex.Decode(bytes, packet[1:pLen-2]); err != nil {
+		return nil, fmt.Errorf("ASCII Frame error: %v", err)
+	}
+
+	// Check the LRC.
+	bLen := len(bytes)
+	lrcExpect := bytes[bLen-1]
+	lrcCalc := lrcModbus(bytes[0 : bLen-1])
+	if lrcCalc != lrcExpect {
+		return nil, fmt.Errorf("ASCII Frame error: LRC (expected 0x%x, got 0x%x)", lrcExpect, lrcCalc)
+	}
+
+	frame := &ASCIIFrame{
+		Address:  bytes[0],
+		Function: bytes[1],
+		Data:     bytes[2 : bLen-1],
+	}
+
+	return frame, nil
+}
+
+// Copy the ASCIIFrame.
+func (frame *ASCIIFrame) Copy() Framer {
+	copy := *frame
+	return &copy
+}
+
+// Bytes returns the Modbus character stream based on the ASCIIFrame fields:
+// the start character, the address, function, data and LRC in uppercase
+// hexadecimal, and CRLF.
+func (frame *ASCIIFrame) Bytes() []byte {
+	bytes := append([]byte{frame.Address, frame.Function}, frame.Data...)
+	bytes = append(bytes, lrcModbus(bytes))
+
+	packet := make([]byte, 1+hex.EncodedLen(len(bytes))+2)
+	packet[0] = ':'
+	for i, b := range bytes {
+		packet[1+i*2] = upperHex[b>>4]
+		packet[2+i*2] = upperHex[b&0x0f]
+	}
+	copy(packet[len(packet)-2:], "\r\n")
+	return packet
+}
+
+const upperHex = "0123456789ABCDEF"
+
+// GetFunction returns the Modbus function code.
+func (frame *ASCIIFrame) GetFunction() uint8 {
+	return frame.Function
+}
+
+func (frame *ASCIIFrame) GetSlaveId() uint8 {
+	return frame.Address
+}
+
+// GetData returns the ASCIIFrame Data byte field.
+func (frame *ASCIIFrame) GetData() []byte {
+	return frame.Data
+}
+
+// SetData sets the ASCIIFrame Data byte field.
+func (frame *ASCIIFrame) SetData(data []byte) {
+	frame.Data = data
+}
+
+// SetException sets the Modbus exception code in the frame.
+func (frame *ASCIIFrame) SetException(exception *Exception) {
+	frame.Function = frame.Function | 0x80
+	frame.Data = []byte{byte(*exception)}
+}
+
+// lrcModbus returns the longitudinal redundancy check of data: the two's
+// complement of the sum of its bytes.
+func lrcModbus(data []byte) uint8 {
+	var sum uint8
+	for _, b := range data {
+		sum += b
+	}
+	return -sum
+}
@@ -0,0 +1,73 @@
+package mbserver
+
+import (
+	"bufio"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestNewASCIIFrame(t *testing.T) {
+	frame, err := NewASCIIFrame([]byte(":010300000001FB\r\n"))
+	if !isEqual(nil, err) {
+		t.Fatalf("expected %v, got %v", nil, err)
+	}
+	if frame.Address != 1 || frame.Function != 3 || !isEqual([]byte{0, 0, 0, 1}, frame.Data) {
+		t.Errorf("expected address 1, function 3 and data [0 0 0 1], got %+v", frame)
+	}
+}
+
+func TestNewASCIIFrameErrors(t *testing.T) {
+	for _, packet := range []string{
+		":0103\r\n",
+		"010300000001FB\r\n",
+		":010300000001FB",
+		":010300000001FC\r\n",
+		":0103000000ZZFB\r\n",
+	} {
+		if _, err := NewASCIIFrame([]byte(packet)); err == nil {
+			t.Errorf("expected an error for %q", packet)
+		}
+	}
+}
+
+func TestASCIIFrameBytes(t *testing.T) {
+	frame := &ASCIIFrame{Address: 1, Function: 3, Data: []byte{2, 0xab, 0xcd}}
+	expect := ":010302ABCD82\r\n"
+	if got := string(frame.Bytes()); got != expect {
+		t.Errorf("expected %q, got %q", expect, got)
+	}
+}
+
+func TestASCIIRequests(t *testing.T) {
+	s := NewServer(WithLogger(discardLogger{}), WithHoldingRegisters(map[uint16]uint16{0: 0xabcd}))
+	defer s.Close()
+	frameErrors := make(chan string, 1)
+	s.OnSerialFrameError(func(raw []byte, reason string) {
+		frameErrors <- reason
+	})
+
+	port, line := net.Pipe()
+	defer line.Close()
+	go s.acceptASCIIRequests(pipePort{port}, nil)
+
+	line.Write([]byte(":010300000001FC\r\n"))
+	select {
+	case reason := <-frameErrors:
+		if reason != BadLRC {
+			t.Errorf("expected %q, got %q", BadLRC, reason)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected a frame error")
+	}
+
+	line.Write([]byte(":010300000001FB\r\n"))
+	line.SetReadDeadline(time.Now().Add(time.Second))
+	response, err := bufio.NewReader(line).ReadString('\n')
+	if err != nil {
+		t.Fatalf("expected a response, got %v", err)
+	}
+	if expect := ":010302ABCD82\r\n"; response != expect {
+		t.Errorf("expected %q, got %q", expect, response)
+	}
+}
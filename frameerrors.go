@@ -0,0 +1,53 @@
+package mbserver
+
+import (
+	"context"
+	"log/slog"
+)
+
+// Reasons passed to the OnSerialFrameError callback.
+const (
+	ShortFrame = "short frame"
+	BadCRC     = "bad CRC"
+	BadLRC     = "bad LRC"
+)
+
+// OnSerialFrameError sets a callback fired from the serial read loop for
+// every chunk discarded because it is not a valid frame, with a copy of the
+// raw bytes and the reason, ShortFrame, BadCRC or, for ASCII framing,
+// BadLRC. Counting and inspecting them helps diagnosing noise on RS-485
+// wiring. No response is sent to discarded frames. A nil callback removes it.
+func (s *Server) OnSerialFrameError(callback func(raw []byte, reason string)) {
+	s.hooksLock.Lock()
+	s.serialFrameError = callback
+	s.hooksLock.Unlock()
+}
+
+// serialFrameErrorReason returns the reason an RTU packet was rejected.
+func serialFrameErrorReason(packet []byte) string {
+	if len(packet) < 5 {
+		return ShortFrame
+	}
+	return BadCRC
+}
+
+// asciiFrameErrorReason returns the reason an ASCII packet was rejected.
+func asciiFrameErrorReason(packet []byte) string {
+	if len(packet) < 9 {
+		return ShortFrame
+	}
+	return BadLRC
+}
+
+func (s *Server) notifySerialFrameError(packet []byte, reason string) {
+	s.countDiagnostic(ReturnBusCommErrorCount)
+	s.logEvent(context.Background(), slog.LevelWarn, "frame error", slog.String("reason", reason), slog.Int("length", len(packet)))
+
+	s.hooksLock.RLock()
+	callback := s.serialFrameError
+	s.hooksLock.RUnlock()
+
+	if callback != nil {
+		callback(append([]byte(nil), packet...), reason)
+	}
+}
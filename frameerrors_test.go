@@ -0,0 +1,65 @@
+package mbserver
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/goburrow/serial"
+)
+
+// pipePort is a serial port over one end of a net.Pipe.
+type pipePort struct {
+	net.Conn
+}
+
+func (p pipePort) Open(*serial.Config) error {
+	return nil
+}
+
+type serialFrameError struct {
+	raw    []byte
+	reason string
+}
+
+func TestOnSerialFrameError(t *testing.T) {
+	s := NewServer(WithLogger(discardLogger{}))
+	defer s.Close()
+	frameErrors := make(chan serialFrameError, 2)
+	s.OnSerialFrameError(func(raw []byte, reason string) {
+		frameErrors <- serialFrameError{raw, reason}
+	})
+
+	port, line := net.Pipe()
+	defer line.Close()
+	go s.acceptSerialRequests(pipePort{port}, nil)
+
+	frame := &RTUFrame{Address: 1, Function: ReadHoldingRegistersFC}
+	SetDataWithRegisterAndNumber(frame, 0, 1)
+	badCRC := frame.Bytes()
+	badCRC[len(badCRC)-1] ^= 0xff
+
+	for _, expect := range []serialFrameError{{[]byte{1, 3}, ShortFrame}, {badCRC, BadCRC}} {
+		line.Write(expect.raw)
+		select {
+		case got := <-frameErrors:
+			if !isEqual(expect.raw, got.raw) || got.reason != expect.reason {
+				t.Errorf("expected %v %q, got %v %q", expect.raw, expect.reason, got.raw, got.reason)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("expected a frame error for %v", expect.raw)
+		}
+	}
+
+	// Valid frames are still answered.
+	line.Write(frame.Bytes())
+	line.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := io.ReadFull(line, make([]byte, 7)); err != nil {
+		t.Errorf("expected a response, got %v", err)
+	}
+}
+
+type discardLogger struct{}
+
+func (discardLogger) Printf(format string, v ...interface{}) {}
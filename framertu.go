@@ -11,6 +11,20 @@ type RTUFrame struct {
 	Function uint8
 	Data     []byte
 	CRC      uint16
+	// crcSet makes Bytes use CRC rather than compute it.
+	crcSet bool
+}
+
+// BuildRTUFrame builds an RTU frame from its fields, with the correct CRC.
+// Together with SetCRC it builds malformed frames for tests:
+//
+//	frame := mbserver.BuildRTUFrame(1, mbserver.ReadHoldingRegistersFC, []byte{0, 0, 0, 1})
+//	frame.SetCRC(frame.CRC ^ 0xffff)
+//	port.Write(frame.Bytes())
+func BuildRTUFrame(slaveID, function uint8, data []byte) *RTUFrame {
+	frame := &RTUFrame{Address: slaveID, Function: function, Data: data}
+	frame.ComputeCRC()
+	return frame
 }
 
 // NewRTUFrame converts a packet to a Modbus TCP frame.
@@ -43,7 +57,8 @@ func (frame *RTUFrame) Copy() Framer {
 	return &copy
 }
 
-// Bytes returns the Modbus byte stream based on the RTUFrame fields
+// Bytes returns the Modbus byte stream based on the RTUFrame fields. The CRC
+// is computed, unless it was set with SetCRC or ComputeCRC.
 func (frame *RTUFrame) Bytes() []byte {
 	bytes := make([]byte, 2)
 
@@ -54,6 +69,9 @@ func (frame *RTUFrame) Bytes() []byte {
 	// Calculate the CRC.
 	pLen := len(bytes)
 	crc := crcModbus(bytes[0:pLen])
+	if frame.crcSet {
+		crc = frame.CRC
+	}
 
 	// Add the CRC.
 	bytes = append(bytes, []byte{0, 0}...)
@@ -77,13 +95,28 @@ func (frame *RTUFrame) GetData() []byte {
 }
 
 // SetData sets the RTUFrame Data byte field and updates the frame length
-// accordingly.
+// accordingly. A CRC set with SetCRC is discarded.
 func (frame *RTUFrame) SetData(data []byte) {
 	frame.Data = data
+	frame.crcSet = false
 }
 
-// SetException sets the Modbus exception code in the frame.
+// SetException sets the Modbus exception code in the frame. A CRC set with
+// SetCRC is discarded.
 func (frame *RTUFrame) SetException(exception *Exception) {
 	frame.Function = frame.Function | 0x80
 	frame.Data = []byte{byte(*exception)}
+	frame.crcSet = false
+}
+
+// SetCRC sets the CRC written by Bytes, which may deliberately be wrong.
+func (frame *RTUFrame) SetCRC(crc uint16) {
+	frame.CRC = crc
+	frame.crcSet = true
+}
+
+// ComputeCRC sets the CRC written by Bytes to the CRC of the frame fields.
+func (frame *RTUFrame) ComputeCRC() {
+	bytes := append([]byte{frame.Address, frame.Function}, frame.Data...)
+	frame.SetCRC(crcModbus(bytes))
 }
@@ -49,3 +49,25 @@ func TestRTUFrameBytes(t *testing.T) {
 		t.Errorf("expected %v, got %v", expect, got)
 	}
 }
+
+func TestBuildRTUFrame(t *testing.T) {
+	frame := BuildRTUFrame(1, 4, []byte{0x02, 0xff, 0xff})
+	expect := []byte{0x01, 0x04, 0x02, 0xFF, 0xFF, 0xB8, 0x80}
+	if got := frame.Bytes(); !isEqual(expect, got) {
+		t.Errorf("expected %v, got %v", expect, got)
+	}
+
+	frame.SetCRC(0x1234)
+	expect = []byte{0x01, 0x04, 0x02, 0xFF, 0xFF, 0x34, 0x12}
+	if got := frame.Bytes(); !isEqual(expect, got) {
+		t.Errorf("expected %v, got %v", expect, got)
+	}
+	if _, err := NewRTUFrame(frame.Bytes()); err == nil {
+		t.Errorf("expected the wrong CRC to be rejected")
+	}
+
+	frame.ComputeCRC()
+	if frame.CRC != 0x80B8 {
+		t.Errorf("expected CRC 0x80B8, got 0x%x", frame.CRC)
+	}
+}
@@ -13,6 +13,24 @@ type TCPFrame struct {
 	Device                uint8
 	Function              uint8
 	Data                  []byte
+	// lengthSet makes Bytes use Length rather than compute it.
+	lengthSet bool
+}
+
+// BuildTCPFrame builds a TCP frame from its fields, the MBAP header ones
+// included. The length is written by Bytes as given, even when it does not
+// match the data, which builds malformed frames for tests; ComputeLength
+// sets the correct one.
+func BuildTCPFrame(transactionID, protocolID, length uint16, unitID, function uint8, data []byte) *TCPFrame {
+	frame := &TCPFrame{
+		TransactionIdentifier: transactionID,
+		ProtocolIdentifier:    protocolID,
+		Device:                unitID,
+		Function:              function,
+		Data:                  data,
+	}
+	frame.SetLength(length)
+	return frame
 }
 
 // NewTCPFrame converts a packet to a Modbus TCP frame.
@@ -45,13 +63,18 @@ func (frame *TCPFrame) Copy() Framer {
 	return &copy
 }
 
-// Bytes returns the Modbus byte stream based on the TCPFrame fields
+// Bytes returns the Modbus byte stream based on the TCPFrame fields. The
+// length is computed, unless it was set with SetLength or BuildTCPFrame.
 func (frame *TCPFrame) Bytes() []byte {
 	bytes := make([]byte, 8)
 
+	length := uint16(2 + len(frame.Data))
+	if frame.lengthSet {
+		length = frame.Length
+	}
 	binary.BigEndian.PutUint16(bytes[0:2], frame.TransactionIdentifier)
 	binary.BigEndian.PutUint16(bytes[2:4], frame.ProtocolIdentifier)
-	binary.BigEndian.PutUint16(bytes[4:6], uint16(2+len(frame.Data)))
+	binary.BigEndian.PutUint16(bytes[4:6], length)
 	bytes[6] = frame.Device
 	bytes[7] = frame.Function
 	bytes = append(bytes, frame.Data...)
@@ -89,4 +112,18 @@ func (frame *TCPFrame) SetException(exception *Exception) {
 
 func (frame *TCPFrame) setLength() {
 	frame.Length = uint16(len(frame.Data) + 2)
+	frame.lengthSet = false
+}
+
+// SetLength sets the length written by Bytes, which may deliberately be
+// wrong. SetData and SetException discard it.
+func (frame *TCPFrame) SetLength(length uint16) {
+	frame.Length = length
+	frame.lengthSet = true
+}
+
+// ComputeLength sets the length written by Bytes to the length of the
+// frame fields.
+func (frame *TCPFrame) ComputeLength() {
+	frame.SetLength(uint16(len(frame.Data) + 2))
 }
@@ -0,0 +1,33 @@
+package mbserver
+
+import "testing"
+
+func TestBuildTCPFrame(t *testing.T) {
+	frame := BuildTCPFrame(0x0102, 0, 6, 1, 3, []byte{0x00, 0x00, 0x00, 0x01})
+	expect := []byte{0x01, 0x02, 0x00, 0x00, 0x00, 0x06, 0x01, 0x03, 0x00, 0x00, 0x00, 0x01}
+	if got := frame.Bytes(); !isEqual(expect, got) {
+		t.Errorf("expected %v, got %v", expect, got)
+	}
+
+	// A wrong length is written as is and rejected by NewTCPFrame.
+	frame = BuildTCPFrame(1, 7, 42, 1, 3, []byte{0x00, 0x00, 0x00, 0x01})
+	expect = []byte{0x00, 0x01, 0x00, 0x07, 0x00, 0x2a, 0x01, 0x03, 0x00, 0x00, 0x00, 0x01}
+	if got := frame.Bytes(); !isEqual(expect, got) {
+		t.Errorf("expected %v, got %v", expect, got)
+	}
+	if _, err := NewTCPFrame(frame.Bytes()); err == nil {
+		t.Errorf("expected the wrong length to be rejected")
+	}
+
+	frame.ComputeLength()
+	if frame.Length != 6 {
+		t.Errorf("expected length 6, got %v", frame.Length)
+	}
+
+	// Responses built from the frame get the correct length.
+	response := frame.Copy()
+	response.SetData([]byte{0x02, 0x00, 0x00})
+	if got := response.Bytes()[5]; got != 5 {
+		t.Errorf("expected length 5, got %v", got)
+	}
+}
@@ -7,147 +7,339 @@ import (
 const (
 	MaxRegisterSize = 65536
 
-	ReadCoilsFC             = 1
-	ReadDiscreteInputsFC    = 2
-	ReadHoldingRegistersFC  = 3
-	ReadInputRegistersFC    = 4
-	WriteSingleCoilFC       = 5
-	WriteHoldingRegisterFC  = 6
-	WriteMultipleCoilsFC    = 15
-	WriteHoldingRegistersFC = 16
+	// Maximum quantities per request defined by the Modbus specification.
+	MaxReadBits       = 2000
+	MaxReadRegisters  = 125
+	MaxWriteBits      = 1968
+	MaxWriteRegisters = 123
+	// MaxReadWriteRegisters is the number of registers function 23 may write.
+	MaxReadWriteRegisters = 121
+
+	ReadCoilsFC                  = 1
+	ReadDiscreteInputsFC         = 2
+	ReadHoldingRegistersFC       = 3
+	ReadInputRegistersFC         = 4
+	WriteSingleCoilFC            = 5
+	WriteHoldingRegisterFC       = 6
+	DiagnosticsFC                = 8
+	WriteMultipleCoilsFC         = 15
+	WriteHoldingRegistersFC      = 16
+	MaskWriteRegisterFC          = 22
+	ReadWriteMultipleRegistersFC = 23
+	ReadFIFOQueueFC              = 24
 )
 
 // ReadCoils function 1, reads coils from internal memory.
 func ReadCoils(s *Server, frame Framer) ([]byte, *Exception) {
-	register, numRegs, endRegister := registerAddressAndNumber(frame)
-	if endRegister > MaxRegisterSize {
-		return []byte{}, &IllegalDataAddress
-	}
-	dataSize := numRegs / 8
-	if (numRegs % 8) != 0 {
-		dataSize++
+	register, numRegs, _ := registerAddressAndNumber(frame)
+	register -= s.startAddress
+	if err := s.validateReadRange(Coil, register, numRegs, s.maxQuantity(readBitsLimit)); err != nil {
+		return []byte{}, exceptionFromError(err)
 	}
-	data := make([]byte, 1+dataSize)
-	data[0] = byte(dataSize)
-	for i, value := range s.Coils[register:endRegister] {
-		if value != 0 {
-			shift := uint(i) % 8
-			data[1+i/8] |= byte(1 << shift)
-		}
+	bits, err := s.readBits(Coil, register, numRegs)
+	if err != nil {
+		return []byte{}, exceptionFromError(err)
 	}
-	return data, &Success
+	return packBits(bits), &Success
 }
 
 // ReadDiscreteInputs function 2, reads discrete inputs from internal memory.
 func ReadDiscreteInputs(s *Server, frame Framer) ([]byte, *Exception) {
-	register, numRegs, endRegister := registerAddressAndNumber(frame)
-	if endRegister > MaxRegisterSize {
-		return []byte{}, &IllegalDataAddress
+	register, numRegs, _ := registerAddressAndNumber(frame)
+	register -= s.startAddress
+	if err := s.validateReadRange(DiscreteInput, register, numRegs, s.maxQuantity(readBitsLimit)); err != nil {
+		return []byte{}, exceptionFromError(err)
 	}
-	dataSize := numRegs / 8
-	if (numRegs % 8) != 0 {
-		dataSize++
+	bits, err := s.readBits(DiscreteInput, register, numRegs)
+	if err != nil {
+		return []byte{}, exceptionFromError(err)
 	}
-	data := make([]byte, 1+dataSize)
-	data[0] = byte(dataSize)
-	for i, value := range s.DiscreteInputs[register:endRegister] {
-		if value != 0 {
-			shift := uint(i) % 8
-			data[1+i/8] |= byte(1 << shift)
-		}
-	}
-	return data, &Success
+	return packBits(bits), &Success
 }
 
 // ReadHoldingRegisters function 3, reads holding registers from internal memory.
 func ReadHoldingRegisters(s *Server, frame Framer) ([]byte, *Exception) {
-	register, numRegs, endRegister := registerAddressAndNumber(frame)
-	if endRegister > MaxRegisterSize {
-		return []byte{}, &IllegalDataAddress
+	register, numRegs, _ := registerAddressAndNumber(frame)
+	if s.inEnronRange(register) {
+		return readEnronRegisters(s, register, numRegs)
 	}
-	return append([]byte{byte(numRegs * 2)}, Uint16ToBytes(s.HoldingRegisters[register:endRegister])...), &Success
+	register -= s.startAddress
+	if err := s.validateReadRange(HoldingRegister, register, numRegs, s.maxQuantity(readRegistersLimit)); err != nil {
+		return []byte{}, exceptionFromError(err)
+	}
+	values, err := s.readRegisters(HoldingRegister, register, numRegs)
+	if err != nil {
+		return []byte{}, exceptionFromError(err)
+	}
+	return append([]byte{byte(numRegs * 2)}, s.encodeRegisters(values)...), &Success
 }
 
 // ReadInputRegisters function 4, reads input registers from internal memory.
 func ReadInputRegisters(s *Server, frame Framer) ([]byte, *Exception) {
-	register, numRegs, endRegister := registerAddressAndNumber(frame)
-	if endRegister > MaxRegisterSize {
-		return []byte{}, &IllegalDataAddress
+	register, numRegs, _ := registerAddressAndNumber(frame)
+	register -= s.startAddress
+	if err := s.validateReadRange(InputRegister, register, numRegs, s.maxQuantity(readRegistersLimit)); err != nil {
+		return []byte{}, exceptionFromError(err)
+	}
+	values, err := s.readRegisters(InputRegister, register, numRegs)
+	if err != nil {
+		return []byte{}, exceptionFromError(err)
 	}
-	return append([]byte{byte(numRegs * 2)}, Uint16ToBytes(s.InputRegisters[register:endRegister])...), &Success
+	return append([]byte{byte(numRegs * 2)}, s.encodeRegisters(values)...), &Success
 }
 
 // WriteSingleCoil function 5, write a coil to internal memory.
 func WriteSingleCoil(s *Server, frame Framer) ([]byte, *Exception) {
 	register, value := registerAddressAndValue(frame)
+	register -= s.startAddress
+	if err := s.validateRange(Coil, register, 1, 1); err != nil {
+		return []byte{}, exceptionFromError(err)
+	}
 	// TODO Should we use 0 for off and 65,280 (FF00 in hexadecimal) for on?
 	if value != 0 {
 		value = 1
 	}
-	s.Coils[register] = byte(value)
+	if exception := s.validateWrite(register, []uint16{value}, Coil); exception != nil {
+		return []byte{}, exception
+	}
+	if err := s.writeBits(Coil, register, []byte{byte(value)}); err != nil {
+		return []byte{}, exceptionFromError(err)
+	}
+	s.notifyWrite(frame, Coil, register, []uint16{value})
 	return frame.GetData()[0:4], &Success
 }
 
 // WriteHoldingRegister function 6, write a holding register to internal memory.
 func WriteHoldingRegister(s *Server, frame Framer) ([]byte, *Exception) {
-	register, value := registerAddressAndValue(frame)
-	s.HoldingRegisters[register] = value
+	register, _ := registerAddressAndValue(frame)
+	if s.inEnronRange(register) {
+		return writeEnronRegister(s, frame, register)
+	}
+	register -= s.startAddress
+	value := s.decodeRegisters(frame.GetData()[2:4])[0]
+	if err := s.validateRange(HoldingRegister, register, 1, 1); err != nil {
+		return []byte{}, exceptionFromError(err)
+	}
+	if exception := s.validateWrite(register, []uint16{value}, HoldingRegister); exception != nil {
+		return []byte{}, exception
+	}
+	if err := s.writeRegisters(HoldingRegister, register, []uint16{value}); err != nil {
+		return []byte{}, exceptionFromError(err)
+	}
+	s.notifyWrite(frame, HoldingRegister, register, []uint16{value})
 	return frame.GetData()[0:4], &Success
 }
 
+// Diagnostics sub-function codes.
+const (
+	ReturnQueryData       = 0x00
+	RestartCommunications = 0x01
+	ForceListenOnlyMode   = 0x04
+)
+
+// Diagnostics function 8, runs the sub-function registered with
+// RegisterDiagnosticSubFunction for the sub-function code of the request.
+// Sub-functions 0 (Return Query Data), which echoes the request and lets
+// masters check the server is alive, 1 (Restart Communications, which also
+// clears the counters), 4 (Force Listen Only Mode), 10 (Clear Counters), 11
+// to 18, which return the counters (see Counters), and 20 (Clear Overrun
+// Counter) are built in. Other sub-functions return IllegalFunction.
+//
+// Force Listen Only Mode makes the server stop responding, to every master,
+// until Restart Communications is received. Requests keep being processed
+// meanwhile, so writes still update memory. Neither request is answered while
+// in listen only mode.
+func Diagnostics(s *Server, frame Framer) ([]byte, *Exception) {
+	data := frame.GetData()
+	if len(data) < 2 {
+		return []byte{}, &IllegalDataValue
+	}
+	function := s.diagnosticSubs[binary.BigEndian.Uint16(data[0:2])]
+	if function == nil {
+		return []byte{}, &IllegalFunction
+	}
+	result, exception := function(s, data[2:])
+	if exception != &Success {
+		return []byte{}, exception
+	}
+	return append(append([]byte(nil), data[0:2]...), result...), &Success
+}
+
+func returnQueryData(s *Server, data []byte) ([]byte, *Exception) {
+	return append([]byte(nil), data...), &Success
+}
+
+func restartCommunications(s *Server, data []byte) ([]byte, *Exception) {
+	if len(data) < 2 {
+		return []byte{}, &IllegalDataValue
+	}
+	if option := binary.BigEndian.Uint16(data[0:2]); option != 0x0000 && option != 0xff00 {
+		return []byte{}, &IllegalDataValue
+	}
+	s.changeState(func() { s.listenOnly.Store(false) })
+	s.ResetCounters()
+	return append([]byte(nil), data[0:2]...), &Success
+}
+
+func forceListenOnlyMode(s *Server, data []byte) ([]byte, *Exception) {
+	s.changeState(func() { s.listenOnly.Store(true) })
+	return append([]byte(nil), data...), &Success
+}
+
 // WriteMultipleCoils function 15, writes holding registers to internal memory.
 func WriteMultipleCoils(s *Server, frame Framer) ([]byte, *Exception) {
-	register, numRegs, endRegister := registerAddressAndNumber(frame)
+	register, numRegs, _ := registerAddressAndNumber(frame)
+	register -= s.startAddress
 	valueBytes := frame.GetData()[5:]
 
-	if endRegister > MaxRegisterSize {
-		return []byte{}, &IllegalDataAddress
+	if err := s.validateRange(Coil, register, numRegs, s.maxQuantity(writeBitsLimit)); err != nil {
+		return []byte{}, exceptionFromError(err)
 	}
 
-	// TODO This is not correct, bits and bytes do not always align
-	//if len(valueBytes)/2 != numRegs {
-	//	return []byte{}, &IllegalDataAddress
-	//}
+	// The byte count must cover the coils, the padding bits of the last
+	// byte are ignored.
+	byteCount := (numRegs + 7) / 8
+	if int(frame.GetData()[4]) != byteCount || len(valueBytes) < byteCount {
+		return []byte{}, &IllegalDataValue
+	}
 
-	bitCount := 0
-	for i, value := range valueBytes {
-		for bitPos := uint(0); bitPos < 8; bitPos++ {
-			s.Coils[register+(i*8)+int(bitPos)] = bitAtPosition(value, bitPos)
-			bitCount++
-			if bitCount >= numRegs {
-				break
-			}
-		}
-		if bitCount >= numRegs {
-			break
+	values := make([]uint16, 0, numRegs)
+	for _, value := range valueBytes {
+		for bitPos := uint(0); bitPos < 8 && len(values) < numRegs; bitPos++ {
+			values = append(values, uint16(bitAtPosition(value, bitPos)))
 		}
 	}
 
+	if exception := s.validateWrite(register, values, Coil); exception != nil {
+		return []byte{}, exception
+	}
+	if err := s.writeRegisters(Coil, register, values); err != nil {
+		return []byte{}, exceptionFromError(err)
+	}
+	s.notifyWrite(frame, Coil, register, values)
+
 	return frame.GetData()[0:4], &Success
 }
 
 // WriteHoldingRegisters function 16, writes holding registers to internal memory.
 func WriteHoldingRegisters(s *Server, frame Framer) ([]byte, *Exception) {
 	register, numRegs, _ := registerAddressAndNumber(frame)
+	if s.inEnronRange(register) {
+		return writeEnronRegisters(s, frame, register, numRegs)
+	}
+	register -= s.startAddress
 	valueBytes := frame.GetData()[5:]
-	var exception *Exception
-	var data []byte
 
-	if len(valueBytes)/2 != numRegs {
-		exception = &IllegalDataAddress
+	if err := s.validateRange(HoldingRegister, register, numRegs, s.maxQuantity(writeRegistersLimit)); err != nil {
+		return []byte{}, exceptionFromError(err)
+	}
+
+	values := s.decodeRegisters(valueBytes)
+	if len(values) != numRegs {
+		return []byte{}, &IllegalDataAddress
+	}
+	if exception := s.validateWrite(register, values, HoldingRegister); exception != nil {
+		return []byte{}, exception
 	}
 
 	// Copy data to memroy
-	values := BytesToUint16(valueBytes)
-	valuesUpdated := copy(s.HoldingRegisters[register:], values)
-	if valuesUpdated == numRegs {
-		exception = &Success
-		data = frame.GetData()[0:4]
-	} else {
-		exception = &IllegalDataAddress
+	if err := s.writeRegisters(HoldingRegister, register, values); err != nil {
+		return []byte{}, exceptionFromError(err)
+	}
+	s.notifyWrite(frame, HoldingRegister, register, values)
+	return frame.GetData()[0:4], &Success
+}
+
+// MaskWriteRegister function 22, modifies a holding register with an AND mask
+// and an OR mask: the register becomes (current AND and) OR (or AND NOT and).
+func MaskWriteRegister(s *Server, frame Framer) ([]byte, *Exception) {
+	data := frame.GetData()
+	if len(data) < 6 {
+		return []byte{}, &IllegalDataValue
+	}
+	register := int(binary.BigEndian.Uint16(data[0:2])) - s.startAddress
+	masks := s.decodeRegisters(data[2:6])
+	andMask, orMask := masks[0], masks[1]
+	if err := s.validateRange(HoldingRegister, register, 1, 1); err != nil {
+		return []byte{}, exceptionFromError(err)
+	}
+
+	current, err := s.readRegisters(HoldingRegister, register, 1)
+	if err != nil {
+		return []byte{}, exceptionFromError(err)
+	}
+	value := (current[0] & andMask) | (orMask &^ andMask)
+	if exception := s.validateWrite(register, []uint16{value}, HoldingRegister); exception != nil {
+		return []byte{}, exception
+	}
+	if err := s.writeRegisters(HoldingRegister, register, []uint16{value}); err != nil {
+		return []byte{}, exceptionFromError(err)
+	}
+	s.notifyWrite(frame, HoldingRegister, register, []uint16{value})
+	return data[0:6], &Success
+}
+
+// ReadWriteMultipleRegisters function 23, writes holding registers then reads
+// holding registers, in a single transaction.
+func ReadWriteMultipleRegisters(s *Server, frame Framer) ([]byte, *Exception) {
+	data := frame.GetData()
+	if len(data) < 9 {
+		return []byte{}, &IllegalDataValue
+	}
+	readRegister, readNumRegs, _ := registerAddressAndNumber(frame)
+	readRegister -= s.startAddress
+	writeRegister := int(binary.BigEndian.Uint16(data[4:6])) - s.startAddress
+	writeNumRegs := int(binary.BigEndian.Uint16(data[6:8]))
+	valueBytes := data[9:]
+
+	if err := s.validateReadRange(HoldingRegister, readRegister, readNumRegs, s.maxQuantity(readRegistersLimit)); err != nil {
+		return []byte{}, exceptionFromError(err)
+	}
+	writeLimit := s.maxQuantity(writeRegistersLimit)
+	if writeLimit > MaxReadWriteRegisters {
+		writeLimit = MaxReadWriteRegisters
+	}
+	if err := s.validateRange(HoldingRegister, writeRegister, writeNumRegs, writeLimit); err != nil {
+		return []byte{}, exceptionFromError(err)
+	}
+	if int(data[8]) != writeNumRegs*2 || len(valueBytes) != writeNumRegs*2 {
+		return []byte{}, &IllegalDataValue
+	}
+
+	values := s.decodeRegisters(valueBytes)
+	if exception := s.validateWrite(writeRegister, values, HoldingRegister); exception != nil {
+		return []byte{}, exception
 	}
+	if err := s.writeRegisters(HoldingRegister, writeRegister, values); err != nil {
+		return []byte{}, exceptionFromError(err)
+	}
+	s.notifyWrite(frame, HoldingRegister, writeRegister, values)
 
-	return data, exception
+	read, err := s.readRegisters(HoldingRegister, readRegister, readNumRegs)
+	if err != nil {
+		return []byte{}, exceptionFromError(err)
+	}
+	return append([]byte{byte(readNumRegs * 2)}, s.encodeRegisters(read)...), &Success
+}
+
+// ReadFIFOQueue function 24, reads the FIFO queue configured with SetFIFOQueue.
+func ReadFIFOQueue(s *Server, frame Framer) ([]byte, *Exception) {
+	data := frame.GetData()
+	if len(data) < 2 {
+		return []byte{}, &IllegalDataValue
+	}
+	values, ok := s.fifoQueue(binary.BigEndian.Uint16(data[0:2]))
+	if !ok {
+		return []byte{}, &IllegalDataAddress
+	}
+	if len(values) > MaxFIFOCount {
+		return []byte{}, &IllegalDataValue
+	}
+
+	response := make([]byte, 4, 4+len(values)*2)
+	binary.BigEndian.PutUint16(response[0:2], uint16(2+len(values)*2))
+	binary.BigEndian.PutUint16(response[2:4], uint16(len(values)))
+	return append(response, Uint16ToBytes(values)...), &Success
 }
 
 // BytesToUint16 converts a big endian array of bytes to an array of unit16s
@@ -170,6 +362,30 @@ func Uint16ToBytes(values []uint16) []byte {
 	return bytes
 }
 
+// packBits packs bit values LSB first into bytes, prefixed by the byte count.
+// Any non-zero value is a set bit.
+func packBits(bits []byte) []byte {
+	dataSize := (len(bits) + 7) / 8
+	data := make([]byte, 1+dataSize)
+	data[0] = byte(dataSize)
+
+	// Pack eight values at a time: set the top bit of each non-zero byte,
+	// then gather the top bits into one byte with a single multiplication.
+	full := len(bits) / 8
+	packed := data[1 : 1+full]
+	for i := range packed {
+		x := binary.LittleEndian.Uint64(bits[i*8 : i*8+8])
+		x = ((x & 0x7f7f7f7f7f7f7f7f) + 0x7f7f7f7f7f7f7f7f | x) & 0x8080808080808080
+		packed[i] = byte(((x >> 7) * 0x0102040810204080) >> 56)
+	}
+	for i := full * 8; i < len(bits); i++ {
+		if bits[i] != 0 {
+			data[1+i/8] |= 1 << (uint(i) % 8)
+		}
+	}
+	return data
+}
+
 func bitAtPosition(value uint8, pos uint) uint8 {
 	return (value >> pos) & 0x01
 }
@@ -1,8 +1,12 @@
 package mbserver
 
 import (
+	"encoding/binary"
 	"encoding/json"
+	"io"
+	"net"
 	"testing"
+	"time"
 )
 
 func isEqual(a interface{}, b interface{}) bool {
@@ -48,6 +52,35 @@ func TestReadCoils(t *testing.T) {
 	}
 }
 
+// Coil N of the request maps to bit N mod 8 of byte N div 8, LSB first.
+func TestReadCoilsBitOrder(t *testing.T) {
+	s := NewServer()
+	for i, value := range []byte{1, 0, 1, 1, 0, 0, 1, 0, 1} {
+		s.Coils[20+i] = value
+	}
+
+	var frame TCPFrame
+	frame.Device = 1
+	frame.Function = 1
+	SetDataWithRegisterAndNumber(&frame, 20, 9)
+
+	var req Request
+	req.frame = &frame
+	response := s.handle(&req)
+
+	exception := GetException(response)
+	if exception != Success {
+		t.Errorf("expected Success, got %v", exception.String())
+		t.FailNow()
+	}
+	// 2 bytes, 0b01001101, 0b00000001
+	expect := []byte{2, 0x4D, 0x01}
+	got := response.GetData()
+	if !isEqual(expect, got) {
+		t.Errorf("expected %v, got %v", expect, got)
+	}
+}
+
 // Function 2
 func TestReadDiscreteInputs(t *testing.T) {
 	s := NewServer()
@@ -222,6 +255,46 @@ func TestWriteMultipleCoils(t *testing.T) {
 	}
 }
 
+// Only the requested coils are written, the padding bits of the last byte
+// are ignored.
+func TestWriteMultipleCoilsPartialByte(t *testing.T) {
+	s := NewServer()
+
+	var frame TCPFrame
+	frame.Device = 1
+	frame.Function = 15
+	SetDataWithRegisterAndNumberAndBytes(&frame, 20, 10, []byte{0xFF, 0xFF})
+
+	var req Request
+	req.frame = &frame
+	response := s.handle(&req)
+	exception := GetException(response)
+	if exception != Success {
+		t.Errorf("expected Success, got %v", exception.String())
+		t.FailNow()
+	}
+	expect := []byte{0, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 0, 0, 0, 0, 0, 0, 0}
+	got := s.Coils[19:37]
+	if !isEqual(expect, got) {
+		t.Errorf("expected %v, got %v\n", expect, got)
+	}
+
+	// The response echoes the start address and quantity.
+	expect = []byte{0, 20, 0, 10}
+	got = response.GetData()
+	if !isEqual(expect, got) {
+		t.Errorf("expected %v, got %v\n", expect, got)
+	}
+
+	// A byte count not matching the quantity is rejected.
+	SetDataWithRegisterAndNumberAndBytes(&frame, 20, 10, []byte{0xFF})
+	response = s.handle(&req)
+	exception = GetException(response)
+	if exception != IllegalDataValue {
+		t.Errorf("expected IllegalDataValue, got %v", exception.String())
+	}
+}
+
 // Function 16
 func TestWriteHoldingRegisters(t *testing.T) {
 	s := NewServer()
@@ -249,6 +322,65 @@ func TestWriteHoldingRegisters(t *testing.T) {
 	}
 }
 
+// Function 22, the example of the specification.
+func TestMaskWriteRegister(t *testing.T) {
+	s := NewServer()
+	s.HoldingRegisters[4] = 0x12
+
+	frame := &TCPFrame{Device: 1, Function: MaskWriteRegisterFC}
+	frame.SetData([]byte{0, 4, 0, 0xf2, 0, 0x25})
+	response := s.handle(&Request{frame: frame})
+	if exception := GetException(response); exception != Success {
+		t.Fatalf("expected Success, got %v", exception.String())
+	}
+	if !isEqual([]byte{0, 4, 0, 0xf2, 0, 0x25}, response.GetData()) {
+		t.Errorf("expected the request echoed, got %v", response.GetData())
+	}
+	if s.HoldingRegisters[4] != 0x17 {
+		t.Errorf("expected 0x17, got 0x%x", s.HoldingRegisters[4])
+	}
+
+	frame.SetData([]byte{0, 4, 0, 0xf2})
+	if exception := GetException(s.handle(&Request{frame: frame})); exception != IllegalDataValue {
+		t.Errorf("expected IllegalDataValue for a short request, got %v", exception.String())
+	}
+}
+
+// Function 23 writes before it reads.
+func TestReadWriteMultipleRegisters(t *testing.T) {
+	s := NewServer()
+	s.HoldingRegisters[0] = 7
+
+	frame := &TCPFrame{Device: 1, Function: ReadWriteMultipleRegistersFC}
+	frame.SetData([]byte{0, 0, 0, 3, 0, 1, 0, 2, 4, 0, 8, 0, 9})
+	response := s.handle(&Request{frame: frame})
+	if exception := GetException(response); exception != Success {
+		t.Fatalf("expected Success, got %v", exception.String())
+	}
+	if !isEqual([]byte{6, 0, 7, 0, 8, 0, 9}, response.GetData()) {
+		t.Errorf("expected the written registers in the read, got %v", response.GetData())
+	}
+
+	for _, test := range []struct {
+		data   []byte
+		expect Exception
+	}{
+		{[]byte{0, 0, 0, 1, 0, 1, 0, 2, 2, 0, 8}, IllegalDataValue},
+		{[]byte{0, 0, 0, 126, 0, 1, 0, 1, 2, 0, 8}, IllegalDataValue},
+		{[]byte{0, 0, 0, 1, 0, 1, 0, 122, 244}, IllegalDataValue},
+		{[]byte{0xff, 0xff, 0, 2, 0, 1, 0, 1, 2, 0, 8}, IllegalDataAddress},
+		{[]byte{0, 0, 0, 1, 0xff, 0xff, 0, 2, 4, 0, 8, 0, 9}, IllegalDataAddress},
+	} {
+		frame.SetData(test.data)
+		if exception := GetException(s.handle(&Request{frame: frame})); exception != test.expect {
+			t.Errorf("expected %v for %v, got %v", test.expect.String(), test.data, exception.String())
+		}
+	}
+	if s.HoldingRegisters[1] != 8 {
+		t.Errorf("expected rejected requests not to write, got %v", s.HoldingRegisters[1])
+	}
+}
+
 func TestBytesToUint16(t *testing.T) {
 	bytes := []byte{1, 2, 3, 4}
 	got := BytesToUint16(bytes)
@@ -329,3 +461,303 @@ func TestOutOfBounds(t *testing.T) {
 		t.Errorf("expected IllegalDataAddress, got %v", exception.String())
 	}
 }
+
+// Function 24
+func TestReadFIFOQueue(t *testing.T) {
+	s := NewServer()
+	s.SetFIFOQueue(0x04DE, []uint16{0x01B8, 0x1284})
+
+	var frame TCPFrame
+	frame.Device = 1
+	frame.Function = 24
+	frame.SetData([]byte{0x04, 0xDE})
+
+	var req Request
+	req.frame = &frame
+	response := s.handle(&req)
+	exception := GetException(response)
+	if exception != Success {
+		t.Errorf("expected Success, got %v", exception.String())
+		t.FailNow()
+	}
+	expect := []byte{0, 6, 0, 2, 0x01, 0xB8, 0x12, 0x84}
+	got := response.GetData()
+	if !isEqual(expect, got) {
+		t.Errorf("expected %v, got %v", expect, got)
+	}
+
+	// Too many values.
+	s.SetFIFOQueue(0x04DE, make([]uint16, MaxFIFOCount+1))
+	response = s.handle(&req)
+	exception = GetException(response)
+	if exception != IllegalDataValue {
+		t.Errorf("expected IllegalDataValue, got %v", exception.String())
+	}
+
+	// No queue configured.
+	s.SetFIFOQueue(0x04DE, nil)
+	response = s.handle(&req)
+	exception = GetException(response)
+	if exception != IllegalDataAddress {
+		t.Errorf("expected IllegalDataAddress, got %v", exception.String())
+	}
+}
+
+func TestQuantityLimits(t *testing.T) {
+	s := NewServer()
+
+	var frame TCPFrame
+	frame.Device = 1
+
+	var req Request
+	req.frame = &frame
+
+	tests := []struct {
+		function uint8
+		quantity uint16
+	}{
+		{ReadCoilsFC, MaxReadBits + 1},
+		{ReadDiscreteInputsFC, MaxReadBits + 1},
+		{ReadHoldingRegistersFC, MaxReadRegisters + 1},
+		{ReadInputRegistersFC, MaxReadRegisters + 1},
+		{ReadHoldingRegistersFC, 0},
+	}
+	for _, test := range tests {
+		frame.Function = test.function
+		SetDataWithRegisterAndNumber(&frame, 0, test.quantity)
+		response := s.handle(&req)
+		exception := GetException(response)
+		if exception != IllegalDataValue {
+			t.Errorf("function %v quantity %v: expected IllegalDataValue, got %v", test.function, test.quantity, exception.String())
+		}
+	}
+
+	frame.Function = WriteHoldingRegistersFC
+	SetDataWithRegisterAndNumberAndValues(&frame, 0, MaxWriteRegisters+1, make([]uint16, MaxWriteRegisters+1))
+	response := s.handle(&req)
+	exception := GetException(response)
+	if exception != IllegalDataValue {
+		t.Errorf("expected IllegalDataValue, got %v", exception.String())
+	}
+}
+
+// Function 8
+func TestDiagnosticsReturnQueryData(t *testing.T) {
+	s := NewServer()
+
+	var frame TCPFrame
+	frame.Device = 1
+	frame.Function = 8
+	frame.SetData([]byte{0, 0, 0xA5, 0x37})
+
+	var req Request
+	req.frame = &frame
+	response := s.handle(&req)
+	exception := GetException(response)
+	if exception != Success {
+		t.Errorf("expected Success, got %v", exception.String())
+		t.FailNow()
+	}
+	expect := []byte{0, 0, 0xA5, 0x37}
+	got := response.GetData()
+	if !isEqual(expect, got) {
+		t.Errorf("expected %v, got %v", expect, got)
+	}
+
+	frame.SetData([]byte{0x12, 0x34, 0, 0})
+	response = s.handle(&req)
+	exception = GetException(response)
+	if exception != IllegalFunction {
+		t.Errorf("expected IllegalFunction, got %v", exception.String())
+	}
+}
+
+func TestRegisterDiagnosticSubFunction(t *testing.T) {
+	s := NewServer()
+	s.InputRegisters[0] = 0x1234
+	// A vendor-specific sub-function returning an input register.
+	s.RegisterDiagnosticSubFunction(0x4000, func(s *Server, data []byte) ([]byte, *Exception) {
+		if len(data) != 0 {
+			return []byte{}, &IllegalDataValue
+		}
+		return Uint16ToBytes(s.InputRegisters[0:1]), &Success
+	})
+	// Return Query Data overridden.
+	s.RegisterDiagnosticSubFunction(ReturnQueryData, func(s *Server, data []byte) ([]byte, *Exception) {
+		return []byte{0xbe, 0xef}, &Success
+	})
+	s.RegisterDiagnosticSubFunction(ForceListenOnlyMode, nil)
+
+	tests := []struct {
+		request   []byte
+		exception Exception
+		response  []byte
+	}{
+		{[]byte{0x40, 0x00}, Success, []byte{0x40, 0x00, 0x12, 0x34}},
+		{[]byte{0x40, 0x00, 0x00}, IllegalDataValue, nil},
+		{[]byte{0x00, 0x00, 0xa5, 0x37}, Success, []byte{0x00, 0x00, 0xbe, 0xef}},
+		{[]byte{0x00, ForceListenOnlyMode, 0x00, 0x00}, IllegalFunction, nil},
+		{[]byte{0x40, 0x01, 0x00, 0x00}, IllegalFunction, nil},
+	}
+	for _, test := range tests {
+		frame := &TCPFrame{Device: 1, Function: DiagnosticsFC}
+		frame.SetData(test.request)
+		response := s.handle(&Request{frame: frame})
+		if exception := GetException(response); exception != test.exception {
+			t.Errorf("%v: expected %v, got %v", test.request, test.exception.String(), exception.String())
+			continue
+		}
+		if test.exception == Success && !isEqual(test.response, response.GetData()) {
+			t.Errorf("%v: expected %v, got %v", test.request, test.response, response.GetData())
+		}
+	}
+	if s.ListenOnly() {
+		t.Errorf("expected the removed sub-function not to run")
+	}
+}
+
+func TestSetMaxQuantity(t *testing.T) {
+	s := NewServer()
+	s.SetMaxReadQuantity(16, 32)
+	s.SetMaxWriteQuantity(8, 0)
+
+	var frame TCPFrame
+	frame.Device = 1
+
+	var req Request
+	req.frame = &frame
+
+	tests := []struct {
+		function uint8
+		quantity uint16
+		expect   Exception
+	}{
+		{ReadHoldingRegistersFC, 16, Success},
+		{ReadHoldingRegistersFC, 17, IllegalDataValue},
+		{ReadInputRegistersFC, 17, IllegalDataValue},
+		{ReadCoilsFC, 32, Success},
+		{ReadDiscreteInputsFC, 33, IllegalDataValue},
+	}
+	for _, test := range tests {
+		frame.Function = test.function
+		SetDataWithRegisterAndNumber(&frame, 0, test.quantity)
+		exception := GetException(s.handle(&req))
+		if exception != test.expect {
+			t.Errorf("function %v quantity %v: expected %v, got %v", test.function, test.quantity, test.expect.String(), exception.String())
+		}
+	}
+
+	frame.Function = WriteHoldingRegistersFC
+	SetDataWithRegisterAndNumberAndValues(&frame, 0, 9, make([]uint16, 9))
+	if exception := GetException(s.handle(&req)); exception != IllegalDataValue {
+		t.Errorf("expected IllegalDataValue, got %v", exception.String())
+	}
+
+	// 0 keeps the specification maximum.
+	frame.Function = WriteMultipleCoilsFC
+	SetDataWithRegisterAndNumberAndBytes(&frame, 0, MaxWriteBits, make([]byte, (MaxWriteBits+7)/8))
+	if exception := GetException(s.handle(&req)); exception != Success {
+		t.Errorf("expected Success, got %v", exception.String())
+	}
+}
+
+func TestDiagnosticsListenOnlyMode(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	conn, master := net.Pipe()
+	defer master.Close()
+	client := s.trackConn(conn)
+
+	send := func(function uint8, data []byte) {
+		frame := &TCPFrame{Device: 1, Function: function}
+		frame.SetData(data)
+		s.requestChans[0] <- &Request{conn: client, frame: frame}
+	}
+	send(DiagnosticsFC, []byte{0, ForceListenOnlyMode, 0, 0})
+	send(WriteHoldingRegisterFC, []byte{0, 1, 0, 7})
+	send(DiagnosticsFC, []byte{0, RestartCommunications, 0, 0})
+	send(ReadHoldingRegistersFC, []byte{0, 1, 0, 1})
+
+	// Only the read after Restart Communications is answered.
+	response := make([]byte, 11)
+	master.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := io.ReadFull(master, response); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	expect := []byte{0, 0, 0, 0, 0, 5, 1, ReadHoldingRegistersFC, 2, 0, 7}
+	if !isEqual(expect, response) {
+		t.Errorf("expected %v, got %v", expect, response)
+	}
+	if s.ListenOnly() {
+		t.Errorf("expected listen only mode to be left")
+	}
+
+	// Restart Communications is answered outside listen only mode.
+	send(DiagnosticsFC, []byte{0, RestartCommunications, 0xff, 0})
+	response = make([]byte, 12)
+	if _, err := io.ReadFull(master, response); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	expect = []byte{0, 0, 0, 0, 0, 6, 1, DiagnosticsFC, 0, RestartCommunications, 0xff, 0}
+	if !isEqual(expect, response) {
+		t.Errorf("expected %v, got %v", expect, response)
+	}
+}
+
+func TestSetWireByteOrder(t *testing.T) {
+	for _, order := range []binary.ByteOrder{binary.BigEndian, binary.LittleEndian} {
+		s := NewServer()
+		s.SetWireByteOrder(order)
+		encoded := make([]byte, 4)
+		order.PutUint16(encoded[0:2], 0x1234)
+		order.PutUint16(encoded[2:4], 0xabcd)
+
+		var frame TCPFrame
+		frame.Device = 1
+		frame.Function = WriteHoldingRegistersFC
+		SetDataWithRegisterAndNumberAndBytes(&frame, 5, 2, encoded)
+		var req Request
+		req.frame = &frame
+		s.handle(&req)
+		if !isEqual([]uint16{0x1234, 0xabcd}, s.HoldingRegisters[5:7]) {
+			t.Errorf("%v: expected [0x1234 0xabcd], got %x", order, s.HoldingRegisters[5:7])
+		}
+
+		frame.Function = WriteHoldingRegisterFC
+		frame.SetData(append([]byte{0, 7}, encoded[0:2]...))
+		s.handle(&req)
+		if s.HoldingRegisters[7] != 0x1234 {
+			t.Errorf("%v: expected 0x1234, got %#x", order, s.HoldingRegisters[7])
+		}
+
+		s.InputRegisters[5], s.InputRegisters[6] = 0x1234, 0xabcd
+		for _, function := range []uint8{ReadHoldingRegistersFC, ReadInputRegistersFC} {
+			frame.Function = function
+			SetDataWithRegisterAndNumber(&frame, 5, 2)
+			response := s.handle(&req)
+			if !isEqual(append([]byte{4}, encoded...), response.GetData()) {
+				t.Errorf("%v function %v: expected %v, got %v", order, function, append([]byte{4}, encoded...), response.GetData())
+			}
+		}
+	}
+}
+
+func TestPackBits(t *testing.T) {
+	bits := make([]byte, 2000)
+	for i := range bits {
+		// Non-zero values other than 1 are set bits too.
+		bits[i] = []byte{0, 1, 0, 0, 2, 128, 255, 0, 1, 1, 0}[i%11]
+	}
+	for _, n := range []int{0, 1, 7, 8, 9, 16, 63, 2000} {
+		expect := make([]byte, 1+(n+7)/8)
+		expect[0] = byte(len(expect) - 1)
+		for i, value := range bits[:n] {
+			if value != 0 {
+				expect[1+i/8] |= 1 << (i % 8)
+			}
+		}
+		if got := packBits(bits[:n]); !isEqual(expect, got) {
+			t.Errorf("%v bits: expected %v, got %v", n, expect, got)
+		}
+	}
+}
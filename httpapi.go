@@ -0,0 +1,239 @@
+package mbserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HTTPReadHeaderTimeout bounds the time the endpoint started by ListenHTTP
+// waits for the headers of a request.
+const HTTPReadHeaderTimeout = 5 * time.Second
+
+// httpTables maps the table names of the HTTP endpoint to the memory maps.
+var httpTables = map[string]RegisterKind{
+	"coils":             Coil,
+	"discrete-inputs":   DiscreteInput,
+	"holding-registers": HoldingRegister,
+	"input-registers":   InputRegister,
+}
+
+// HTTPRegisters is the JSON body of the register requests of the HTTP
+// endpoint, see HTTPHandler.
+type HTTPRegisters struct {
+	Address uint16   `json:"address"`
+	Values  []uint16 `json:"values"`
+}
+
+// HTTPConnection describes a served connection or serial port in the
+// responses of the HTTP endpoint.
+type HTTPConnection struct {
+	RemoteAddr   string    `json:"remote_addr,omitempty"`
+	ConnectedAt  time.Time `json:"connected_at"`
+	LastActivity time.Time `json:"last_activity"`
+	BytesRead    uint64    `json:"bytes_read"`
+	BytesWritten uint64    `json:"bytes_written"`
+}
+
+// ListenHTTP starts an HTTP server on "address:port" serving the endpoint of
+// HTTPHandler, to inspect and change the memory maps with curl or a web
+// page while masters are connected. It is stopped by Close, and started
+// again by Restart. The endpoint has no authentication: bind it to the
+// loopback interface unless the network is trusted.
+func (s *Server) ListenHTTP(addressPort string) error {
+	listen, err := net.Listen("tcp", addressPort)
+	if err != nil {
+		s.logger.Printf("Failed to Listen: %v\n", err)
+		return err
+	}
+	server := &http.Server{Handler: s.HTTPHandler(), ReadHeaderTimeout: HTTPReadHeaderTimeout}
+
+	s.listenersLock.Lock()
+	s.httpEndpoints = append(s.httpEndpoints, httpEndpoint{server: server, listen: listen})
+	s.listenersLock.Unlock()
+	go server.Serve(listen)
+	s.rememberListen(listen, func() error { return s.ListenHTTP(addressPort) })
+	return nil
+}
+
+// httpEndpoint is an HTTP server started by ListenHTTP.
+type httpEndpoint struct {
+	server *http.Server
+	listen net.Listener
+}
+
+// close closes the listener itself, as the server only closes it once Serve
+// started, so that the address is free again once close returns.
+func (e httpEndpoint) close() {
+	e.listen.Close()
+	e.server.Close()
+}
+
+// HTTPHandler returns the handler of the endpoint started by ListenHTTP, to
+// be mounted on an HTTP server of the application instead:
+//
+//	GET /registers/{table}?address=0&quantity=10
+//	PUT /registers/{table}         {"address": 0, "values": [215, 16]}
+//	GET /connections
+//	GET /stats
+//
+// The table is one of coils, discrete-inputs, holding-registers or
+// input-registers, and coils and discrete inputs are given as 0 or 1. A unit
+// query parameter selects a unit added with AddUnit rather than the server.
+// Reads return an HTTPRegisters object, quantity defaulting to 1, and
+// connections a list of HTTPConnection objects. Errors are returned as
+// {"error": "..."}.
+//
+// The registers are read and written under the memory lock, like the
+// requests of masters, and writes fire the OnWrite callbacks with Function
+// set to 0, as WriteHoldingRegistersBatch does.
+func (s *Server) HTTPHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/registers/", s.serveHTTPRegisters)
+	mux.HandleFunc("/connections", s.serveHTTPConnections)
+	mux.HandleFunc("/stats", s.serveHTTPStats)
+	return mux
+}
+
+func (s *Server) serveHTTPRegisters(w http.ResponseWriter, r *http.Request) {
+	kind, ok := httpTables[strings.TrimPrefix(r.URL.Path, "/registers/")]
+	if !ok {
+		writeHTTPError(w, http.StatusNotFound, fmt.Errorf("unknown table %q", strings.TrimPrefix(r.URL.Path, "/registers/")))
+		return
+	}
+	target, err := s.httpUnit(r)
+	if err != nil {
+		writeHTTPError(w, http.StatusNotFound, err)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		address, err := httpQueryUint16(r, "address", 0)
+		if err != nil {
+			writeHTTPError(w, http.StatusBadRequest, err)
+			return
+		}
+		quantity, err := httpQueryUint16(r, "quantity", 1)
+		if err != nil {
+			writeHTTPError(w, http.StatusBadRequest, err)
+			return
+		}
+		values, err := target.ReadAnyRegisters(address, quantity, kind)
+		if err != nil {
+			writeHTTPError(w, httpErrorStatus(err), err)
+			return
+		}
+		writeHTTPJSON(w, HTTPRegisters{Address: address, Values: values})
+	case http.MethodPut, http.MethodPost:
+		var body HTTPRegisters
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeHTTPError(w, http.StatusBadRequest, err)
+			return
+		}
+		if err := target.writeAny(kind, body.Address, body.Values); err != nil {
+			writeHTTPError(w, httpErrorStatus(err), err)
+			return
+		}
+		if len(body.Values) > 0 {
+			target.runWriteCallbacks([]WriteEvent{{
+				Unit:    target.SlaveID(),
+				Kind:    kind,
+				Address: body.Address,
+				Values:  body.Values,
+			}})
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, PUT, POST")
+		writeHTTPError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %v not allowed", r.Method))
+	}
+}
+
+func (s *Server) serveHTTPConnections(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeHTTPError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %v not allowed", r.Method))
+		return
+	}
+	clients := s.Clients()
+	connections := make([]HTTPConnection, len(clients))
+	for i, client := range clients {
+		connections[i] = HTTPConnection{
+			ConnectedAt:  client.ConnectedAt,
+			LastActivity: client.LastActivity,
+			BytesRead:    client.BytesRead,
+			BytesWritten: client.BytesWritten,
+		}
+		if client.RemoteAddr != nil {
+			connections[i].RemoteAddr = client.RemoteAddr.String()
+		}
+	}
+	writeHTTPJSON(w, connections)
+}
+
+func (s *Server) serveHTTPStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeHTTPError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %v not allowed", r.Method))
+		return
+	}
+	writeHTTPJSON(w, s.Stats())
+}
+
+// httpUnit returns the server or unit selected by the unit query parameter.
+func (s *Server) httpUnit(r *http.Request) (*Server, error) {
+	param := r.URL.Query().Get("unit")
+	if param == "" {
+		return s, nil
+	}
+	id, err := strconv.ParseUint(param, 10, 8)
+	if err != nil {
+		return nil, fmt.Errorf("invalid unit %q", param)
+	}
+	if uint8(id) == s.SlaveID() {
+		return s, nil
+	}
+	unit := s.unit(uint8(id))
+	if unit == nil {
+		return nil, fmt.Errorf("no unit %v", id)
+	}
+	return unit.Server, nil
+}
+
+func httpQueryUint16(r *http.Request, name string, value uint16) (uint16, error) {
+	param := r.URL.Query().Get(name)
+	if param == "" {
+		return value, nil
+	}
+	parsed, err := strconv.ParseUint(param, 10, 16)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %v %q", name, param)
+	}
+	return uint16(parsed), nil
+}
+
+// httpErrorStatus returns the status answering a failed read or write:
+// invalid ranges are the fault of the client, store errors of the server.
+func httpErrorStatus(err error) int {
+	if errors.Is(err, ErrAddressOutOfRange) || errors.Is(err, ErrQuantityExceedsLimit) {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+func writeHTTPJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeHTTPError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
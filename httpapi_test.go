@@ -0,0 +1,121 @@
+package mbserver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHTTPHandler(t *testing.T) {
+	s := NewServer(WithLogger(discardLogger{}))
+	unit := s.AddUnit(2)
+	s.WriteHoldingRegisters(10, []uint16{215, 16})
+	var events []WriteEvent
+	s.OnWrite(func(event WriteEvent) {
+		events = append(events, event)
+	})
+	api := httptest.NewServer(s.HTTPHandler())
+	defer api.Close()
+
+	get := func(path string, v interface{}) int {
+		t.Helper()
+		resp, err := http.Get(api.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if v != nil && resp.StatusCode == http.StatusOK {
+			if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return resp.StatusCode
+	}
+	put := func(path, body string) int {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPut, api.URL+path, strings.NewReader(body))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	var registers HTTPRegisters
+	if status := get("/registers/holding-registers?address=10&quantity=2", &registers); status != http.StatusOK {
+		t.Fatalf("expected 200, got %v", status)
+	}
+	if !isEqual(HTTPRegisters{Address: 10, Values: []uint16{215, 16}}, registers) {
+		t.Errorf("expected the holding registers, got %v", registers)
+	}
+
+	if status := put("/registers/coils", `{"address": 3, "values": [1, 0, 1]}`); status != http.StatusNoContent {
+		t.Fatalf("expected 204, got %v", status)
+	}
+	if coils, _ := s.ReadCoils(3, 3); !isEqual([]bool{true, false, true}, coils) {
+		t.Errorf("expected the coils to be written, got %v", coils)
+	}
+	if len(events) != 1 || events[0].Kind != Coil || events[0].Address != 3 || events[0].Function != 0 {
+		t.Errorf("expected a write event for the coils, got %v", events)
+	}
+
+	if status := put("/registers/input-registers?unit=2", `{"address": 0, "values": [7]}`); status != http.StatusNoContent {
+		t.Fatalf("expected 204, got %v", status)
+	}
+	if values, _ := unit.ReadInputRegisters(0, 1); !isEqual([]uint16{7}, values) {
+		t.Errorf("expected the unit input register to be written, got %v", values)
+	}
+
+	for path, want := range map[string]int{
+		"/registers/unknown":                                    http.StatusNotFound,
+		"/registers/coils?unit=9":                               http.StatusNotFound,
+		"/registers/coils?address=x":                            http.StatusBadRequest,
+		"/registers/holding-registers?address=65535&quantity=2": http.StatusBadRequest,
+	} {
+		if status := get(path, nil); status != want {
+			t.Errorf("GET %v: expected %v, got %v", path, want, status)
+		}
+	}
+	if status := put("/registers/holding-registers", `{"address": 65535, "values": [1, 2]}`); status != http.StatusBadRequest {
+		t.Errorf("expected 400 for a write beyond the memory map, got %v", status)
+	}
+
+	var connections []HTTPConnection
+	if status := get("/connections", &connections); status != http.StatusOK || len(connections) != 0 {
+		t.Errorf("expected no connections, got %v %v", status, connections)
+	}
+
+	s.handle(&Request{frame: &TCPFrame{Device: 1, Function: ReadCoilsFC, Data: []byte{0, 0, 0, 1}}})
+	var stats Stats
+	if status := get("/stats", &stats); status != http.StatusOK || stats.Requests[ReadCoilsFC] != 1 {
+		t.Errorf("expected the stats to count the request, got %v %v", status, stats)
+	}
+}
+
+func TestListenHTTPRestart(t *testing.T) {
+	s := NewServer(WithLogger(discardLogger{}))
+	addr := getFreePort()
+	if err := s.ListenHTTP(addr); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Restart(); err != nil {
+		t.Fatalf("expected the endpoint to be opened again, got %v", err)
+	}
+	defer s.Close()
+
+	resp, err := http.Get("http://" + addr + "/stats")
+	if err != nil {
+		t.Fatalf("expected the restarted endpoint to answer, got %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected 200, got %v", resp.StatusCode)
+	}
+}
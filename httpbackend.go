@@ -0,0 +1,118 @@
+package mbserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HTTPBackendTimeout bounds each request made by HTTPBackendHandler.
+const HTTPBackendTimeout = 2 * time.Second
+
+// HTTPMapping maps a block of registers onto an HTTP endpoint, see
+// HTTPBackendHandler.
+type HTTPMapping struct {
+	// Start and End are the first and last register addresses of the block.
+	Start uint16
+	End   uint16
+	// Path is appended to the base URL to get the values of the block.
+	Path string
+}
+
+// HTTPBackendHandler returns a handler for Read Holding Registers or Read
+// Input Registers that fetches the register values from an HTTP backend,
+// to be registered with RegisterFunctionHandler:
+//
+//	s.RegisterFunctionHandler(ReadHoldingRegistersFC, HTTPBackendHandler("http://plant/api", time.Second,
+//		HTTPMapping{Start: 0, End: 9, Path: "/pump/1"},
+//		HTTPMapping{Start: 100, End: 119, Path: "/tank/levels"},
+//	))
+//
+// A GET request to the base URL followed by the path of a mapping must return
+// a JSON array holding one number per register of the block. The values are
+// cached for ttl, so that polling masters do not hit the backend on every
+// read. Reads that are not entirely inside one mapping return an
+// IllegalDataAddress exception, and backend errors a SlaveDeviceFailure
+// exception.
+//
+// Other requests wait for the backend, so keep it close or the ttl long.
+func HTTPBackendHandler(baseURL string, ttl time.Duration, mappings ...HTTPMapping) func(*Server, Framer) ([]byte, *Exception) {
+	backend := &httpBackend{
+		baseURL:  strings.TrimSuffix(baseURL, "/"),
+		ttl:      ttl,
+		mappings: mappings,
+		client:   &http.Client{Timeout: HTTPBackendTimeout},
+		cache:    make(map[int]httpCacheEntry),
+	}
+	return backend.handle
+}
+
+type httpBackend struct {
+	baseURL  string
+	ttl      time.Duration
+	mappings []HTTPMapping
+	client   *http.Client
+
+	lock  sync.Mutex
+	cache map[int]httpCacheEntry
+}
+
+type httpCacheEntry struct {
+	values  []uint16
+	fetched time.Time
+}
+
+func (b *httpBackend) handle(s *Server, frame Framer) ([]byte, *Exception) {
+	register, numRegs, _ := registerAddressAndNumber(frame)
+	if numRegs == 0 || numRegs > s.maxQuantity(readRegistersLimit) {
+		return []byte{}, &IllegalDataValue
+	}
+
+	for i, mapping := range b.mappings {
+		if register < int(mapping.Start) || register+numRegs-1 > int(mapping.End) {
+			continue
+		}
+		values, err := b.values(i)
+		if err != nil {
+			s.logger.Printf("HTTP backend error %v\n", err)
+			return []byte{}, &SlaveDeviceFailure
+		}
+		offset := register - int(mapping.Start)
+		return append([]byte{byte(numRegs * 2)}, s.encodeRegisters(values[offset:offset+numRegs])...), &Success
+	}
+	return []byte{}, &IllegalDataAddress
+}
+
+// values returns the values of a mapping, from the cache while fresh.
+func (b *httpBackend) values(i int) ([]uint16, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if entry, ok := b.cache[i]; ok && time.Since(entry.fetched) < b.ttl {
+		return entry.values, nil
+	}
+
+	mapping := b.mappings[i]
+	url := b.baseURL + mapping.Path
+	resp, err := b.client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %v: %v", url, resp.Status)
+	}
+
+	var values []uint16
+	if err := json.NewDecoder(resp.Body).Decode(&values); err != nil {
+		return nil, fmt.Errorf("GET %v: %v", url, err)
+	}
+	if want := int(mapping.End) - int(mapping.Start) + 1; len(values) != want {
+		return nil, fmt.Errorf("GET %v: got %d values, expected %d", url, len(values), want)
+	}
+	b.cache[i] = httpCacheEntry{values: values, fetched: time.Now()}
+	return values, nil
+}
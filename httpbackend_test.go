@@ -0,0 +1,63 @@
+package mbserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHTTPBackendHandler(t *testing.T) {
+	var hits atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		switch r.URL.Path {
+		case "/pump":
+			w.Write([]byte("[1, 2, 3, 4]"))
+		case "/short":
+			w.Write([]byte("[1]"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer backend.Close()
+
+	s := NewServer(WithLogger(discardLogger{}))
+	s.RegisterFunctionHandler(ReadHoldingRegistersFC, HTTPBackendHandler(backend.URL+"/", time.Minute,
+		HTTPMapping{Start: 10, End: 13, Path: "/pump"},
+		HTTPMapping{Start: 20, End: 21, Path: "/short"},
+		HTTPMapping{Start: 30, End: 30, Path: "/missing"},
+	))
+
+	read := func(address, quantity uint16) Framer {
+		frame := &TCPFrame{Device: 1, Function: ReadHoldingRegistersFC}
+		SetDataWithRegisterAndNumber(frame, address, quantity)
+		return s.handle(&Request{frame: frame})
+	}
+
+	response := read(11, 2)
+	if !isEqual([]byte{4, 0, 2, 0, 3}, response.GetData()) {
+		t.Errorf("expected [4 0 2 0 3], got %v", response.GetData())
+	}
+	read(10, 4)
+	if hits.Load() != 1 {
+		t.Errorf("expected the values to be cached, got %v backend requests", hits.Load())
+	}
+
+	tests := []struct {
+		address, quantity uint16
+		expect            Exception
+	}{
+		{12, 3, IllegalDataAddress},
+		{0, 1, IllegalDataAddress},
+		{20, 1, SlaveDeviceFailure},
+		{30, 1, SlaveDeviceFailure},
+		{10, 0, IllegalDataValue},
+	}
+	for _, test := range tests {
+		if exception := GetException(read(test.address, test.quantity)); exception != test.expect {
+			t.Errorf("%v-%v: expected %v, got %v", test.address, test.quantity, test.expect.String(), exception.String())
+		}
+	}
+}
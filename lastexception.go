@@ -0,0 +1,25 @@
+package mbserver
+
+import "time"
+
+type lastException struct {
+	exception *Exception
+	at        time.Time
+}
+
+// LastException returns the most recent exception the server answered a
+// request for the function code with, and when. It returns nil and the zero
+// time when no request for the function code has failed.
+func (s *Server) LastException(funcCode uint8) (*Exception, time.Time) {
+	s.exceptionLock.Lock()
+	defer s.exceptionLock.Unlock()
+
+	last := s.lastExceptions[funcCode]
+	return last.exception, last.at
+}
+
+func (s *Server) recordException(funcCode uint8, exception *Exception) {
+	s.exceptionLock.Lock()
+	s.lastExceptions[funcCode] = lastException{exception: exception, at: time.Now()}
+	s.exceptionLock.Unlock()
+}
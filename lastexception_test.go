@@ -0,0 +1,33 @@
+package mbserver
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLastException(t *testing.T) {
+	s := NewServer()
+	if exception, at := s.LastException(ReadHoldingRegistersFC); exception != nil || !at.IsZero() {
+		t.Errorf("expected no exception, got %v at %v", exception, at)
+	}
+
+	before := time.Now()
+	frame := &TCPFrame{Device: 1, Function: ReadHoldingRegistersFC}
+	SetDataWithRegisterAndNumber(frame, 65535, 2)
+	s.handle(&Request{frame: frame})
+
+	// A later successful request does not clear it.
+	SetDataWithRegisterAndNumber(frame, 0, 1)
+	s.handle(&Request{frame: frame})
+
+	exception, at := s.LastException(ReadHoldingRegistersFC)
+	if exception == nil || *exception != IllegalDataAddress {
+		t.Errorf("expected IllegalDataAddress, got %v", exception)
+	}
+	if at.Before(before) {
+		t.Errorf("expected a time after %v, got %v", before, at)
+	}
+	if exception, _ := s.LastException(ReadCoilsFC); exception != nil {
+		t.Errorf("expected no exception for function 1, got %v", exception)
+	}
+}
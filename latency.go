@@ -0,0 +1,123 @@
+package mbserver
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// LatencyStats summarizes the time taken to serve requests, from the moment
+// a request was read to the moment its response was written. Percentiles are
+// estimated from a histogram with buckets 10% wide.
+type LatencyStats struct {
+	Count uint64
+	Min   time.Duration
+	Max   time.Duration
+	Mean  time.Duration
+	P50   time.Duration
+	P90   time.Duration
+	P99   time.Duration
+}
+
+const (
+	// latencyBase is the upper bound of the first histogram bucket.
+	latencyBase = time.Microsecond
+	// latencyGrowth is the ratio between the bounds of consecutive buckets.
+	latencyGrowth = 1.1
+	// latencyBuckets covers latencies up to about 100s, longer ones are
+	// counted in the last bucket.
+	latencyBuckets = 195
+)
+
+// latencyHistogram is a streaming estimator of the latency distribution,
+// using constant memory.
+type latencyHistogram struct {
+	lock    sync.Mutex
+	count   uint64
+	sum     time.Duration
+	min     time.Duration
+	max     time.Duration
+	buckets [latencyBuckets]uint64
+}
+
+func (h *latencyHistogram) record(d time.Duration) {
+	bucket := 0
+	if d > latencyBase {
+		bucket = int(math.Ceil(math.Log(float64(d)/float64(latencyBase)) / math.Log(latencyGrowth)))
+		if bucket >= latencyBuckets {
+			bucket = latencyBuckets - 1
+		}
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if h.count == 0 || d < h.min {
+		h.min = d
+	}
+	if d > h.max {
+		h.max = d
+	}
+	h.count++
+	h.sum += d
+	h.buckets[bucket]++
+}
+
+// percentile returns the upper bound of the bucket holding the p-th
+// percentile, clamped to the observed range. It is called with the lock held.
+func (h *latencyHistogram) percentile(p float64) time.Duration {
+	rank := uint64(math.Ceil(p * float64(h.count)))
+	var seen uint64
+	for i, n := range h.buckets {
+		seen += n
+		if seen >= rank {
+			d := time.Duration(float64(latencyBase) * math.Pow(latencyGrowth, float64(i)))
+			if d > h.max {
+				d = h.max
+			}
+			if d < h.min {
+				d = h.min
+			}
+			return d
+		}
+	}
+	return h.max
+}
+
+func (h *latencyHistogram) stats() LatencyStats {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if h.count == 0 {
+		return LatencyStats{}
+	}
+	return LatencyStats{
+		Count: h.count,
+		Min:   h.min,
+		Max:   h.max,
+		Mean:  h.sum / time.Duration(h.count),
+		P50:   h.percentile(0.50),
+		P90:   h.percentile(0.90),
+		P99:   h.percentile(0.99),
+	}
+}
+
+func (h *latencyHistogram) reset() {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.count, h.sum, h.min, h.max = 0, 0, 0, 0
+	h.buckets = [latencyBuckets]uint64{}
+}
+
+// LatencyStats returns the latency of the requests answered since the server
+// was created or ResetStats was called.
+func (s *Server) LatencyStats() LatencyStats {
+	return s.latency.stats()
+}
+
+// ResetStats clears the latency statistics and the counters of Stats.
+func (s *Server) ResetStats() {
+	s.latency.reset()
+	s.resetCounts()
+}
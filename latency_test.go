@@ -0,0 +1,50 @@
+package mbserver
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLatencyHistogram(t *testing.T) {
+	var h latencyHistogram
+	for i := 1; i <= 100; i++ {
+		h.record(time.Duration(i) * time.Millisecond)
+	}
+
+	stats := h.stats()
+	if stats.Count != 100 || stats.Min != time.Millisecond || stats.Max != 100*time.Millisecond {
+		t.Errorf("expected 100 requests from 1ms to 100ms, got %+v", stats)
+	}
+	if stats.Mean != 50500*time.Microsecond {
+		t.Errorf("expected a mean of 50.5ms, got %v", stats.Mean)
+	}
+	// Buckets are 10% wide.
+	for _, test := range []struct {
+		got, expect time.Duration
+	}{{stats.P50, 50 * time.Millisecond}, {stats.P90, 90 * time.Millisecond}, {stats.P99, 99 * time.Millisecond}} {
+		if test.got < test.expect || float64(test.got) > float64(test.expect)*1.1 {
+			t.Errorf("expected about %v, got %v", test.expect, test.got)
+		}
+	}
+
+	h.reset()
+	if stats := h.stats(); stats != (LatencyStats{}) {
+		t.Errorf("expected empty stats, got %+v", stats)
+	}
+}
+
+func TestLatencyStats(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	if _, err := s.RoundTrip([]byte{0, 1, 0, 0, 0, 6, 1, 3, 0, 0, 0, 1}); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if stats := s.LatencyStats(); stats.Count != 1 || stats.Max <= 0 {
+		t.Errorf("expected one request, got %+v", stats)
+	}
+	s.ResetStats()
+	if stats := s.LatencyStats(); stats.Count != 0 {
+		t.Errorf("expected no request, got %+v", stats)
+	}
+}
@@ -0,0 +1,46 @@
+package mbserver
+
+// Indexes of the quantity limits, see SetMaxReadQuantity and
+// SetMaxWriteQuantity.
+const (
+	readRegistersLimit = iota
+	readBitsLimit
+	writeRegistersLimit
+	writeBitsLimit
+)
+
+// specLimits are the maxima of the Modbus specification, in the order above.
+var specLimits = [4]int{MaxReadRegisters, MaxReadBits, MaxWriteRegisters, MaxWriteBits}
+
+// SetMaxReadQuantity lowers the number of registers (functions 3 and 4) and
+// coils or discrete inputs (functions 1 and 2) a single request may read, to
+// emulate constrained devices. Requests above the limits return an
+// IllegalDataValue exception. Values of 0 or above the specification maxima
+// (MaxReadRegisters and MaxReadBits, the defaults) restore the maxima.
+func (s *Server) SetMaxReadQuantity(registers, coils int) {
+	s.setQuantityLimit(readRegistersLimit, registers)
+	s.setQuantityLimit(readBitsLimit, coils)
+}
+
+// SetMaxWriteQuantity lowers the number of registers (function 16) and coils
+// (function 15) a single request may write, like SetMaxReadQuantity. The
+// defaults are MaxWriteRegisters and MaxWriteBits.
+func (s *Server) SetMaxWriteQuantity(registers, coils int) {
+	s.setQuantityLimit(writeRegistersLimit, registers)
+	s.setQuantityLimit(writeBitsLimit, coils)
+}
+
+func (s *Server) setQuantityLimit(limit int, n int) {
+	if n <= 0 || n > specLimits[limit] {
+		n = 0
+	}
+	s.quantityLimit[limit].Store(int32(n))
+}
+
+// maxQuantity returns the quantity limit in effect.
+func (s *Server) maxQuantity(limit int) int {
+	if n := s.quantityLimit[limit].Load(); n != 0 {
+		return int(n)
+	}
+	return specLimits[limit]
+}
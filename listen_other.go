@@ -0,0 +1,18 @@
+//go:build !linux && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd
+// +build !linux,!darwin,!dragonfly,!freebsd,!netbsd,!openbsd
+
+package mbserver
+
+import (
+	"context"
+	"net"
+)
+
+// listenTCPWithBacklog ignores the backlog on platforms where the listening
+// socket cannot be created by hand.
+func listenTCPWithBacklog(addressPort string, backlog int, config *net.ListenConfig) (net.Listener, error) {
+	if config != nil {
+		return config.Listen(context.Background(), "tcp", addressPort)
+	}
+	return net.Listen("tcp", addressPort)
+}
@@ -0,0 +1,97 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+// +build linux darwin dragonfly freebsd netbsd openbsd
+
+package mbserver
+
+import (
+	"net"
+	"os"
+	"syscall"
+)
+
+// listenTCPWithBacklog creates the listening socket by hand because the net
+// package always uses the system wide backlog. Only the Control function of
+// config is used.
+func listenTCPWithBacklog(addressPort string, backlog int, config *net.ListenConfig) (net.Listener, error) {
+	addr, err := net.ResolveTCPAddr("tcp", addressPort)
+	if err != nil {
+		return nil, err
+	}
+
+	network, family := "tcp4", syscall.AF_INET
+	var sa syscall.Sockaddr
+	switch ip4 := addr.IP.To4(); {
+	case addr.IP == nil:
+		// Like net.Listen, an empty host listens on both IPv4 and IPv6.
+		network, family = "tcp", syscall.AF_INET6
+		sa = &syscall.SockaddrInet6{Port: addr.Port}
+	case ip4 != nil:
+		sa4 := &syscall.SockaddrInet4{Port: addr.Port}
+		copy(sa4.Addr[:], ip4)
+		sa = sa4
+	default:
+		network, family = "tcp6", syscall.AF_INET6
+		sa6 := &syscall.SockaddrInet6{Port: addr.Port}
+		copy(sa6.Addr[:], addr.IP.To16())
+		sa = sa6
+	}
+
+	fd, err := syscall.Socket(family, syscall.SOCK_STREAM, syscall.IPPROTO_TCP)
+	if err != nil && addr.IP == nil {
+		// Without IPv6 support, fall back to the IPv4 wildcard address.
+		network, family = "tcp4", syscall.AF_INET
+		sa = &syscall.SockaddrInet4{Port: addr.Port}
+		fd, err = syscall.Socket(family, syscall.SOCK_STREAM, syscall.IPPROTO_TCP)
+	}
+	if err != nil {
+		return nil, os.NewSyscallError("socket", err)
+	}
+	syscall.CloseOnExec(fd)
+
+	if network == "tcp" {
+		if err = syscall.SetsockoptInt(fd, syscall.IPPROTO_IPV6, syscall.IPV6_V6ONLY, 0); err != nil {
+			syscall.Close(fd)
+			return nil, os.NewSyscallError("setsockopt", err)
+		}
+	}
+	if err = syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_REUSEADDR, 1); err != nil {
+		syscall.Close(fd)
+		return nil, os.NewSyscallError("setsockopt", err)
+	}
+	if config != nil && config.Control != nil {
+		if err = config.Control(network, addr.String(), fdConn(fd)); err != nil {
+			syscall.Close(fd)
+			return nil, err
+		}
+	}
+	if err = syscall.Bind(fd, sa); err != nil {
+		syscall.Close(fd)
+		return nil, os.NewSyscallError("bind", err)
+	}
+	if err = syscall.Listen(fd, backlog); err != nil {
+		syscall.Close(fd)
+		return nil, os.NewSyscallError("listen", err)
+	}
+
+	// FileListener dups the descriptor, so the file is always closed here.
+	file := os.NewFile(uintptr(fd), "tcp:"+addressPort)
+	defer file.Close()
+	return net.FileListener(file)
+}
+
+// fdConn is the syscall.RawConn of a socket created by hand, as passed to
+// net.ListenConfig.Control.
+type fdConn int
+
+func (fd fdConn) Control(f func(fd uintptr)) error {
+	f(uintptr(fd))
+	return nil
+}
+
+func (fd fdConn) Read(f func(fd uintptr) bool) error {
+	return syscall.EINVAL
+}
+
+func (fd fdConn) Write(f func(fd uintptr) bool) error {
+	return syscall.EINVAL
+}
@@ -0,0 +1,161 @@
+package mbserver
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// LogLevel selects the messages written to the logger, see SetLogLevel.
+type LogLevel int32
+
+const (
+	// LogError only logs errors, the default.
+	LogError LogLevel = iota
+	// LogInfo also logs one line per request, such as
+	// "unit=1 fn=ReadHoldingRegisters addr=40001 qty=10 -> ok (21 bytes)".
+	LogInfo
+)
+
+// SetLogLevel sets the level of the messages written to the logger. At
+// LogInfo, each request handled is logged with its decoded fields and
+// outcome, which is useful to operators but too verbose for most production
+// servers.
+func (s *Server) SetLogLevel(level LogLevel) {
+	s.logLevel.Store(int32(level))
+}
+
+// FunctionCode is a Modbus function code, printed by name.
+type FunctionCode uint8
+
+var functionNames = map[FunctionCode]string{
+	ReadCoilsFC:                      "ReadCoils",
+	ReadDiscreteInputsFC:             "ReadDiscreteInputs",
+	ReadHoldingRegistersFC:           "ReadHoldingRegisters",
+	ReadInputRegistersFC:             "ReadInputRegisters",
+	WriteSingleCoilFC:                "WriteSingleCoil",
+	WriteHoldingRegisterFC:           "WriteHoldingRegister",
+	DiagnosticsFC:                    "Diagnostics",
+	WriteMultipleCoilsFC:             "WriteMultipleCoils",
+	WriteHoldingRegistersFC:          "WriteHoldingRegisters",
+	MaskWriteRegisterFC:              "MaskWriteRegister",
+	ReadWriteMultipleRegistersFC:     "ReadWriteMultipleRegisters",
+	ReadFIFOQueueFC:                  "ReadFIFOQueue",
+	EncapsulatedInterfaceTransportFC: "ReadDeviceIdentification",
+}
+
+func (f FunctionCode) String() string {
+	if name, ok := functionNames[f]; ok {
+		return name
+	}
+	return fmt.Sprintf("Function(%d)", uint8(f))
+}
+
+// functionKinds is the memory map addressed by the functions with an address.
+var functionKinds = map[uint8]RegisterKind{
+	ReadCoilsFC:             Coil,
+	ReadDiscreteInputsFC:    DiscreteInput,
+	ReadHoldingRegistersFC:  HoldingRegister,
+	ReadInputRegistersFC:    InputRegister,
+	WriteSingleCoilFC:       Coil,
+	WriteHoldingRegisterFC:  HoldingRegister,
+	WriteMultipleCoilsFC:    Coil,
+	WriteHoldingRegistersFC: HoldingRegister,
+	MaskWriteRegisterFC:     HoldingRegister,
+	// The read range of Read/Write Multiple Registers.
+	ReadWriteMultipleRegistersFC: HoldingRegister,
+}
+
+// logRequest logs a request and its response at LogInfo.
+func (s *Server) logRequest(frame Framer, response Framer) {
+	if LogLevel(s.logLevel.Load()) < LogInfo {
+		return
+	}
+
+	var line strings.Builder
+	fmt.Fprintf(&line, "unit=%d fn=%v", frame.GetSlaveId(), FunctionCode(frame.GetFunction()))
+	if address, quantity, ok := requestRange(frame); ok {
+		kind := functionKinds[frame.GetFunction()]
+		fmt.Fprintf(&line, " addr=%v qty=%d", modiconReference(kind, uint16(address)), quantity)
+	}
+	switch {
+	case response == nil:
+		line.WriteString(" -> no response")
+	case GetException(response) != Success:
+		fmt.Fprintf(&line, " -> exception %v", GetException(response).String())
+	default:
+		fmt.Fprintf(&line, " -> ok (%d bytes)", len(response.GetData()))
+	}
+	s.logger.Printf("%v\n", line.String())
+}
+
+// modiconReference returns the Modicon reference of an address, in 5 digit
+// notation when it fits.
+func modiconReference(kind RegisterKind, address uint16) int {
+	offset := map[RegisterKind]int{Coil: 0, DiscreteInput: 10000, InputRegister: 30000, HoldingRegister: 40000}[kind]
+	if address < 9999 {
+		return offset + int(address) + 1
+	}
+	return offset*10 + int(address) + 1
+}
+
+// SetLogHandler sends structured events to handler, in addition to the
+// messages of the logger: frames received and sent (at debug level),
+// exceptions returned (info), connections accepted and closed (info) and
+// serial frame errors such as CRC errors (warn). Events about a request carry
+// the remote address of the master, the unit ID, the function code and, over
+// TCP, the transaction ID. A nil handler (the default) disables the events.
+// Units added with AddUnit without a handler of their own send their events
+// to the handler of the server.
+func (s *Server) SetLogHandler(handler slog.Handler) {
+	if handler == nil {
+		s.slogger.Store(nil)
+		return
+	}
+	s.slogger.Store(slog.New(handler))
+}
+
+// structuredLogger returns the logger set by SetLogHandler, that of the
+// server a unit was added to when it has none.
+func (s *Server) structuredLogger() *slog.Logger {
+	if logger := s.slogger.Load(); logger != nil || s.parent == nil {
+		return logger
+	}
+	return s.parent.slogger.Load()
+}
+
+// logEvent sends an event to the structured logger, if any is enabled at
+// level.
+func (s *Server) logEvent(ctx context.Context, level slog.Level, msg string, attrs ...slog.Attr) {
+	logger := s.structuredLogger()
+	if logger == nil || !logger.Enabled(ctx, level) {
+		return
+	}
+	logger.LogAttrs(ctx, level, msg, attrs...)
+}
+
+// logFrame sends an event about a request or its response.
+func (s *Server) logFrame(level slog.Level, msg string, request *Request, frame Framer, attrs ...slog.Attr) {
+	logger := s.structuredLogger()
+	if logger == nil || !logger.Enabled(request.Context(), level) {
+		return
+	}
+	if remote := request.RemoteAddr(); remote != nil {
+		attrs = append(attrs, slog.String("remote", remote.String()))
+	}
+	attrs = append(attrs, slog.Int("unit", int(frame.GetSlaveId())), slog.Any("function", FunctionCode(frame.GetFunction())))
+	if tcp, ok := frame.(*TCPFrame); ok {
+		attrs = append(attrs, slog.Int("transaction", int(tcp.TransactionIdentifier)))
+	}
+	logger.LogAttrs(request.Context(), level, msg, attrs...)
+}
+
+// logConn sends an event about a connection or serial port.
+func (s *Server) logConn(msg string, client *clientConn) {
+	if client.info.RemoteAddr == nil {
+		s.logEvent(context.Background(), slog.LevelInfo, msg)
+		return
+	}
+	s.logEvent(context.Background(), slog.LevelInfo, msg, slog.String("remote", client.info.RemoteAddr.String()))
+}
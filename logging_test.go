@@ -0,0 +1,127 @@
+package mbserver
+
+import (
+	"encoding/json"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/goburrow/modbus"
+)
+
+func TestSetLogLevel(t *testing.T) {
+	logs := make(chanLogger, 10)
+	s := NewServer(WithLogger(logs))
+
+	read := func(address, quantity uint16) {
+		frame := &TCPFrame{Device: 1, Function: ReadHoldingRegistersFC}
+		SetDataWithRegisterAndNumber(frame, address, quantity)
+		s.handle(&Request{frame: frame})
+	}
+
+	read(0, 10)
+	if len(logs) != 0 {
+		t.Errorf("expected no request log by default, got %q", <-logs)
+	}
+
+	s.SetLogLevel(LogInfo)
+	tests := []struct {
+		frame  Framer
+		expect string
+	}{
+		{&TCPFrame{Device: 1, Function: ReadHoldingRegistersFC, Data: []byte{0, 0, 0, 10}}, "unit=1 fn=ReadHoldingRegisters addr=40001 qty=10 -> ok (21 bytes)\n"},
+		{&TCPFrame{Device: 1, Function: ReadInputRegistersFC, Data: []byte{0xff, 0xff, 0, 2}}, "unit=1 fn=ReadInputRegisters addr=365536 qty=2 -> exception IllegalDataAddress\n"},
+		{&TCPFrame{Device: 1, Function: WriteSingleCoilFC, Data: []byte{0, 4, 0xff, 0}}, "unit=1 fn=WriteSingleCoil addr=5 qty=1 -> ok (4 bytes)\n"},
+		{&TCPFrame{Device: 1, Function: 100}, "unit=1 fn=Function(100) -> exception IllegalFunction\n"},
+	}
+	for _, test := range tests {
+		s.handle(&Request{frame: test.frame})
+		if line := <-logs; line != test.expect {
+			t.Errorf("expected %q, got %q", test.expect, line)
+		}
+	}
+}
+
+// eventWriter receives the events of a JSON slog handler, one per write.
+type eventWriter chan map[string]interface{}
+
+func (w eventWriter) Write(p []byte) (int, error) {
+	var event map[string]interface{}
+	if err := json.Unmarshal(p, &event); err != nil {
+		return 0, err
+	}
+	w <- event
+	return len(p), nil
+}
+
+func (w eventWriter) next(t *testing.T) map[string]interface{} {
+	t.Helper()
+	select {
+	case event := <-w:
+		return event
+	case <-time.After(time.Second):
+		t.Fatalf("expected an event")
+		return nil
+	}
+}
+
+func TestSetLogHandler(t *testing.T) {
+	events := make(eventWriter, 10)
+	s := NewServer()
+	s.SetLogHandler(slog.NewJSONHandler(events, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	s.SetUnitFunctions(1, []uint8{ReadHoldingRegistersFC})
+	addr, err := s.ListenTCPAny()
+	if err != nil {
+		t.Fatalf("failed to listen, got %v\n", err)
+	}
+	defer s.Close()
+
+	handler := modbus.NewTCPClientHandler(addr.String())
+	handler.SlaveId = 1
+	if err := handler.Connect(); err != nil {
+		t.Fatalf("failed to connect, got %v\n", err)
+	}
+	client := modbus.NewClient(handler)
+
+	if event := events.next(t); event["msg"] != "connection accepted" || event["level"] != "INFO" || event["remote"] == nil {
+		t.Errorf("expected the connection to be accepted, got %v", event)
+	}
+	if _, err := client.ReadHoldingRegisters(0, 1); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	received := events.next(t)
+	if received["msg"] != "frame received" || received["level"] != "DEBUG" || received["unit"] != 1.0 || received["function"] != 3.0 || received["transaction"] == nil {
+		t.Errorf("expected the frame to be received, got %v", received)
+	}
+	if sent := events.next(t); sent["msg"] != "frame sent" || sent["transaction"] != received["transaction"] {
+		t.Errorf("expected the response to be sent, got %v", sent)
+	}
+
+	client.ReadInputRegisters(0, 1)
+	events.next(t)
+	if event := events.next(t); event["msg"] != "exception returned" || event["function"] != 4.0 || event["exception"] != IllegalFunction.String() {
+		t.Errorf("expected an exception, got %v", event)
+	}
+	events.next(t)
+
+	handler.Close()
+	if event := events.next(t); event["msg"] != "connection closed" {
+		t.Errorf("expected the connection to be closed, got %v", event)
+	}
+
+	s.SetLogHandler(nil)
+	s.notifySerialFrameError([]byte{1, 2}, BadCRC)
+	if len(events) != 0 {
+		t.Errorf("expected no event once removed, got %v", <-events)
+	}
+}
+
+func TestLogHandlerFrameError(t *testing.T) {
+	events := make(eventWriter, 1)
+	s := NewServer()
+	s.SetLogHandler(slog.NewJSONHandler(events, nil))
+	s.notifySerialFrameError([]byte{1, 2, 3}, BadCRC)
+	if event := events.next(t); event["msg"] != "frame error" || event["level"] != "WARN" || event["reason"] != BadCRC || event["length"] != 3.0 {
+		t.Errorf("expected a frame error, got %v", event)
+	}
+}
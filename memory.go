@@ -0,0 +1,306 @@
+package mbserver
+
+import "fmt"
+
+// sparseMemory backs the memory maps with Go maps in sparse mode. Only
+// non-zero values are stored.
+type sparseMemory struct {
+	size   [4]int
+	values [4]map[uint16]uint16
+}
+
+func newSparseMemory(coils, discreteInputs, holdingRegisters, inputRegisters int) *sparseMemory {
+	m := &sparseMemory{
+		size: [4]int{coils, discreteInputs, holdingRegisters, inputRegisters},
+	}
+	for kind := range m.values {
+		m.values[kind] = make(map[uint16]uint16)
+	}
+	return m
+}
+
+func (m *sparseMemory) get(kind RegisterKind, address int) uint16 {
+	return m.values[kind][uint16(address)]
+}
+
+func (m *sparseMemory) set(kind RegisterKind, address int, value uint16) {
+	if value == 0 {
+		delete(m.values[kind], uint16(address))
+	} else {
+		m.values[kind][uint16(address)] = value
+	}
+}
+
+// SetSparse switches the memory maps between the dense slices (the default)
+// and sparse storage. The current values are carried over.
+//
+// Sparse storage keeps only non-zero values in Go maps, which saves memory
+// when simulating many devices with few populated addresses, but each read
+// and write becomes a map operation instead of a slice index. While sparse,
+// the Coils, DiscreteInputs, HoldingRegisters and InputRegisters slices are
+// nil. SetSparse must not be called while requests are being served, and has
+// no effect on servers created with NewServerWithStore.
+func (s *Server) SetSparse(sparse bool) {
+	if s.store != nil || sparse == (s.sparse != nil) {
+		return
+	}
+
+	if sparse {
+		m := newSparseMemory(len(s.Coils), len(s.DiscreteInputs), len(s.HoldingRegisters), len(s.InputRegisters))
+		for i, value := range s.Coils {
+			m.set(Coil, i, uint16(value))
+		}
+		for i, value := range s.DiscreteInputs {
+			m.set(DiscreteInput, i, uint16(value))
+		}
+		for i, value := range s.HoldingRegisters {
+			m.set(HoldingRegister, i, value)
+		}
+		for i, value := range s.InputRegisters {
+			m.set(InputRegister, i, value)
+		}
+		s.Coils, s.DiscreteInputs, s.HoldingRegisters, s.InputRegisters = nil, nil, nil, nil
+		s.sparse = m
+		return
+	}
+
+	m := s.sparse
+	s.sparse = nil
+	s.Coils = make([]byte, m.size[Coil])
+	s.DiscreteInputs = make([]byte, m.size[DiscreteInput])
+	s.HoldingRegisters = make([]uint16, m.size[HoldingRegister])
+	s.InputRegisters = make([]uint16, m.size[InputRegister])
+	for kind, values := range m.values {
+		for address, value := range values {
+			if int(address) < m.size[kind] {
+				s.writeRegisters(RegisterKind(kind), int(address), []uint16{value})
+			}
+		}
+	}
+}
+
+// RegisterCounts returns the number of coils, discrete inputs, holding
+// registers and input registers allocated, as configured when the server was
+// created. Function handlers should check addresses against these rather than
+// MaxRegisterSize. It may be called from a function handler.
+func (s *Server) RegisterCounts() (coils, discreteInputs, holding, input int) {
+	return s.counts[Coil], s.counts[DiscreteInput], s.counts[HoldingRegister], s.counts[InputRegister]
+}
+
+// bankSize returns the number of items allocated for a memory map.
+func (s *Server) bankSize(kind RegisterKind) int {
+	if s.store != nil {
+		return s.counts[kind]
+	}
+	if s.sparse != nil {
+		return s.sparse.size[kind]
+	}
+	switch kind {
+	case Coil:
+		return len(s.Coils)
+	case DiscreteInput:
+		return len(s.DiscreteInputs)
+	case HoldingRegister:
+		return len(s.HoldingRegisters)
+	case InputRegister:
+		return len(s.InputRegisters)
+	}
+	return 0
+}
+
+// readBits returns the values of coils or discrete inputs. In dense mode the
+// returned slice aliases the memory map.
+func (s *Server) readBits(kind RegisterKind, address int, quantity int) ([]byte, error) {
+	if s.store != nil {
+		bits, err := s.store.ReadBits(kind, uint16(address), uint16(quantity))
+		if err == nil && len(bits) != quantity {
+			err = fmt.Errorf("store returned %d values for %d %v", len(bits), quantity, kind)
+		}
+		return bits, err
+	}
+	if s.sparse != nil {
+		bits := make([]byte, quantity)
+		for i := range bits {
+			bits[i] = byte(s.sparse.get(kind, address+i))
+		}
+		return bits, nil
+	}
+	if kind == DiscreteInput {
+		return s.DiscreteInputs[address : address+quantity], nil
+	}
+	return s.Coils[address : address+quantity], nil
+}
+
+// writeBits sets coils or discrete inputs, values are 0 or 1.
+func (s *Server) writeBits(kind RegisterKind, address int, values []byte) error {
+	if s.store != nil {
+		return s.store.WriteBits(kind, uint16(address), values)
+	}
+	if s.sparse != nil {
+		for i, value := range values {
+			s.sparse.set(kind, address+i, uint16(value))
+		}
+		return nil
+	}
+	if kind == DiscreteInput {
+		copy(s.DiscreteInputs[address:], values)
+	} else {
+		copy(s.Coils[address:], values)
+	}
+	return nil
+}
+
+// readRegisters returns the values of holding or input registers. In dense
+// mode the returned slice aliases the memory map. Coils and discrete inputs
+// are accepted too, and copied.
+func (s *Server) readRegisters(kind RegisterKind, address int, quantity int) ([]uint16, error) {
+	if kind == Coil || kind == DiscreteInput {
+		bits, err := s.readBits(kind, address, quantity)
+		if err != nil {
+			return nil, err
+		}
+		values := make([]uint16, len(bits))
+		for i, bit := range bits {
+			values[i] = uint16(bit)
+		}
+		return values, nil
+	}
+	if s.store != nil {
+		values, err := s.store.ReadRegisters(kind, uint16(address), uint16(quantity))
+		if err == nil && len(values) != quantity {
+			err = fmt.Errorf("store returned %d values for %d %v", len(values), quantity, kind)
+		}
+		return values, err
+	}
+	if s.sparse != nil {
+		values := make([]uint16, quantity)
+		for i := range values {
+			values[i] = s.sparse.get(kind, address+i)
+		}
+		return values, nil
+	}
+	if kind == InputRegister {
+		return s.InputRegisters[address : address+quantity], nil
+	}
+	return s.HoldingRegisters[address : address+quantity], nil
+}
+
+// writeRegisters sets holding or input registers. Coils and discrete inputs
+// are accepted too, with non-zero values stored as 1.
+func (s *Server) writeRegisters(kind RegisterKind, address int, values []uint16) error {
+	if kind == Coil || kind == DiscreteInput {
+		bits := make([]byte, len(values))
+		for i, value := range values {
+			if value != 0 {
+				bits[i] = 1
+			}
+		}
+		return s.writeBits(kind, address, bits)
+	}
+	if s.store != nil {
+		return s.store.WriteRegisters(kind, uint16(address), values)
+	}
+	if s.sparse != nil {
+		for i, value := range values {
+			s.sparse.set(kind, address+i, value)
+		}
+		return nil
+	}
+	if kind == InputRegister {
+		copy(s.InputRegisters[address:], values)
+	} else {
+		copy(s.HoldingRegisters[address:], values)
+	}
+	return nil
+}
+
+// RegisterSnapshotInto copies len(dst) values of a memory map, starting at
+// the start address, into dst. Coils and discrete inputs are copied as 0 or 1.
+// Unlike reading the exported slices, the copy is taken while no request is
+// being processed, and no memory is allocated in dense mode, which suits
+// polling a fixed window at a high rate.
+//
+// An error wrapping ErrAddressOutOfRange is returned, and dst left untouched,
+// when the range extends beyond the memory map. Errors of the Store of a
+// server created with NewServerWithStore are returned as is.
+func (s *Server) RegisterSnapshotInto(dst []uint16, kind RegisterKind, start uint16) error {
+	if len(dst) == 0 {
+		return nil
+	}
+
+	s.memoryLock.RLock()
+	defer s.memoryLock.RUnlock()
+
+	if err := checkRange(int(start), len(dst), s.bankSize(kind), MaxRegisterSize); err != nil {
+		return err
+	}
+	if s.sparse != nil {
+		for i := range dst {
+			dst[i] = s.sparse.get(kind, int(start)+i)
+		}
+		return nil
+	}
+	if s.store == nil && (kind == Coil || kind == DiscreteInput) {
+		bits, _ := s.readBits(kind, int(start), len(dst))
+		for i, value := range bits {
+			dst[i] = uint16(value)
+		}
+		return nil
+	}
+	values, err := s.readRegisters(kind, int(start), len(dst))
+	if err != nil {
+		return err
+	}
+	copy(dst, values)
+	return nil
+}
+
+// ReadAnyRegisters returns a copy of qty values of any memory map from addr,
+// coils and discrete inputs as 0 or 1, taken while no request is being
+// processed. The range is validated as by the built-in read functions,
+// regions mapped with MapRegion and gaps included, except for the per
+// request quantity limit: an error wrapping ErrAddressOutOfRange is returned
+// when it extends beyond the memory map, and one wrapping
+// ErrQuantityExceedsLimit when qty is 0. Errors of the Store of a server
+// created with NewServerWithStore are returned as is.
+func (s *Server) ReadAnyRegisters(addr uint16, qty uint16, kind RegisterKind) ([]uint16, error) {
+	s.memoryLock.RLock()
+	defer s.memoryLock.RUnlock()
+
+	if err := s.validateReadRange(kind, int(addr), int(qty), MaxRegisterSize); err != nil {
+		return nil, err
+	}
+	values, err := s.readRegisters(kind, int(addr), int(qty))
+	if err != nil {
+		return nil, err
+	}
+	return append([]uint16(nil), values...), nil
+}
+
+// WriteHoldingRegistersBatch sets len(values) holding registers from addr
+// under a single acquisition of the memory lock, then fires the OnWrite
+// callbacks once, on the calling goroutine, with an event covering the whole
+// range. Function is 0 in that event, as no request made the change. Use it
+// rather than one setter call per register for bulk updates by the
+// application.
+//
+// The whole range is checked first: an error wrapping ErrAddressOutOfRange
+// is returned, and no register written, when it extends beyond the holding
+// registers. Errors of the Store of a server created with NewServerWithStore
+// are returned as is, and no callback is fired then.
+func (s *Server) WriteHoldingRegistersBatch(addr uint16, values []uint16) error {
+	if len(values) == 0 {
+		return nil
+	}
+	if err := s.writeAny(HoldingRegister, addr, values); err != nil {
+		return err
+	}
+
+	s.runWriteCallbacks([]WriteEvent{{
+		Unit:    s.SlaveID(),
+		Kind:    HoldingRegister,
+		Address: addr,
+		Values:  append([]uint16(nil), values...),
+	}})
+	return nil
+}
@@ -0,0 +1,198 @@
+package mbserver
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSparseMatchesDense(t *testing.T) {
+	dense := NewServer()
+	sparse := NewServer(WithSparse())
+	if sparse.HoldingRegisters != nil {
+		t.Fatalf("expected no dense holding registers in sparse mode")
+	}
+
+	requests := []struct {
+		function uint8
+		setData  func(frame Framer)
+	}{
+		{WriteMultipleCoilsFC, func(f Framer) { SetDataWithRegisterAndNumberAndBytes(f, 100, 10, []byte{0xA5, 0x03}) }},
+		{ReadCoilsFC, func(f Framer) { SetDataWithRegisterAndNumber(f, 98, 16) }},
+		{WriteSingleCoilFC, func(f Framer) { SetDataWithRegisterAndNumber(f, 65535, 0xFF00) }},
+		{ReadCoilsFC, func(f Framer) { SetDataWithRegisterAndNumber(f, 65534, 2) }},
+		{WriteHoldingRegistersFC, func(f Framer) { SetDataWithRegisterAndNumberAndValues(f, 7, 3, []uint16{1, 0, 65535}) }},
+		{WriteHoldingRegisterFC, func(f Framer) { SetDataWithRegisterAndNumber(f, 8, 42) }},
+		{ReadHoldingRegistersFC, func(f Framer) { SetDataWithRegisterAndNumber(f, 5, 6) }},
+		{ReadInputRegistersFC, func(f Framer) { SetDataWithRegisterAndNumber(f, 0, 4) }},
+		{ReadDiscreteInputsFC, func(f Framer) { SetDataWithRegisterAndNumber(f, 0, 9) }},
+		{ReadHoldingRegistersFC, func(f Framer) { SetDataWithRegisterAndNumber(f, 65535, 2) }},
+	}
+	for i, request := range requests {
+		var responses [][]byte
+		for _, s := range []*Server{dense, sparse} {
+			frame := &TCPFrame{Device: 1, Function: request.function}
+			request.setData(frame)
+			responses = append(responses, s.handle(&Request{frame: frame}).Bytes())
+		}
+		if !isEqual(responses[0], responses[1]) {
+			t.Errorf("request %v: dense %v, sparse %v", i, responses[0], responses[1])
+		}
+	}
+
+	// Only the non-zero values are stored.
+	if len(sparse.sparse.values[HoldingRegister]) != 3 {
+		t.Errorf("expected 3 stored holding registers, got %v", len(sparse.sparse.values[HoldingRegister]))
+	}
+}
+
+func TestSetSparseKeepsValues(t *testing.T) {
+	s := NewServer(WithCoilCount(10))
+	s.Coils[3] = 1
+	s.HoldingRegisters[100] = 1234
+
+	s.SetSparse(true)
+	if s.Coils != nil {
+		t.Fatalf("expected no dense coils in sparse mode")
+	}
+	if s.bankSize(Coil) != 10 {
+		t.Errorf("expected 10 coils, got %v", s.bankSize(Coil))
+	}
+	s.writeRegisters(InputRegister, 9, []uint16{9})
+
+	s.SetSparse(false)
+	if len(s.Coils) != 10 || s.Coils[3] != 1 {
+		t.Errorf("expected coil 3 of 10 set, got %v", s.Coils)
+	}
+	if s.HoldingRegisters[100] != 1234 {
+		t.Errorf("expected 1234, got %v", s.HoldingRegisters[100])
+	}
+	if s.InputRegisters[9] != 9 {
+		t.Errorf("expected 9, got %v", s.InputRegisters[9])
+	}
+}
+
+func TestRegisterSnapshotInto(t *testing.T) {
+	for _, sparse := range []bool{false, true} {
+		s := NewServer(WithHoldingRegisters(map[uint16]uint16{10: 1, 12: 3}))
+		s.SetSparse(sparse)
+		s.writeBits(Coil, 65534, []byte{1, 1})
+
+		dst := make([]uint16, 3)
+		if err := s.RegisterSnapshotInto(dst, HoldingRegister, 10); err != nil {
+			t.Fatalf("expected nil, got %v", err)
+		}
+		if !isEqual([]uint16{1, 0, 3}, dst) {
+			t.Errorf("sparse %v: expected [1 0 3], got %v", sparse, dst)
+		}
+
+		if err := s.RegisterSnapshotInto(dst[:2], Coil, 65534); err != nil {
+			t.Fatalf("expected nil, got %v", err)
+		}
+		if !isEqual([]uint16{1, 1, 3}, dst) {
+			t.Errorf("sparse %v: expected [1 1 3], got %v", sparse, dst)
+		}
+
+		err := s.RegisterSnapshotInto(dst, Coil, 65534)
+		if !errors.Is(err, ErrAddressOutOfRange) {
+			t.Errorf("sparse %v: expected ErrAddressOutOfRange, got %v", sparse, err)
+		}
+	}
+}
+
+func TestRegisterCounts(t *testing.T) {
+	for _, s := range []*Server{
+		NewServer(WithCoilCount(1), WithDiscreteInputCount(2), WithHoldingRegisterCount(3), WithInputRegisterCount(4)),
+		NewServer(WithSparse(), WithCoilCount(1), WithDiscreteInputCount(2), WithHoldingRegisterCount(3), WithInputRegisterCount(4)),
+		NewServerWithStore(newMapStore(), WithCoilCount(1), WithDiscreteInputCount(2), WithHoldingRegisterCount(3), WithInputRegisterCount(4)),
+	} {
+		coils, discreteInputs, holding, input := s.RegisterCounts()
+		if coils != 1 || discreteInputs != 2 || holding != 3 || input != 4 {
+			t.Errorf("expected 1 2 3 4, got %v %v %v %v", coils, discreteInputs, holding, input)
+		}
+	}
+
+	coils, _, _, input := NewServer().RegisterCounts()
+	if coils != MaxRegisterSize || input != MaxRegisterSize {
+		t.Errorf("expected %v, got %v %v", MaxRegisterSize, coils, input)
+	}
+}
+
+func TestWriteHoldingRegistersBatch(t *testing.T) {
+	s := NewServer()
+	var events []WriteEvent
+	s.OnWrite(func(event WriteEvent) {
+		events = append(events, event)
+	})
+
+	values := make([]uint16, 100)
+	for i := range values {
+		values[i] = uint16(i + 1)
+	}
+	if err := s.WriteHoldingRegistersBatch(10, values); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if !isEqual(values, s.HoldingRegisters[10:110]) {
+		t.Errorf("expected %v, got %v", values, s.HoldingRegisters[10:110])
+	}
+	expect := []WriteEvent{{Unit: 1, Kind: HoldingRegister, Address: 10, Values: values}}
+	if !isEqual(expect, events) {
+		t.Errorf("expected %v, got %v", expect, events)
+	}
+
+	// A range crossing the end of memory is rejected as a whole.
+	events = nil
+	err := s.WriteHoldingRegistersBatch(65530, []uint16{1, 2, 3, 4, 5, 6, 7})
+	if !errors.Is(err, ErrAddressOutOfRange) {
+		t.Errorf("expected ErrAddressOutOfRange, got %v", err)
+	}
+	if s.HoldingRegisters[65530] != 0 || len(events) != 0 {
+		t.Errorf("expected no register to be written and no event, got %v %v", s.HoldingRegisters[65530], events)
+	}
+}
+
+func TestReadAnyRegisters(t *testing.T) {
+	s := NewServer()
+	s.Coils[65535] = 1
+	s.DiscreteInputs[0] = 1
+	s.HoldingRegisters[65534] = 7
+	s.HoldingRegisters[65535] = 8
+	s.InputRegisters[0] = 9
+
+	tests := []struct {
+		kind   RegisterKind
+		addr   uint16
+		qty    uint16
+		expect []uint16
+	}{
+		{Coil, 65534, 2, []uint16{0, 1}},
+		{DiscreteInput, 0, 2, []uint16{1, 0}},
+		{HoldingRegister, 65534, 2, []uint16{7, 8}},
+		{InputRegister, 0, 1, []uint16{9}},
+	}
+	for _, test := range tests {
+		values, err := s.ReadAnyRegisters(test.addr, test.qty, test.kind)
+		if err != nil {
+			t.Errorf("%v: expected nil, got %v", test.kind, err)
+			continue
+		}
+		if !isEqual(test.expect, values) {
+			t.Errorf("%v: expected %v, got %v", test.kind, test.expect, values)
+		}
+	}
+
+	// The values are a copy.
+	values, _ := s.ReadAnyRegisters(65534, 2, HoldingRegister)
+	values[0] = 1
+	if s.HoldingRegisters[65534] != 7 {
+		t.Errorf("expected the memory not to change, got %v", s.HoldingRegisters[65534])
+	}
+
+	for _, kind := range []RegisterKind{Coil, DiscreteInput, HoldingRegister, InputRegister} {
+		if _, err := s.ReadAnyRegisters(65535, 2, kind); !errors.Is(err, ErrAddressOutOfRange) {
+			t.Errorf("%v: expected ErrAddressOutOfRange, got %v", kind, err)
+		}
+		if _, err := s.ReadAnyRegisters(0, 0, kind); !errors.Is(err, ErrQuantityExceedsLimit) {
+			t.Errorf("%v: expected ErrQuantityExceedsLimit, got %v", kind, err)
+		}
+	}
+}
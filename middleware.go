@@ -0,0 +1,76 @@
+package mbserver
+
+import "net"
+
+// HandlerFunc handles a request, see Use.
+type HandlerFunc func(*Server, *Request) ([]byte, *Exception)
+
+// Use adds a middleware wrapping the handling of every request, for
+// cross-cutting concerns such as authorization, logging or metrics:
+//
+//	s.Use(func(next mbserver.HandlerFunc) mbserver.HandlerFunc {
+//		return func(s *mbserver.Server, request *mbserver.Request) ([]byte, *mbserver.Exception) {
+//			start := time.Now()
+//			data, exception := next(s, request)
+//			log.Printf("function %v took %v", request.Frame().GetFunction(), time.Since(start))
+//			return data, exception
+//		}
+//	})
+//
+// Middleware runs in registration order, the first being the outermost, and
+// the last calls the function handler (or returns IllegalFunction when there
+// is none), or forwards the request when the server is a gateway, see
+// SetForwarder and Bridge. A middleware may return without calling next to
+// answer the request itself. Middleware runs without the memory lock, so it
+// may use the accessors of the server. Raw function handlers are not
+// wrapped.
+func (s *Server) Use(mw func(next HandlerFunc) HandlerFunc) {
+	s.hooksLock.Lock()
+	s.middleware = append(s.middleware, mw)
+	s.hooksLock.Unlock()
+}
+
+// middlewareChain composes the middleware around handler, callHandler or the
+// forwarding of a request.
+func (s *Server) middlewareChain(handler HandlerFunc) HandlerFunc {
+	s.hooksLock.RLock()
+	middleware := s.middleware
+	s.hooksLock.RUnlock()
+
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+	return handler
+}
+
+// Frame returns the decoded frame of the request.
+func (r *Request) Frame() Framer {
+	return r.frame
+}
+
+// RemoteAddr returns the address of the master the request was read from,
+// nil for serial ports and requests not read from a connection.
+func (r *Request) RemoteAddr() net.Addr {
+	if client, ok := r.conn.(*clientConn); ok {
+		return client.info.RemoteAddr
+	}
+	return nil
+}
+
+// Client returns the connection or serial port the request was read from,
+// false for requests not read from one, such as those of RoundTrip.
+func (r *Request) Client() (ClientInfo, bool) {
+	if client, ok := r.conn.(*clientConn); ok {
+		return client.clientInfo(), true
+	}
+	return ClientInfo{}, false
+}
+
+// TLSRole returns the role of the TLS client the request was read from, see
+// SetTLSRoleAuthorizer, false for requests not read from a TLS connection.
+func (r *Request) TLSRole() (string, bool) {
+	if r.tlsRole == nil {
+		return "", false
+	}
+	return *r.tlsRole, true
+}
@@ -0,0 +1,108 @@
+package mbserver
+
+import (
+	"net"
+	"testing"
+
+	"github.com/goburrow/modbus"
+)
+
+func TestUse(t *testing.T) {
+	s := NewServer()
+	var calls []string
+	trace := func(name string) func(HandlerFunc) HandlerFunc {
+		return func(next HandlerFunc) HandlerFunc {
+			return func(s *Server, request *Request) ([]byte, *Exception) {
+				calls = append(calls, name)
+				data, exception := next(s, request)
+				calls = append(calls, name+" "+exception.String())
+				return data, exception
+			}
+		}
+	}
+	s.Use(trace("first"))
+	s.Use(trace("second"))
+	// Deny single register writes.
+	s.Use(func(next HandlerFunc) HandlerFunc {
+		return func(s *Server, request *Request) ([]byte, *Exception) {
+			if request.Frame().GetFunction() == WriteHoldingRegisterFC {
+				return []byte{}, &IllegalDataAddress
+			}
+			return next(s, request)
+		}
+	})
+
+	call := func(function uint8) Exception {
+		frame := &TCPFrame{Device: 1, Function: function}
+		SetDataWithRegisterAndNumber(frame, 0, 1)
+		return GetException(s.handle(&Request{frame: frame}))
+	}
+
+	if exception := call(ReadHoldingRegistersFC); exception != Success {
+		t.Errorf("expected Success, got %v", exception.String())
+	}
+	expect := []string{"first", "second", "second Success", "first Success"}
+	if !isEqual(expect, calls) {
+		t.Errorf("expected %v, got %v", expect, calls)
+	}
+
+	calls = nil
+	if exception := call(WriteHoldingRegisterFC); exception != IllegalDataAddress {
+		t.Errorf("expected IllegalDataAddress, got %v", exception.String())
+	}
+	if s.HoldingRegisters[0] != 0 {
+		t.Errorf("expected the write to be denied, got %v", s.HoldingRegisters[0])
+	}
+
+	calls = nil
+	if exception := call(100); exception != IllegalFunction {
+		t.Errorf("expected IllegalFunction, got %v", exception.String())
+	}
+	expect = []string{"first", "second", "second IllegalFunction", "first IllegalFunction"}
+	if !isEqual(expect, calls) {
+		t.Errorf("expected %v, got %v", expect, calls)
+	}
+}
+
+func TestRequestConnectionMetadata(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	remotes := make(chan net.Addr, 1)
+	s.Use(func(next HandlerFunc) HandlerFunc {
+		return func(s *Server, request *Request) ([]byte, *Exception) {
+			if _, ok := request.TLSRole(); ok {
+				t.Errorf("expected no TLS role on a TCP connection")
+			}
+			if client, ok := request.Client(); !ok || client.RemoteAddr != request.RemoteAddr() {
+				t.Errorf("expected the client of the request, got %v", client)
+			}
+			remotes <- request.RemoteAddr()
+			return next(s, request)
+		}
+	})
+	addr, err := s.ListenTCPAny()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := modbus.NewTCPClientHandler(addr.String())
+	handler.SlaveId = 1
+	if err := handler.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer handler.Close()
+	if _, err := modbus.NewClient(handler).ReadCoils(0, 1); err != nil {
+		t.Fatal(err)
+	}
+	if remote := <-remotes; remote == nil {
+		t.Errorf("expected the remote address of the master")
+	}
+
+	// Requests without a connection have no metadata.
+	frame := &TCPFrame{Device: 1, Function: ReadCoilsFC}
+	SetDataWithRegisterAndNumber(frame, 0, 1)
+	request := &Request{frame: frame}
+	if _, ok := request.Client(); ok || request.RemoteAddr() != nil {
+		t.Errorf("expected no connection metadata")
+	}
+}
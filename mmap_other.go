@@ -0,0 +1,15 @@
+//go:build !linux && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd
+// +build !linux,!darwin,!dragonfly,!freebsd,!netbsd,!openbsd
+
+package mbserver
+
+import "fmt"
+
+type mmapBacking struct{}
+
+// UseMmapBacking is only supported on Unix-like systems.
+func (s *Server) UseMmapBacking(path string) error {
+	return fmt.Errorf("memory-mapped backing is not supported on this platform")
+}
+
+func (s *Server) closeMmapBacking() {}
@@ -0,0 +1,91 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+// +build linux darwin dragonfly freebsd netbsd openbsd
+
+package mbserver
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+type mmapBacking struct {
+	file *os.File
+	data []byte
+}
+
+// UseMmapBacking backs the holding registers with a memory-mapped file, so
+// that every write is stored in the file and survives a crash of the
+// process. If the file already holds as many registers as allocated, as left
+// by a previous run, the registers take its values; otherwise it is created
+// or resized and filled with the current values. The file is flushed and
+// unmapped by Close.
+//
+// The registers are stored in the byte order of the host, so the file is not
+// portable between architectures. UseMmapBacking is only supported on
+// Unix-like systems, and not in sparse mode or with a Store.
+func (s *Server) UseMmapBacking(path string) error {
+	s.memoryLock.Lock()
+	defer s.memoryLock.Unlock()
+
+	if s.sparse != nil || s.store != nil {
+		return fmt.Errorf("memory-mapped backing requires the built-in dense memory maps")
+	}
+	if s.mmap != nil {
+		return fmt.Errorf("holding registers are already backed by %v", s.mmap.file.Name())
+	}
+
+	size := len(s.HoldingRegisters) * 2
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	restore := info.Size() == int64(size)
+	if !restore {
+		if err := file.Truncate(int64(size)); err != nil {
+			file.Close()
+			return err
+		}
+	}
+
+	data, err := syscall.Mmap(int(file.Fd()), 0, size, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	registers := unsafe.Slice((*uint16)(unsafe.Pointer(&data[0])), len(s.HoldingRegisters))
+	if !restore {
+		copy(registers, s.HoldingRegisters)
+	}
+	s.HoldingRegisters = registers
+	s.mmap = &mmapBacking{file: file, data: data}
+	return nil
+}
+
+// closeMmapBacking moves the holding registers back to memory and flushes and
+// unmaps the file.
+func (s *Server) closeMmapBacking() {
+	s.memoryLock.Lock()
+	defer s.memoryLock.Unlock()
+
+	if s.mmap == nil {
+		return
+	}
+	if s.sparse == nil {
+		s.HoldingRegisters = append([]uint16(nil), s.HoldingRegisters...)
+	}
+	if err := syscall.Munmap(s.mmap.data); err != nil {
+		s.logger.Printf("failed to unmap %v: %v\n", s.mmap.file.Name(), err)
+	}
+	if err := s.mmap.file.Sync(); err != nil {
+		s.logger.Printf("failed to flush %v: %v\n", s.mmap.file.Name(), err)
+	}
+	s.mmap.file.Close()
+	s.mmap = nil
+}
@@ -0,0 +1,47 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+// +build linux darwin dragonfly freebsd netbsd openbsd
+
+package mbserver
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestUseMmapBacking(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "holding.bin")
+
+	s := NewServer(WithHoldingRegisterCount(16), WithHoldingRegisters(map[uint16]uint16{0: 5}))
+	if err := s.UseMmapBacking(path); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if err := s.UseMmapBacking(path); err == nil {
+		t.Errorf("expected an error mapping twice")
+	}
+	frame := &TCPFrame{Device: 1, Function: WriteHoldingRegisterFC}
+	SetDataWithRegisterAndNumber(frame, 15, 0x1234)
+	s.handle(&Request{frame: frame})
+	s.Close()
+
+	// Values stay readable after Close.
+	if s.HoldingRegisters[15] != 0x1234 {
+		t.Errorf("expected 0x1234, got %#x", s.HoldingRegisters[15])
+	}
+
+	restarted := NewServer(WithHoldingRegisterCount(16))
+	defer restarted.Close()
+	if err := restarted.UseMmapBacking(path); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if restarted.HoldingRegisters[0] != 5 || restarted.HoldingRegisters[15] != 0x1234 {
+		t.Errorf("expected the values to be restored, got %v", restarted.HoldingRegisters)
+	}
+}
+
+func TestUseMmapBackingSparse(t *testing.T) {
+	s := NewServer(WithSparse())
+	defer s.Close()
+	if err := s.UseMmapBacking(filepath.Join(t.TempDir(), "holding.bin")); err == nil {
+		t.Errorf("expected an error in sparse mode")
+	}
+}
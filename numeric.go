@@ -0,0 +1,212 @@
+package mbserver
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// SetHoldingRegisterInt16 stores a signed value in a holding register, as its
+// two's complement bits. Addresses beyond the allocated registers, and errors
+// of a Store, are ignored.
+func (s *Server) SetHoldingRegisterInt16(address uint16, value int16) {
+	s.setRegister(HoldingRegister, address, uint16(value))
+}
+
+// GetHoldingRegisterInt16 returns a holding register interpreted as a signed
+// value. Addresses beyond the allocated registers, and errors of a Store,
+// read 0.
+func (s *Server) GetHoldingRegisterInt16(address uint16) int16 {
+	return int16(s.getRegister(HoldingRegister, address))
+}
+
+// SetInputRegisterInt16 stores a signed value in an input register, like
+// SetHoldingRegisterInt16.
+func (s *Server) SetInputRegisterInt16(address uint16, value int16) {
+	s.setRegister(InputRegister, address, uint16(value))
+}
+
+// GetInputRegisterInt16 returns an input register interpreted as a signed
+// value, like GetHoldingRegisterInt16.
+func (s *Server) GetInputRegisterInt16(address uint16) int16 {
+	return int16(s.getRegister(InputRegister, address))
+}
+
+func (s *Server) setRegister(kind RegisterKind, address uint16, value uint16) {
+	s.memoryLock.Lock()
+	defer s.memoryLock.Unlock()
+
+	if int(address) < s.bankSize(kind) {
+		s.writeRegisters(kind, int(address), []uint16{value})
+	}
+}
+
+func (s *Server) getRegister(kind RegisterKind, address uint16) uint16 {
+	s.memoryLock.RLock()
+	defer s.memoryLock.RUnlock()
+
+	if int(address) >= s.bankSize(kind) {
+		return 0
+	}
+	values, err := s.readRegisters(kind, int(address), 1)
+	if err != nil {
+		return 0
+	}
+	return values[0]
+}
+
+// WordOrder is the order in which a value spanning several registers is
+// stored, named after the bytes of a 32-bit value, a being the most
+// significant. For 64-bit values, the word swapped orders reverse the four
+// registers.
+type WordOrder string
+
+// The word orders found in devices, as in the tags of Bind.
+const (
+	// OrderABCD is big endian, the Modbus convention.
+	OrderABCD WordOrder = "abcd"
+	// OrderCDAB stores the least significant register first.
+	OrderCDAB WordOrder = "cdab"
+	// OrderBADC swaps the bytes of each register.
+	OrderBADC WordOrder = "badc"
+	// OrderDCBA is little endian.
+	OrderDCBA WordOrder = "dcba"
+)
+
+// arrange converts the big endian bytes of a value to the order, and back.
+func (order WordOrder) arrange(raw []byte) ([]byte, error) {
+	arranged := append([]byte(nil), raw...)
+	switch order {
+	case OrderABCD, OrderCDAB, OrderBADC, OrderDCBA:
+	default:
+		return nil, fmt.Errorf("unknown word order %q", order)
+	}
+	if order == OrderCDAB || order == OrderDCBA {
+		for i, j := 0, len(arranged)-2; i < j; i, j = i+2, j-2 {
+			arranged[i], arranged[i+1], arranged[j], arranged[j+1] = arranged[j], arranged[j+1], arranged[i], arranged[i+1]
+		}
+	}
+	if order == OrderBADC || order == OrderDCBA {
+		for i := 0; i < len(arranged); i += 2 {
+			arranged[i], arranged[i+1] = arranged[i+1], arranged[i]
+		}
+	}
+	return arranged, nil
+}
+
+// RegisterValues reads and writes 32 and 64-bit values spanning consecutive
+// holding or input registers, see Server.RegisterValues. Like the accessors,
+// it holds the memory lock, writes all or nothing and does not fire the
+// OnWrite callbacks.
+type RegisterValues struct {
+	server *Server
+	kind   RegisterKind
+	order  WordOrder
+}
+
+// RegisterValues returns the 32 and 64-bit values of the holding or input
+// registers, stored in order.
+func (s *Server) RegisterValues(kind RegisterKind, order WordOrder) RegisterValues {
+	return RegisterValues{server: s, kind: kind, order: order}
+}
+
+func (r RegisterValues) read(address uint16, raw []byte) error {
+	if r.kind != HoldingRegister && r.kind != InputRegister {
+		return fmt.Errorf("%v does not hold registers", r.kind)
+	}
+	values, err := r.server.ReadAnyRegisters(address, uint16(len(raw)/2), r.kind)
+	if err != nil {
+		return err
+	}
+	arranged, err := r.order.arrange(Uint16ToBytes(values))
+	if err != nil {
+		return err
+	}
+	copy(raw, arranged)
+	return nil
+}
+
+func (r RegisterValues) write(address uint16, raw []byte) error {
+	if r.kind != HoldingRegister && r.kind != InputRegister {
+		return fmt.Errorf("%v does not hold registers", r.kind)
+	}
+	arranged, err := r.order.arrange(raw)
+	if err != nil {
+		return err
+	}
+	return r.server.writeAny(r.kind, address, BytesToUint16(arranged))
+}
+
+// Uint32 returns the value of the two registers from address.
+func (r RegisterValues) Uint32(address uint16) (uint32, error) {
+	var raw [4]byte
+	err := r.read(address, raw[:])
+	return binary.BigEndian.Uint32(raw[:]), err
+}
+
+// SetUint32 stores value in the two registers from address.
+func (r RegisterValues) SetUint32(address uint16, value uint32) error {
+	var raw [4]byte
+	binary.BigEndian.PutUint32(raw[:], value)
+	return r.write(address, raw[:])
+}
+
+// Int32 returns the value of the two registers from address, as two's
+// complement.
+func (r RegisterValues) Int32(address uint16) (int32, error) {
+	value, err := r.Uint32(address)
+	return int32(value), err
+}
+
+// SetInt32 stores value in the two registers from address.
+func (r RegisterValues) SetInt32(address uint16, value int32) error {
+	return r.SetUint32(address, uint32(value))
+}
+
+// Float32 returns the IEEE 754 value of the two registers from address.
+func (r RegisterValues) Float32(address uint16) (float32, error) {
+	value, err := r.Uint32(address)
+	return math.Float32frombits(value), err
+}
+
+// SetFloat32 stores value in the two registers from address.
+func (r RegisterValues) SetFloat32(address uint16, value float32) error {
+	return r.SetUint32(address, math.Float32bits(value))
+}
+
+// Uint64 returns the value of the four registers from address.
+func (r RegisterValues) Uint64(address uint16) (uint64, error) {
+	var raw [8]byte
+	err := r.read(address, raw[:])
+	return binary.BigEndian.Uint64(raw[:]), err
+}
+
+// SetUint64 stores value in the four registers from address.
+func (r RegisterValues) SetUint64(address uint16, value uint64) error {
+	var raw [8]byte
+	binary.BigEndian.PutUint64(raw[:], value)
+	return r.write(address, raw[:])
+}
+
+// Int64 returns the value of the four registers from address, as two's
+// complement.
+func (r RegisterValues) Int64(address uint16) (int64, error) {
+	value, err := r.Uint64(address)
+	return int64(value), err
+}
+
+// SetInt64 stores value in the four registers from address.
+func (r RegisterValues) SetInt64(address uint16, value int64) error {
+	return r.SetUint64(address, uint64(value))
+}
+
+// Float64 returns the IEEE 754 value of the four registers from address.
+func (r RegisterValues) Float64(address uint16) (float64, error) {
+	value, err := r.Uint64(address)
+	return math.Float64frombits(value), err
+}
+
+// SetFloat64 stores value in the four registers from address.
+func (r RegisterValues) SetFloat64(address uint16, value float64) error {
+	return r.SetUint64(address, math.Float64bits(value))
+}
@@ -0,0 +1,106 @@
+package mbserver
+
+import (
+	"math"
+	"testing"
+)
+
+func TestHoldingRegisterInt16(t *testing.T) {
+	s := NewServer()
+	for v := math.MinInt16; v <= math.MaxInt16; v++ {
+		s.SetHoldingRegisterInt16(1, int16(v))
+		if got := s.GetHoldingRegisterInt16(1); got != int16(v) {
+			t.Fatalf("expected %v, got %v", v, got)
+		}
+		if s.HoldingRegisters[1] != uint16(int16(v)) {
+			t.Fatalf("expected the two's complement of %v, got %#x", v, s.HoldingRegisters[1])
+		}
+	}
+
+	s.SetHoldingRegisterInt16(2, -2)
+	if s.HoldingRegisters[2] != 0xfffe {
+		t.Errorf("expected 0xfffe, got %#x", s.HoldingRegisters[2])
+	}
+}
+
+func TestInputRegisterInt16(t *testing.T) {
+	s := NewServer(WithInputRegisterCount(4), WithSparse())
+	s.SetInputRegisterInt16(3, math.MinInt16)
+	if got := s.GetInputRegisterInt16(3); got != math.MinInt16 {
+		t.Errorf("expected %v, got %v", math.MinInt16, got)
+	}
+
+	// Beyond the allocated registers.
+	s.SetInputRegisterInt16(4, -1)
+	if got := s.GetInputRegisterInt16(4); got != 0 {
+		t.Errorf("expected 0, got %v", got)
+	}
+}
+
+func TestRegisterValuesOrder(t *testing.T) {
+	for _, test := range []struct {
+		order  WordOrder
+		expect []uint16
+	}{
+		{OrderABCD, []uint16{0x0102, 0x0304}},
+		{OrderCDAB, []uint16{0x0304, 0x0102}},
+		{OrderBADC, []uint16{0x0201, 0x0403}},
+		{OrderDCBA, []uint16{0x0403, 0x0201}},
+	} {
+		s := NewServer()
+		values := s.RegisterValues(HoldingRegister, test.order)
+		if err := values.SetUint32(10, 0x01020304); err != nil {
+			t.Fatalf("expected nil, got %v", err)
+		}
+		if !isEqual(test.expect, s.HoldingRegisters[10:12]) {
+			t.Errorf("%v: expected %v, got %v", test.order, test.expect, s.HoldingRegisters[10:12])
+		}
+		if got, err := values.Uint32(10); err != nil || got != 0x01020304 {
+			t.Errorf("%v: expected 0x01020304, got %#x, %v", test.order, got, err)
+		}
+	}
+
+	s := NewServer()
+	if err := s.RegisterValues(InputRegister, OrderCDAB).SetUint64(0, 0x0102030405060708); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	expect := []uint16{0x0708, 0x0506, 0x0304, 0x0102}
+	if !isEqual(expect, s.InputRegisters[0:4]) {
+		t.Errorf("expected %v, got %v", expect, s.InputRegisters[0:4])
+	}
+}
+
+func TestRegisterValuesTypes(t *testing.T) {
+	s := NewServer()
+	values := s.RegisterValues(HoldingRegister, OrderDCBA)
+
+	values.SetFloat32(0, 21.5)
+	if got, _ := values.Float32(0); got != 21.5 {
+		t.Errorf("expected 21.5, got %v", got)
+	}
+	values.SetInt32(2, -7)
+	if got, _ := values.Int32(2); got != -7 {
+		t.Errorf("expected -7, got %v", got)
+	}
+	values.SetFloat64(4, math.Pi)
+	if got, _ := values.Float64(4); got != math.Pi {
+		t.Errorf("expected %v, got %v", math.Pi, got)
+	}
+	values.SetInt64(8, math.MinInt64)
+	if got, _ := values.Int64(8); got != math.MinInt64 {
+		t.Errorf("expected %v, got %v", int64(math.MinInt64), got)
+	}
+
+	if err := values.SetUint64(65533, 1); err == nil {
+		t.Errorf("expected an error writing beyond the memory map")
+	}
+	if s.HoldingRegisters[65533] != 0 {
+		t.Errorf("expected nothing to be written, got %v", s.HoldingRegisters[65533:])
+	}
+	if _, err := s.RegisterValues(Coil, OrderABCD).Uint32(0); err == nil {
+		t.Errorf("expected an error reading coils")
+	}
+	if err := s.RegisterValues(HoldingRegister, "abdc").SetUint32(0, 1); err == nil {
+		t.Errorf("expected an error with an unknown order")
+	}
+}
@@ -0,0 +1,203 @@
+package mbserver
+
+import "log"
+
+// Logger is the interface used by the server to report errors. *log.Logger
+// satisfies it.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// Option configures a Server created by NewServer.
+type Option func(*serverConfig)
+
+type serverConfig struct {
+	slaveId              uint8
+	coilCount            int
+	discreteInputCount   int
+	holdingRegisterCount int
+	inputRegisterCount   int
+	startAddress         int
+	holdingRegisters     map[uint16]uint16
+	inputRegisters       map[uint16]uint16
+	fill                 map[RegisterKind]uint16
+	sparse               bool
+	logger               Logger
+	workers              int
+	requestQueue         int
+}
+
+func defaultServerConfig() serverConfig {
+	return serverConfig{
+		slaveId:              1,
+		coilCount:            MaxRegisterSize,
+		discreteInputCount:   MaxRegisterSize,
+		holdingRegisterCount: MaxRegisterSize,
+		inputRegisterCount:   MaxRegisterSize,
+		logger:               log.Default(),
+		workers:              1,
+	}
+}
+
+// WithSlaveID sets the slave ID (unit identifier) the server responds to.
+// The default is 1.
+func WithSlaveID(slaveId uint8) Option {
+	return func(c *serverConfig) {
+		c.slaveId = slaveId
+	}
+}
+
+// WithCoilCount sets the number of coils allocated. Requests beyond the last
+// coil return IllegalDataAddress.
+func WithCoilCount(count int) Option {
+	return func(c *serverConfig) {
+		c.coilCount = clampRegisterCount(count)
+	}
+}
+
+// WithDiscreteInputCount sets the number of discrete inputs allocated.
+func WithDiscreteInputCount(count int) Option {
+	return func(c *serverConfig) {
+		c.discreteInputCount = clampRegisterCount(count)
+	}
+}
+
+// WithHoldingRegisterCount sets the number of holding registers allocated.
+func WithHoldingRegisterCount(count int) Option {
+	return func(c *serverConfig) {
+		c.holdingRegisterCount = clampRegisterCount(count)
+	}
+}
+
+// WithInputRegisterCount sets the number of input registers allocated.
+func WithInputRegisterCount(count int) Option {
+	return func(c *serverConfig) {
+		c.inputRegisterCount = clampRegisterCount(count)
+	}
+}
+
+// WithStartAddress sets the address of the first coil, discrete input and
+// register in requests, for devices whose address map does not start at 0.
+// Requests below it return IllegalDataAddress. The memory maps, and the
+// methods of the server taking an address, are indexed from it: address
+// start of a request is item 0 of the memory maps.
+func WithStartAddress(start uint16) Option {
+	return func(c *serverConfig) {
+		c.startAddress = int(start)
+	}
+}
+
+// WithHoldingRegisters seeds the holding registers with the given
+// address/value pairs. Addresses beyond the allocated registers are ignored.
+func WithHoldingRegisters(values map[uint16]uint16) Option {
+	return func(c *serverConfig) {
+		c.holdingRegisters = values
+	}
+}
+
+// WithInputRegisters seeds the input registers with the given address/value
+// pairs. Addresses beyond the allocated registers are ignored.
+func WithInputRegisters(values map[uint16]uint16) Option {
+	return func(c *serverConfig) {
+		c.inputRegisters = values
+	}
+}
+
+// WithCoilFill sets every coil on or off initially, see FillCoils.
+func WithCoilFill(on bool) Option {
+	return withFill(Coil, boolValue(on))
+}
+
+// WithDiscreteInputFill sets every discrete input on or off initially.
+func WithDiscreteInputFill(on bool) Option {
+	return withFill(DiscreteInput, boolValue(on))
+}
+
+// WithHoldingRegisterFill sets every holding register to value initially.
+// Registers seeded with WithHoldingRegisters take their seeded value.
+func WithHoldingRegisterFill(value uint16) Option {
+	return withFill(HoldingRegister, value)
+}
+
+// WithInputRegisterFill sets every input register to value initially.
+// Registers seeded with WithInputRegisters take their seeded value.
+func WithInputRegisterFill(value uint16) Option {
+	return withFill(InputRegister, value)
+}
+
+func withFill(kind RegisterKind, value uint16) Option {
+	return func(c *serverConfig) {
+		if c.fill == nil {
+			c.fill = make(map[RegisterKind]uint16)
+		}
+		c.fill[kind] = value
+	}
+}
+
+// WithSparse allocates the memory maps in sparse mode, see SetSparse.
+func WithSparse() Option {
+	return func(c *serverConfig) {
+		c.sparse = true
+	}
+}
+
+// WithWorkers sets the number of goroutines handling requests, 1 by
+// default, where every request is handled in turn. With more workers, the
+// requests of different connections and serial ports are handled and
+// answered concurrently, so that a slow master or a response delay only
+// holds up its own connection; those of one connection are still handled in
+// the order they were read. The memory maps stay consistent, as handlers
+// run under the memory lock of the server or unit the request is addressed
+// to, but function handlers, middlewares and callbacks must then be safe for
+// concurrent use.
+func WithWorkers(n int) Option {
+	return func(c *serverConfig) {
+		if n < 1 {
+			n = 1
+		}
+		c.workers = n
+	}
+}
+
+// WithRequestQueue sets the number of requests read from connections and
+// serial ports that may wait for each worker (see WithWorkers), 0 by
+// default: the goroutine reading a connection then waits until a worker
+// takes its request. A queue lets connections keep reading while the
+// workers are busy.
+func WithRequestQueue(size int) Option {
+	return func(c *serverConfig) {
+		if size < 0 {
+			size = 0
+		}
+		c.requestQueue = size
+	}
+}
+
+// WithLogger sets the logger used to report errors. The default is the
+// standard logger of the log package.
+func WithLogger(logger Logger) Option {
+	return func(c *serverConfig) {
+		if logger != nil {
+			c.logger = logger
+		}
+	}
+}
+
+// clampRegisterCount limits a memory size to the Modbus address space.
+// Non-positive sizes select the full address space.
+func clampRegisterCount(count int) int {
+	if count <= 0 || count > MaxRegisterSize {
+		return MaxRegisterSize
+	}
+	return count
+}
+
+func (s *Server) seedRegisters(kind RegisterKind, values map[uint16]uint16) {
+	for address, value := range values {
+		if int(address) < s.bankSize(kind) {
+			if err := s.writeRegisters(kind, int(address), []uint16{value}); err != nil {
+				s.logger.Printf("failed to seed %v %v: %v\n", kind, address, err)
+			}
+		}
+	}
+}
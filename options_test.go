@@ -0,0 +1,117 @@
+package mbserver
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewServerOptions(t *testing.T) {
+	s := NewServer(
+		WithSlaveID(5),
+		WithCoilCount(100),
+		WithHoldingRegisters(map[uint16]uint16{1: 10, 2: 20}),
+	)
+
+	if s.SlaveID() != 5 {
+		t.Errorf("expected slave id 5, got %v", s.SlaveID())
+	}
+	if len(s.Coils) != 100 {
+		t.Errorf("expected 100 coils, got %v", len(s.Coils))
+	}
+	if len(s.HoldingRegisters) != MaxRegisterSize {
+		t.Errorf("expected %v holding registers, got %v", MaxRegisterSize, len(s.HoldingRegisters))
+	}
+	expect := []uint16{0, 10, 20}
+	got := s.HoldingRegisters[0:3]
+	if !isEqual(expect, got) {
+		t.Errorf("expected %v, got %v", expect, got)
+	}
+}
+
+func TestCoilCountOutOfBounds(t *testing.T) {
+	s := NewServer(WithCoilCount(100))
+
+	var frame TCPFrame
+	frame.Device = 1
+	var req Request
+	req.frame = &frame
+
+	frame.Function = ReadCoilsFC
+	SetDataWithRegisterAndNumber(&frame, 99, 2)
+	response := s.handle(&req)
+	exception := GetException(response)
+	if exception != IllegalDataAddress {
+		t.Errorf("expected IllegalDataAddress, got %v", exception.String())
+	}
+
+	frame.Function = WriteSingleCoilFC
+	SetDataWithRegisterAndNumber(&frame, 100, 0xFF00)
+	response = s.handle(&req)
+	exception = GetException(response)
+	if exception != IllegalDataAddress {
+		t.Errorf("expected IllegalDataAddress, got %v", exception.String())
+	}
+}
+
+func TestWithLogger(t *testing.T) {
+	var buf bytes.Buffer
+	s := NewServer(WithLogger(log.New(&buf, "", 0)))
+
+	err := s.ListenTCP("256.0.0.1:0")
+	if err == nil {
+		t.Fatalf("expected error, got nil")
+	}
+	if !strings.Contains(buf.String(), "Failed to Listen") {
+		t.Errorf("expected the error to be logged, got %q", buf.String())
+	}
+}
+
+func TestWithWorkers(t *testing.T) {
+	s := NewServer(WithWorkers(2), WithRequestQueue(4))
+	defer s.Close()
+	if len(s.requestChans) != 2 || cap(s.requestChans[0]) != 4 {
+		t.Fatalf("expected 2 queues of 4 requests, got %v of %v", len(s.requestChans), cap(s.requestChans[0]))
+	}
+	s.AddUnit(2)
+	s.SetResponseDelayForUnit(1, 2*time.Second)
+	addr, err := s.ListenTCPAny()
+	if err != nil {
+		t.Fatalf("failed to listen, got %v\n", err)
+	}
+
+	dial := func() net.Conn {
+		conn, err := net.Dial("tcp", addr.String())
+		if err != nil {
+			t.Fatalf("failed to connect, got %v\n", err)
+		}
+		return conn
+	}
+	slow := dial()
+	defer slow.Close()
+	waitForClients(t, s, 1)
+	fast := dial()
+	defer fast.Close()
+	waitForClients(t, s, 2)
+
+	read := &TCPFrame{TransactionIdentifier: 1, Device: 1, Function: ReadHoldingRegistersFC}
+	SetDataWithRegisterAndNumber(read, 0, 1)
+	slow.Write(read.Bytes())
+	read.Device = 2
+	fast.Write(read.Bytes())
+
+	// The read of unit 2 is answered while the other worker waits to
+	// answer the one of unit 1.
+	fast.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := io.ReadFull(fast, make([]byte, 11)); err != nil {
+		t.Fatalf("expected a response while the slow request is answered, got %v", err)
+	}
+
+	if s := NewServer(WithWorkers(0), WithRequestQueue(-1)); len(s.requestChans) != 1 || cap(s.requestChans[0]) != 0 {
+		t.Errorf("expected one unbuffered queue, got %v", s.requestChans)
+	}
+}
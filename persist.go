@@ -0,0 +1,142 @@
+package mbserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"time"
+)
+
+// SaveState writes the four memory maps to w as a JSON encoded Snapshot,
+// taken while no request is being processed, for LoadState.
+func (s *Server) SaveState(w io.Writer) error {
+	snapshot, err := s.Snapshot()
+	if err != nil {
+		return err
+	}
+	return json.NewEncoder(w).Encode(snapshot)
+}
+
+// LoadState restores the memory maps saved by SaveState. Memory maps saved
+// shorter than those of the server are restored from address 0 and the rest
+// left untouched; nothing is restored when a memory map saved is longer.
+// Write callbacks are not fired.
+func (s *Server) LoadState(r io.Reader) error {
+	var snapshot Snapshot
+	if err := json.NewDecoder(r).Decode(&snapshot); err != nil {
+		return fmt.Errorf("invalid state: %w", err)
+	}
+
+	s.memoryLock.Lock()
+	defer s.memoryLock.Unlock()
+
+	for _, kind := range snapshotKinds {
+		if values := *snapshot.bank(kind); len(values) > s.bankSize(kind) {
+			return fmt.Errorf("%w: %d %v saved, size %d", ErrAddressOutOfRange, len(values), kind, s.bankSize(kind))
+		}
+	}
+	for _, kind := range snapshotKinds {
+		if values := *snapshot.bank(kind); len(values) > 0 {
+			if err := s.writeRegisters(kind, 0, values); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// AutoPersist keeps the memory maps in the file at path, so that a simulated
+// device survives a restart of the process. The file is loaded first if it
+// exists, then the memory maps are saved to it every interval when they
+// changed, and once more by Close. The file is replaced atomically, by
+// renaming a temporary file written next to it. A server persists to a
+// single file: calling AutoPersist again switches to the new file. Restart
+// does not resume persisting.
+func (s *Server) AutoPersist(path string, interval time.Duration) error {
+	if interval <= 0 {
+		return fmt.Errorf("invalid persist interval %v", interval)
+	}
+	if file, err := os.Open(path); err == nil {
+		err = s.LoadState(file)
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("%v: %w", path, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	saved, err := s.Snapshot()
+	if err != nil {
+		return err
+	}
+
+	s.stopPersist()
+	stop, done := make(chan struct{}), make(chan struct{})
+	s.persistLock.Lock()
+	s.persistStop, s.persistDone = stop, done
+	s.persistLock.Unlock()
+
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				saved = s.persist(path, saved)
+			case <-stop:
+				s.persist(path, saved)
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// persist saves the memory maps to path if they changed since saved, and
+// returns the memory maps now saved.
+func (s *Server) persist(path string, saved *Snapshot) *Snapshot {
+	snapshot, err := s.Snapshot()
+	if err != nil {
+		s.logger.Printf("failed to persist %v: %v\n", path, err)
+		return saved
+	}
+	if reflect.DeepEqual(snapshot, saved) {
+		return saved
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err == nil {
+		err = json.NewEncoder(file).Encode(snapshot)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err == nil {
+			err = os.Rename(file.Name(), path)
+		}
+		if err != nil {
+			os.Remove(file.Name())
+		}
+	}
+	if err != nil {
+		s.logger.Printf("failed to persist %v: %v\n", path, err)
+		return saved
+	}
+	return snapshot
+}
+
+// stopPersist stops persisting, after a last save.
+func (s *Server) stopPersist() {
+	s.persistLock.Lock()
+	stop, done := s.persistStop, s.persistDone
+	s.persistStop, s.persistDone = nil, nil
+	s.persistLock.Unlock()
+
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+}
@@ -0,0 +1,78 @@
+package mbserver
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSaveState(t *testing.T) {
+	s := NewServer()
+	s.Coils[7] = 1
+	s.HoldingRegisters[3] = 0x1234
+	s.InputRegisters[65535] = 9
+
+	var state bytes.Buffer
+	if err := s.SaveState(&state); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+
+	restored := NewServer()
+	if err := restored.LoadState(bytes.NewReader(state.Bytes())); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if restored.Coils[7] != 1 || restored.HoldingRegisters[3] != 0x1234 || restored.InputRegisters[65535] != 9 {
+		t.Errorf("expected the saved values, got coil %v, holding %v, input %v",
+			restored.Coils[7], restored.HoldingRegisters[3], restored.InputRegisters[65535])
+	}
+
+	small, err := NewServerWithConfig(ServerConfig{SlaveID: 1, CoilCount: 10, DiscreteInputCount: 10, HoldingRegisterCount: 10, InputRegisterCount: 10})
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if err := small.LoadState(bytes.NewReader(state.Bytes())); err == nil {
+		t.Errorf("expected an error loading 65536 holding registers into 10")
+	}
+	if err := restored.LoadState(bytes.NewReader([]byte("{"))); err == nil {
+		t.Errorf("expected an error loading an invalid state")
+	}
+}
+
+func TestAutoPersist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	s := NewServer()
+	if err := s.AutoPersist(path, 10*time.Millisecond); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if err := s.WriteHoldingRegisters(5, []uint16{42}); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, err := os.Stat(path); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %v to be saved", path)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	s.SetCoil(3, true)
+	s.Close()
+
+	restored := NewServer()
+	if err := restored.AutoPersist(path, time.Hour); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	defer restored.Close()
+	if restored.HoldingRegisters[5] != 42 || restored.Coils[3] != 1 {
+		t.Errorf("expected the saved values, got holding %v, coil %v", restored.HoldingRegisters[5], restored.Coils[3])
+	}
+
+	if err := restored.AutoPersist(path, 0); err == nil {
+		t.Errorf("expected an error with a zero interval")
+	}
+}
@@ -0,0 +1,116 @@
+package mbserver
+
+import "encoding/binary"
+
+// ListenOption restricts the functions masters may use over one listener or
+// serial port, see ListenTCP.
+type ListenOption func(*listenPolicy)
+
+type listenPolicy struct {
+	readOnly bool
+	allowed  *[256]bool
+}
+
+// WithReadOnly only allows the functions that do not change memory: the
+// built-in read functions (1-4), Diagnostics (8), Read FIFO Queue (24), Read
+// Device Identification (43) and handlers registered with
+// RegisterReadOnlyFunctionHandler. Other functions return IllegalFunction,
+// and so do the Diagnostics sub-functions changing the state of the server:
+// Restart Communications, Force Listen Only Mode, Clear Counters and Clear
+// Overrun Counter.
+func WithReadOnly() ListenOption {
+	return func(p *listenPolicy) {
+		p.readOnly = true
+	}
+}
+
+// WithAllowedFunctions only allows the given function codes, others return
+// IllegalFunction. Combined with WithReadOnly, functions must pass both.
+func WithAllowedFunctions(funcCodes []uint8) ListenOption {
+	return func(p *listenPolicy) {
+		if p.allowed == nil {
+			p.allowed = new([256]bool)
+		}
+		for _, funcCode := range funcCodes {
+			p.allowed[funcCode] = true
+		}
+	}
+}
+
+// newListenPolicy returns the policy set by opts, nil when there is none.
+func newListenPolicy(opts []ListenOption) *listenPolicy {
+	if len(opts) == 0 {
+		return nil
+	}
+	p := &listenPolicy{}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// readOnlyDiagnostics reports whether the request of a Diagnostics
+// sub-function leaves the state of the server alone.
+func readOnlyDiagnostics(frame Framer) bool {
+	data := frame.GetData()
+	if len(data) < 2 {
+		return true
+	}
+	switch binary.BigEndian.Uint16(data[0:2]) {
+	case RestartCommunications, ForceListenOnlyMode, ClearCounters, ClearOverrunCounter:
+		return false
+	}
+	return true
+}
+
+// allows reports whether the policy allows the function of a request.
+func (p *listenPolicy) allows(s *Server, frame Framer) bool {
+	if p == nil {
+		return true
+	}
+	funcCode := frame.GetFunction()
+	if p.allowed != nil && !p.allowed[funcCode] {
+		return false
+	}
+	if !p.readOnly {
+		return true
+	}
+	if funcCode == DiagnosticsFC && !readOnlyDiagnostics(frame) {
+		return false
+	}
+	return s.isReadOnly(frame.GetSlaveId(), funcCode)
+}
+
+// SetUnitFunctions declares the function codes valid for one unit ID, as for
+// a gateway fronting devices with different capabilities: other functions
+// return IllegalFunction for requests addressed to that unit, before their
+// handler runs. Units without such a list allow every function, and an
+// empty list removes the one of a unit. Unlike RegisterFunctionHandlerForUnit
+// it only gates the functions, their handlers are shared.
+func (s *Server) SetUnitFunctions(id uint8, codes []uint8) {
+	s.unitAllowedLock.Lock()
+	defer s.unitAllowedLock.Unlock()
+
+	if len(codes) == 0 {
+		delete(s.unitAllowed, id)
+		return
+	}
+	allowed := new([256]bool)
+	for _, funcCode := range codes {
+		allowed[funcCode] = true
+	}
+	if s.unitAllowed == nil {
+		s.unitAllowed = make(map[uint8]*[256]bool)
+	}
+	s.unitAllowed[id] = allowed
+}
+
+// unitAllows reports whether the functions set with SetUnitFunctions allow a
+// function code for a unit.
+func (s *Server) unitAllows(unit uint8, funcCode uint8) bool {
+	s.unitAllowedLock.RLock()
+	defer s.unitAllowedLock.RUnlock()
+
+	allowed, ok := s.unitAllowed[unit]
+	return !ok || allowed[funcCode]
+}
@@ -0,0 +1,123 @@
+package mbserver
+
+import (
+	"testing"
+
+	"github.com/goburrow/modbus"
+)
+
+func TestListenReadOnly(t *testing.T) {
+	s := NewServer()
+	addr, err := s.ListenTCPAny(WithReadOnly())
+	if err != nil {
+		t.Fatalf("failed to listen, got %v\n", err)
+	}
+	defer s.Close()
+
+	handler := modbus.NewTCPClientHandler(addr.String())
+	handler.SlaveId = 1
+	if err := handler.Connect(); err != nil {
+		t.Fatalf("failed to connect, got %v\n", err)
+	}
+	defer handler.Close()
+	client := modbus.NewClient(handler)
+
+	if _, err := client.ReadHoldingRegisters(0, 1); err != nil {
+		t.Errorf("expected the read to succeed, got %v", err)
+	}
+	_, err = client.WriteSingleRegister(0, 1)
+	if exception, ok := err.(*modbus.ModbusError); !ok || exception.ExceptionCode != modbus.ExceptionCodeIllegalFunction {
+		t.Errorf("expected an illegal function exception, got %v", err)
+	}
+	if s.HoldingRegisters[0] != 0 {
+		t.Errorf("expected the write to be rejected, got %v", s.HoldingRegisters[0])
+	}
+}
+
+func TestListenPolicy(t *testing.T) {
+	s := NewServer()
+	s.RegisterReadOnlyFunctionHandler(100, func(s *Server, frame Framer) ([]byte, *Exception) {
+		return []byte{}, &Success
+	})
+	s.RegisterRawFunctionHandler(101, func(s *Server, frame Framer) ([]byte, bool) {
+		return []byte{101}, true
+	})
+
+	tests := []struct {
+		opts     []ListenOption
+		function uint8
+		expect   Exception
+	}{
+		{nil, WriteHoldingRegisterFC, Success},
+		{[]ListenOption{WithReadOnly()}, ReadCoilsFC, Success},
+		{[]ListenOption{WithReadOnly()}, WriteSingleCoilFC, IllegalFunction},
+		{[]ListenOption{WithReadOnly()}, 100, Success},
+		{[]ListenOption{WithReadOnly()}, 101, IllegalFunction},
+		{[]ListenOption{WithAllowedFunctions([]uint8{ReadCoilsFC, WriteSingleCoilFC})}, WriteSingleCoilFC, Success},
+		{[]ListenOption{WithAllowedFunctions([]uint8{ReadCoilsFC, WriteSingleCoilFC})}, ReadHoldingRegistersFC, IllegalFunction},
+		{[]ListenOption{WithAllowedFunctions([]uint8{ReadCoilsFC, WriteSingleCoilFC}), WithReadOnly()}, WriteSingleCoilFC, IllegalFunction},
+		{[]ListenOption{WithAllowedFunctions([]uint8{101})}, 101, Success},
+	}
+	for i, test := range tests {
+		frame := &TCPFrame{Device: 1, Function: test.function}
+		SetDataWithRegisterAndNumber(frame, 0, 1)
+		response := s.handle(&Request{frame: frame, policy: newListenPolicy(test.opts)})
+		if exception := GetException(response); exception != test.expect {
+			t.Errorf("%v: function %v: expected %v, got %v", i, test.function, test.expect.String(), exception.String())
+		}
+	}
+
+	// Diagnostics changing the state of the server are not read-only.
+	diagnostics := []struct {
+		sub    uint16
+		expect Exception
+	}{
+		{ReturnQueryData, Success},
+		{ReturnBusMessageCount, Success},
+		{RestartCommunications, IllegalFunction},
+		{ForceListenOnlyMode, IllegalFunction},
+		{ClearCounters, IllegalFunction},
+		{ClearOverrunCounter, IllegalFunction},
+	}
+	for _, test := range diagnostics {
+		frame := &TCPFrame{Device: 1, Function: DiagnosticsFC}
+		SetDataWithRegisterAndNumber(frame, test.sub, 0)
+		response := s.handle(&Request{frame: frame, policy: newListenPolicy([]ListenOption{WithReadOnly()})})
+		if exception := GetException(response); exception != test.expect {
+			t.Errorf("sub-function %v: expected %v, got %v", test.sub, test.expect.String(), exception.String())
+		}
+	}
+	if s.ListenOnly() {
+		t.Errorf("expected Force Listen Only Mode to be rejected")
+	}
+}
+
+func TestSetUnitFunctions(t *testing.T) {
+	s := NewServer()
+	s.SetUnitFunctions(1, []uint8{ReadHoldingRegistersFC})
+
+	read := &TCPFrame{Device: 1, Function: ReadHoldingRegistersFC}
+	SetDataWithRegisterAndNumber(read, 0, 1)
+	if exception := GetException(s.handle(&Request{frame: read})); exception != Success {
+		t.Errorf("expected the read to succeed, got %v", exception.String())
+	}
+	write := &TCPFrame{Device: 1, Function: WriteHoldingRegisterFC}
+	SetDataWithRegisterAndNumber(write, 0, 1)
+	if exception := GetException(s.handle(&Request{frame: write})); exception != IllegalFunction {
+		t.Errorf("expected IllegalFunction, got %v", exception.String())
+	}
+	if s.HoldingRegisters[0] != 0 {
+		t.Errorf("expected the write to be rejected, got %v", s.HoldingRegisters[0])
+	}
+
+	// Other units, and the unit once its list is removed, allow everything.
+	write.Device = 2
+	if exception := GetException(s.handle(&Request{frame: write})); exception != Success {
+		t.Errorf("expected the write to unit 2 to succeed, got %v", exception.String())
+	}
+	s.SetUnitFunctions(1, nil)
+	write.Device = 1
+	if exception := GetException(s.handle(&Request{frame: write})); exception != Success {
+		t.Errorf("expected the write to succeed, got %v", exception.String())
+	}
+}
@@ -0,0 +1,231 @@
+package mbserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+)
+
+// Profile describes the register layout of a simulated device, see
+// SetProfile. Its fields are tagged for JSON and YAML.
+type Profile struct {
+	Registers []ProfileRegister `json:"registers" yaml:"registers"`
+}
+
+// ProfileRegister is a named value of a Profile.
+type ProfileRegister struct {
+	Name string `json:"name" yaml:"name"`
+	// Table is the memory map holding the value: coil, discrete, input or
+	// holding.
+	Table string `json:"table" yaml:"table"`
+	// Address is the address of the first coil or register, from 0.
+	Address uint16 `json:"address" yaml:"address"`
+	// Type is bool (coils and discrete inputs), int16, uint16, int32,
+	// uint32 or float32.
+	Type string `json:"type" yaml:"type"`
+	// Order is the byte order of 32-bit values, as for Bind: abcd (the
+	// default), cdab, badc or dcba.
+	Order string `json:"order,omitempty" yaml:"order,omitempty"`
+	// Value is the initial value, a bool or a number.
+	Value interface{} `json:"value,omitempty" yaml:"value,omitempty"`
+	// ReadOnly rejects writes by masters with IllegalDataAddress.
+	ReadOnly bool `json:"readOnly,omitempty" yaml:"readOnly,omitempty"`
+}
+
+type profileField struct {
+	boundField
+	typ      reflect.Type
+	readOnly bool
+}
+
+var profileTypes = map[string]reflect.Type{
+	"bool":    reflect.TypeOf(false),
+	"int16":   reflect.TypeOf(int16(0)),
+	"uint16":  reflect.TypeOf(uint16(0)),
+	"int32":   reflect.TypeOf(int32(0)),
+	"uint32":  reflect.TypeOf(uint32(0)),
+	"float32": reflect.TypeOf(float32(0)),
+}
+
+// LoadProfile reads a JSON encoded Profile from r and applies it with
+// SetProfile. A YAML profile can be decoded into a Profile by a YAML package
+// and passed to SetProfile.
+func (s *Server) LoadProfile(r io.Reader) error {
+	var profile Profile
+	if err := json.NewDecoder(r).Decode(&profile); err != nil {
+		return fmt.Errorf("invalid profile: %w", err)
+	}
+	return s.SetProfile(profile)
+}
+
+// SetProfile replaces the named registers by those of profile, and writes
+// their initial values. The whole profile is validated first: names must be
+// unique, registers must not overlap and must fit the memory maps. The
+// registers are then read and written by name with GetByName and SetByName.
+func (s *Server) SetProfile(profile Profile) error {
+	fields := make(map[string]profileField, len(profile.Registers))
+	values := make([][]uint16, len(profile.Registers))
+	for i, register := range profile.Registers {
+		field, err := s.parseProfileRegister(register)
+		if err != nil {
+			return err
+		}
+		if _, ok := fields[field.name]; ok {
+			return fmt.Errorf("register %v: duplicate name", field.name)
+		}
+		for _, other := range fields {
+			if other.kind == field.kind && field.address < other.address+other.size && other.address < field.address+field.size {
+				return fmt.Errorf("register %v overlaps register %v", field.name, other.name)
+			}
+		}
+		if register.Value != nil {
+			if values[i], err = field.encodeValue(register.Value); err != nil {
+				return err
+			}
+		}
+		fields[field.name] = field
+	}
+
+	s.memoryLock.Lock()
+	defer s.memoryLock.Unlock()
+
+	for i, register := range profile.Registers {
+		if values[i] == nil {
+			continue
+		}
+		field := fields[register.Name]
+		if err := s.writeRegisters(field.kind, field.address, values[i]); err != nil {
+			return fmt.Errorf("register %v: %w", field.name, err)
+		}
+	}
+	s.profileFields = fields
+	return nil
+}
+
+func (s *Server) parseProfileRegister(register ProfileRegister) (profileField, error) {
+	field := profileField{boundField: boundField{name: register.Name, address: int(register.Address), order: "abcd"}, readOnly: register.ReadOnly}
+	if field.name == "" {
+		return field, fmt.Errorf("register at %d: a name is required", register.Address)
+	}
+	bank, ok := bindKinds[register.Table]
+	if !ok {
+		return field, fmt.Errorf("register %v: unknown memory map %q", field.name, register.Table)
+	}
+	field.kind = bank.kind
+	if field.typ, ok = profileTypes[register.Type]; !ok {
+		return field, fmt.Errorf("register %v: unknown type %q", field.name, register.Type)
+	}
+	switch register.Order {
+	case "":
+	case "abcd", "cdab", "badc", "dcba":
+		field.order = register.Order
+	default:
+		return field, fmt.Errorf("register %v: unknown byte order %q", field.name, register.Order)
+	}
+
+	var err error
+	if field.size, err = bindSize(field.name, field.kind, field.typ); err != nil {
+		return field, err
+	}
+	if err := checkRange(field.address, field.size, s.bankSize(field.kind), MaxRegisterSize); err != nil {
+		return field, fmt.Errorf("register %v: %w", field.name, err)
+	}
+	return field, nil
+}
+
+// encodeValue returns the coils or registers holding value, a bool or a
+// number that fits the type of the field.
+func (field profileField) encodeValue(value interface{}) ([]uint16, error) {
+	target := reflect.New(field.typ).Elem()
+	v := reflect.ValueOf(value)
+	if target.Kind() == reflect.Bool {
+		if v.Kind() != reflect.Bool {
+			return nil, fmt.Errorf("register %v: cannot set %T to a bool", field.name, value)
+		}
+		target.SetBool(v.Bool())
+		return field.encode(target), nil
+	}
+
+	var number float64
+	switch {
+	case v.CanInt():
+		number = float64(v.Int())
+	case v.CanUint():
+		number = float64(v.Uint())
+	case v.CanFloat():
+		number = v.Float()
+	default:
+		return nil, fmt.Errorf("register %v: cannot set %T to a %v", field.name, value, field.typ)
+	}
+	switch {
+	case target.CanFloat():
+		if target.OverflowFloat(number) {
+			return nil, fmt.Errorf("register %v: %v overflows %v", field.name, value, field.typ)
+		}
+		target.SetFloat(number)
+	case number != math.Trunc(number):
+		return nil, fmt.Errorf("register %v: %v is not an integer", field.name, value)
+	case target.CanInt():
+		if target.OverflowInt(int64(number)) {
+			return nil, fmt.Errorf("register %v: %v overflows %v", field.name, value, field.typ)
+		}
+		target.SetInt(int64(number))
+	default:
+		if number < 0 || target.OverflowUint(uint64(number)) {
+			return nil, fmt.Errorf("register %v: %v overflows %v", field.name, value, field.typ)
+		}
+		target.SetUint(uint64(number))
+	}
+	return field.encode(target), nil
+}
+
+// SetByName writes value to the register of the profile named name. The
+// value is a bool or a number that fits the type of the register, for
+// instance s.SetByName("Temperature", 21.5). Registers read-only to masters
+// can be written, but the OnWrite callbacks are not fired.
+func (s *Server) SetByName(name string, value interface{}) error {
+	s.memoryLock.Lock()
+	defer s.memoryLock.Unlock()
+
+	field, ok := s.profileFields[name]
+	if !ok {
+		return fmt.Errorf("no register named %q", name)
+	}
+	values, err := field.encodeValue(value)
+	if err != nil {
+		return err
+	}
+	return s.writeRegisters(field.kind, field.address, values)
+}
+
+// GetByName returns the value of the register of the profile named name, as
+// a bool, int16, uint16, int32, uint32 or float32 as declared by its type.
+func (s *Server) GetByName(name string) (interface{}, error) {
+	s.memoryLock.RLock()
+	defer s.memoryLock.RUnlock()
+
+	field, ok := s.profileFields[name]
+	if !ok {
+		return nil, fmt.Errorf("no register named %q", name)
+	}
+	values, err := s.readRegisters(field.kind, field.address, field.size)
+	if err != nil {
+		return nil, err
+	}
+	value := reflect.New(field.typ).Elem()
+	field.decode(value, values)
+	return value.Interface(), nil
+}
+
+// checkReadOnly returns an error when quantity items of kind from address
+// touch a read-only register of the profile. The memory lock must be held.
+func (s *Server) checkReadOnly(kind RegisterKind, address int, quantity int) error {
+	for _, field := range s.profileFields {
+		if field.readOnly && field.kind == kind && field.address < address+quantity && address < field.address+field.size {
+			return fmt.Errorf("%w: register %v is read-only", ErrAddressOutOfRange, field.name)
+		}
+	}
+	return nil
+}
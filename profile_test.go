@@ -0,0 +1,86 @@
+package mbserver
+
+import (
+	"strings"
+	"testing"
+)
+
+const testProfile = `{
+	"registers": [
+		{"name": "Running", "table": "coil", "address": 0, "type": "bool", "value": true},
+		{"name": "Temperature", "table": "input", "address": 10, "type": "float32", "order": "cdab", "value": 21.5},
+		{"name": "Setpoint", "table": "holding", "address": 0, "type": "int16", "value": -4},
+		{"name": "Serial", "table": "holding", "address": 1, "type": "uint32", "value": 65538, "readOnly": true}
+	]
+}`
+
+func TestLoadProfile(t *testing.T) {
+	s := NewServer()
+	if err := s.LoadProfile(strings.NewReader(testProfile)); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	// 21.5 is 0x41ac0000, word swapped.
+	if s.Coils[0] != 1 || !isEqual([]uint16{0, 0x41ac}, s.InputRegisters[10:12]) || !isEqual([]uint16{0xfffc, 1, 2}, s.HoldingRegisters[0:3]) {
+		t.Errorf("expected the initial values, got coil %v, input %v, holding %v", s.Coils[0], s.InputRegisters[10:12], s.HoldingRegisters[0:3])
+	}
+
+	if err := s.SetByName("Temperature", 19); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	value, err := s.GetByName("Temperature")
+	if err != nil || value != float32(19) {
+		t.Errorf("expected 19, got %v, %v", value, err)
+	}
+	if value, _ := s.GetByName("Setpoint"); value != int16(-4) {
+		t.Errorf("expected -4, got %v", value)
+	}
+
+	for _, test := range []struct {
+		name  string
+		value interface{}
+	}{
+		{"Unknown", 1},
+		{"Setpoint", 40000},
+		{"Setpoint", 1.5},
+		{"Serial", -1},
+		{"Running", 1},
+		{"Temperature", "hot"},
+	} {
+		if err := s.SetByName(test.name, test.value); err == nil {
+			t.Errorf("expected an error setting %v to %v", test.name, test.value)
+		}
+	}
+
+	frame := &TCPFrame{Device: 1, Function: WriteHoldingRegistersFC}
+	SetDataWithRegisterAndNumberAndValues(frame, 0, 2, []uint16{1, 2})
+	if response := s.handle(&Request{frame: frame}); response.GetFunction() != WriteHoldingRegistersFC|0x80 {
+		t.Errorf("expected a write to the read-only register to fail, got %v", response.GetData())
+	}
+	frame = &TCPFrame{Device: 1, Function: WriteHoldingRegisterFC}
+	SetDataWithRegisterAndNumber(frame, 0, 7)
+	if response := s.handle(&Request{frame: frame}); response.GetFunction() != WriteHoldingRegisterFC {
+		t.Errorf("expected the write to succeed, got %v", response.GetData())
+	}
+}
+
+func TestSetProfileErrors(t *testing.T) {
+	for _, register := range [][]ProfileRegister{
+		{{Table: "holding", Type: "uint16"}},
+		{{Name: "A", Table: "eeprom", Type: "uint16"}},
+		{{Name: "A", Table: "holding", Type: "string"}},
+		{{Name: "A", Table: "holding", Type: "bool"}},
+		{{Name: "A", Table: "coil", Type: "uint16"}},
+		{{Name: "A", Table: "holding", Type: "uint32", Order: "abdc"}},
+		{{Name: "A", Table: "holding", Address: 65535, Type: "uint32"}},
+		{{Name: "A", Table: "holding", Type: "uint16"}, {Name: "A", Table: "holding", Address: 1, Type: "uint16"}},
+		{{Name: "A", Table: "holding", Type: "uint32"}, {Name: "B", Table: "holding", Address: 1, Type: "uint16"}},
+		{{Name: "A", Table: "holding", Type: "uint16", Value: 1}, {Name: "B", Table: "holding", Address: 1, Type: "uint16", Value: -1}},
+	} {
+		s := NewServer()
+		if err := s.SetProfile(Profile{Registers: register}); err == nil {
+			t.Errorf("expected an error for %+v", register)
+		} else if s.HoldingRegisters[0] != 0 {
+			t.Errorf("expected memory to be untouched for %+v", register)
+		}
+	}
+}
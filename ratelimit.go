@@ -0,0 +1,63 @@
+package mbserver
+
+import (
+	"sync"
+	"time"
+)
+
+// tokenBucket paces requests at a rate, allowing bursts of up to one
+// second worth of requests.
+type tokenBucket struct {
+	lock   sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+// reserve takes a token and returns how long to wait before using it.
+func (b *tokenBucket) reserve(now time.Time) time.Duration {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.rate {
+		b.tokens = b.rate
+	}
+	b.last = now
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// SetGlobalRateLimit caps the rate of the requests processed, across all
+// connections and serial ports, to protect a shared Store or the devices
+// behind a gateway. Requests over the limit are delayed until they fit in it,
+// never dropped, so their responses stay correct; bursts of up to perSecond
+// requests are let through. A limit of 0 (the default) removes the cap.
+func (s *Server) SetGlobalRateLimit(perSecond int) {
+	if perSecond <= 0 {
+		s.rateLimit.Store(nil)
+		return
+	}
+	s.rateLimit.Store(&tokenBucket{rate: float64(perSecond), tokens: float64(perSecond), last: time.Now()})
+}
+
+// ThrottledRequests returns the number of requests delayed by the global
+// rate limit.
+func (s *Server) ThrottledRequests() uint64 {
+	return s.throttled.Load()
+}
+
+// throttle waits for the global rate limit to let a request through.
+func (s *Server) throttle() {
+	bucket := s.rateLimit.Load()
+	if bucket == nil {
+		return
+	}
+	if wait := bucket.reserve(time.Now()); wait > 0 {
+		s.throttled.Add(1)
+		time.Sleep(wait)
+	}
+}
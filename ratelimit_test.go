@@ -0,0 +1,39 @@
+package mbserver
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSetGlobalRateLimit(t *testing.T) {
+	s := NewServer()
+	s.SetGlobalRateLimit(50)
+
+	frame := &TCPFrame{Device: 1, Function: ReadHoldingRegistersFC}
+	SetDataWithRegisterAndNumber(frame, 0, 1)
+
+	// A burst of 50 requests goes through, the next 10 are delayed by 20ms
+	// each rather than dropped.
+	start := time.Now()
+	for i := 0; i < 60; i++ {
+		if exception := GetException(s.handle(&Request{frame: frame})); exception != Success {
+			t.Fatalf("expected Success, got %v", exception.String())
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("expected the requests over the limit to be delayed, took %v", elapsed)
+	}
+	// Tokens refilled while serving the burst may let a request through.
+	if throttled := s.ThrottledRequests(); throttled < 8 || throttled > 10 {
+		t.Errorf("expected 10 throttled requests, got %v", throttled)
+	}
+
+	s.SetGlobalRateLimit(0)
+	start = time.Now()
+	for i := 0; i < 100; i++ {
+		s.handle(&Request{frame: frame})
+	}
+	if elapsed := time.Since(start); elapsed >= 100*time.Millisecond {
+		t.Errorf("expected no delay without a limit, took %v", elapsed)
+	}
+}
@@ -0,0 +1,52 @@
+package mbserver
+
+// RegisterRawFunctionHandler overrides the default behavior for a given
+// Modbus function with a handler that builds the whole response PDU itself:
+// the returned bytes are the function code followed by the response data.
+// When the returned bool is false, no response is sent at all. It replaces
+// any handler registered with RegisterFunctionHandler or
+// RegisterContextFunctionHandler for the function code.
+//
+// Raw handlers exist for non-standard response shapes and are easy to misuse.
+// The bytes are sent as is, so nothing checks that they form a valid
+// response, that the function code matches the request or that the exception
+// bit is set consistently. Function codes 128-255 are reserved for exception
+// responses and still return IllegalFunction. Startup busy responses, error
+// injection and handlers registered for a single unit are bypassed. The
+// transaction ID and unit ID of TCP frames and the address and CRC of RTU
+// frames are still filled in by the server. Custom Framer implementations
+// only receive the data, through SetData.
+func (s *Server) RegisterRawFunctionHandler(funcCode uint8, function func(*Server, Framer) ([]byte, bool)) {
+	s.function[funcCode] = nil
+	s.contextFunction[funcCode] = nil
+	s.rawFunction[funcCode] = function
+	s.readOnlyFunction[funcCode] = false
+}
+
+// handleRaw runs a raw function handler, the response is nil when nothing is
+// to be sent.
+func (s *Server) handleRaw(request *Request, function func(*Server, Framer) ([]byte, bool)) Framer {
+	s.memoryLock.Lock()
+	pdu, send := function(s, request.frame)
+	s.memoryLock.Unlock()
+
+	if !send {
+		return nil
+	}
+	if len(pdu) == 0 {
+		s.logger.Printf("raw handler for function %v returned an empty response\n", request.frame.GetFunction())
+		return nil
+	}
+
+	response := request.frame.Copy()
+	switch frame := response.(type) {
+	case *TCPFrame:
+		frame.Function = pdu[0]
+	case *RTUFrame:
+		frame.Function = pdu[0]
+	case *ASCIIFrame:
+		frame.Function = pdu[0]
+	}
+	response.SetData(append([]byte(nil), pdu[1:]...))
+	return response
+}
@@ -0,0 +1,57 @@
+package mbserver
+
+import "testing"
+
+func TestRegisterRawFunctionHandler(t *testing.T) {
+	s := NewServer()
+	s.RegisterRawFunctionHandler(0x41, func(s *Server, frame Framer) ([]byte, bool) {
+		data := frame.GetData()
+		if len(data) == 0 {
+			return nil, false
+		}
+		return append([]byte{0x42}, data...), true
+	})
+
+	frame := &TCPFrame{TransactionIdentifier: 7, Device: 1, Function: 0x41, Data: []byte{1, 2, 3}}
+	response := s.handle(&Request{frame: frame})
+	expect := []byte{0, 7, 0, 0, 0, 5, 1, 0x42, 1, 2, 3}
+	if !isEqual(expect, response.Bytes()) {
+		t.Errorf("expected %v, got %v", expect, response.Bytes())
+	}
+
+	frame = &TCPFrame{Device: 1, Function: 0x41}
+	if response := s.handle(&Request{frame: frame}); response != nil {
+		t.Errorf("expected no response, got %v", response.Bytes())
+	}
+
+	if !isEqual([]uint8{1, 2, 3, 4, 5, 6, 8, 15, 16, 22, 23, 24, 43, 0x41}, s.RegisteredFunctions()) {
+		t.Errorf("expected 0x41 to be registered, got %v", s.RegisteredFunctions())
+	}
+
+	// Registering a regular handler replaces the raw one.
+	s.RegisterFunctionHandler(0x41, func(s *Server, frame Framer) ([]byte, *Exception) {
+		return []byte{9}, &Success
+	})
+	frame = &TCPFrame{Device: 1, Function: 0x41}
+	response = s.handle(&Request{frame: frame})
+	if !isEqual([]byte{9}, response.GetData()) {
+		t.Errorf("expected [9], got %v", response.GetData())
+	}
+}
+
+func TestRawFunctionHandlerReservedCode(t *testing.T) {
+	s := NewServer()
+	called := false
+	s.RegisterRawFunctionHandler(0x81, func(s *Server, frame Framer) ([]byte, bool) {
+		called = true
+		return []byte{0x81}, true
+	})
+
+	response := s.handle(&Request{frame: &TCPFrame{Device: 1, Function: 0x81}})
+	if exception := GetException(response); exception != IllegalFunction {
+		t.Errorf("expected IllegalFunction, got %v", exception.String())
+	}
+	if called {
+		t.Errorf("expected the raw handler of a reserved function code not to be called")
+	}
+}
@@ -0,0 +1,115 @@
+package mbserver
+
+import (
+	"encoding/binary"
+	"sync"
+)
+
+// RecordedRequest is a request received by a RecordingServer.
+type RecordedRequest struct {
+	Function uint8
+	Unit     uint8
+	// Address and Quantity are set for the read and write functions (1-6, 15
+	// and 16), a single write having a quantity of 1.
+	Address  uint16
+	Quantity uint16
+	// Values holds the values of the write functions, coils as 0 or 1.
+	Values []uint16
+	// Data is the data of the request PDU, after the function code.
+	Data []byte
+}
+
+// RecordingServer is a Server recording every request it receives, to test
+// master code:
+//
+//	s := NewRecordingServer()
+//	// ... run the master against s ...
+//	for _, request := range s.Requests() {
+//		if request.Function == WriteHoldingRegisterFC && request.Address == 4 && request.Values[0] == 42 {
+//			// The master wrote 42 to register 40005.
+//		}
+//	}
+//
+// Requests are served as usual and recorded before they are processed,
+// whatever their unit ID.
+type RecordingServer struct {
+	*Server
+
+	lock     sync.Mutex
+	requests []RecordedRequest
+}
+
+// NewRecordingServer creates a new Modbus server (slave) that records the
+// requests it receives.
+func NewRecordingServer(opts ...Option) *RecordingServer {
+	r := &RecordingServer{Server: NewServer(opts...)}
+	r.hooksLock.Lock()
+	r.requestHook = r.record
+	r.hooksLock.Unlock()
+	return r
+}
+
+// Requests returns the requests recorded so far, oldest first.
+func (r *RecordingServer) Requests() []RecordedRequest {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]RecordedRequest(nil), r.requests...)
+}
+
+// Reset resets the server, see Server.Reset, and forgets the recorded
+// requests.
+func (r *RecordingServer) Reset() {
+	r.Server.Reset()
+	r.lock.Lock()
+	r.requests = nil
+	r.lock.Unlock()
+}
+
+func (r *RecordingServer) record(frame Framer) {
+	// The wire byte order is guarded by the memory lock.
+	r.memoryLock.RLock()
+	request := decodeRequest(r.Server, frame)
+	r.memoryLock.RUnlock()
+
+	r.lock.Lock()
+	r.requests = append(r.requests, request)
+	r.lock.Unlock()
+}
+
+// decodeRequest decodes the address, quantity and values of a request.
+func decodeRequest(s *Server, frame Framer) RecordedRequest {
+	data := frame.GetData()
+	request := RecordedRequest{
+		Function: frame.GetFunction(),
+		Unit:     frame.GetSlaveId(),
+		Data:     append([]byte(nil), data...),
+	}
+	if len(data) < 4 {
+		return request
+	}
+
+	switch request.Function {
+	case ReadCoilsFC, ReadDiscreteInputsFC, ReadHoldingRegistersFC, ReadInputRegistersFC:
+		request.Address = binary.BigEndian.Uint16(data[0:2])
+		request.Quantity = binary.BigEndian.Uint16(data[2:4])
+	case WriteSingleCoilFC:
+		request.Address, request.Quantity = binary.BigEndian.Uint16(data[0:2]), 1
+		request.Values = []uint16{boolValue(binary.BigEndian.Uint16(data[2:4]) != 0)}
+	case WriteHoldingRegisterFC:
+		request.Address, request.Quantity = binary.BigEndian.Uint16(data[0:2]), 1
+		request.Values = s.decodeRegisters(data[2:4])
+	case WriteMultipleCoilsFC:
+		request.Address = binary.BigEndian.Uint16(data[0:2])
+		request.Quantity = binary.BigEndian.Uint16(data[2:4])
+		for i := 0; i < int(request.Quantity) && 5+i/8 < len(data); i++ {
+			request.Values = append(request.Values, uint16(bitAtPosition(data[5+i/8], uint(i%8))))
+		}
+	case WriteHoldingRegistersFC:
+		request.Address = binary.BigEndian.Uint16(data[0:2])
+		request.Quantity = binary.BigEndian.Uint16(data[2:4])
+		if len(data) > 5 {
+			request.Values = s.decodeRegisters(data[5:])
+		}
+	}
+	return request
+}
@@ -0,0 +1,49 @@
+package mbserver
+
+import (
+	"testing"
+
+	"github.com/goburrow/modbus"
+)
+
+func TestRecordingServer(t *testing.T) {
+	s := NewRecordingServer()
+	addr, err := s.ListenTCPAny()
+	if err != nil {
+		t.Fatalf("failed to listen, got %v\n", err)
+	}
+	defer s.Close()
+
+	handler := modbus.NewTCPClientHandler(addr.String())
+	handler.SlaveId = 1
+	if err := handler.Connect(); err != nil {
+		t.Fatalf("failed to connect, got %v\n", err)
+	}
+	defer handler.Close()
+	client := modbus.NewClient(handler)
+
+	client.WriteSingleRegister(4, 42)
+	client.ReadHoldingRegisters(4, 2)
+	client.WriteMultipleCoils(1, 3, []byte{0x05})
+	client.WriteMultipleRegisters(10, 2, []byte{0, 7, 0, 8})
+	client.WriteSingleCoil(2, 0xff00)
+
+	expect := []RecordedRequest{
+		{Function: WriteHoldingRegisterFC, Unit: 1, Address: 4, Quantity: 1, Values: []uint16{42}, Data: []byte{0, 4, 0, 42}},
+		{Function: ReadHoldingRegistersFC, Unit: 1, Address: 4, Quantity: 2, Data: []byte{0, 4, 0, 2}},
+		{Function: WriteMultipleCoilsFC, Unit: 1, Address: 1, Quantity: 3, Values: []uint16{1, 0, 1}, Data: []byte{0, 1, 0, 3, 1, 5}},
+		{Function: WriteHoldingRegistersFC, Unit: 1, Address: 10, Quantity: 2, Values: []uint16{7, 8}, Data: []byte{0, 10, 0, 2, 4, 0, 7, 0, 8}},
+		{Function: WriteSingleCoilFC, Unit: 1, Address: 2, Quantity: 1, Values: []uint16{1}, Data: []byte{0, 2, 0xff, 0}},
+	}
+	if !isEqual(expect, s.Requests()) {
+		t.Errorf("expected %+v, got %+v", expect, s.Requests())
+	}
+	if s.HoldingRegisters[4] != 42 {
+		t.Errorf("expected the write to be served, got %v", s.HoldingRegisters[4])
+	}
+
+	s.Reset()
+	if len(s.Requests()) != 0 {
+		t.Errorf("expected no requests after Reset, got %+v", s.Requests())
+	}
+}
@@ -0,0 +1,150 @@
+package mbserver
+
+import "fmt"
+
+// region is an address range reserved for one kind of memory map.
+type region struct {
+	start, end int
+	kind       RegisterKind
+}
+
+// MapRegion declares the addresses start to end (inclusive) as belonging to
+// one kind of memory map. Requests for another kind that touch the region
+// return IllegalDataAddress, which models devices with a strict,
+// non-overlapping address map. Regions of different kinds may not overlap.
+//
+// Addresses outside every region remain accessible to all kinds unless
+// strict regions are enabled with SetStrictRegions.
+func (s *Server) MapRegion(start, end uint16, kind RegisterKind) error {
+	if end < start {
+		return fmt.Errorf("region end %d before start %d", end, start)
+	}
+
+	s.regionsLock.Lock()
+	defer s.regionsLock.Unlock()
+
+	for _, r := range s.regions {
+		if r.kind != kind && int(start) <= r.end && int(end) >= r.start {
+			return fmt.Errorf("region %d-%d overlaps %v region %d-%d", start, end, r.kind, r.start, r.end)
+		}
+	}
+	s.regions = append(s.regions, region{start: int(start), end: int(end), kind: kind})
+	return nil
+}
+
+// SetStrictRegions rejects requests touching addresses that are not mapped
+// with MapRegion for the requested kind.
+func (s *Server) SetStrictRegions(strict bool) {
+	s.regionsLock.Lock()
+	s.strictRegions = strict
+	s.regionsLock.Unlock()
+}
+
+// GapBehavior is the response to reads touching addresses outside every
+// region mapped with MapRegion, see SetGapBehavior.
+type GapBehavior uint8
+
+const (
+	// ReturnZero serves the gaps from memory like other addresses, where
+	// they read as zero unless written.
+	ReturnZero GapBehavior = iota
+	// ReturnException returns IllegalDataAddress.
+	ReturnException
+)
+
+// SetGapBehavior sets how reads crossing a gap between the regions mapped
+// with MapRegion are answered: some devices return zero, others an
+// IllegalDataAddress exception. The default is ReturnZero. Writes to gaps are
+// not affected, and gaps only exist once a region is mapped. With strict
+// regions, every gap returns an exception.
+func (s *Server) SetGapBehavior(behavior GapBehavior) {
+	s.regionsLock.Lock()
+	s.gapBehavior = behavior
+	s.regionsLock.Unlock()
+}
+
+// checkGaps returns an error when quantity items from address touch an
+// address outside every region and gaps return exceptions.
+func (s *Server) checkGaps(address int, quantity int) error {
+	s.regionsLock.RLock()
+	defer s.regionsLock.RUnlock()
+
+	if len(s.regions) == 0 || s.gapBehavior != ReturnException {
+		return nil
+	}
+	end := address + quantity - 1
+	for next := address; next <= end; {
+		r, ok := s.regionAt(next)
+		if !ok {
+			return fmt.Errorf("%w: %d is not mapped", ErrAddressOutOfRange, next)
+		}
+		next = r.end + 1
+	}
+	return nil
+}
+
+// checkRegions validates quantity items of kind from address against the
+// mapped regions.
+func (s *Server) checkRegions(kind RegisterKind, address int, quantity int) error {
+	s.regionsLock.RLock()
+	defer s.regionsLock.RUnlock()
+
+	if len(s.regions) == 0 && !s.strictRegions {
+		return nil
+	}
+
+	// Walk the range region by region rather than address by address.
+	end := address + quantity - 1
+	for next := address; next <= end; {
+		r, ok := s.regionAt(next)
+		switch {
+		case ok && r.kind != kind:
+			return fmt.Errorf("%w: %d is mapped as %v", ErrAddressOutOfRange, next, r.kind)
+		case ok:
+			next = r.end + 1
+		case s.strictRegions:
+			return fmt.Errorf("%w: %d is not mapped", ErrAddressOutOfRange, next)
+		default:
+			next = s.nextRegionStart(next, end)
+		}
+	}
+	return nil
+}
+
+func (s *Server) regionAt(address int) (region, bool) {
+	for _, r := range s.regions {
+		if address >= r.start && address <= r.end {
+			return r, true
+		}
+	}
+	return region{}, false
+}
+
+// nextRegionStart returns the start of the first region after address, or
+// end+1 when there is none up to end.
+func (s *Server) nextRegionStart(address int, end int) int {
+	next := end + 1
+	for _, r := range s.regions {
+		if r.start > address && r.start < next {
+			next = r.start
+		}
+	}
+	return next
+}
+
+// validateRange checks a request for quantity items of kind from address
+// against the allocated memory, the per request limit and the mapped regions.
+func (s *Server) validateRange(kind RegisterKind, address int, quantity int, limit int) error {
+	if err := checkRange(address, quantity, s.bankSize(kind), limit); err != nil {
+		return err
+	}
+	return s.checkRegions(kind, address, quantity)
+}
+
+// validateReadRange is validateRange for reads, which also checks gaps.
+func (s *Server) validateReadRange(kind RegisterKind, address int, quantity int, limit int) error {
+	if err := s.validateRange(kind, address, quantity, limit); err != nil {
+		return err
+	}
+	return s.checkGaps(address, quantity)
+}
@@ -0,0 +1,93 @@
+package mbserver
+
+import "testing"
+
+func TestMapRegion(t *testing.T) {
+	s := NewServer()
+	err := s.MapRegion(0, 99, DiscreteInput)
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	err = s.MapRegion(100, 199, HoldingRegister)
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	err = s.MapRegion(150, 250, Coil)
+	if err == nil {
+		t.Errorf("expected overlapping regions to be rejected")
+	}
+
+	tests := []struct {
+		function uint8
+		address  uint16
+		quantity uint16
+		expect   Exception
+	}{
+		{ReadDiscreteInputsFC, 0, 100, Success},
+		{ReadHoldingRegistersFC, 0, 1, IllegalDataAddress},
+		{ReadHoldingRegistersFC, 100, 100, Success},
+		{ReadHoldingRegistersFC, 98, 4, IllegalDataAddress},
+		{ReadHoldingRegistersFC, 190, 20, Success},
+		{ReadCoilsFC, 300, 10, Success},
+		{ReadCoilsFC, 95, 10, IllegalDataAddress},
+	}
+	for _, test := range tests {
+		frame := &TCPFrame{Device: 1, Function: test.function}
+		SetDataWithRegisterAndNumber(frame, test.address, test.quantity)
+		response := s.handle(&Request{frame: frame})
+		exception := GetException(response)
+		if exception != test.expect {
+			t.Errorf("%+v: expected %v, got %v", test, test.expect.String(), exception.String())
+		}
+	}
+
+	// Unmapped addresses are rejected in strict mode.
+	s.SetStrictRegions(true)
+	frame := &TCPFrame{Device: 1, Function: ReadHoldingRegistersFC}
+	SetDataWithRegisterAndNumber(frame, 190, 20)
+	response := s.handle(&Request{frame: frame})
+	exception := GetException(response)
+	if exception != IllegalDataAddress {
+		t.Errorf("expected IllegalDataAddress, got %v", exception.String())
+	}
+}
+
+func TestSetGapBehavior(t *testing.T) {
+	s := NewServer()
+	s.MapRegion(0, 9, HoldingRegister)
+	s.MapRegion(20, 29, HoldingRegister)
+
+	call := func(function uint8, address, quantity uint16) Exception {
+		frame := &TCPFrame{Device: 1, Function: function}
+		if function == WriteHoldingRegistersFC {
+			SetDataWithRegisterAndNumberAndValues(frame, address, quantity, make([]uint16, quantity))
+		} else {
+			SetDataWithRegisterAndNumber(frame, address, quantity)
+		}
+		return GetException(s.handle(&Request{frame: frame}))
+	}
+
+	if exception := call(ReadHoldingRegistersFC, 5, 20); exception != Success {
+		t.Errorf("expected Success by default, got %v", exception.String())
+	}
+
+	s.SetGapBehavior(ReturnException)
+	tests := []struct {
+		function uint8
+		address  uint16
+		quantity uint16
+		expect   Exception
+	}{
+		{ReadHoldingRegistersFC, 5, 20, IllegalDataAddress},
+		{ReadHoldingRegistersFC, 0, 10, Success},
+		{ReadHoldingRegistersFC, 20, 10, Success},
+		{ReadHoldingRegistersFC, 25, 10, IllegalDataAddress},
+		{ReadCoilsFC, 10, 1, IllegalDataAddress},
+		{WriteHoldingRegistersFC, 5, 20, Success},
+	}
+	for _, test := range tests {
+		if exception := call(test.function, test.address, test.quantity); exception != test.expect {
+			t.Errorf("%+v: expected %v, got %v", test, test.expect.String(), exception.String())
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package mbserver
+
+// RegisterKind identifies one of the four Modbus memory maps.
+type RegisterKind uint8
+
+const (
+	// Coil is a single read-write bit.
+	Coil RegisterKind = iota
+	// DiscreteInput is a single read-only bit.
+	DiscreteInput
+	// HoldingRegister is a read-write 16-bit register.
+	HoldingRegister
+	// InputRegister is a read-only 16-bit register.
+	InputRegister
+)
+
+func (k RegisterKind) String() string {
+	switch k {
+	case Coil:
+		return "Coil"
+	case DiscreteInput:
+		return "DiscreteInput"
+	case HoldingRegister:
+		return "HoldingRegister"
+	case InputRegister:
+		return "InputRegister"
+	default:
+		return "unknown"
+	}
+}
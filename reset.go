@@ -0,0 +1,70 @@
+package mbserver
+
+// ResetMemory sets all coils, discrete inputs, holding registers and input
+// registers to zero, Enron registers included. The memory maps keep their
+// size.
+//
+// ResetMemory waits for the request being processed to finish, so it must not
+// be called from a function handler.
+func (s *Server) ResetMemory() {
+	s.memoryLock.Lock()
+	defer s.memoryLock.Unlock()
+
+	s.enronValues = nil
+	if s.store != nil {
+		for kind := Coil; kind <= InputRegister; kind++ {
+			s.fillStore(kind, 0)
+		}
+		return
+	}
+	if s.sparse != nil {
+		for kind := range s.sparse.values {
+			s.sparse.values[kind] = make(map[uint16]uint16)
+		}
+		return
+	}
+	clear(s.Coils)
+	clear(s.DiscreteInputs)
+	clear(s.HoldingRegisters)
+	clear(s.InputRegisters)
+}
+
+// Reset returns the server to the state of a new server between test cases,
+// without closing listeners, serial ports or client connections. It clears
+// the memory maps (see ResetMemory), the FIFO queues, error injection, RTU
+// CRC corruption, the written write-once addresses, listen only mode, the
+// remaining startup busy responses, the last exceptions and the traffic
+// captured on each connection.
+//
+// Function handlers, write callbacks, the write validator, mapped regions,
+// write-once ranges, the slave ID and the other settings are kept.
+func (s *Server) Reset() {
+	s.ResetMemory()
+
+	s.fifoLock.Lock()
+	s.fifoQueues = nil
+	s.fifoLock.Unlock()
+
+	s.faultsLock.Lock()
+	s.errorInjections = nil
+	s.crcCorruption = 0
+	s.faultsLock.Unlock()
+
+	s.ResetWriteOnce()
+	s.changeState(func() {
+		s.startupBusy.Store(0)
+		s.listenOnly.Store(false)
+	})
+
+	s.exceptionLock.Lock()
+	s.lastExceptions = [256]lastException{}
+	s.exceptionLock.Unlock()
+
+	s.connsLock.Lock()
+	for _, client := range s.conns {
+		client.captureLock.Lock()
+		client.captured = nil
+		client.captureLock.Unlock()
+	}
+	s.connsLock.Unlock()
+}
@@ -0,0 +1,54 @@
+package mbserver
+
+import "testing"
+
+func TestReset(t *testing.T) {
+	s := NewServer()
+	s.Coils[1] = 1
+	s.DiscreteInputs[2] = 1
+	s.HoldingRegisters[3] = 3
+	s.InputRegisters[4] = 4
+	s.SetFIFOQueue(0, []uint16{1})
+	s.SetErrorInjection(ReadCoilsFC, 1, &SlaveDeviceBusy)
+	s.SetStartupBusy(1)
+	validated := false
+	s.SetWriteValidator(func(address uint16, values []uint16, kind RegisterKind) *Exception {
+		validated = true
+		return nil
+	})
+
+	s.Reset()
+
+	if s.Coils[1] != 0 || s.DiscreteInputs[2] != 0 || s.HoldingRegisters[3] != 0 || s.InputRegisters[4] != 0 {
+		t.Errorf("expected memory to be cleared")
+	}
+	if _, ok := s.fifoQueue(0); ok {
+		t.Errorf("expected FIFO queues to be cleared")
+	}
+
+	frame := &TCPFrame{Device: 1, Function: WriteHoldingRegisterFC}
+	SetDataWithRegisterAndNumber(frame, 3, 7)
+	response := s.handle(&Request{frame: frame})
+	if exception := GetException(response); exception != Success {
+		t.Errorf("expected Success, got %v", exception.String())
+	}
+	if !validated {
+		t.Errorf("expected the write validator to be kept")
+	}
+}
+
+func TestResetMemorySparse(t *testing.T) {
+	s := NewServer(WithSparse())
+	frame := &TCPFrame{Device: 1, Function: WriteHoldingRegisterFC}
+	SetDataWithRegisterAndNumber(frame, 3, 7)
+	s.handle(&Request{frame: frame})
+
+	s.ResetMemory()
+
+	if got, _ := s.readRegisters(HoldingRegister, 3, 1); !isEqual([]uint16{0}, got) {
+		t.Errorf("expected 0, got %v", got)
+	}
+	if s.bankSize(HoldingRegister) != 65536 {
+		t.Errorf("expected the memory map to keep its size")
+	}
+}
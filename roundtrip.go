@@ -0,0 +1,97 @@
+package mbserver
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"time"
+)
+
+// RoundTrip hands the raw bytes of a Modbus TCP request (MBAP header and PDU)
+// to the server, as if it had been received on a connection, and returns the
+// raw bytes of the response. It is a synchronous test driver: requests are
+// processed in order with those of the other connections, through the same
+// path. ErrNoResponse is returned when the server does not answer, for
+// instance because the unit ID of the request matches neither SlaveID nor a
+// unit added with AddUnit and no forwarder is set, or the server is in
+// listen only mode, and ErrServerClosed once the server was shut down.
+func (s *Server) RoundTrip(req []byte) ([]byte, error) {
+	frame, err := NewTCPFrame(req)
+	if err != nil {
+		return nil, err
+	}
+
+	conn := &roundTripConn{}
+	done := make(chan struct{})
+	// As in submit, the request is counted before checking the flag.
+	s.inFlight.Add(1)
+	if s.shuttingDown.Load() {
+		s.inFlight.Add(-1)
+		return nil, ErrServerClosed
+	}
+	request := &Request{conn: conn, frame: frame, ctx: context.Background(), received: time.Now(), done: done}
+	s.requestQueue(request) <- request
+	<-done
+
+	if conn.response.Len() == 0 {
+		return nil, ErrNoResponse
+	}
+	return conn.response.Bytes(), nil
+}
+
+// Dispatch runs a decoded request frame through the server, without any
+// transport, and returns the response frame and whether it would be sent. It
+// is the lowest-level test entry point for function handlers:
+//
+//	frame := &mbserver.TCPFrame{Device: 1, Function: mbserver.ReadHoldingRegistersFC}
+//	mbserver.SetDataWithRegisterAndNumber(frame, 0, 10)
+//	response, ok := s.Dispatch(frame)
+//
+// Requests for a unit added with AddUnit are dispatched to it. Requests for
+// other unit IDs than SlaveID return nil and false, unless they are broadcast
+// reads answered as set by SetBroadcastReadBehavior. Broadcast writes of
+// serial frames are applied to the server and its units, and return nil and
+// false. In listen only mode the response is returned with false. Unlike
+// RoundTrip, Dispatch runs the request on the calling goroutine and bypasses
+// the TCP to RTU gateway and the forwarder set with SetForwarder.
+func (s *Server) Dispatch(frame Framer) (Framer, bool) {
+	s.runRequestHook(frame)
+	if frame.GetSlaveId() != s.SlaveID() {
+		if unit := s.unit(frame.GetSlaveId()); unit != nil {
+			request := &Request{frame: frame, ctx: context.Background(), received: time.Now()}
+			if exception := s.checkAccess(request); exception != nil {
+				response := frame.Copy()
+				s.setException(request, response, exception)
+				return response, true
+			}
+			return unit.Dispatch(frame)
+		}
+		if s.isBroadcastWrite(frame) {
+			s.serveBroadcast(&Request{frame: frame, ctx: context.Background(), received: time.Now()})
+			return nil, false
+		}
+		response := s.broadcastReadException(frame)
+		return response, response != nil
+	}
+	response, send := s.process(&Request{frame: frame, ctx: context.Background(), received: time.Now()})
+	s.flushWriteEvents(frame)
+	s.requestProcessed(frame.GetFunction())
+	return response, send
+}
+
+// roundTripConn collects the response written by the request handler.
+type roundTripConn struct {
+	response bytes.Buffer
+}
+
+func (c *roundTripConn) Read(p []byte) (int, error) {
+	return 0, io.EOF
+}
+
+func (c *roundTripConn) Write(p []byte) (int, error) {
+	return c.response.Write(p)
+}
+
+func (c *roundTripConn) Close() error {
+	return nil
+}
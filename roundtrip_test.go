@@ -0,0 +1,86 @@
+package mbserver
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.HoldingRegisters[107] = 0x022b
+	s.HoldingRegisters[108] = 0x0000
+	s.HoldingRegisters[109] = 0x0064
+
+	// Read Holding Registers example of the Modbus specification.
+	tests := []struct {
+		request  []byte
+		response []byte
+	}{
+		{
+			[]byte{0, 1, 0, 0, 0, 6, 1, 0x03, 0x00, 0x6b, 0x00, 0x03},
+			[]byte{0, 1, 0, 0, 0, 9, 1, 0x03, 0x06, 0x02, 0x2b, 0x00, 0x00, 0x00, 0x64},
+		},
+		{
+			[]byte{0, 2, 0, 0, 0, 6, 1, 0x06, 0x00, 0x01, 0x00, 0x03},
+			[]byte{0, 2, 0, 0, 0, 6, 1, 0x06, 0x00, 0x01, 0x00, 0x03},
+		},
+		{
+			[]byte{0, 3, 0, 0, 0, 6, 1, 0x03, 0xff, 0xff, 0x00, 0x02},
+			[]byte{0, 3, 0, 0, 0, 3, 1, 0x83, 0x02},
+		},
+	}
+	for _, test := range tests {
+		response, err := s.RoundTrip(test.request)
+		if err != nil {
+			t.Fatalf("expected nil, got %v", err)
+		}
+		if !isEqual(test.response, response) {
+			t.Errorf("expected %v, got %v", test.response, response)
+		}
+	}
+
+	_, err := s.RoundTrip([]byte{0, 4, 0, 0, 0, 6, 2, 0x03, 0x00, 0x00, 0x00, 0x01})
+	if !errors.Is(err, ErrNoResponse) {
+		t.Errorf("expected ErrNoResponse for another unit, got %v", err)
+	}
+}
+
+func TestDispatch(t *testing.T) {
+	s := NewServer()
+	s.HoldingRegisters[1] = 7
+	s.RegisterFunctionHandler(100, func(s *Server, frame Framer) ([]byte, *Exception) {
+		return []byte{byte(s.HoldingRegisters[1])}, &Success
+	})
+
+	response, ok := s.Dispatch(&TCPFrame{TransactionIdentifier: 5, Device: 1, Function: 100})
+	if !ok {
+		t.Fatalf("expected a response to be sent")
+	}
+	expect := &TCPFrame{TransactionIdentifier: 5, Length: 3, Device: 1, Function: 100, Data: []byte{7}}
+	if !isEqual(expect, response) {
+		t.Errorf("expected %v, got %v", expect, response)
+	}
+
+	if response, ok := s.Dispatch(&TCPFrame{Device: 2, Function: 100}); ok || response != nil {
+		t.Errorf("expected no response for another unit, got %v", response)
+	}
+
+	s.listenOnly.Store(true)
+	response, ok = s.Dispatch(&TCPFrame{Device: 1, Function: 100})
+	if ok || response == nil {
+		t.Errorf("expected a response not to be sent in listen only mode, got %v %v", response, ok)
+	}
+}
+
+func TestRoundTripShutdown(t *testing.T) {
+	s := NewServer()
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	_, err := s.RoundTrip([]byte{0, 1, 0, 0, 0, 6, 1, 0x03, 0x00, 0x00, 0x00, 0x01})
+	if !errors.Is(err, ErrServerClosed) {
+		t.Errorf("expected ErrServerClosed, got %v", err)
+	}
+}
@@ -0,0 +1,66 @@
+package mbserver
+
+import (
+	"fmt"
+	"io"
+	"net"
+)
+
+// FramingMode is the framing of the requests read from a connection, see
+// ServeConn.
+type FramingMode int
+
+const (
+	// FramingTCP is Modbus TCP framing, with an MBAP header.
+	FramingTCP FramingMode = iota
+	// FramingRTU is Modbus RTU framing, with a CRC, as over serial ports.
+	FramingRTU
+	// FramingASCII is Modbus ASCII framing, with an LRC, see ListenASCII.
+	FramingASCII
+)
+
+func (m FramingMode) String() string {
+	switch m {
+	case FramingTCP:
+		return "TCP"
+	case FramingRTU:
+		return "RTU"
+	case FramingASCII:
+		return "ASCII"
+	}
+	return fmt.Sprintf("FramingMode(%d)", int(m))
+}
+
+// Serve accepts Modbus TCP connections on a listener created by the caller,
+// such as a Unix socket listener, until it is closed; it then returns nil.
+// Connections are served as those of ListenTCP, and the listener is closed
+// by Close and Shutdown. Unlike the Listen functions Serve blocks, and
+// Restart does not serve the listener again.
+func (s *Server) Serve(listen net.Listener, opts ...ListenOption) error {
+	s.listenersLock.Lock()
+	s.listeners = append(s.listeners, listen)
+	s.listenersLock.Unlock()
+	return s.accept(listen, newListenPolicy(opts))
+}
+
+// ServeConn serves the requests read from a single connection, such as one
+// end of a net.Pipe or a multiplexed stream, with the given framing, until
+// it is closed. FramingTCP connections are served as those of ListenTCP,
+// FramingRTU and FramingASCII ones as serial ports. The options restrict the
+// functions the master may use, see ListenTCP.
+func (s *Server) ServeConn(conn io.ReadWriteCloser, framing FramingMode, opts ...ListenOption) error {
+	policy := newListenPolicy(opts)
+	switch framing {
+	case FramingTCP:
+		s.serveTCP(conn, policy)
+	case FramingRTU:
+		defer conn.Close()
+		s.acceptSerialRequests(conn, policy)
+	case FramingASCII:
+		defer conn.Close()
+		s.acceptASCIIRequests(conn, policy)
+	default:
+		return fmt.Errorf("unknown framing mode %v", framing)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package mbserver
+
+import (
+	"io"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestServe(t *testing.T) {
+	s := NewServer()
+	listen, err := net.Listen("unix", filepath.Join(t.TempDir(), "modbus.sock"))
+	if err != nil {
+		t.Skipf("unix sockets are not supported: %v", err)
+	}
+	served := make(chan error, 1)
+	go func() { served <- s.Serve(listen) }()
+
+	conn, err := net.Dial("unix", listen.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	frame := &TCPFrame{Device: 1, Function: ReadCoilsFC}
+	SetDataWithRegisterAndNumber(frame, 0, 8)
+	conn.Write(frame.Bytes())
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := io.ReadFull(conn, make([]byte, 10)); err != nil {
+		t.Errorf("expected a response, got %v", err)
+	}
+
+	s.Close()
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Errorf("expected nil once the listener is closed, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("expected Serve to return once the server is closed")
+	}
+}
+
+func TestServeConn(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.HoldingRegisters[0] = 0x1234
+
+	tests := []struct {
+		framing FramingMode
+		request Framer
+		expect  []byte
+	}{
+		{FramingTCP, &TCPFrame{TransactionIdentifier: 3, Device: 1, Function: ReadHoldingRegistersFC}, []byte{0, 3, 0, 0, 0, 5, 1, 3, 2, 0x12, 0x34}},
+		{FramingRTU, &RTUFrame{Address: 1, Function: ReadHoldingRegistersFC}, (&RTUFrame{Address: 1, Function: 3, Data: []byte{2, 0x12, 0x34}}).Bytes()},
+		{FramingASCII, &ASCIIFrame{Address: 1, Function: ReadHoldingRegistersFC}, (&ASCIIFrame{Address: 1, Function: 3, Data: []byte{2, 0x12, 0x34}}).Bytes()},
+	}
+	for _, test := range tests {
+		conn, line := net.Pipe()
+		served := make(chan error, 1)
+		go func() { served <- s.ServeConn(conn, test.framing) }()
+
+		SetDataWithRegisterAndNumber(test.request, 0, 1)
+		line.Write(test.request.Bytes())
+		line.SetReadDeadline(time.Now().Add(time.Second))
+		response := make([]byte, len(test.expect))
+		if _, err := io.ReadFull(line, response); err != nil {
+			t.Errorf("%v: expected a response, got %v", test.framing, err)
+		} else if !isEqual(test.expect, response) {
+			t.Errorf("%v: expected %v, got %v", test.framing, test.expect, response)
+		}
+
+		line.Close()
+		if err := <-served; err != nil {
+			t.Errorf("%v: expected nil, got %v", test.framing, err)
+		}
+	}
+
+	if err := s.ServeConn(nil, FramingMode(9)); err == nil {
+		t.Errorf("expected an error for an unknown framing mode")
+	}
+}
@@ -2,47 +2,212 @@
 package mbserver
 
 import (
+	"context"
+	"crypto/x509"
+	"encoding/binary"
 	"io"
+	"log/slog"
+	"math/rand"
 	"net"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/goburrow/serial"
 )
 
 // Server is a Modbus slave with allocated memory for discrete inputs, coils, etc.
 type Server struct {
-	// Debug enables more verbose messaging.
-	Debug            bool
-	slaveId          uint8
+	// Debug is kept for compatibility and has no effect, see SetLogLevel
+	// and SetLogHandler.
+	Debug           bool
+	slaveId         atomic.Uint32
+	logger          Logger
+	listenBacklog   int
+	linger          atomic.Int32
+	requestDeadline atomic.Int64
+	logLevel        atomic.Int32
+	slogger         atomic.Pointer[slog.Logger]
+	// parent is the server a unit was added to, nil for other servers.
+	parent           *Server
+	diagCounters     [diagnosticCounters]atomic.Uint32
+	broadcastRead    atomic.Int32
+	unitDelays       [256]atomic.Int64
+	unitAllowedLock  sync.RWMutex
+	unitAllowed      map[uint8]*[256]bool
+	diagnosticSubs   map[uint16]func(*Server, []byte) ([]byte, *Exception)
+	rateLimit        atomic.Pointer[tokenBucket]
+	throttled        atomic.Uint64
+	deviceIDLock     sync.RWMutex
+	deviceObjects    map[uint8]string
+	unitsLock        sync.RWMutex
+	units            map[uint8]*Unit
+	jitterLock       sync.Mutex
+	jitterRand       *rand.Rand
+	jitterMin        time.Duration
+	jitterMax        time.Duration
+	listenOnly       atomic.Bool
+	shuttingDown     atomic.Bool
+	handlerRunning   atomic.Bool
+	lifecycleLock    sync.Mutex
+	handlerQuit      chan struct{}
+	handlerDone      chan struct{}
+	closed           chan struct{}
+	listenSpecs      []listenSpec
+	inFlight         atomic.Int64
+	quantityLimit    [4]atomic.Int32
+	listenersLock    sync.Mutex
 	listeners        []net.Listener
+	packetConns      []net.PacketConn
+	httpEndpoints    []httpEndpoint
+	listenConfig     *net.ListenConfig
 	ports            []serial.Port
 	portsWG          sync.WaitGroup
 	portsCloseChan   chan struct{}
-	requestChan      chan *Request
+	connsLock        sync.Mutex
+	conns            map[io.ReadWriteCloser]*clientConn
+	captureDepth     int32
+	startupBusy      atomic.Int64
+	hooksLock        sync.RWMutex
+	writeValidator   func(address uint16, values []uint16, kind RegisterKind) *Exception
+	tracer           Tracer
+	serialFrameError func(raw []byte, reason string)
+	requestHook      func(Framer)
+	responseHooks    []func(*Request, Framer, bool)
+	middleware       []func(HandlerFunc) HandlerFunc
+	allowedNets      []*net.IPNet
+	deniedNets       []*net.IPNet
+	accessRules      []accessRule
+	readOnlyRanges   []region
+	violationHook    func(AccessViolation)
+	rejectedConns    atomic.Uint64
+	maxConns         atomic.Int32
+	activeConns      atomic.Int32
+	idleTimeout      atomic.Int64
+	readTimeout      atomic.Int64
+	connectHook      func(ClientInfo)
+	disconnectHook   func(ClientInfo)
+	connContext      func(conn net.Conn) context.Context
+	tlsAuthorizer    func(*x509.Certificate) error
+	roleAuthorizer   func(role string, unit uint8, funcCode uint8) bool
+	writeCallbacks   []func(WriteEvent)
+	writeSubs        map[chan WriteEvent]struct{}
+	callbackTiming   int32
+	deferredWrites   map[Framer][]WriteEvent
+	bridge           *bridge
+	bridgeTimeout    atomic.Int64
+	handshakeTimeout atomic.Int64
+	forwarder        Forwarder
+	regionsLock      sync.RWMutex
+	regions          []region
+	writeOnce        []region
+	profileFields    map[string]profileField
+	startAddress     int
+	written          [4][]uint64
+	strictRegions    bool
+	gapBehavior      GapBehavior
+	faultsLock       sync.Mutex
+	faultsRand       *rand.Rand
+	errorInjections  map[uint8]errorInjection
+	functionFaults   map[uint8]functionFault
+	crcCorruption    float64
+	latency          latencyHistogram
+	requestCounts    [256]atomic.Uint64
+	exceptionCounts  [256]atomic.Uint64
+	bytesIn          atomic.Uint64
+	bytesOut         atomic.Uint64
+	exceptionLock    sync.Mutex
+	lastExceptions   [256]lastException
+	awaitLock        sync.Mutex
+	awaiters         []chan uint8
+	pulseLock        sync.Mutex
+	pulses           map[uint16]*time.Timer
+	fifoLock         sync.Mutex
+	fifoQueues       map[uint16][]uint16
+	persistLock      sync.Mutex
+	persistStop      chan struct{}
+	persistDone      chan struct{}
+	simLock          sync.Mutex
+	simGenerators    map[simulatedValue]Generator
+	simStop          chan struct{}
+	simDone          chan struct{}
+	requestChans     []chan *Request
+	nextWorker       atomic.Uint32
 	function         [256](func(*Server, Framer) ([]byte, *Exception))
+	contextFunction  [256](func(context.Context, *Server, Framer) ([]byte, *Exception))
+	rawFunction      [256](func(*Server, Framer) ([]byte, bool))
+	unitFunction     map[uint8]*[256](func(*Server, Framer) ([]byte, *Exception))
+	readOnlyFunction [256]bool
+	memoryLock       sync.RWMutex
+	wireOrder        binary.ByteOrder
+	enronMode        bool
+	enronStart       uint16
+	enronEnd         uint16
+	enronValues      map[uint16]uint32
 	DiscreteInputs   []byte
 	Coils            []byte
 	HoldingRegisters []uint16
 	InputRegisters   []uint16
+	sparse           *sparseMemory
+	store            Store
+	counts           [4]int
+	mmap             *mmapBacking
 }
 
 // Request contains the connection and Modbus frame.
 type Request struct {
 	conn  io.ReadWriteCloser
 	frame Framer
+	ctx   context.Context
+	// received is the time the request was read.
+	received time.Time
+	// done, if set, is closed once the request was processed.
+	done chan struct{}
+	// policy restricts the functions allowed by the listener the request
+	// was read from, nil when all are.
+	policy *listenPolicy
+	// tlsRole is the role of the TLS client the request was read from, nil
+	// for other connections.
+	tlsRole *string
 }
 
-// NewServerWithSlaveId creates a new Modbus server (slave).
-func NewServerWithSlaveId(slaveId uint8) *Server {
+// NewServer creates a new Modbus server (slave) configured by the given
+// options. Without options it responds to slave ID 1 and allocates the full
+// Modbus address space for each memory map.
+func NewServer(opts ...Option) *Server {
+	return newServer(nil, opts)
+}
+
+func newServer(store Store, opts []Option) *Server {
+	cfg := defaultServerConfig()
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
 	s := &Server{
-		slaveId: slaveId,
+		logger:       cfg.logger,
+		startAddress: cfg.startAddress,
 	}
+	s.slaveId.Store(uint32(cfg.slaveId))
+	s.linger.Store(-1)
 
 	// Allocate Modbus memory maps.
-	s.DiscreteInputs = make([]byte, MaxRegisterSize)
-	s.Coils = make([]byte, MaxRegisterSize)
-	s.HoldingRegisters = make([]uint16, MaxRegisterSize)
-	s.InputRegisters = make([]uint16, MaxRegisterSize)
+	s.counts = [4]int{cfg.coilCount, cfg.discreteInputCount, cfg.holdingRegisterCount, cfg.inputRegisterCount}
+	if store != nil {
+		s.store = store
+	} else if cfg.sparse {
+		s.sparse = newSparseMemory(cfg.coilCount, cfg.discreteInputCount, cfg.holdingRegisterCount, cfg.inputRegisterCount)
+	} else {
+		s.DiscreteInputs = make([]byte, cfg.discreteInputCount)
+		s.Coils = make([]byte, cfg.coilCount)
+		s.HoldingRegisters = make([]uint16, cfg.holdingRegisterCount)
+		s.InputRegisters = make([]uint16, cfg.inputRegisterCount)
+	}
+	for kind, value := range cfg.fill {
+		s.fill(kind, value)
+	}
+	s.seedRegisters(HoldingRegister, cfg.holdingRegisters)
+	s.seedRegisters(InputRegister, cfg.inputRegisters)
 
 	// Add default functions.
 	s.function[ReadCoilsFC] = ReadCoils
@@ -51,65 +216,495 @@ func NewServerWithSlaveId(slaveId uint8) *Server {
 	s.function[ReadInputRegistersFC] = ReadInputRegisters
 	s.function[WriteSingleCoilFC] = WriteSingleCoil
 	s.function[WriteHoldingRegisterFC] = WriteHoldingRegister
+	s.function[DiagnosticsFC] = Diagnostics
 	s.function[WriteMultipleCoilsFC] = WriteMultipleCoils
 	s.function[WriteHoldingRegistersFC] = WriteHoldingRegisters
+	s.function[MaskWriteRegisterFC] = MaskWriteRegister
+	s.function[ReadWriteMultipleRegistersFC] = ReadWriteMultipleRegisters
+	s.function[ReadFIFOQueueFC] = ReadFIFOQueue
+	s.function[EncapsulatedInterfaceTransportFC] = ReadDeviceIdentification
+	for _, funcCode := range []uint8{ReadCoilsFC, ReadDiscreteInputsFC, ReadHoldingRegistersFC, ReadInputRegistersFC, DiagnosticsFC, ReadFIFOQueueFC, EncapsulatedInterfaceTransportFC} {
+		s.readOnlyFunction[funcCode] = true
+	}
+	s.diagnosticSubs = map[uint16]func(*Server, []byte) ([]byte, *Exception){
+		ReturnQueryData:       returnQueryData,
+		RestartCommunications: restartCommunications,
+		ForceListenOnlyMode:   forceListenOnlyMode,
+		ClearCounters:         clearCounters,
+		ClearOverrunCounter:   clearOverrunCounter,
+	}
+	for sub := uint16(ReturnBusMessageCount); sub <= ReturnBusOverrunCount; sub++ {
+		s.diagnosticSubs[sub] = returnCounter(sub)
+	}
 
-	s.requestChan = make(chan *Request)
+	s.conns = make(map[io.ReadWriteCloser]*clientConn)
+	s.requestChans = make([]chan *Request, cfg.workers)
+	for i := range s.requestChans {
+		s.requestChans[i] = make(chan *Request, cfg.requestQueue)
+	}
 	s.portsCloseChan = make(chan struct{})
 
-	go s.handler()
+	s.startHandler()
 
 	return s
 }
 
-// NewServer creates a new Modbus server (slave). default slaveId 1
-func NewServer() *Server {
-	return NewServerWithSlaveId(1)
+// NewServerWithSlaveId creates a new Modbus server (slave).
+func NewServerWithSlaveId(slaveId uint8) *Server {
+	return NewServer(WithSlaveID(slaveId))
+}
+
+// SetSlaveID changes the slave ID (unit identifier) the server responds to.
+// Each request is checked against a single snapshot of the ID, so it takes
+// effect from the next request on.
+func (s *Server) SetSlaveID(slaveId uint8) {
+	s.slaveId.Store(uint32(slaveId))
+}
+
+// SlaveID returns the slave ID (unit identifier) the server responds to.
+func (s *Server) SlaveID() uint8 {
+	return uint8(s.slaveId.Load())
 }
 
 // RegisterFunctionHandler override the default behavior for a given Modbus function.
+// The handler runs with the memory lock held for writing, see
+// RegisterReadOnlyFunctionHandler.
 func (s *Server) RegisterFunctionHandler(funcCode uint8, function func(*Server, Framer) ([]byte, *Exception)) {
+	s.rawFunction[funcCode] = nil
+	s.contextFunction[funcCode] = nil
 	s.function[funcCode] = function
+	s.readOnlyFunction[funcCode] = false
+}
+
+// RegisterReadOnlyFunctionHandler is like RegisterFunctionHandler for a
+// handler that does not change the memory maps. It runs with the memory lock
+// held for reading only, like the built-in read functions, so that it does
+// not wait for other readers. A read-only handler must not write to memory.
+func (s *Server) RegisterReadOnlyFunctionHandler(funcCode uint8, function func(*Server, Framer) ([]byte, *Exception)) {
+	s.RegisterFunctionHandler(funcCode, function)
+	s.readOnlyFunction[funcCode] = true
+}
+
+// RegisterDiagnosticSubFunction overrides the behavior of a sub-function of
+// Diagnostics (function 8), for vendor-specific diagnostics. The function is
+// passed the request data following the sub-function code, and returns the
+// response data following it, which Diagnostics prepends. It overrides the
+// built-in sub-functions too, and a nil function removes the sub-function,
+// whose requests then return IllegalFunction.
+//
+// Diagnostics is read-only, see RegisterReadOnlyFunctionHandler: the
+// function must not write to memory.
+func (s *Server) RegisterDiagnosticSubFunction(sub uint16, function func(s *Server, data []byte) ([]byte, *Exception)) {
+	if function == nil {
+		delete(s.diagnosticSubs, sub)
+		return
+	}
+	s.diagnosticSubs[sub] = function
+}
+
+// UnregisterFunctionHandler removes the handler for a Modbus function, so
+// that requests for it return IllegalFunction.
+func (s *Server) UnregisterFunctionHandler(funcCode uint8) {
+	s.rawFunction[funcCode] = nil
+	s.contextFunction[funcCode] = nil
+	s.function[funcCode] = nil
+	s.readOnlyFunction[funcCode] = false
+}
+
+// RegisteredFunctions returns the sorted function codes that have a handler,
+// the defaults included. Handlers registered for a single unit are not
+// reported.
+func (s *Server) RegisteredFunctions() []uint8 {
+	var funcCodes []uint8
+	for funcCode := range s.function {
+		if s.function[funcCode] != nil || s.contextFunction[funcCode] != nil || s.rawFunction[funcCode] != nil {
+			funcCodes = append(funcCodes, uint8(funcCode))
+		}
+	}
+	return funcCodes
+}
+
+// RegisterFunctionHandlerForUnit overrides the behavior of a Modbus function
+// for requests addressed to a single unit ID. It takes precedence over the
+// handler registered with RegisterFunctionHandler for that unit.
+func (s *Server) RegisterFunctionHandlerForUnit(unit uint8, funcCode uint8, function func(*Server, Framer) ([]byte, *Exception)) {
+	if s.unitFunction == nil {
+		s.unitFunction = make(map[uint8]*[256](func(*Server, Framer) ([]byte, *Exception)))
+	}
+	functions, ok := s.unitFunction[unit]
+	if !ok {
+		functions = new([256](func(*Server, Framer) ([]byte, *Exception)))
+		s.unitFunction[unit] = functions
+	}
+	functions[funcCode] = function
+}
+
+// functionHandler returns the handler for a function code, preferring a
+// handler registered for the unit over the global one.
+func (s *Server) functionHandler(unit uint8, funcCode uint8) func(context.Context, *Server, Framer) ([]byte, *Exception) {
+	if functions, ok := s.unitFunction[unit]; ok && functions[funcCode] != nil {
+		return withoutContext(functions[funcCode])
+	}
+	if s.contextFunction[funcCode] != nil {
+		return s.contextFunction[funcCode]
+	}
+	if s.function[funcCode] != nil {
+		return withoutContext(s.function[funcCode])
+	}
+	return nil
 }
 
 func (s *Server) handle(request *Request) Framer {
-	var exception *Exception
-	var data []byte
+	s.throttle()
+	span := s.startSpan(request.frame)
+	response := s.handleFrame(request)
+	endSpan(span, response)
+	s.countRequest(request.frame, response)
+	s.logRequest(request.frame, response)
+	return response
+}
+
+// handleFrame runs the handler of a request and builds the response, nil
+// when nothing is to be sent.
+func (s *Server) handleFrame(request *Request) Framer {
+	funcCode := request.frame.GetFunction()
+	exception := s.checkAccess(request)
+	// Function codes 128-255 are reserved for exception responses.
+	if exception == nil && funcCode&0x80 != 0 {
+		exception = &IllegalFunction
+	}
+	if raw := s.rawFunction[funcCode]; raw != nil && exception == nil {
+		return s.handleRaw(request, raw)
+	}
 
 	response := request.frame.Copy()
 
-	function := request.frame.GetFunction()
-	if s.function[function] != nil {
-		data, exception = s.function[function](s, request.frame)
+	data := []byte{}
+	if exception == nil {
+		data, exception = s.dispatch(request)
+	}
+	if exception == &Success {
 		response.SetData(data)
 	} else {
-		exception = &IllegalFunction
+		s.setException(request, response, exception)
 	}
 
-	if exception != &Success {
-		response.SetException(exception)
+	return response
+}
+
+// setException makes response an exception response to request, and records
+// the exception.
+func (s *Server) setException(request *Request, response Framer, exception *Exception) {
+	response.SetException(exception)
+	s.recordException(request.frame.GetFunction(), exception)
+	s.countException(exception)
+	s.logFrame(slog.LevelInfo, "exception returned", request, request.frame, slog.String("exception", exception.String()))
+}
+
+// relay answers a request for a downstream device with the response of
+// forward, once the request passed the rate limit, the access checks and the
+// middleware, like the requests served from memory.
+func (s *Server) relay(request *Request, forward func() Framer) Framer {
+	s.throttle()
+	exception := s.checkAccess(request)
+	data := []byte{}
+	var forwarded Framer
+	called := false
+	if exception == nil {
+		data, exception = s.middlewareChain(func(s *Server, request *Request) ([]byte, *Exception) {
+			called = true
+			forwarded = forward()
+			return []byte{}, &Success
+		})(s, request)
+	}
+	if called && exception == &Success {
+		return forwarded
 	}
 
+	// The request was refused, or answered by a middleware.
+	response := request.frame.Copy()
+	if exception == &Success {
+		response.SetData(data)
+	} else {
+		s.setException(request, response, exception)
+	}
 	return response
 }
 
-// All requests are handled synchronously to prevent modbus memory corruption.
-func (s *Server) handler() {
+// dispatch runs the function handler for the request.
+func (s *Server) dispatch(request *Request) ([]byte, *Exception) {
+	if s.takeStartupBusy() {
+		return []byte{}, &SlaveDeviceBusy
+	}
+
+	funcCode := request.frame.GetFunction()
+	if exception := s.injectedError(funcCode); exception != nil {
+		return []byte{}, exception
+	}
+
+	data, exception := s.middlewareChain(callHandler)(s, request)
+	s.beforeResponse(request.frame)
+	return data, exception
+}
+
+// callHandler runs the function handler of a request, at the end of the
+// middleware chain.
+func callHandler(s *Server, request *Request) ([]byte, *Exception) {
+	funcCode := request.frame.GetFunction()
+	function := s.functionHandler(request.frame.GetSlaveId(), funcCode)
+	if function == nil {
+		return []byte{}, &IllegalFunction
+	}
+	readOnly := s.isReadOnly(request.frame.GetSlaveId(), funcCode)
+
+	if d := time.Duration(s.requestDeadline.Load()); d > 0 {
+		return s.callWithDeadline(function, request, readOnly, d)
+	}
+	return s.callLocked(request.Context(), function, request, readOnly)
+}
+
+// callLocked runs a function handler with the memory lock held, for reading
+// only when the handler is read-only.
+func (s *Server) callLocked(ctx context.Context, function func(context.Context, *Server, Framer) ([]byte, *Exception), request *Request, readOnly bool) ([]byte, *Exception) {
+	if readOnly {
+		s.memoryLock.RLock()
+		defer s.memoryLock.RUnlock()
+	} else {
+		s.memoryLock.Lock()
+		defer s.memoryLock.Unlock()
+	}
+	return function(ctx, s, request.frame)
+}
+
+// isReadOnly reports whether the handler of a function code is read-only.
+// Handlers registered for a single unit never are.
+func (s *Server) isReadOnly(unit uint8, funcCode uint8) bool {
+	if functions, ok := s.unitFunction[unit]; ok && functions[funcCode] != nil {
+		return false
+	}
+	return s.readOnlyFunction[funcCode]
+}
+
+// ListenOnly reports whether the server is in listen only mode, see
+// Diagnostics.
+func (s *Server) ListenOnly() bool {
+	return s.listenOnly.Load()
+}
+
+// SetStartupBusy makes the next count requests, across all connections,
+// return a SlaveDeviceBusy exception before requests are served normally.
+// This models a device that is still booting.
+func (s *Server) SetStartupBusy(count int) {
+	s.changeState(func() { s.startupBusy.Store(int64(count)) })
+}
+
+func (s *Server) takeStartupBusy() bool {
+	for {
+		busy := s.startupBusy.Load()
+		if busy <= 0 {
+			return false
+		}
+		before := s.OperationalState()
+		if s.startupBusy.CompareAndSwap(busy, busy-1) {
+			if busy == 1 {
+				s.logTransition(before)
+			}
+			return true
+		}
+	}
+}
+
+// startHandler starts the handler goroutines of the workers, unless they are
+// running.
+func (s *Server) startHandler() bool {
+	s.lifecycleLock.Lock()
+	defer s.lifecycleLock.Unlock()
+
+	if !s.handlerRunning.CompareAndSwap(false, true) {
+		return false
+	}
+	quit, done := make(chan struct{}), make(chan struct{})
+	s.handlerQuit, s.handlerDone = quit, done
+
+	var workers sync.WaitGroup
+	for _, requests := range s.requestChans {
+		workers.Add(1)
+		go func(requests chan *Request) {
+			defer workers.Done()
+			s.handler(requests, quit)
+		}(requests)
+	}
+	go func() {
+		workers.Wait()
+		s.handlerRunning.Store(false)
+		close(done)
+	}()
+	return true
+}
+
+// stopHandler makes the handler goroutines exit once they are done with the
+// request being processed. The returned channel is closed once they have.
+func (s *Server) stopHandler() chan struct{} {
+	s.lifecycleLock.Lock()
+	defer s.lifecycleLock.Unlock()
+
+	if s.handlerQuit != nil {
+		close(s.handlerQuit)
+		s.handlerQuit = nil
+	}
+	return s.handlerDone
+}
+
+// handler handles the requests queued for a worker in turn, until quit is
+// closed.
+func (s *Server) handler(requests chan *Request, quit chan struct{}) {
 	for {
-		request := <-s.requestChan
-		if request.frame.GetSlaveId() != s.slaveId {
-			continue
+		select {
+		case request := <-requests:
+			s.serveRequest(request)
+			s.inFlight.Add(-1)
+			if request.done != nil {
+				close(request.done)
+			}
+		case <-quit:
+			return
+		}
+	}
+}
+
+// requestQueue returns the queue of the worker handling the requests of the
+// connection a request was read from.
+func (s *Server) requestQueue(request *Request) chan *Request {
+	if client, ok := request.conn.(*clientConn); ok {
+		return s.requestChans[client.worker]
+	}
+	return s.requestChans[0]
+}
+
+// serveRequest processes a request and writes the response, if any.
+func (s *Server) serveRequest(request *Request) {
+	if isFailed(request.conn) {
+		return
+	}
+	s.logFrame(slog.LevelDebug, "frame received", request, request.frame)
+	s.runRequestHook(request.frame)
+	if request.frame.GetSlaveId() != s.SlaveID() {
+		if unit := s.unit(request.frame.GetSlaveId()); unit != nil {
+			if exception := s.checkAccess(request); exception != nil {
+				response := request.frame.Copy()
+				s.setException(request, response, exception)
+				s.sendResponse(request, response, true)
+				return
+			}
+			unit.serveRequest(request)
+			return
+		}
+	}
+	if b := s.currentBridge(); b != nil {
+		if frame, ok := request.frame.(*TCPFrame); ok {
+			response := s.relay(request, func() Framer { return s.forward(b, frame) })
+			sent := response != nil && s.writeResponse(request.conn, response.Bytes())
+			s.notifyResponse(request, response, sent)
+			s.requestProcessed(frame.Function)
+			return
+		}
+	}
+	if request.frame.GetSlaveId() != s.SlaveID() {
+		if s.isBroadcastWrite(request.frame) {
+			s.countDiagnostic(ReturnSlaveMessageCount)
+			s.serveBroadcast(request)
+			return
+		}
+		if forwarder := s.currentForwarder(); forwarder != nil && request.frame.GetSlaveId() != BroadcastUnitID {
+			response := s.relay(request, func() Framer { return s.forwardRequest(forwarder, request.frame) })
+			sent := s.writeResponse(request.conn, s.responseBytes(response))
+			s.notifyResponse(request, response, sent)
+			s.requestProcessed(request.frame.GetFunction())
+			return
 		}
-		response := s.handle(request)
-		request.conn.Write(response.Bytes())
+		if response := s.broadcastReadException(request.frame); response != nil {
+			sent := s.writeResponse(request.conn, s.responseBytes(response))
+			s.notifyResponse(request, response, sent)
+		}
+		return
+	}
+	s.countDiagnostic(ReturnSlaveMessageCount)
+	response, send := s.process(request)
+	if jitter := s.responseJitter(); send && jitter > 0 {
+		// The request stays in flight, and RoundTrip waits, until the
+		// response was written.
+		done := request.done
+		request.done = nil
+		s.inFlight.Add(1)
+		go func() {
+			time.Sleep(jitter)
+			s.sendResponse(request, response, send)
+			s.inFlight.Add(-1)
+			if done != nil {
+				close(done)
+			}
+		}()
+		return
 	}
+	s.sendResponse(request, response, send)
 }
 
-// Close stops listening to TCP/IP ports and closes serial ports.
+// sendResponse writes the response to a request addressed to the server, if
+// it is to be sent, and runs the callbacks of the request.
+func (s *Server) sendResponse(request *Request, response Framer, send bool) {
+	sent := false
+	if send {
+		s.delayResponse(request.frame)
+		s.setWriteDeadline(request)
+		sent = s.writeResponse(request.conn, s.responseBytes(response))
+		s.latency.record(time.Since(request.receivedAt()))
+	} else {
+		s.countDiagnostic(ReturnSlaveNoResponseCount)
+	}
+	s.notifyResponse(request, response, sent)
+	s.flushWriteEvents(request.frame)
+	s.requestProcessed(request.frame.GetFunction())
+}
+
+// process handles a request addressed to the server and reports whether the
+// response is to be sent.
+func (s *Server) process(request *Request) (Framer, bool) {
+	// Requests are processed in listen only mode, but not answered.
+	listenOnly := s.listenOnly.Load()
+	response := s.handle(request)
+	send := response != nil && !listenOnly && !s.listenOnly.Load()
+	return response, send && !s.dropResponse(request.frame.GetFunction())
+}
+
+func (s *Server) runRequestHook(frame Framer) {
+	s.hooksLock.RLock()
+	hook := s.requestHook
+	s.hooksLock.RUnlock()
+	if hook != nil {
+		hook(frame)
+	}
+}
+
+// Close stops listening to TCP/IP ports, UDP sockets and HTTP endpoints,
+// closes serial ports and cancels the pending coil pulses, those of the units
+// included, and the simulation. The handler goroutines of the units are
+// stopped, and started again by Restart. The memory maps are saved a last
+// time when persisting, see AutoPersist.
 func (s *Server) Close() {
+	s.stopPulses()
+	s.stopUnits()
+
+	s.listenersLock.Lock()
 	for _, listen := range s.listeners {
 		listen.Close()
 	}
+	for _, conn := range s.packetConns {
+		conn.Close()
+	}
+	for _, endpoint := range s.httpEndpoints {
+		endpoint.close()
+	}
+	s.listenersLock.Unlock()
 
 	close(s.portsCloseChan)
 	s.portsWG.Wait()
@@ -117,4 +712,12 @@ func (s *Server) Close() {
 	for _, port := range s.ports {
 		port.Close()
 	}
+
+	if b := s.currentBridge(); b != nil {
+		b.downstream.Close()
+	}
+
+	s.StopSimulation()
+	s.stopPersist()
+	s.closeMmapBacking()
 }
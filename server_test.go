@@ -1,6 +1,10 @@
 package mbserver
 
 import (
+	"context"
+	"errors"
+	"net"
+	"syscall"
 	"testing"
 	"time"
 
@@ -137,3 +141,447 @@ func TestModbus(t *testing.T) {
 		t.Errorf("expected %v, got %v", expect, got)
 	}
 }
+
+func TestListenBacklog(t *testing.T) {
+	s := NewServer()
+	s.SetListenBacklog(64)
+	addr := getFreePort()
+	err := s.ListenTCP(addr)
+	if err != nil {
+		t.Fatalf("failed to listen, got %v\n", err)
+	}
+	defer s.Close()
+
+	handler := modbus.NewTCPClientHandler(addr)
+	handler.SlaveId = 1
+	err = handler.Connect()
+	if err != nil {
+		t.Fatalf("failed to connect, got %v\n", err)
+	}
+	defer handler.Close()
+	client := modbus.NewClient(handler)
+
+	s.HoldingRegisters[10] = 42
+	results, err := client.ReadHoldingRegisters(10, 1)
+	if err != nil {
+		t.Fatalf("expected nil, got %v\n", err)
+	}
+	expect := []byte{0, 42}
+	if !isEqual(expect, results) {
+		t.Errorf("expected %v, got %v", expect, results)
+	}
+}
+
+func TestListenBacklogDualStack(t *testing.T) {
+	hosts := []string{"127.0.0.1"}
+	if probe, err := net.Listen("tcp", "[::1]:0"); err == nil {
+		probe.Close()
+		hosts = append(hosts, "::1")
+	}
+
+	s := NewServer()
+	s.SetListenBacklog(64)
+	_, port, _ := net.SplitHostPort(getFreePort())
+	if err := s.ListenTCP(":" + port); err != nil {
+		t.Fatalf("failed to listen, got %v\n", err)
+	}
+	defer s.Close()
+
+	for _, host := range hosts {
+		conn, err := net.Dial("tcp", net.JoinHostPort(host, port))
+		if err != nil {
+			t.Fatalf("failed to connect to %v, got %v", host, err)
+		}
+		conn.Close()
+	}
+}
+
+func TestRegisterFunctionHandlerForUnit(t *testing.T) {
+	s := NewServer()
+	s.HoldingRegisters[0] = 7
+	// Unit 2 is read-only.
+	s.RegisterFunctionHandlerForUnit(2, WriteHoldingRegisterFC,
+		func(s *Server, frame Framer) ([]byte, *Exception) {
+			return []byte{}, &IllegalFunction
+		})
+
+	var frame TCPFrame
+	frame.Device = 2
+	frame.Function = WriteHoldingRegisterFC
+	SetDataWithRegisterAndNumber(&frame, 0, 9)
+
+	var req Request
+	req.frame = &frame
+	response := s.handle(&req)
+	exception := GetException(response)
+	if exception != IllegalFunction {
+		t.Errorf("expected IllegalFunction, got %v", exception.String())
+	}
+	if s.HoldingRegisters[0] != 7 {
+		t.Errorf("expected 7, got %v", s.HoldingRegisters[0])
+	}
+
+	// Other units fall back to the global handler.
+	frame.Device = 1
+	frame.Function = WriteHoldingRegisterFC
+	SetDataWithRegisterAndNumber(&frame, 0, 9)
+	response = s.handle(&req)
+	exception = GetException(response)
+	if exception != Success {
+		t.Errorf("expected Success, got %v", exception.String())
+	}
+	if s.HoldingRegisters[0] != 9 {
+		t.Errorf("expected 9, got %v", s.HoldingRegisters[0])
+	}
+}
+
+func TestListenTCPDuplicateAddress(t *testing.T) {
+	s := NewServer()
+	addr := getFreePort()
+	err := s.ListenTCP(addr)
+	if err != nil {
+		t.Fatalf("failed to listen, got %v\n", err)
+	}
+	defer s.Close()
+
+	err = s.ListenTCP(addr)
+	if err == nil {
+		t.Fatalf("expected error listening twice on %v, got nil", addr)
+	}
+	if len(s.listeners) != 1 {
+		t.Errorf("expected 1 listener, got %v", len(s.listeners))
+	}
+
+	// The first listener still serves requests.
+	handler := modbus.NewTCPClientHandler(addr)
+	handler.SlaveId = 1
+	err = handler.Connect()
+	if err != nil {
+		t.Fatalf("failed to connect, got %v\n", err)
+	}
+	defer handler.Close()
+	client := modbus.NewClient(handler)
+
+	_, err = client.ReadCoils(0, 8)
+	if err != nil {
+		t.Errorf("expected nil, got %v\n", err)
+	}
+}
+
+func TestReservedFunctionCode(t *testing.T) {
+	s := NewServer()
+	called := false
+	s.RegisterFunctionHandler(0x90,
+		func(s *Server, frame Framer) ([]byte, *Exception) {
+			called = true
+			return []byte{}, &Success
+		})
+
+	var frame TCPFrame
+	frame.Device = 1
+	frame.Function = 0x90
+
+	var req Request
+	req.frame = &frame
+	response := s.handle(&req)
+	exception := GetException(response)
+	if exception != IllegalFunction {
+		t.Errorf("expected IllegalFunction, got %v", exception.String())
+	}
+	if called {
+		t.Errorf("expected the handler for a reserved function code not to be called")
+	}
+}
+
+func TestStartupBusy(t *testing.T) {
+	s := NewServer()
+	s.SetStartupBusy(2)
+
+	var frame TCPFrame
+	frame.Device = 1
+	frame.Function = ReadCoilsFC
+	SetDataWithRegisterAndNumber(&frame, 0, 1)
+
+	var req Request
+	req.frame = &frame
+	for i, expect := range []Exception{SlaveDeviceBusy, SlaveDeviceBusy, Success, Success} {
+		response := s.handle(&req)
+		exception := GetException(response)
+		if exception != expect {
+			t.Errorf("request %v: expected %v, got %v", i, expect.String(), exception.String())
+		}
+	}
+}
+
+func TestStopListener(t *testing.T) {
+	s := NewServer()
+	addr1 := getFreePort()
+	addr2 := getFreePort()
+	for _, addr := range []string{addr1, addr2} {
+		err := s.ListenTCP(addr)
+		if err != nil {
+			t.Fatalf("failed to listen, got %v\n", err)
+		}
+	}
+	defer s.Close()
+
+	err := s.StopListener(addr1)
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	err = s.StopListener(addr1)
+	if err == nil {
+		t.Errorf("expected error stopping %v twice, got nil", addr1)
+	}
+
+	handler := modbus.NewTCPClientHandler(addr1)
+	err = handler.Connect()
+	if err == nil {
+		handler.Close()
+		t.Errorf("expected %v to refuse connections", addr1)
+	}
+
+	handler = modbus.NewTCPClientHandler(addr2)
+	handler.SlaveId = 1
+	err = handler.Connect()
+	if err != nil {
+		t.Fatalf("failed to connect, got %v\n", err)
+	}
+	defer handler.Close()
+	client := modbus.NewClient(handler)
+	_, err = client.ReadCoils(0, 8)
+	if err != nil {
+		t.Errorf("expected nil, got %v\n", err)
+	}
+}
+
+func TestListenTCPContext(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	addr := getFreePort()
+	if err := s.ListenTCPContext(ctx, addr); err != nil {
+		t.Fatalf("failed to listen, got %v\n", err)
+	}
+
+	handler := modbus.NewTCPClientHandler(addr)
+	handler.SlaveId = 1
+	if err := handler.Connect(); err != nil {
+		t.Fatalf("failed to connect, got %v\n", err)
+	}
+	defer handler.Close()
+	client := modbus.NewClient(handler)
+
+	cancel()
+	deadline := time.Now().Add(time.Second)
+	for len(s.Addrs()) != 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if len(s.Addrs()) != 0 {
+		t.Fatalf("expected the listener to be closed once the context is done")
+	}
+	if _, err := net.Dial("tcp", addr); err == nil {
+		t.Errorf("expected %v to refuse connections", addr)
+	}
+	if _, err := client.ReadCoils(0, 8); err != nil {
+		t.Errorf("expected the established connection to be served, got %v", err)
+	}
+}
+
+func TestSetSlaveID(t *testing.T) {
+	s := NewServer()
+	addr := getFreePort()
+	err := s.ListenTCP(addr)
+	if err != nil {
+		t.Fatalf("failed to listen, got %v\n", err)
+	}
+	defer s.Close()
+
+	handler := modbus.NewTCPClientHandler(addr)
+	handler.SlaveId = 9
+	handler.Timeout = 50 * time.Millisecond
+	err = handler.Connect()
+	if err != nil {
+		t.Fatalf("failed to connect, got %v\n", err)
+	}
+	defer handler.Close()
+	client := modbus.NewClient(handler)
+
+	_, err = client.ReadCoils(0, 1)
+	if err == nil {
+		t.Fatalf("expected no response for slave id 9")
+	}
+
+	s.SetSlaveID(9)
+	if s.SlaveID() != 9 {
+		t.Errorf("expected slave id 9, got %v", s.SlaveID())
+	}
+	_, err = client.ReadCoils(0, 1)
+	if err != nil {
+		t.Errorf("expected nil, got %v\n", err)
+	}
+}
+
+func TestRegisteredFunctions(t *testing.T) {
+	s := NewServer()
+	s.RegisterFunctionHandler(100,
+		func(s *Server, frame Framer) ([]byte, *Exception) {
+			return []byte{}, &Success
+		})
+	s.UnregisterFunctionHandler(WriteHoldingRegisterFC)
+
+	expect := []uint8{1, 2, 3, 4, 5, 8, 15, 16, 22, 23, 24, 43, 100}
+	got := s.RegisteredFunctions()
+	if !isEqual(expect, got) {
+		t.Errorf("expected %v, got %v", expect, got)
+	}
+
+	var frame TCPFrame
+	frame.Device = 1
+	frame.Function = WriteHoldingRegisterFC
+	SetDataWithRegisterAndNumber(&frame, 0, 1)
+	response := s.handle(&Request{frame: &frame})
+	exception := GetException(response)
+	if exception != IllegalFunction {
+		t.Errorf("expected IllegalFunction, got %v", exception.String())
+	}
+}
+
+func TestListenTCPAny(t *testing.T) {
+	s := NewServer()
+	addr, err := s.ListenTCPAny()
+	if err != nil {
+		t.Fatalf("failed to listen, got %v\n", err)
+	}
+	defer s.Close()
+
+	if !isEqual([]string{addr.String()}, []string{s.Addrs()[0].String()}) {
+		t.Errorf("expected Addrs to report %v, got %v", addr, s.Addrs())
+	}
+
+	// No wait is needed before connecting.
+	handler := modbus.NewTCPClientHandler(addr.String())
+	handler.SlaveId = 1
+	err = handler.Connect()
+	if err != nil {
+		t.Fatalf("failed to connect, got %v\n", err)
+	}
+	defer handler.Close()
+	_, err = modbus.NewClient(handler).ReadCoils(0, 1)
+	if err != nil {
+		t.Errorf("expected nil, got %v\n", err)
+	}
+}
+
+func TestSetLinger(t *testing.T) {
+	s := NewServer()
+	s.SetLinger(0)
+	addr, err := s.ListenTCPAny()
+	if err != nil {
+		t.Fatalf("failed to listen, got %v\n", err)
+	}
+	defer s.Close()
+
+	conn, err := net.Dial("tcp", addr.String())
+	if err != nil {
+		t.Fatalf("failed to connect, got %v\n", err)
+	}
+	defer conn.Close()
+
+	// A malformed packet, with an invalid length, makes the server close the
+	// connection, which resets it instead of a graceful FIN.
+	conn.Write([]byte{0, 1, 0, 0, 0, 0})
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = conn.Read(make([]byte, 1))
+	if !errors.Is(err, syscall.ECONNRESET) {
+		t.Errorf("expected ECONNRESET, got %v", err)
+	}
+}
+
+func TestReadOnlyFunctionHandler(t *testing.T) {
+	s := NewServer()
+
+	// A handler for which the memory lock can be read locked is not holding it
+	// for writing.
+	var shared bool
+	probe := func(s *Server, frame Framer) ([]byte, *Exception) {
+		shared = s.memoryLock.TryRLock()
+		if shared {
+			s.memoryLock.RUnlock()
+		}
+		return []byte{}, &Success
+	}
+	call := func(funcCode uint8) bool {
+		frame := &TCPFrame{Device: 1, Function: funcCode}
+		_, exception := s.dispatch(&Request{frame: frame})
+		if exception != &Success {
+			t.Fatalf("expected Success, got %v", exception.String())
+		}
+		return shared
+	}
+
+	s.RegisterReadOnlyFunctionHandler(100, probe)
+	if !call(100) {
+		t.Errorf("expected a read-only handler to hold the read lock")
+	}
+	s.RegisterFunctionHandler(100, probe)
+	if call(100) {
+		t.Errorf("expected a handler to hold the write lock")
+	}
+	s.RegisterReadOnlyFunctionHandler(101, probe)
+	s.RegisterFunctionHandlerForUnit(1, 101, probe)
+	if call(101) {
+		t.Errorf("expected a unit handler to hold the write lock")
+	}
+
+	for funcCode, readOnly := range map[uint8]bool{
+		ReadCoilsFC:             true,
+		ReadDiscreteInputsFC:    true,
+		ReadHoldingRegistersFC:  true,
+		ReadInputRegistersFC:    true,
+		WriteSingleCoilFC:       false,
+		WriteHoldingRegisterFC:  false,
+		WriteMultipleCoilsFC:    false,
+		WriteHoldingRegistersFC: false,
+	} {
+		if s.readOnlyFunction[funcCode] != readOnly {
+			t.Errorf("function %v: expected read-only %v", funcCode, readOnly)
+		}
+	}
+}
+
+func TestSetListenConfig(t *testing.T) {
+	for _, backlog := range []int{0, 16} {
+		s := NewServer()
+		s.SetListenBacklog(backlog)
+		var networks []string
+		s.SetListenConfig(&net.ListenConfig{Control: func(network, address string, c syscall.RawConn) error {
+			networks = append(networks, network)
+			return c.Control(func(fd uintptr) {})
+		}})
+		addr, err := s.ListenTCPAny()
+		if err != nil {
+			t.Fatalf("backlog %v: failed to listen, got %v\n", backlog, err)
+		}
+		if !isEqual([]string{"tcp4"}, networks) {
+			t.Errorf("backlog %v: expected Control to be called for tcp4, got %v", backlog, networks)
+		}
+		conn, err := net.Dial("tcp", addr.String())
+		if err != nil {
+			t.Errorf("backlog %v: failed to connect, got %v\n", backlog, err)
+		} else {
+			conn.Close()
+		}
+		s.Close()
+	}
+
+	// A Control error fails the listener.
+	s := NewServer(WithLogger(discardLogger{}))
+	defer s.Close()
+	s.SetListenConfig(&net.ListenConfig{Control: func(network, address string, c syscall.RawConn) error {
+		return errors.New("refused")
+	}})
+	if _, err := s.ListenTCPAny(); err == nil {
+		t.Errorf("expected the Control error")
+	}
+}
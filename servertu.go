@@ -1,31 +1,41 @@
 package mbserver
 
 import (
+	"bufio"
+	"bytes"
 	"io"
 	"log"
+	"time"
 
 	"github.com/goburrow/serial"
 )
 
 // ListenRTU starts the Modbus server listening to a serial device.
 // For example:  err := s.ListenRTU(&serial.Config{Address: "/dev/ttyUSB0"})
-func (s *Server) ListenRTU(serialConfig *serial.Config) (err error) {
+// The options restrict the functions masters on the device may use, see
+// ListenTCP.
+func (s *Server) ListenRTU(serialConfig *serial.Config, opts ...ListenOption) (err error) {
 	port, err := serial.Open(serialConfig)
 	if err != nil {
 		log.Fatalf("failed to open %s: %v\n", serialConfig.Address, err)
 	}
 	s.ports = append(s.ports, port)
+	policy := newListenPolicy(opts)
 
 	s.portsWG.Add(1)
 	go func() {
 		defer s.portsWG.Done()
-		s.acceptSerialRequests(port)
+		s.acceptSerialRequests(port, policy)
 	}()
+	s.rememberListen(port, func() error { return s.ListenRTU(serialConfig, opts...) })
 
 	return err
 }
 
-func (s *Server) acceptSerialRequests(port serial.Port) {
+func (s *Server) acceptSerialRequests(port io.ReadWriteCloser, policy *listenPolicy) {
+	client := s.trackConn(port)
+	defer s.untrackConn(client)
+
 SkipFrameError:
 	for {
 		select {
@@ -36,10 +46,10 @@ SkipFrameError:
 
 		buffer := make([]byte, 512)
 
-		bytesRead, err := port.Read(buffer)
+		bytesRead, err := client.Read(buffer)
 		if err != nil {
 			if err != io.EOF {
-				log.Printf("serial read error %v\n", err)
+				s.logger.Printf("serial read error %v\n", err)
 			}
 			return
 		}
@@ -48,20 +58,97 @@ SkipFrameError:
 
 			// Set the length of the packet to the number of read bytes.
 			packet := buffer[:bytesRead]
+			client.capture(packet)
 
 			frame, err := NewRTUFrame(packet)
 			if err != nil {
-				log.Printf("bad serial frame error %v\n", err)
+				s.logger.Printf("bad serial frame error %v\n", err)
+				s.notifySerialFrameError(packet, serialFrameErrorReason(packet))
 				//The next line prevents RTU server from exiting when it receives a bad frame. Simply discard the erroneous
 				//frame and wait for next frame by jumping back to the beginning of the 'for' loop.
-				log.Printf("Keep the RTU server running!!\n")
+				s.logger.Printf("Keep the RTU server running!!\n")
 				continue SkipFrameError
 				//return
 			}
 
-			request := &Request{port, frame}
+			request := &Request{conn: client, frame: frame, received: time.Now(), policy: policy}
+
+			if !s.submit(request) {
+				return
+			}
+		}
+	}
+}
+
+// ListenASCII starts the Modbus server listening to a serial device, like
+// ListenRTU, with Modbus ASCII framing: each frame starts with ':', holds the
+// address, function, data and LRC in hexadecimal, and ends with CRLF.
+func (s *Server) ListenASCII(serialConfig *serial.Config, opts ...ListenOption) (err error) {
+	port, err := serial.Open(serialConfig)
+	if err != nil {
+		s.logger.Printf("failed to open %s: %v\n", serialConfig.Address, err)
+		return err
+	}
+	s.ports = append(s.ports, port)
+	policy := newListenPolicy(opts)
+
+	s.portsWG.Add(1)
+	go func() {
+		defer s.portsWG.Done()
+		s.acceptASCIIRequests(port, policy)
+	}()
+	s.rememberListen(port, func() error { return s.ListenASCII(serialConfig, opts...) })
+
+	return err
+}
+
+// maxASCIILength is the longest ASCII frame: the start character, the
+// address, a PDU of 253 bytes and the LRC in hexadecimal, and CRLF.
+const maxASCIILength = 1 + 2*(1+253+1) + 2
+
+func (s *Server) acceptASCIIRequests(port io.ReadWriteCloser, policy *listenPolicy) {
+	client := s.trackConn(port)
+	defer s.untrackConn(client)
+
+	reader := bufio.NewReaderSize(client, maxASCIILength)
+	for {
+		select {
+		case <-s.portsCloseChan:
+			return
+		default:
+		}
+
+		line, err := reader.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			s.logger.Printf("bad serial frame error: ASCII frame longer than %d bytes\n", maxASCIILength)
+			continue
+		}
+		if err != nil {
+			if err != io.EOF {
+				s.logger.Printf("serial read error %v\n", err)
+			}
+			return
+		}
+
+		// Characters received before the start of the frame are noise.
+		packet := line
+		if start := bytes.IndexByte(line, ':'); start > 0 {
+			packet = line[start:]
+		}
+		packet = append([]byte(nil), packet...)
+		client.capture(packet)
+
+		frame, err := NewASCIIFrame(packet)
+		if err != nil {
+			s.logger.Printf("bad serial frame error %v\n", err)
+			s.notifySerialFrameError(packet, asciiFrameErrorReason(packet))
+			continue
+		}
 
-			s.requestChan <- request
+		request := &Request{conn: client, frame: frame, received: time.Now(), policy: policy}
+
+		if !s.submit(request) {
+			return
 		}
 	}
 }
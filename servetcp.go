@@ -1,60 +1,279 @@
 package mbserver
 
 import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
 	"io"
-	"log"
 	"net"
 	"strings"
+	"time"
 )
 
-func (s *Server) accept(listen net.Listener) error {
+func (s *Server) accept(listen net.Listener, policy *listenPolicy) error {
 	for {
 		conn, err := listen.Accept()
 		if err != nil {
 			if strings.Contains(err.Error(), "use of closed network connection") {
 				return nil
 			}
-			log.Printf("Unable to accept connections: %#v\n", err)
+			s.logger.Printf("Unable to accept connections: %#v\n", err)
 			return err
 		}
 
-		go func(conn net.Conn) {
-			defer conn.Close()
+		if !s.acceptConn(conn.RemoteAddr()) || !s.reserveConn() {
+			s.rejectedConns.Add(1)
+			conn.Close()
+			continue
+		}
+		go func() {
+			defer s.activeConns.Add(-1)
+			s.serveTCP(conn, policy)
+		}()
+	}
+}
 
-			for {
-				packet := make([]byte, 512)
-				bytesRead, err := conn.Read(packet)
-				if err != nil {
-					if err != io.EOF {
-						log.Printf("read error %v\n", err)
-					}
-					return
-				}
-				// Set the length of the packet to the number of read bytes.
-				packet = packet[:bytesRead]
+// serveTCP reads the requests of a TCP connection until it is closed.
+func (s *Server) serveTCP(conn io.ReadWriteCloser, policy *listenPolicy) {
+	ctx := context.Background()
+	if netConn, ok := conn.(net.Conn); ok {
+		s.applyLinger(netConn)
+	}
 
-				frame, err := NewTCPFrame(packet)
-				if err != nil {
-					log.Printf("bad packet error %v\n", err)
-					return
-				}
+	var tlsRole *string
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		role, err := s.authorizeTLS(tlsConn)
+		if err != nil {
+			s.logger.Printf("rejected TLS client %v: %v\n", tlsConn.RemoteAddr(), err)
+			conn.Close()
+			return
+		}
+		tlsRole = &role
+	}
 
-				request := &Request{conn, frame}
+	client := s.trackConn(conn)
+	if netConn, ok := conn.(net.Conn); ok {
+		ctx = s.newConnContext(netConn)
+	}
+	defer s.untrackConn(client)
+	defer s.notifyDisconnect(client)
+	defer conn.Close()
+	s.notifyConnect(client)
 
-				s.requestChan <- request
+	for {
+		packet, err := readTCPPacket(s.requestReader(client, conn))
+		if err != nil {
+			if isTimeout(err) {
+				s.logger.Printf("closing connection %v: %v\n", client.info.RemoteAddr, err)
+			} else if err != io.EOF {
+				s.logger.Printf("read error %v\n", err)
 			}
-		}(conn)
+			return
+		}
+		client.capture(packet)
+
+		frame, err := NewTCPFrame(packet)
+		if err != nil {
+			s.logger.Printf("bad packet error %v\n", err)
+			return
+		}
+
+		request := &Request{conn: client, frame: frame, ctx: ctx, received: time.Now(), policy: policy, tlsRole: tlsRole}
+
+		if !s.submit(request) {
+			return
+		}
 	}
 }
 
-// ListenTCP starts the Modbus server listening on "address:port".
-func (s *Server) ListenTCP(addressPort string) (err error) {
-	listen, err := net.Listen("tcp", addressPort)
+// maxTCPLength is the largest MBAP length field: the unit ID and a PDU of at
+// most 253 bytes.
+const maxTCPLength = 254
+
+// readTCPPacket reads one Modbus TCP packet, delimited by the length field of
+// its MBAP header, so that pipelined requests sent in a single segment, or
+// requests split across segments, are read one at a time.
+func readTCPPacket(r io.Reader) ([]byte, error) {
+	packet := make([]byte, 6, 6+maxTCPLength)
+	if _, err := io.ReadFull(r, packet); err != nil {
+		return nil, err
+	}
+	length := int(binary.BigEndian.Uint16(packet[4:6]))
+	if length < 2 || length > maxTCPLength {
+		return nil, fmt.Errorf("TCP Frame error: invalid length %d", length)
+	}
+	packet = packet[:6+length]
+	if _, err := io.ReadFull(r, packet[6:]); err != nil {
+		return nil, err
+	}
+	return packet, nil
+}
+
+// ListenTCP starts the Modbus server listening on "address:port". The options
+// restrict the functions masters connected to this listener may use.
+func (s *Server) ListenTCP(addressPort string, opts ...ListenOption) (err error) {
+	return s.ListenTCPContext(context.Background(), addressPort, opts...)
+}
+
+// ListenTCPContext is ListenTCP with a listener that is closed once ctx is
+// done, as with StopListener, tying it to the lifecycle of the application.
+// Established connections keep being served, use Shutdown to stop the whole
+// server.
+func (s *Server) ListenTCPContext(ctx context.Context, addressPort string, opts ...ListenOption) (err error) {
+	listen, err := s.listen(addressPort)
 	if err != nil {
-		log.Printf("Failed to Listen: %v\n", err)
+		s.logger.Printf("Failed to Listen: %v\n", err)
 		return err
 	}
-	s.listeners = append(s.listeners, listen)
-	go s.accept(listen)
+	s.serveListener(listen, newListenPolicy(opts))
+	if ctx.Err() == nil {
+		s.rememberListen(listen, func() error {
+			if ctx.Err() != nil {
+				// ctx was done while the server was shut down.
+				return nil
+			}
+			return s.ListenTCPContext(ctx, addressPort, opts...)
+		})
+	}
+	s.stopListenerOnDone(ctx, listen)
 	return err
 }
+
+// stopListenerOnDone closes the listener once ctx is done, unless the server
+// is closed first.
+func (s *Server) stopListenerOnDone(ctx context.Context, listen net.Listener) {
+	if ctx.Done() == nil {
+		return
+	}
+	closed := s.portsCloseChan
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.StopListener(listen.Addr().String())
+		case <-closed:
+		}
+	}()
+}
+
+// ListenTCPAny starts the Modbus server listening on an ephemeral port of the
+// loopback interface and returns the address it is bound to. The address is
+// known before the server accepts connections, which avoids racing a test
+// client against the listener.
+func (s *Server) ListenTCPAny(opts ...ListenOption) (net.Addr, error) {
+	listen, err := s.listen("127.0.0.1:0")
+	if err != nil {
+		s.logger.Printf("Failed to Listen: %v\n", err)
+		return nil, err
+	}
+	s.serveListener(listen, newListenPolicy(opts))
+	s.rememberListen(listen, func() error { return s.ListenTCP(listen.Addr().String(), opts...) })
+	return listen.Addr(), nil
+}
+
+// Addrs returns the addresses of the TCP and TLS listeners.
+func (s *Server) Addrs() []net.Addr {
+	s.listenersLock.Lock()
+	defer s.listenersLock.Unlock()
+
+	addrs := make([]net.Addr, len(s.listeners))
+	for i, listen := range s.listeners {
+		addrs[i] = listen.Addr()
+	}
+	return addrs
+}
+
+// serveListener accepts connections until the listener is closed.
+func (s *Server) serveListener(listen net.Listener, policy *listenPolicy) {
+	s.listenersLock.Lock()
+	s.listeners = append(s.listeners, listen)
+	s.listenersLock.Unlock()
+	go s.accept(listen, policy)
+}
+
+// StopListener closes the listener whose address (as reported by its Addr
+// method, e.g. "127.0.0.1:1502") matches addr. Other listeners, serial ports
+// and established connections keep being served. The listener is not opened
+// again by Restart.
+func (s *Server) StopListener(addr string) error {
+	s.listenersLock.Lock()
+	var stopped net.Listener
+	for i, listen := range s.listeners {
+		if listen.Addr().String() == addr {
+			s.listeners = append(s.listeners[:i], s.listeners[i+1:]...)
+			stopped = listen
+			break
+		}
+	}
+	s.listenersLock.Unlock()
+
+	if stopped == nil {
+		return fmt.Errorf("no listener on %v", addr)
+	}
+	s.forgetListen(stopped)
+	return stopped.Close()
+}
+
+// SetListenBacklog sets the length of the pending connection queue used by
+// subsequent calls to ListenTCP. A value of 0 (the default) keeps the
+// operating system default.
+//
+// The backlog is only honoured on Unix-like systems, where the listening
+// socket is created directly so that the value can be passed to listen(2).
+// On Linux the kernel silently caps it at net.core.somaxconn. An empty host
+// such as ":502" listens on both IPv4 and IPv6, like net.Listen. On other
+// platforms the value is ignored.
+func (s *Server) SetListenBacklog(n int) {
+	s.listenBacklog = n
+}
+
+// SetLinger sets the SO_LINGER option of TCP connections accepted from then
+// on, see net.TCPConn.SetLinger. With sec set to 0, closing a connection (for
+// instance when the server is closed) discards unsent data and resets it, so
+// that it does not linger in TIME_WAIT. A negative value (the default) keeps
+// the operating system behavior. Serial ports are not affected.
+func (s *Server) SetLinger(sec int) {
+	s.linger.Store(int32(sec))
+}
+
+func (s *Server) applyLinger(conn net.Conn) {
+	sec := int(s.linger.Load())
+	if sec < 0 {
+		return
+	}
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		conn = tlsConn.NetConn()
+	}
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		tcpConn.SetLinger(sec)
+	}
+}
+
+// SetListenConfig sets the configuration of the listening sockets created
+// from then on by ListenTCP, ListenTCPAny and ListenTLS, for instance to set
+// socket options such as SO_REUSEPORT in its Control function, or the
+// keep-alive of accepted connections. Listeners already created are not
+// affected. A nil config (the default) uses the net package defaults.
+//
+// With a listen backlog (see SetListenBacklog) the socket is created by hand:
+// Control is still called before the socket is bound, but the other fields
+// of the config are ignored.
+func (s *Server) SetListenConfig(config *net.ListenConfig) {
+	s.listenersLock.Lock()
+	s.listenConfig = config
+	s.listenersLock.Unlock()
+}
+
+func (s *Server) listen(addressPort string) (net.Listener, error) {
+	s.listenersLock.Lock()
+	config := s.listenConfig
+	s.listenersLock.Unlock()
+
+	if s.listenBacklog > 0 {
+		return listenTCPWithBacklog(addressPort, s.listenBacklog, config)
+	}
+	if config != nil {
+		return config.Listen(context.Background(), "tcp", addressPort)
+	}
+	return net.Listen("tcp", addressPort)
+}
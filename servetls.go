@@ -0,0 +1,142 @@
+package mbserver
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+	"time"
+)
+
+// DefaultTLSHandshakeTimeout is how long a TLS client has to complete the
+// handshake.
+const DefaultTLSHandshakeTimeout = 10 * time.Second
+
+// TLSRoleOID is the X.509 extension holding the role of a client in the
+// Modbus/TCP Security specification, an ASN.1 UTF8String.
+var TLSRoleOID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 50316, 802, 1}
+
+// ListenTLS starts the Modbus server listening for Modbus/TCP Security (TLS)
+// connections on "address:port". Set config.ClientCAs and
+// config.ClientAuth = tls.RequireAndVerifyClientCert to verify client
+// certificates. The options restrict the functions masters connected to this
+// listener may use, see ListenTCP.
+func (s *Server) ListenTLS(addressPort string, config *tls.Config, opts ...ListenOption) (err error) {
+	return s.ListenTLSContext(context.Background(), addressPort, config, opts...)
+}
+
+// ListenTLSContext is ListenTLS with a listener that is closed once ctx is
+// done, see ListenTCPContext.
+func (s *Server) ListenTLSContext(ctx context.Context, addressPort string, config *tls.Config, opts ...ListenOption) (err error) {
+	listen, err := s.listen(addressPort)
+	if err != nil {
+		s.logger.Printf("Failed to Listen: %v\n", err)
+		return err
+	}
+	tlsListen := tls.NewListener(listen, config)
+	s.serveListener(tlsListen, newListenPolicy(opts))
+	if ctx.Err() == nil {
+		s.rememberListen(tlsListen, func() error {
+			if ctx.Err() != nil {
+				// ctx was done while the server was shut down.
+				return nil
+			}
+			return s.ListenTLSContext(ctx, addressPort, config, opts...)
+		})
+	}
+	s.stopListenerOnDone(ctx, tlsListen)
+	return err
+}
+
+// SetTLSHandshakeTimeout sets how long a TLS client has to complete the
+// handshake before its connection is closed, so that stalled clients do not
+// hold a slot of SetMaxConns. The default is DefaultTLSHandshakeTimeout.
+func (s *Server) SetTLSHandshakeTimeout(timeout time.Duration) {
+	s.handshakeTimeout.Store(int64(timeout))
+}
+
+// SetTLSClientAuthorizer sets a function deciding whether a TLS client may
+// use the server, typically by matching the subject of its certificate. It is
+// called after the handshake with the leaf client certificate; a non-nil error
+// closes the connection before any Modbus frame is processed. Clients without
+// a certificate are rejected while an authorizer is set.
+func (s *Server) SetTLSClientAuthorizer(authorize func(*x509.Certificate) error) {
+	s.hooksLock.Lock()
+	s.tlsAuthorizer = authorize
+	s.hooksLock.Unlock()
+}
+
+// SetTLSRoleAuthorizer sets a function deciding whether the role of a TLS
+// client, see TLSRole, may run a function for a unit. It is called for every
+// request received over ListenTLS, with an empty role for clients whose
+// certificate has none; requests it rejects return IllegalFunction, as
+// required by the Modbus/TCP Security specification. Requests received over
+// plain TCP and serial ports are not affected. A nil function (the default)
+// authorizes every role.
+func (s *Server) SetTLSRoleAuthorizer(authorize func(role string, unit uint8, funcCode uint8) bool) {
+	s.hooksLock.Lock()
+	s.roleAuthorizer = authorize
+	s.hooksLock.Unlock()
+}
+
+// TLSRole returns the role carried by the TLSRoleOID extension of a client
+// certificate, or an empty string when it has none.
+func TLSRole(cert *x509.Certificate) (string, error) {
+	for _, extension := range cert.Extensions {
+		if !extension.Id.Equal(TLSRoleOID) {
+			continue
+		}
+		var role string
+		if _, err := asn1.UnmarshalWithParams(extension.Value, &role, "utf8"); err != nil {
+			return "", fmt.Errorf("invalid role extension: %w", err)
+		}
+		return role, nil
+	}
+	return "", nil
+}
+
+// roleAllows reports whether the role authorizer allows the request.
+func (s *Server) roleAllows(request *Request, unit uint8, funcCode uint8) bool {
+	if request.tlsRole == nil {
+		return true
+	}
+	s.hooksLock.RLock()
+	authorize := s.roleAuthorizer
+	s.hooksLock.RUnlock()
+	return authorize == nil || authorize(*request.tlsRole, unit, funcCode)
+}
+
+// authorizeTLS completes the handshake, runs the client authorizer and
+// returns the role of the client.
+func (s *Server) authorizeTLS(conn *tls.Conn) (string, error) {
+	timeout := time.Duration(s.handshakeTimeout.Load())
+	if timeout <= 0 {
+		timeout = DefaultTLSHandshakeTimeout
+	}
+	conn.SetDeadline(time.Now().Add(timeout))
+	err := conn.Handshake()
+	conn.SetDeadline(time.Time{})
+	if err != nil {
+		return "", err
+	}
+
+	s.hooksLock.RLock()
+	authorize := s.tlsAuthorizer
+	s.hooksLock.RUnlock()
+	certs := conn.ConnectionState().PeerCertificates
+	if authorize == nil {
+		if len(certs) == 0 {
+			return "", nil
+		}
+		return TLSRole(certs[0])
+	}
+
+	if len(certs) == 0 {
+		return "", fmt.Errorf("no client certificate")
+	}
+	if err := authorize(certs[0]); err != nil {
+		return "", err
+	}
+	return TLSRole(certs[0])
+}
@@ -0,0 +1,253 @@
+package mbserver
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &testCA{cert: cert, key: key, pool: pool}
+}
+
+// issue creates a certificate for commonName signed by the CA.
+func (ca *testCA) issue(t *testing.T, serial int64, commonName string, usage x509.ExtKeyUsage) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	return ca.sign(t, template, key)
+}
+
+// issueWithRole creates a client certificate carrying a Modbus Security role.
+func (ca *testCA) issueWithRole(t *testing.T, serial int64, role string) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, err := asn1.MarshalWithParams(role, "utf8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:    big.NewInt(serial),
+		Subject:         pkix.Name{CommonName: role},
+		NotBefore:       time.Now().Add(-time.Hour),
+		NotAfter:        time.Now().Add(time.Hour),
+		KeyUsage:        x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		ExtraExtensions: []pkix.Extension{{Id: TLSRoleOID, Value: value}},
+	}
+	return ca.sign(t, template, key)
+}
+
+func (ca *testCA) sign(t *testing.T, template *x509.Certificate, key *ecdsa.PrivateKey) tls.Certificate {
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// tlsReadCoils sends a Read Coils request over a new TLS connection.
+func tlsReadCoils(addr string, config *tls.Config) error {
+	conn, err := tls.Dial("tcp", addr, config)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	frame := &TCPFrame{Device: 1, Function: ReadCoilsFC}
+	SetDataWithRegisterAndNumber(frame, 0, 8)
+	_, err = conn.Write(frame.Bytes())
+	if err != nil {
+		return err
+	}
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	response := make([]byte, 10)
+	_, err = io.ReadFull(conn, response)
+	return err
+}
+
+func TestListenTLSClientAuthorizer(t *testing.T) {
+	ca := newTestCA(t)
+
+	s := NewServer()
+	s.SetTLSClientAuthorizer(func(cert *x509.Certificate) error {
+		if cert.Subject.CommonName != "hmi-1" {
+			return fmt.Errorf("unknown client %v", cert.Subject.CommonName)
+		}
+		return nil
+	})
+	addr := getFreePort()
+	err := s.ListenTLS(addr, &tls.Config{
+		Certificates: []tls.Certificate{ca.issue(t, 2, "server", x509.ExtKeyUsageServerAuth)},
+		ClientCAs:    ca.pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	})
+	if err != nil {
+		t.Fatalf("failed to listen, got %v\n", err)
+	}
+	defer s.Close()
+
+	err = tlsReadCoils(addr, &tls.Config{
+		RootCAs:      ca.pool,
+		Certificates: []tls.Certificate{ca.issue(t, 3, "hmi-1", x509.ExtKeyUsageClientAuth)},
+	})
+	if err != nil {
+		t.Errorf("expected authorized client to be served, got %v", err)
+	}
+
+	err = tlsReadCoils(addr, &tls.Config{
+		RootCAs:      ca.pool,
+		Certificates: []tls.Certificate{ca.issue(t, 4, "intruder", x509.ExtKeyUsageClientAuth)},
+	})
+	if err == nil {
+		t.Errorf("expected unauthorized client to be rejected")
+	}
+}
+
+func TestSetTLSRoleAuthorizer(t *testing.T) {
+	ca := newTestCA(t)
+
+	s := NewServer()
+	s.SetTLSRoleAuthorizer(func(role string, unit uint8, funcCode uint8) bool {
+		return role == "operator" || s.isReadOnly(unit, funcCode)
+	})
+	addr := getFreePort()
+	err := s.ListenTLS(addr, &tls.Config{
+		Certificates: []tls.Certificate{ca.issue(t, 2, "server", x509.ExtKeyUsageServerAuth)},
+		ClientCAs:    ca.pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	})
+	if err != nil {
+		t.Fatalf("failed to listen, got %v\n", err)
+	}
+	defer s.Close()
+
+	writeCoil := func(role string, serial int64) []byte {
+		conn, err := tls.Dial("tcp", addr, &tls.Config{
+			RootCAs:      ca.pool,
+			Certificates: []tls.Certificate{ca.issueWithRole(t, serial, role)},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+
+		frame := &TCPFrame{Device: 1, Function: WriteSingleCoilFC}
+		SetDataWithRegisterAndNumber(frame, 0, 0xff00)
+		if _, err := conn.Write(frame.Bytes()); err != nil {
+			t.Fatal(err)
+		}
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		packet, err := readTCPPacket(conn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return packet[7:]
+	}
+
+	if pdu := writeCoil("viewer", 3); !isEqual([]byte{WriteSingleCoilFC | 0x80, byte(IllegalFunction)}, pdu) {
+		t.Errorf("expected viewer writes to be rejected, got %v", pdu)
+	}
+	if s.Coils[0] != 0 {
+		t.Errorf("expected the rejected write not to change memory")
+	}
+	if pdu := writeCoil("operator", 4); !isEqual([]byte{WriteSingleCoilFC, 0, 0, 0xff, 0}, pdu) {
+		t.Errorf("expected operator writes to succeed, got %v", pdu)
+	}
+}
+
+func TestTLSRole(t *testing.T) {
+	ca := newTestCA(t)
+	cert, err := x509.ParseCertificate(ca.issueWithRole(t, 2, "engineer").Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if role, err := TLSRole(cert); role != "engineer" || err != nil {
+		t.Errorf("expected role engineer, got %q, %v", role, err)
+	}
+	if role, err := TLSRole(ca.cert); role != "" || err != nil {
+		t.Errorf("expected no role, got %q, %v", role, err)
+	}
+}
+
+func TestSetTLSHandshakeTimeout(t *testing.T) {
+	ca := newTestCA(t)
+
+	s := NewServer(WithLogger(discardLogger{}))
+	s.SetMaxConns(1)
+	s.SetTLSHandshakeTimeout(50 * time.Millisecond)
+	addr := getFreePort()
+	err := s.ListenTLS(addr, &tls.Config{
+		Certificates: []tls.Certificate{ca.issue(t, 2, "server", x509.ExtKeyUsageServerAuth)},
+	})
+	if err != nil {
+		t.Fatalf("failed to listen, got %v\n", err)
+	}
+	defer s.Close()
+
+	// A client stalling the handshake is disconnected, freeing its slot.
+	stalled, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stalled.Close()
+	stalled.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := stalled.Read(make([]byte, 1)); err == nil || isTimeout(err) {
+		t.Errorf("expected the stalled connection to be closed, got %v", err)
+	}
+
+	if err := tlsReadCoils(addr, &tls.Config{RootCAs: ca.pool}); err != nil {
+		t.Errorf("expected the next client to be served, got %v", err)
+	}
+}
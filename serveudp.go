@@ -0,0 +1,90 @@
+package mbserver
+
+import (
+	"errors"
+	"io"
+	"net"
+	"time"
+)
+
+// ListenUDP starts the Modbus server listening for Modbus UDP datagrams on
+// "address:port". Each datagram holds one MBAP framed request, as over TCP,
+// and is answered with a datagram sent to its source address. The options
+// restrict the functions masters may use, see ListenTCP.
+//
+// UDP masters are not connections: they are not reported by Clients nor
+// subject to the connection limits. Datagrams from masters outside the
+// allowed networks, or inside the denied ones (see SetAllowedCIDRs), are
+// dropped.
+func (s *Server) ListenUDP(addressPort string, opts ...ListenOption) (err error) {
+	conn, err := net.ListenPacket("udp", addressPort)
+	if err != nil {
+		s.logger.Printf("Failed to Listen: %v\n", err)
+		return err
+	}
+	s.listenersLock.Lock()
+	s.packetConns = append(s.packetConns, conn)
+	s.listenersLock.Unlock()
+
+	go s.serveUDP(conn, newListenPolicy(opts))
+	s.rememberListen(conn, func() error { return s.ListenUDP(addressPort, opts...) })
+	return err
+}
+
+// serveUDP reads datagrams until the connection is closed.
+func (s *Server) serveUDP(conn net.PacketConn, policy *listenPolicy) {
+	// One byte more than the longest packet, so that a longer datagram is
+	// rejected by the length check rather than truncated.
+	buffer := make([]byte, 6+maxTCPLength+1)
+	for {
+		n, addr, err := conn.ReadFrom(buffer)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				s.logger.Printf("UDP read error %v\n", err)
+			}
+			return
+		}
+		s.bytesIn.Add(uint64(n))
+		if !s.acceptConn(addr) {
+			continue
+		}
+
+		packet := append([]byte(nil), buffer[:n]...)
+		frame, err := NewTCPFrame(packet)
+		if err != nil {
+			s.logger.Printf("bad datagram error %v\n", err)
+			continue
+		}
+
+		client := s.newClientConn(&udpReply{conn: conn, addr: addr})
+		client.capture(packet)
+		request := &Request{conn: client, frame: frame, received: time.Now(), policy: policy}
+
+		if !s.submit(request) {
+			return
+		}
+	}
+}
+
+// udpReply answers the datagram received from addr.
+type udpReply struct {
+	conn net.PacketConn
+	addr net.Addr
+}
+
+func (r *udpReply) Read([]byte) (int, error) {
+	return 0, io.EOF
+}
+
+func (r *udpReply) Write(p []byte) (int, error) {
+	return r.conn.WriteTo(p, r.addr)
+}
+
+// Close does not close the shared socket.
+func (r *udpReply) Close() error {
+	return nil
+}
+
+func (r *udpReply) RemoteAddr() net.Addr {
+	return r.addr
+}
@@ -0,0 +1,49 @@
+package mbserver
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestListenUDP(t *testing.T) {
+	s := NewServer(WithLogger(discardLogger{}))
+	defer s.Close()
+	s.HoldingRegisters[0] = 0x1234
+	addr := getFreePort()
+	if err := s.ListenUDP(addr); err != nil {
+		t.Fatalf("failed to listen, got %v\n", err)
+	}
+
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+
+	// A malformed datagram is dropped, the next one is answered.
+	conn.Write([]byte{0, 1, 0, 0, 0, 9, 1, 3})
+	frame := &TCPFrame{TransactionIdentifier: 7, Device: 1, Function: ReadHoldingRegistersFC}
+	SetDataWithRegisterAndNumber(frame, 0, 1)
+	if _, err := conn.Write(frame.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	response := make([]byte, 32)
+	n, err := conn.Read(response)
+	if err != nil {
+		t.Fatalf("expected a response, got %v", err)
+	}
+	expect := []byte{0, 7, 0, 0, 0, 5, 1, 3, 2, 0x12, 0x34}
+	if !isEqual(expect, response[:n]) {
+		t.Errorf("expected %v, got %v", expect, response[:n])
+	}
+
+	// Datagrams from denied networks are dropped.
+	s.SetDeniedCIDRs([]string{"127.0.0.0/8"})
+	conn.Write(frame.Bytes())
+	conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, err := conn.Read(response); err == nil {
+		t.Errorf("expected no response to a datagram from a denied network")
+	}
+}
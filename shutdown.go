@@ -0,0 +1,182 @@
+package mbserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// shutdownPollInterval is how often Shutdown checks for in-flight requests.
+const shutdownPollInterval = 10 * time.Millisecond
+
+// Shutdown gracefully shuts the server down. It stops listening, stops
+// reading requests from connections and serial ports, waits for the requests
+// already read to be answered and then closes the connections and the server
+// as Close does.
+//
+// When ctx is done before then, the remaining connections and ports are
+// closed without waiting any longer and the context error, such as
+// context.DeadlineExceeded, is returned: Shutdown always returns by the
+// deadline of ctx, even if a handler never does. The goroutine of such a
+// handler is left behind. Close must not be called after Shutdown, see
+// Restart to serve again.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.changeState(func() { s.shuttingDown.Store(true) })
+	s.listenersLock.Lock()
+	for _, listen := range s.listeners {
+		listen.Close()
+	}
+	s.listenersLock.Unlock()
+
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+	for s.inFlight.Load() > 0 {
+		select {
+		case <-ctx.Done():
+			s.closeAll(false)
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+
+	select {
+	case <-s.closeAll(true):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// closeAll closes the connections, stops the handler goroutines of the
+// workers and closes the server in the background, returning a channel
+// closed once it is done. With wait set, that is also once the handler
+// goroutines have exited.
+func (s *Server) closeAll(wait bool) chan struct{} {
+	s.closeConns()
+	handlerDone := s.stopHandler()
+
+	closed := make(chan struct{})
+	s.lifecycleLock.Lock()
+	s.closed = closed
+	s.lifecycleLock.Unlock()
+	go func() {
+		s.Close()
+		if wait {
+			<-handlerDone
+		}
+		close(closed)
+	}()
+	return closed
+}
+
+// submit queues a request read from a connection or a serial port, false
+// once the server is shutting down.
+func (s *Server) submit(request *Request) bool {
+	// Counting the request before checking the flag ensures Shutdown either
+	// waits for it or sees it refused.
+	s.inFlight.Add(1)
+	if s.shuttingDown.Load() {
+		s.inFlight.Add(-1)
+		return false
+	}
+	s.countDiagnostic(ReturnBusMessageCount)
+	s.requestQueue(request) <- request
+	return true
+}
+
+// closeConns closes the connections and serial ports being served.
+func (s *Server) closeConns() {
+	s.connsLock.Lock()
+	defer s.connsLock.Unlock()
+
+	for conn := range s.conns {
+		conn.Close()
+	}
+}
+
+// Restart serves again a server stopped with Shutdown: the handler
+// goroutines of the workers are started again and so are the listeners and
+// serial ports opened before, on the same addresses and with the same
+// options (ListenTCPAny listeners reuse their port). Memory, handlers and
+// settings are kept, but UseMmapBacking must be called again as Shutdown
+// unmapped the file. An error is returned when the server was not shut down,
+// when the handler of a request abandoned by a forced Shutdown is still
+// running, or when a listener cannot be opened again; it is tried again by
+// the next Restart. Listeners closed with StopListener, or whose context is
+// done, are not opened again.
+func (s *Server) Restart() error {
+	if !s.shuttingDown.Load() {
+		return fmt.Errorf("server is running, Shutdown must be called before Restart")
+	}
+	s.lifecycleLock.Lock()
+	closed := s.closed
+	s.lifecycleLock.Unlock()
+	select {
+	case <-closed:
+	default:
+		return fmt.Errorf("server is still shutting down")
+	}
+	if !s.startHandler() {
+		return fmt.Errorf("the handler of an abandoned request is still running")
+	}
+	s.startUnits()
+
+	s.listenersLock.Lock()
+	s.listeners = nil
+	s.packetConns = nil
+	s.httpEndpoints = nil
+	s.listenersLock.Unlock()
+	s.ports = nil
+	s.portsCloseChan = make(chan struct{})
+
+	s.lifecycleLock.Lock()
+	specs := s.listenSpecs
+	s.listenSpecs = nil
+	s.lifecycleLock.Unlock()
+
+	s.changeState(func() { s.shuttingDown.Store(false) })
+	var errs []error
+	var failed []listenSpec
+	for _, spec := range specs {
+		// A listener opened again records a new spec.
+		if err := spec.listen(); err != nil {
+			errs = append(errs, err)
+			failed = append(failed, spec)
+		}
+	}
+	// The specs failing to open are kept for the next Restart.
+	s.lifecycleLock.Lock()
+	s.listenSpecs = append(s.listenSpecs, failed...)
+	s.lifecycleLock.Unlock()
+	return errors.Join(errs...)
+}
+
+// listenSpec records how to open the listener, socket or serial port key
+// again on Restart.
+type listenSpec struct {
+	key    interface{}
+	listen func() error
+}
+
+// rememberListen records how to open a listener or serial port again on
+// Restart.
+func (s *Server) rememberListen(key interface{}, listen func() error) {
+	s.lifecycleLock.Lock()
+	s.listenSpecs = append(s.listenSpecs, listenSpec{key: key, listen: listen})
+	s.lifecycleLock.Unlock()
+}
+
+// forgetListen removes the spec of a listener closed for good, so that
+// Restart does not open it again.
+func (s *Server) forgetListen(key interface{}) {
+	s.lifecycleLock.Lock()
+	defer s.lifecycleLock.Unlock()
+
+	for i, spec := range s.listenSpecs {
+		if spec.key == key {
+			s.listenSpecs = append(s.listenSpecs[:i], s.listenSpecs[i+1:]...)
+			return
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package mbserver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/goburrow/modbus"
+)
+
+func startSlowServer(t *testing.T, delay time.Duration) (*Server, net.Conn) {
+	s := NewServer(WithLogger(discardLogger{}))
+	s.RegisterFunctionHandler(ReadHoldingRegistersFC, func(s *Server, frame Framer) ([]byte, *Exception) {
+		time.Sleep(delay)
+		return ReadHoldingRegisters(s, frame)
+	})
+	addr, err := s.ListenTCPAny()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.Dial("tcp", addr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	frame := &TCPFrame{TransactionIdentifier: 1, Device: 1, Function: ReadHoldingRegistersFC}
+	SetDataWithRegisterAndNumber(frame, 0, 1)
+	if _, err := conn.Write(frame.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	// Wait for the request to be in flight.
+	for s.inFlight.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	return s, conn
+}
+
+func TestShutdown(t *testing.T) {
+	s, conn := startSlowServer(t, 50*time.Millisecond)
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// The in-flight request was answered before the connection was closed.
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	response := make([]byte, 512)
+	n, err := conn.Read(response)
+	if err != nil {
+		t.Fatalf("expected a response, got %v", err)
+	}
+	if n != 11 {
+		t.Errorf("expected an 11 byte response, got %v", response[:n])
+	}
+	if _, err := conn.Read(response); err == nil {
+		t.Errorf("expected the connection to be closed")
+	}
+}
+
+func TestShutdownDeadline(t *testing.T) {
+	s, conn := startSlowServer(t, 2*time.Second)
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := s.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected Shutdown to return by the deadline, took %v", elapsed)
+	}
+
+	// The connection was closed without waiting for the response.
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if n, err := conn.Read(make([]byte, 512)); err == nil || n != 0 {
+		t.Errorf("expected the connection to be closed, got %v bytes, %v", n, err)
+	}
+}
+
+func TestRestart(t *testing.T) {
+	s := NewServer()
+	if err := s.Restart(); err == nil {
+		t.Errorf("expected an error restarting a running server")
+	}
+
+	// A handler detecting concurrent handler goroutines.
+	var running, overlaps atomic.Int32
+	s.RegisterFunctionHandler(ReadHoldingRegistersFC, func(s *Server, frame Framer) ([]byte, *Exception) {
+		if running.Add(1) > 1 {
+			overlaps.Add(1)
+		}
+		time.Sleep(time.Millisecond)
+		running.Add(-1)
+		return ReadHoldingRegisters(s, frame)
+	})
+	addr, err := s.ListenTCPAny()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := s.Restart(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer s.Close()
+	if s.startHandler() {
+		t.Errorf("expected the handler goroutine not to be started twice")
+	}
+
+	// Clients reach the restarted listener on the same address, and their
+	// requests never run concurrently.
+	done := make(chan error)
+	for i := 0; i < 4; i++ {
+		go func() {
+			handler := modbus.NewTCPClientHandler(addr.String())
+			handler.SlaveId = 1
+			if err := handler.Connect(); err != nil {
+				done <- err
+				return
+			}
+			defer handler.Close()
+			client := modbus.NewClient(handler)
+			for j := 0; j < 10; j++ {
+				if _, err := client.ReadHoldingRegisters(0, 1); err != nil {
+					done <- err
+					return
+				}
+			}
+			done <- nil
+		}()
+	}
+	for i := 0; i < 4; i++ {
+		if err := <-done; err != nil {
+			t.Errorf("expected nil, got %v", err)
+		}
+	}
+	if overlaps.Load() != 0 {
+		t.Errorf("expected one handler at a time, got %v overlaps", overlaps.Load())
+	}
+}
+
+func TestRestartListenSpecs(t *testing.T) {
+	s := NewServer(WithLogger(discardLogger{}))
+	defer s.Close()
+	stopped, err := s.ListenTCPAny()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.StopListener(stopped.String()); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := s.ListenTCPContext(ctx, getFreePort()); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	// The address kept busy makes the listener fail to open again.
+	busy, err := s.ListenTCPAny()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	squatter, err := net.Listen("tcp", busy.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Restart(); err == nil {
+		t.Errorf("expected an error opening a busy address")
+	}
+	if len(s.listeners) != 0 {
+		t.Errorf("expected the stopped and cancelled listeners to stay closed, got %v", s.listeners)
+	}
+
+	// The listener failing to open is tried again by the next Restart.
+	squatter.Close()
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Restart(); err != nil {
+		t.Fatalf("expected the busy address to be opened, got %v", err)
+	}
+	if len(s.listeners) != 1 || s.listeners[0].Addr().String() != busy.String() {
+		t.Errorf("expected the listener on %v, got %v", busy, s.listeners)
+	}
+}
@@ -0,0 +1,219 @@
+package mbserver
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Generator produces the values of a simulated signal, see Simulate. Value is
+// called with the time elapsed since the simulation started, from a single
+// goroutine.
+type Generator interface {
+	Value(elapsed time.Duration) float64
+}
+
+// GeneratorFunc adapts a function to a Generator.
+type GeneratorFunc func(elapsed time.Duration) float64
+
+// Value calls f(elapsed).
+func (f GeneratorFunc) Value(elapsed time.Duration) float64 {
+	return f(elapsed)
+}
+
+// Sine returns a sine wave around offset, of the given amplitude and period.
+// A period that is not positive returns offset.
+func Sine(offset, amplitude float64, period time.Duration) Generator {
+	return GeneratorFunc(func(elapsed time.Duration) float64 {
+		if period <= 0 {
+			return offset
+		}
+		return offset + amplitude*math.Sin(2*math.Pi*float64(elapsed)/float64(period))
+	})
+}
+
+// Ramp returns a sawtooth going from from to to over each period. A period
+// that is not positive returns to.
+func Ramp(from, to float64, period time.Duration) Generator {
+	return GeneratorFunc(func(elapsed time.Duration) float64 {
+		if period <= 0 {
+			return to
+		}
+		return from + (to-from)*float64(elapsed%period)/float64(period)
+	})
+}
+
+// RandomWalk returns a signal starting at start and moving by a random amount
+// of at most step at each value, staying between min and max. The same seed
+// produces the same walk.
+func RandomWalk(start, step, min, max float64, seed int64) Generator {
+	random := rand.New(rand.NewSource(seed))
+	value := start
+	return GeneratorFunc(func(time.Duration) float64 {
+		value += step * (2*random.Float64() - 1)
+		value = math.Max(min, math.Min(max, value))
+		return value
+	})
+}
+
+// Playback returns a signal replaying the rows of a CSV recording, each
+// holding a timestamp in seconds from the start of the recording and a value.
+// A value is held until the timestamp of the next row, the last one
+// indefinitely. Rows need not be sorted.
+func Playback(r io.Reader) (Generator, error) {
+	type sample struct {
+		at    time.Duration
+		value float64
+	}
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 2
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("empty recording")
+	}
+	var samples []sample
+	for i, record := range records {
+		at, err := strconv.ParseFloat(record[0], 64)
+		if err != nil {
+			return nil, fmt.Errorf("row %d: invalid timestamp %q", i+1, record[0])
+		}
+		value, err := strconv.ParseFloat(record[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("row %d: invalid value %q", i+1, record[1])
+		}
+		samples = append(samples, sample{at: time.Duration(at * float64(time.Second)), value: value})
+	}
+	sort.SliceStable(samples, func(i, j int) bool { return samples[i].at < samples[j].at })
+
+	return GeneratorFunc(func(elapsed time.Duration) float64 {
+		i := sort.Search(len(samples), func(i int) bool { return samples[i].at > elapsed })
+		if i == 0 {
+			return samples[0].value
+		}
+		return samples[i-1].value
+	}), nil
+}
+
+type simulatedValue struct {
+	kind    RegisterKind
+	address uint16
+}
+
+// Simulate drives a coil, discrete input or register with generator once the
+// simulation is started, see StartSimulation. Register values are rounded,
+// clamped to -32768 to 65535, and negative values stored as their two's
+// complement; coils and discrete inputs are set by positive values. A nil
+// generator stops driving the address.
+func (s *Server) Simulate(kind RegisterKind, address uint16, generator Generator) error {
+	if kind > InputRegister {
+		return fmt.Errorf("unknown memory map %v", kind)
+	}
+	if int(address) >= s.bankSize(kind) {
+		return fmt.Errorf("%w: %v %d, size %d", ErrAddressOutOfRange, kind, address, s.bankSize(kind))
+	}
+
+	s.simLock.Lock()
+	defer s.simLock.Unlock()
+	target := simulatedValue{kind: kind, address: address}
+	if generator == nil {
+		delete(s.simGenerators, target)
+		return nil
+	}
+	if s.simGenerators == nil {
+		s.simGenerators = make(map[simulatedValue]Generator)
+	}
+	s.simGenerators[target] = generator
+	return nil
+}
+
+// StartSimulation updates the addresses driven by Simulate every interval,
+// all at once under the memory lock, so that masters never read a partial
+// update. The OnWrite callbacks are not fired. The simulation runs until
+// StopSimulation or Close.
+func (s *Server) StartSimulation(interval time.Duration) error {
+	if interval <= 0 {
+		return fmt.Errorf("invalid simulation interval %v", interval)
+	}
+	s.simLock.Lock()
+	defer s.simLock.Unlock()
+	if s.simStop != nil {
+		return fmt.Errorf("simulation already started")
+	}
+	stop, done := make(chan struct{}), make(chan struct{})
+	s.simStop, s.simDone = stop, done
+
+	go func() {
+		defer close(done)
+		start := time.Now()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		s.simulate(0)
+		for {
+			select {
+			case now := <-ticker.C:
+				s.simulate(now.Sub(start))
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// StopSimulation stops updating the simulated addresses, which keep their
+// last values.
+func (s *Server) StopSimulation() {
+	s.simLock.Lock()
+	stop, done := s.simStop, s.simDone
+	s.simStop, s.simDone = nil, nil
+	s.simLock.Unlock()
+
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+}
+
+// simulate writes the values of the generators at elapsed.
+func (s *Server) simulate(elapsed time.Duration) {
+	s.simLock.Lock()
+	defer s.simLock.Unlock()
+	if len(s.simGenerators) == 0 {
+		return
+	}
+	values := make(map[simulatedValue]uint16, len(s.simGenerators))
+	for target, generator := range s.simGenerators {
+		values[target] = simulatedRegister(target.kind, generator.Value(elapsed))
+	}
+
+	s.memoryLock.Lock()
+	defer s.memoryLock.Unlock()
+	for target, value := range values {
+		if err := s.writeRegisters(target.kind, int(target.address), []uint16{value}); err != nil {
+			s.logger.Printf("failed to simulate %v %d: %v\n", target.kind, target.address, err)
+		}
+	}
+}
+
+func simulatedRegister(kind RegisterKind, value float64) uint16 {
+	if kind == Coil || kind == DiscreteInput {
+		return boolValue(value > 0)
+	}
+	if math.IsNaN(value) {
+		return 0
+	}
+	value = math.Max(math.MinInt16, math.Min(math.MaxUint16, math.Round(value)))
+	if value < 0 {
+		return uint16(int16(value))
+	}
+	return uint16(value)
+}
@@ -0,0 +1,114 @@
+package mbserver
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGenerators(t *testing.T) {
+	sine := Sine(100, 50, 4*time.Second)
+	for _, test := range []struct {
+		elapsed time.Duration
+		expect  float64
+	}{{0, 100}, {time.Second, 150}, {3 * time.Second, 50}} {
+		if got := sine.Value(test.elapsed); got < test.expect-1e-9 || got > test.expect+1e-9 {
+			t.Errorf("sine at %v: expected %v, got %v", test.elapsed, test.expect, got)
+		}
+	}
+
+	ramp := Ramp(10, 20, 10*time.Second)
+	if got := ramp.Value(5 * time.Second); got != 15 {
+		t.Errorf("expected 15, got %v", got)
+	}
+	if got := ramp.Value(12 * time.Second); got != 12 {
+		t.Errorf("expected the ramp to restart, got %v", got)
+	}
+
+	walk, again := RandomWalk(50, 5, 0, 60, 1), RandomWalk(50, 5, 0, 60, 1)
+	previous := 50.0
+	for i := 0; i < 100; i++ {
+		value := walk.Value(0)
+		if value < 0 || value > 60 || value-previous > 5 || previous-value > 5 {
+			t.Fatalf("expected steps of at most 5 between 0 and 60, got %v after %v", value, previous)
+		}
+		if other := again.Value(0); other != value {
+			t.Fatalf("expected the same walk for the same seed, got %v and %v", value, other)
+		}
+		previous = value
+	}
+}
+
+func TestPlayback(t *testing.T) {
+	playback, err := Playback(strings.NewReader("0, 1\n2.5, 3\n1, 2\n"))
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	for _, test := range []struct {
+		elapsed time.Duration
+		expect  float64
+	}{{0, 1}, {time.Second, 2}, {2 * time.Second, 2}, {2500 * time.Millisecond, 3}, {time.Hour, 3}} {
+		if got := playback.Value(test.elapsed); got != test.expect {
+			t.Errorf("at %v: expected %v, got %v", test.elapsed, test.expect, got)
+		}
+	}
+
+	for _, recording := range []string{"", "0\n", "now, 1\n", "0, high\n"} {
+		if _, err := Playback(strings.NewReader(recording)); err == nil {
+			t.Errorf("expected an error for %q", recording)
+		}
+	}
+}
+
+func TestSimulate(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.Simulate(InputRegister, 1, GeneratorFunc(func(time.Duration) float64 { return -2 }))
+	s.Simulate(InputRegister, 2, GeneratorFunc(func(time.Duration) float64 { return 70000 }))
+	s.Simulate(InputRegister, 3, GeneratorFunc(func(elapsed time.Duration) float64 { return elapsed.Seconds() }))
+	s.Simulate(DiscreteInput, 4, GeneratorFunc(func(time.Duration) float64 { return 0.5 }))
+
+	s.simulate(7400 * time.Millisecond)
+	expect := []uint16{0, 0xfffe, 0xffff, 7}
+	if !isEqual(expect, s.InputRegisters[0:4]) || s.DiscreteInputs[4] != 1 {
+		t.Errorf("expected %v and discrete input 4 set, got %v, %v", expect, s.InputRegisters[0:4], s.DiscreteInputs[4])
+	}
+
+	s.Simulate(InputRegister, 1, nil)
+	if err := s.Simulate(InputRegister, 1, nil); err != nil {
+		t.Errorf("expected nil, got %v", err)
+	}
+	s.InputRegisters[1] = 0
+	if err := s.StartSimulation(time.Millisecond); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if err := s.StartSimulation(time.Millisecond); err == nil {
+		t.Errorf("expected an error starting the simulation twice")
+	}
+	deadline := time.Now().Add(time.Second)
+	for {
+		values, _ := s.ReadInputRegisters(0, 4)
+		if values[2] == 0xffff && values[3] == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the simulation to restart from 0, got %v", values)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	s.StopSimulation()
+	if s.InputRegisters[1] != 0 {
+		t.Errorf("expected the removed generator not to run, got %v", s.InputRegisters[1])
+	}
+
+	if err := s.Simulate(InputRegister, 65535, Sine(0, 1, time.Second)); err != nil {
+		t.Errorf("expected nil, got %v", err)
+	}
+	small := NewServer(WithInputRegisterCount(4))
+	if err := small.Simulate(InputRegister, 4, Sine(0, 1, time.Second)); err == nil {
+		t.Errorf("expected an error beyond the memory map")
+	}
+	if err := small.StartSimulation(0); err == nil {
+		t.Errorf("expected an error with a zero interval")
+	}
+}
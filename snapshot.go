@@ -0,0 +1,79 @@
+package mbserver
+
+// Snapshot is a copy of the four memory maps, taken by Server.Snapshot.
+// Coils and discrete inputs are stored as 0 or 1.
+type Snapshot struct {
+	Coils            []uint16
+	DiscreteInputs   []uint16
+	HoldingRegisters []uint16
+	InputRegisters   []uint16
+}
+
+// RegisterChange is the change of a coil, discrete input or register found
+// by Diff.
+type RegisterChange struct {
+	Kind    RegisterKind
+	Address uint16
+	Old     uint16
+	New     uint16
+}
+
+var snapshotKinds = []RegisterKind{Coil, DiscreteInput, HoldingRegister, InputRegister}
+
+// Snapshot returns a copy of the memory maps, taken while no request is
+// being processed, for a later Diff. An error is returned when the Store of
+// a server created with NewServerWithStore fails.
+func (s *Server) Snapshot() (*Snapshot, error) {
+	s.memoryLock.RLock()
+	defer s.memoryLock.RUnlock()
+
+	snapshot := &Snapshot{}
+	for _, kind := range snapshotKinds {
+		values, err := s.readRegisters(kind, 0, s.bankSize(kind))
+		if err != nil {
+			return nil, err
+		}
+		*snapshot.bank(kind) = append([]uint16(nil), values...)
+	}
+	return snapshot, nil
+}
+
+func (snapshot *Snapshot) bank(kind RegisterKind) *[]uint16 {
+	switch kind {
+	case Coil:
+		return &snapshot.Coils
+	case DiscreteInput:
+		return &snapshot.DiscreteInputs
+	case HoldingRegister:
+		return &snapshot.HoldingRegisters
+	default:
+		return &snapshot.InputRegisters
+	}
+}
+
+// Diff compares a snapshot taken before, for instance, running a master
+// workflow, with the current memory and returns the changes, by memory map
+// (coils, discrete inputs, holding registers then input registers) and
+// address. A test can then assert that exactly the expected registers
+// changed:
+//
+//	before, _ := s.Snapshot()
+//	runMaster()
+//	changes, _ := s.Diff(before)
+func (s *Server) Diff(before *Snapshot) ([]RegisterChange, error) {
+	after, err := s.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []RegisterChange
+	for _, kind := range snapshotKinds {
+		old, current := *before.bank(kind), *after.bank(kind)
+		for address, value := range current {
+			if address < len(old) && old[address] != value {
+				changes = append(changes, RegisterChange{Kind: kind, Address: uint16(address), Old: old[address], New: value})
+			}
+		}
+	}
+	return changes, nil
+}
@@ -0,0 +1,40 @@
+package mbserver
+
+import "testing"
+
+func TestDiff(t *testing.T) {
+	s := NewServer()
+	s.HoldingRegisters[3] = 5
+	s.InputRegisters[9] = 1
+	before, err := s.Snapshot()
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+
+	frame := &TCPFrame{Device: 1, Function: WriteHoldingRegistersFC}
+	SetDataWithRegisterAndNumberAndValues(frame, 2, 3, []uint16{1, 5, 7})
+	s.handle(&Request{frame: frame})
+	frame = &TCPFrame{Device: 1, Function: WriteSingleCoilFC}
+	SetDataWithRegisterAndNumber(frame, 65535, 0xFF00)
+	s.handle(&Request{frame: frame})
+	s.InputRegisters[9] = 0
+
+	changes, err := s.Diff(before)
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	// Register 3 was written its current value, so it did not change.
+	expect := []RegisterChange{
+		{Kind: Coil, Address: 65535, Old: 0, New: 1},
+		{Kind: HoldingRegister, Address: 2, Old: 0, New: 1},
+		{Kind: HoldingRegister, Address: 4, Old: 0, New: 7},
+		{Kind: InputRegister, Address: 9, Old: 1, New: 0},
+	}
+	if !isEqual(expect, changes) {
+		t.Errorf("expected %v, got %v", expect, changes)
+	}
+
+	if changes, _ := s.Diff(before); len(changes) != len(expect) {
+		t.Errorf("expected the snapshot not to change, got %v", changes)
+	}
+}
@@ -0,0 +1,60 @@
+package mbserver
+
+// State is the operational state of a server, see OperationalState.
+type State uint8
+
+const (
+	// Running serves requests normally.
+	Running State = iota
+	// ListenOnly processes requests without answering them, see Diagnostics.
+	ListenOnly
+	// Busy answers requests with SlaveDeviceBusy, see SetStartupBusy.
+	Busy
+	// Stopped no longer reads requests, see Shutdown.
+	Stopped
+)
+
+func (st State) String() string {
+	switch st {
+	case Running:
+		return "Running"
+	case ListenOnly:
+		return "ListenOnly"
+	case Busy:
+		return "Busy"
+	case Stopped:
+		return "Stopped"
+	default:
+		return "unknown"
+	}
+}
+
+// OperationalState returns the state of the server, from the first that
+// applies of Stopped, ListenOnly, Busy and Running. Transitions are logged.
+func (s *Server) OperationalState() State {
+	switch {
+	case s.shuttingDown.Load():
+		return Stopped
+	case s.listenOnly.Load():
+		return ListenOnly
+	case s.startupBusy.Load() > 0:
+		return Busy
+	default:
+		return Running
+	}
+}
+
+// changeState runs change, which updates the flags making up the
+// operational state, and logs the transition it causes.
+func (s *Server) changeState(change func()) {
+	before := s.OperationalState()
+	change()
+	s.logTransition(before)
+}
+
+// logTransition logs the operational state when it is no longer before.
+func (s *Server) logTransition(before State) {
+	if after := s.OperationalState(); after != before {
+		s.logger.Printf("operational state %v -> %v\n", before, after)
+	}
+}
@@ -0,0 +1,48 @@
+package mbserver
+
+import (
+	"context"
+	"testing"
+)
+
+func TestOperationalState(t *testing.T) {
+	logs := make(chanLogger, 10)
+	s := NewServer(WithLogger(logs))
+	expectState := func(expect State, transition string) {
+		t.Helper()
+		if state := s.OperationalState(); state != expect {
+			t.Errorf("expected %v, got %v", expect, state)
+		}
+		select {
+		case line := <-logs:
+			if line != transition {
+				t.Errorf("expected %q to be logged, got %q", transition, line)
+			}
+		default:
+			t.Errorf("expected %q to be logged", transition)
+		}
+	}
+	if state := s.OperationalState(); state != Running {
+		t.Errorf("expected %v, got %v", Running, state)
+	}
+
+	s.SetStartupBusy(1)
+	expectState(Busy, "operational state Running -> Busy\n")
+	read := &TCPFrame{Device: 1, Function: ReadHoldingRegistersFC}
+	SetDataWithRegisterAndNumber(read, 0, 1)
+	s.handle(&Request{frame: read})
+	expectState(Running, "operational state Busy -> Running\n")
+
+	diagnostics := &TCPFrame{Device: 1, Function: DiagnosticsFC}
+	SetDataWithRegisterAndNumber(diagnostics, ForceListenOnlyMode, 0)
+	s.handle(&Request{frame: diagnostics})
+	expectState(ListenOnly, "operational state Running -> ListenOnly\n")
+	SetDataWithRegisterAndNumber(diagnostics, RestartCommunications, 0)
+	s.handle(&Request{frame: diagnostics})
+	expectState(Running, "operational state ListenOnly -> Running\n")
+
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	expectState(Stopped, "operational state Running -> Stopped\n")
+}
@@ -0,0 +1,66 @@
+package mbserver
+
+// Stats is a snapshot of the traffic served since the server was created or
+// ResetStats was called, see Stats.
+type Stats struct {
+	// Requests counts the requests handled by function code.
+	Requests map[uint8]uint64
+	// Exceptions counts the exception responses by exception code.
+	Exceptions map[uint8]uint64
+	// BytesRead is the number of bytes received on connections and serial
+	// ports.
+	BytesRead uint64
+	// BytesWritten is the number of bytes sent on connections and serial
+	// ports.
+	BytesWritten uint64
+	// Connections is the number of connections and serial ports currently
+	// served.
+	Connections int
+	// Latency is the time taken to answer requests, see LatencyStats.
+	Latency LatencyStats
+}
+
+// Stats returns the traffic statistics of the server, to be exported to a
+// monitoring system. Function and exception codes never seen are left out of
+// the maps.
+func (s *Server) Stats() Stats {
+	stats := Stats{
+		Requests:     make(map[uint8]uint64),
+		Exceptions:   make(map[uint8]uint64),
+		BytesRead:    s.bytesIn.Load(),
+		BytesWritten: s.bytesOut.Load(),
+		Latency:      s.latency.stats(),
+	}
+	for code := range s.requestCounts {
+		if n := s.requestCounts[code].Load(); n != 0 {
+			stats.Requests[uint8(code)] = n
+		}
+		if n := s.exceptionCounts[code].Load(); n != 0 {
+			stats.Exceptions[uint8(code)] = n
+		}
+	}
+
+	s.connsLock.Lock()
+	stats.Connections = len(s.conns)
+	s.connsLock.Unlock()
+	return stats
+}
+
+// countRequest counts a handled request and its response, nil when nothing
+// is sent.
+func (s *Server) countRequest(frame Framer, response Framer) {
+	s.requestCounts[frame.GetFunction()].Add(1)
+	if response == nil || response.GetFunction()&0x80 == 0 || len(response.GetData()) == 0 {
+		return
+	}
+	s.exceptionCounts[response.GetData()[0]].Add(1)
+}
+
+func (s *Server) resetCounts() {
+	for code := range s.requestCounts {
+		s.requestCounts[code].Store(0)
+		s.exceptionCounts[code].Store(0)
+	}
+	s.bytesIn.Store(0)
+	s.bytesOut.Store(0)
+}
@@ -0,0 +1,60 @@
+package mbserver
+
+import (
+	"testing"
+	"time"
+
+	"github.com/goburrow/modbus"
+)
+
+func TestStats(t *testing.T) {
+	s := NewServer(WithCoilCount(8))
+	defer s.Close()
+	addr, err := s.ListenTCPAny()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := modbus.NewTCPClientHandler(addr.String())
+	handler.SlaveId = 1
+	if err := handler.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer handler.Close()
+	client := modbus.NewClient(handler)
+	if _, err := client.ReadCoils(0, 8); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.ReadCoils(8, 1); err == nil {
+		t.Fatalf("expected an exception")
+	}
+
+	// The latency is recorded once the response was written.
+	stats := s.Stats()
+	for deadline := time.Now().Add(time.Second); stats.Latency.Count < 2 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+		stats = s.Stats()
+	}
+	if !isEqual(map[uint8]uint64{ReadCoilsFC: 2}, stats.Requests) {
+		t.Errorf("expected 2 Read Coils requests, got %v", stats.Requests)
+	}
+	if !isEqual(map[uint8]uint64{uint8(IllegalDataAddress): 1}, stats.Exceptions) {
+		t.Errorf("expected 1 IllegalDataAddress exception, got %v", stats.Exceptions)
+	}
+	// Two 12 byte requests, a 10 byte response and a 9 byte exception.
+	if stats.BytesRead != 24 || stats.BytesWritten != 19 {
+		t.Errorf("expected 24 bytes read and 19 written, got %v and %v", stats.BytesRead, stats.BytesWritten)
+	}
+	if stats.Connections != 1 {
+		t.Errorf("expected 1 connection, got %v", stats.Connections)
+	}
+	if stats.Latency.Count != 2 {
+		t.Errorf("expected the latency of 2 requests, got %v", stats.Latency.Count)
+	}
+
+	s.ResetStats()
+	stats = s.Stats()
+	if len(stats.Requests) != 0 || len(stats.Exceptions) != 0 || stats.BytesRead != 0 || stats.Latency.Count != 0 {
+		t.Errorf("expected the statistics to be reset, got %+v", stats)
+	}
+}
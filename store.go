@@ -0,0 +1,124 @@
+package mbserver
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Store holds the memory maps of a server created with NewServerWithStore,
+// for instance to keep them in Redis or a database shared by several server
+// processes. Addresses and quantities are always within the sizes configured
+// for the server. Coils and discrete inputs are 0 or 1.
+//
+// Errors wrapping ErrAddressOutOfRange return an IllegalDataAddress exception
+// to the master, other errors a SlaveDeviceFailure exception.
+type Store interface {
+	// ReadBits returns quantity coils or discrete inputs from address.
+	ReadBits(kind RegisterKind, address, quantity uint16) ([]byte, error)
+	// WriteBits sets coils or discrete inputs from address.
+	WriteBits(kind RegisterKind, address uint16, values []byte) error
+	// ReadRegisters returns quantity holding or input registers from address.
+	ReadRegisters(kind RegisterKind, address, quantity uint16) ([]uint16, error)
+	// WriteRegisters sets holding or input registers from address.
+	WriteRegisters(kind RegisterKind, address uint16, values []uint16) error
+}
+
+// NewServerWithStore creates a new Modbus server (slave) keeping its memory
+// maps in store instead of the built-in slices, which are then nil. The
+// sizes of the memory maps are set with the count options, the full Modbus
+// address space by default. Options seeding register values write them to
+// the store.
+//
+// The built-in handlers call the store with the memory lock held, so a slow
+// store delays every request. Reads hold it for reading only and may call
+// ReadBits and ReadRegisters concurrently. SetSparse and UseMmapBacking are not
+// supported.
+func NewServerWithStore(store Store, opts ...Option) *Server {
+	return newServer(store, opts)
+}
+
+// MemoryStore is a Store over slices covering the whole Modbus address space,
+// the same memory maps as the built-in ones. It may be embedded in a Store
+// that computes some values on demand and keeps the others in memory. It is
+// safe for concurrent use.
+type MemoryStore struct {
+	lock      sync.RWMutex
+	bits      [2][]byte
+	registers [2][]uint16
+}
+
+// NewMemoryStore creates a MemoryStore with every coil, discrete input and
+// register set to 0.
+func NewMemoryStore() *MemoryStore {
+	m := &MemoryStore{}
+	for i := range m.bits {
+		m.bits[i] = make([]byte, MaxRegisterSize)
+		m.registers[i] = make([]uint16, MaxRegisterSize)
+	}
+	return m
+}
+
+// ReadBits returns quantity coils or discrete inputs from address.
+func (m *MemoryStore) ReadBits(kind RegisterKind, address, quantity uint16) ([]byte, error) {
+	if err := checkStoreRange(address, int(quantity)); err != nil {
+		return nil, err
+	}
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return append([]byte(nil), m.bits[bitIndex(kind)][address:int(address)+int(quantity)]...), nil
+}
+
+// WriteBits sets coils or discrete inputs from address.
+func (m *MemoryStore) WriteBits(kind RegisterKind, address uint16, values []byte) error {
+	if err := checkStoreRange(address, len(values)); err != nil {
+		return err
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	copy(m.bits[bitIndex(kind)][address:], values)
+	return nil
+}
+
+// ReadRegisters returns quantity holding or input registers from address.
+func (m *MemoryStore) ReadRegisters(kind RegisterKind, address, quantity uint16) ([]uint16, error) {
+	if err := checkStoreRange(address, int(quantity)); err != nil {
+		return nil, err
+	}
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return append([]uint16(nil), m.registers[registerIndex(kind)][address:int(address)+int(quantity)]...), nil
+}
+
+// WriteRegisters sets holding or input registers from address.
+func (m *MemoryStore) WriteRegisters(kind RegisterKind, address uint16, values []uint16) error {
+	if err := checkStoreRange(address, len(values)); err != nil {
+		return err
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	copy(m.registers[registerIndex(kind)][address:], values)
+	return nil
+}
+
+func bitIndex(kind RegisterKind) int {
+	if kind == DiscreteInput {
+		return 1
+	}
+	return 0
+}
+
+func registerIndex(kind RegisterKind) int {
+	if kind == InputRegister {
+		return 1
+	}
+	return 0
+}
+
+// checkStoreRange returns an error wrapping ErrAddressOutOfRange when quantity
+// values from address do not fit in the Modbus address space.
+func checkStoreRange(address uint16, quantity int) error {
+	if int(address)+quantity > MaxRegisterSize {
+		return fmt.Errorf("%w: %d-%d, size %d", ErrAddressOutOfRange, address, int(address)+quantity-1, MaxRegisterSize)
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package mbserver
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// mapStore is a Store over Go maps, failing every call while err is set.
+type mapStore struct {
+	values map[RegisterKind]map[uint16]uint16
+	err    error
+}
+
+func newMapStore() *mapStore {
+	return &mapStore{values: make(map[RegisterKind]map[uint16]uint16)}
+}
+
+func (m *mapStore) ReadBits(kind RegisterKind, address, quantity uint16) ([]byte, error) {
+	values, err := m.ReadRegisters(kind, address, quantity)
+	bits := make([]byte, len(values))
+	for i, value := range values {
+		bits[i] = byte(value)
+	}
+	return bits, err
+}
+
+func (m *mapStore) WriteBits(kind RegisterKind, address uint16, values []byte) error {
+	registers := make([]uint16, len(values))
+	for i, value := range values {
+		registers[i] = uint16(value)
+	}
+	return m.WriteRegisters(kind, address, registers)
+}
+
+func (m *mapStore) ReadRegisters(kind RegisterKind, address, quantity uint16) ([]uint16, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	values := make([]uint16, quantity)
+	for i := range values {
+		values[i] = m.values[kind][address+uint16(i)]
+	}
+	return values, nil
+}
+
+func (m *mapStore) WriteRegisters(kind RegisterKind, address uint16, values []uint16) error {
+	if m.err != nil {
+		return m.err
+	}
+	if m.values[kind] == nil {
+		m.values[kind] = make(map[uint16]uint16)
+	}
+	for i, value := range values {
+		m.values[kind][address+uint16(i)] = value
+	}
+	return nil
+}
+
+func TestNewServerWithStore(t *testing.T) {
+	store := newMapStore()
+	s := NewServerWithStore(store, WithHoldingRegisterCount(10), WithHoldingRegisters(map[uint16]uint16{1: 11}))
+	if s.HoldingRegisters != nil {
+		t.Errorf("expected no built-in holding registers")
+	}
+	if store.values[HoldingRegister][1] != 11 {
+		t.Errorf("expected the seeded value in the store, got %v", store.values[HoldingRegister])
+	}
+
+	frame := &TCPFrame{Device: 1, Function: WriteSingleCoilFC}
+	SetDataWithRegisterAndNumber(frame, 5, 0xff00)
+	s.handle(&Request{frame: frame})
+	if store.values[Coil][5] != 1 {
+		t.Errorf("expected coil 5 on in the store")
+	}
+
+	frame = &TCPFrame{Device: 1, Function: ReadHoldingRegistersFC}
+	SetDataWithRegisterAndNumber(frame, 0, 2)
+	response := s.handle(&Request{frame: frame})
+	if !isEqual([]byte{4, 0, 0, 0, 11}, response.GetData()) {
+		t.Errorf("expected [4 0 0 0 11], got %v", response.GetData())
+	}
+
+	// The configured size is enforced before calling the store.
+	SetDataWithRegisterAndNumber(frame, 9, 2)
+	response = s.handle(&Request{frame: frame})
+	if exception := GetException(response); exception != IllegalDataAddress {
+		t.Errorf("expected IllegalDataAddress, got %v", exception.String())
+	}
+}
+
+func TestStoreErrors(t *testing.T) {
+	store := newMapStore()
+	s := NewServerWithStore(store)
+
+	tests := []struct {
+		err    error
+		expect Exception
+	}{
+		{errors.New("connection refused"), SlaveDeviceFailure},
+		{fmt.Errorf("%w: unmapped", ErrAddressOutOfRange), IllegalDataAddress},
+	}
+	for _, test := range tests {
+		store.err = test.err
+		for _, function := range []uint8{ReadCoilsFC, ReadInputRegistersFC, WriteHoldingRegisterFC} {
+			frame := &TCPFrame{Device: 1, Function: function}
+			SetDataWithRegisterAndNumber(frame, 0, 1)
+			response := s.handle(&Request{frame: frame})
+			if exception := GetException(response); exception != test.expect {
+				t.Errorf("function %v, %v: expected %v, got %v", function, test.err, test.expect.String(), exception.String())
+			}
+		}
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore()
+	s := NewServerWithStore(store, WithHoldingRegisters(map[uint16]uint16{3: 33}))
+
+	frame := &TCPFrame{Device: 1, Function: WriteSingleCoilFC}
+	SetDataWithRegisterAndNumber(frame, 7, 0xff00)
+	s.handle(&Request{frame: frame})
+	bits, err := store.ReadBits(Coil, 7, 1)
+	if err != nil || !isEqual([]byte{1}, bits) {
+		t.Errorf("expected coil 7 on in the store, got %v, %v", bits, err)
+	}
+	if bits, _ := store.ReadBits(DiscreteInput, 7, 1); !isEqual([]byte{0}, bits) {
+		t.Errorf("expected discrete input 7 off, got %v", bits)
+	}
+
+	frame = &TCPFrame{Device: 1, Function: ReadHoldingRegistersFC}
+	SetDataWithRegisterAndNumber(frame, 3, 1)
+	response := s.handle(&Request{frame: frame})
+	if !isEqual([]byte{2, 0, 33}, response.GetData()) {
+		t.Errorf("expected the seeded register, got %v", response.GetData())
+	}
+
+	if err := store.WriteRegisters(InputRegister, 65535, []uint16{1, 2}); !errors.Is(err, ErrAddressOutOfRange) {
+		t.Errorf("expected ErrAddressOutOfRange, got %v", err)
+	}
+}
@@ -0,0 +1,68 @@
+package mbserver
+
+// Tracer creates a span per request, see SetTracer. It is small enough to be
+// adapted to OpenTelemetry or another tracing library without this package
+// depending on it.
+type Tracer interface {
+	// StartSpan starts a span with the given name and attributes.
+	StartSpan(name string, attrs map[string]any) Span
+}
+
+// Span is a span started by a Tracer.
+type Span interface {
+	// End ends the span. err is the Exception the request was answered with,
+	// nil on success.
+	End(err error)
+}
+
+// Span attributes set by the server.
+const (
+	SpanFunctionCode = "modbus.function_code"
+	SpanUnitID       = "modbus.unit_id"
+	SpanAddress      = "modbus.address"
+	SpanQuantity     = "modbus.quantity"
+)
+
+// SetTracer sets the tracer used to create a "modbus.request" span around the
+// processing of each request, with the function code and unit ID as
+// attributes, plus the address and quantity for the read and write functions.
+// A nil tracer (the default) disables tracing.
+func (s *Server) SetTracer(tracer Tracer) {
+	s.hooksLock.Lock()
+	s.tracer = tracer
+	s.hooksLock.Unlock()
+}
+
+// startSpan starts the span of a request, nil when tracing is disabled.
+func (s *Server) startSpan(frame Framer) Span {
+	s.hooksLock.RLock()
+	tracer := s.tracer
+	s.hooksLock.RUnlock()
+	if tracer == nil {
+		return nil
+	}
+
+	attrs := map[string]any{
+		SpanFunctionCode: frame.GetFunction(),
+		SpanUnitID:       frame.GetSlaveId(),
+	}
+	if address, quantity, ok := requestRange(frame); ok {
+		attrs[SpanAddress] = address
+		attrs[SpanQuantity] = quantity
+	}
+	return tracer.StartSpan("modbus.request", attrs)
+}
+
+// endSpan ends the span of a request with the exception of its response.
+func endSpan(span Span, response Framer) {
+	if span == nil {
+		return
+	}
+	if response != nil {
+		if exception := GetException(response); exception != Success {
+			span.End(exception)
+			return
+		}
+	}
+	span.End(nil)
+}
@@ -0,0 +1,58 @@
+package mbserver
+
+import "testing"
+
+type testSpan struct {
+	name  string
+	attrs map[string]any
+	err   error
+	ended bool
+}
+
+func (span *testSpan) End(err error) {
+	span.err = err
+	span.ended = true
+}
+
+type testTracer struct {
+	spans []*testSpan
+}
+
+func (tracer *testTracer) StartSpan(name string, attrs map[string]any) Span {
+	span := &testSpan{name: name, attrs: attrs}
+	tracer.spans = append(tracer.spans, span)
+	return span
+}
+
+func TestSetTracer(t *testing.T) {
+	s := NewServer()
+	tracer := &testTracer{}
+	s.SetTracer(tracer)
+
+	frame := &TCPFrame{Device: 1, Function: ReadHoldingRegistersFC}
+	SetDataWithRegisterAndNumber(frame, 10, 2)
+	s.handle(&Request{frame: frame})
+	SetDataWithRegisterAndNumber(frame, 65535, 2)
+	s.handle(&Request{frame: frame})
+
+	if len(tracer.spans) != 2 {
+		t.Fatalf("expected 2 spans, got %v", len(tracer.spans))
+	}
+	span := tracer.spans[0]
+	expect := map[string]any{SpanFunctionCode: 3, SpanUnitID: 1, SpanAddress: 10, SpanQuantity: 2}
+	if span.name != "modbus.request" || !isEqual(expect, span.attrs) {
+		t.Errorf("expected %v, got %v %v", expect, span.name, span.attrs)
+	}
+	if !span.ended || span.err != nil {
+		t.Errorf("expected the span to end without error, got %v %v", span.ended, span.err)
+	}
+	if err := tracer.spans[1].err; err != IllegalDataAddress {
+		t.Errorf("expected IllegalDataAddress, got %v", err)
+	}
+
+	s.SetTracer(nil)
+	s.handle(&Request{frame: frame})
+	if len(tracer.spans) != 2 {
+		t.Errorf("expected tracing to be disabled")
+	}
+}
@@ -0,0 +1,84 @@
+package mbserver
+
+// Unit is an additional device served by a Server on the same listeners and
+// serial ports, see AddUnit. It is a Server of its own: its memory maps,
+// function handlers, callbacks and settings are independent of those of the
+// server it was added to, and set through the embedded Server as usual.
+type Unit struct {
+	*Server
+}
+
+// AddUnit adds a device answering the requests for unit ID id, with its own
+// DiscreteInputs, Coils, HoldingRegisters and InputRegisters allocated as
+// set by opts, like NewServer does. This simulates a gateway fronting
+// several devices on one TCP port. Requests are routed by unit ID: those for
+// the slave ID of the server are served by the server itself, even when a
+// unit has the same ID. Adding a unit ID again returns the existing unit.
+//
+// Requests for the units are processed in turn with those of the server,
+// and answered before the TCP to RTU gateway gets to forward them. They pass
+// the access checks of the server (see SetAccessRules, SetReadOnlyRange and
+// OnAccessViolation) before those of the unit.
+func (s *Server) AddUnit(id uint8, opts ...Option) *Unit {
+	s.unitsLock.Lock()
+	defer s.unitsLock.Unlock()
+
+	if unit, ok := s.units[id]; ok {
+		return unit
+	}
+	unit := &Unit{Server: NewServer(append(opts, WithSlaveID(id))...)}
+	unit.parent = s
+	if s.units == nil {
+		s.units = make(map[uint8]*Unit)
+	}
+	s.units[id] = unit
+	return unit
+}
+
+// RemoveUnit removes the unit added for a unit ID, whose requests are then
+// no longer answered, and stops its handler goroutines. It does nothing when
+// there is none.
+func (s *Server) RemoveUnit(id uint8) {
+	s.unitsLock.Lock()
+	unit, ok := s.units[id]
+	delete(s.units, id)
+	s.unitsLock.Unlock()
+
+	if ok {
+		unit.stopHandler()
+	}
+}
+
+// unit returns the unit added for a unit ID, nil when there is none.
+func (s *Server) unit(id uint8) *Unit {
+	s.unitsLock.RLock()
+	defer s.unitsLock.RUnlock()
+	return s.units[id]
+}
+
+// stopUnits cancels the pending coil pulses of the units and stops their
+// handler goroutines, which NewServer started, waiting for them to exit.
+func (s *Server) stopUnits() {
+	s.unitsLock.RLock()
+	var handlersDone []chan struct{}
+	for _, unit := range s.units {
+		unit.stopPulses()
+		handlersDone = append(handlersDone, unit.stopHandler())
+	}
+	s.unitsLock.RUnlock()
+
+	for _, done := range handlersDone {
+		<-done
+	}
+}
+
+// startUnits starts again the handler goroutines of the units stopped by
+// stopUnits.
+func (s *Server) startUnits() {
+	s.unitsLock.RLock()
+	defer s.unitsLock.RUnlock()
+
+	for _, unit := range s.units {
+		unit.startHandler()
+	}
+}
@@ -0,0 +1,113 @@
+package mbserver
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+
+	"github.com/goburrow/modbus"
+)
+
+func TestAddUnit(t *testing.T) {
+	s := NewServer()
+	unit := s.AddUnit(2, WithHoldingRegisterCount(10))
+	if s.AddUnit(2) != unit {
+		t.Errorf("expected adding a unit again to return it")
+	}
+	addr, err := s.ListenTCPAny()
+	if err != nil {
+		t.Fatalf("failed to listen, got %v\n", err)
+	}
+	defer s.Close()
+
+	for _, id := range []byte{1, 2} {
+		handler := modbus.NewTCPClientHandler(addr.String())
+		handler.SlaveId = id
+		if err := handler.Connect(); err != nil {
+			t.Fatalf("failed to connect, got %v\n", err)
+		}
+		defer handler.Close()
+		if _, err := modbus.NewClient(handler).WriteSingleRegister(3, uint16(id)*100); err != nil {
+			t.Errorf("unit %v: expected nil, got %v", id, err)
+		}
+	}
+	if s.HoldingRegisters[3] != 100 || unit.HoldingRegisters[3] != 200 {
+		t.Errorf("expected independent registers, got %v and %v", s.HoldingRegisters[3], unit.HoldingRegisters[3])
+	}
+
+	// The unit has its own memory size.
+	response, _ := s.Dispatch(&TCPFrame{Device: 2, Function: ReadHoldingRegistersFC, Data: []byte{0, 10, 0, 1}})
+	if exception := GetException(response); exception != IllegalDataAddress {
+		t.Errorf("expected IllegalDataAddress, got %v", exception.String())
+	}
+
+	s.RemoveUnit(2)
+	_, err = s.RoundTrip([]byte{0, 1, 0, 0, 0, 6, 2, 0x03, 0x00, 0x00, 0x00, 0x01})
+	if !errors.Is(err, ErrNoResponse) {
+		t.Errorf("expected ErrNoResponse for a removed unit, got %v", err)
+	}
+}
+
+func TestUnitAccessChecks(t *testing.T) {
+	events := make(eventWriter, 10)
+	s := NewServer()
+	s.SetLogHandler(slog.NewJSONHandler(events, &slog.HandlerOptions{Level: slog.LevelInfo}))
+	unit := s.AddUnit(2)
+	s.SetAccessRules([]AccessRule{{Units: []uint8{2}, Deny: true}})
+	var violations []AccessViolation
+	s.OnAccessViolation(func(violation AccessViolation) {
+		violations = append(violations, violation)
+	})
+
+	response, err := s.RoundTrip((&TCPFrame{Device: 2, Function: WriteHoldingRegisterFC, Data: []byte{0, 3, 0, 7}}).Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if frame, _ := NewTCPFrame(response); GetException(frame) != IllegalFunction {
+		t.Errorf("expected IllegalFunction for a denied unit, got %v", response)
+	}
+	if unit.HoldingRegisters[3] != 0 {
+		t.Errorf("expected the denied write not to reach the unit")
+	}
+	if len(violations) != 1 || violations[0].Unit != 2 {
+		t.Errorf("expected an access violation for unit 2, got %v", violations)
+	}
+	if event := events.next(t); event["msg"] != "exception returned" || event["unit"] != float64(2) {
+		t.Errorf("expected the exception to be logged, got %v", event)
+	}
+
+	// Without a handler of their own, units log to the server handler.
+	s.SetAccessRules(nil)
+	unit.Dispatch(&TCPFrame{Device: 2, Function: ReadHoldingRegistersFC, Data: []byte{0xff, 0xff, 0, 2}})
+	if event := events.next(t); event["msg"] != "exception returned" || event["unit"] != float64(2) {
+		t.Errorf("expected the exception of the unit to be logged, got %v", event)
+	}
+}
+
+func TestUnitHandlers(t *testing.T) {
+	s := NewServer()
+	removed, kept := s.AddUnit(2), s.AddUnit(3)
+	s.RemoveUnit(2)
+	<-removed.handlerDone
+	if removed.handlerRunning.Load() {
+		t.Errorf("expected the handler of a removed unit to be stopped")
+	}
+
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if kept.handlerRunning.Load() {
+		t.Errorf("expected the handler of the unit to be stopped by Shutdown")
+	}
+	if err := s.Restart(); err != nil {
+		t.Fatal(err)
+	}
+	if !kept.handlerRunning.Load() {
+		t.Errorf("expected the handler of the unit to be started by Restart")
+	}
+	s.Close()
+	if kept.handlerRunning.Load() {
+		t.Errorf("expected the handler of the unit to be stopped by Close")
+	}
+}
@@ -0,0 +1,32 @@
+package mbserver
+
+// SetWriteValidator sets a function consulted by the built-in write functions
+// (5, 6, 15 and 16) before memory is changed. Coil values are passed as 0 or
+// 1. A non-nil exception aborts the write and is returned to the master; nil
+// allows the write. Passing nil removes the validator.
+func (s *Server) SetWriteValidator(validator func(address uint16, values []uint16, kind RegisterKind) *Exception) {
+	s.hooksLock.Lock()
+	s.writeValidator = validator
+	s.hooksLock.Unlock()
+}
+
+// validateWrite returns the exception of the read-only registers of the
+// profile, of the write-once ranges or of the write validator, nil when the
+// write is allowed.
+func (s *Server) validateWrite(address int, values []uint16, kind RegisterKind) *Exception {
+	if err := s.checkReadOnly(kind, address, len(values)); err != nil {
+		return exceptionFromError(err)
+	}
+	if err := s.checkWriteOnce(kind, address, len(values)); err != nil {
+		return exceptionFromError(err)
+	}
+
+	s.hooksLock.RLock()
+	validator := s.writeValidator
+	s.hooksLock.RUnlock()
+
+	if validator == nil {
+		return nil
+	}
+	return validator(uint16(address), values, kind)
+}
@@ -0,0 +1,83 @@
+package mbserver
+
+import "testing"
+
+func TestWriteValidator(t *testing.T) {
+	s := NewServer()
+	s.SetWriteValidator(func(address uint16, values []uint16, kind RegisterKind) *Exception {
+		if kind != HoldingRegister {
+			return nil
+		}
+		for _, value := range values {
+			if value > 100 {
+				return &IllegalDataValue
+			}
+		}
+		return nil
+	})
+
+	var frame TCPFrame
+	frame.Device = 1
+	frame.Function = WriteHoldingRegistersFC
+
+	var req Request
+	req.frame = &frame
+
+	SetDataWithRegisterAndNumberAndValues(&frame, 1, 2, []uint16{50, 150})
+	response := s.handle(&req)
+	exception := GetException(response)
+	if exception != IllegalDataValue {
+		t.Errorf("expected IllegalDataValue, got %v", exception.String())
+	}
+	expect := []uint16{0, 0}
+	got := s.HoldingRegisters[1:3]
+	if !isEqual(expect, got) {
+		t.Errorf("expected %v, got %v", expect, got)
+	}
+
+	SetDataWithRegisterAndNumberAndValues(&frame, 1, 2, []uint16{50, 100})
+	response = s.handle(&req)
+	exception = GetException(response)
+	if exception != Success {
+		t.Errorf("expected Success, got %v", exception.String())
+	}
+	expect = []uint16{50, 100}
+	got = s.HoldingRegisters[1:3]
+	if !isEqual(expect, got) {
+		t.Errorf("expected %v, got %v", expect, got)
+	}
+}
+
+func TestWriteValidatorCoils(t *testing.T) {
+	s := NewServer()
+	var gotAddress uint16
+	var gotValues []uint16
+	s.SetWriteValidator(func(address uint16, values []uint16, kind RegisterKind) *Exception {
+		gotAddress = address
+		gotValues = values
+		return &SlaveDeviceFailure
+	})
+
+	var frame TCPFrame
+	frame.Device = 1
+	frame.Function = WriteMultipleCoilsFC
+	SetDataWithRegisterAndNumberAndBytes(&frame, 10, 3, []byte{5})
+
+	var req Request
+	req.frame = &frame
+	response := s.handle(&req)
+	exception := GetException(response)
+	if exception != SlaveDeviceFailure {
+		t.Errorf("expected SlaveDeviceFailure, got %v", exception.String())
+	}
+	if gotAddress != 10 {
+		t.Errorf("expected address 10, got %v", gotAddress)
+	}
+	expect := []uint16{1, 0, 1}
+	if !isEqual(expect, gotValues) {
+		t.Errorf("expected %v, got %v", expect, gotValues)
+	}
+	if s.Coils[10] != 0 {
+		t.Errorf("expected coil 10 not to be written")
+	}
+}
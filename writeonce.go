@@ -0,0 +1,75 @@
+package mbserver
+
+import "fmt"
+
+// SetWriteOnce declares the addresses start to end (inclusive) of a coil or
+// holding register memory map as write-once, which models devices with
+// configuration registers that may be committed only once after reset. The
+// first write by a master to an address of the range succeeds, further writes
+// return IllegalDataAddress until ResetWriteOnce or Reset is called. A write
+// touching an address already written is rejected as a whole, leaving memory
+// untouched.
+//
+// Only writes by masters are tracked, the accessors of the server and its
+// exported memory maps are not restricted.
+func (s *Server) SetWriteOnce(start, end uint16, kind RegisterKind) error {
+	if end < start {
+		return fmt.Errorf("write-once range end %d before start %d", end, start)
+	}
+	if kind != Coil && kind != HoldingRegister {
+		return fmt.Errorf("%v cannot be written by masters", kind)
+	}
+
+	s.memoryLock.Lock()
+	defer s.memoryLock.Unlock()
+	s.writeOnce = append(s.writeOnce, region{start: int(start), end: int(end), kind: kind})
+	return nil
+}
+
+// ResetWriteOnce forgets which write-once addresses have been written, so
+// that they may be written again.
+func (s *Server) ResetWriteOnce() {
+	s.memoryLock.Lock()
+	defer s.memoryLock.Unlock()
+	s.written = [4][]uint64{}
+}
+
+// checkWriteOnce returns an error when quantity items of kind from address
+// touch a write-once address that has already been written. The memory lock
+// must be held.
+func (s *Server) checkWriteOnce(kind RegisterKind, address int, quantity int) error {
+	for i := address; i < address+quantity; i++ {
+		if s.isWriteOnce(kind, i) && s.isWritten(kind, i) {
+			return fmt.Errorf("%w: write-once %v %d already written", ErrAddressOutOfRange, kind, i)
+		}
+	}
+	return nil
+}
+
+func (s *Server) isWriteOnce(kind RegisterKind, address int) bool {
+	for _, r := range s.writeOnce {
+		if r.kind == kind && address >= r.start && address <= r.end {
+			return true
+		}
+	}
+	return false
+}
+
+// markWritten sets the dirty bits of quantity items of kind from address.
+// The memory lock must be held.
+func (s *Server) markWritten(kind RegisterKind, address int, quantity int) {
+	if len(s.writeOnce) == 0 || int(kind) >= len(s.written) {
+		return
+	}
+	if s.written[kind] == nil {
+		s.written[kind] = make([]uint64, MaxRegisterSize/64)
+	}
+	for i := address; i < address+quantity && i < MaxRegisterSize; i++ {
+		s.written[kind][i/64] |= 1 << (i % 64)
+	}
+}
+
+func (s *Server) isWritten(kind RegisterKind, address int) bool {
+	bits := s.written[kind]
+	return bits != nil && bits[address/64]&(1<<(address%64)) != 0
+}
@@ -0,0 +1,53 @@
+package mbserver
+
+import "testing"
+
+func TestSetWriteOnce(t *testing.T) {
+	s := NewServer()
+	if err := s.SetWriteOnce(10, 19, HoldingRegister); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if err := s.SetWriteOnce(0, 0, InputRegister); err == nil {
+		t.Errorf("expected input registers to be rejected")
+	}
+	if err := s.SetWriteOnce(5, 4, Coil); err == nil {
+		t.Errorf("expected an empty range to be rejected")
+	}
+
+	write := func(address uint16, values ...uint16) Exception {
+		frame := &TCPFrame{Device: 1, Function: WriteHoldingRegistersFC}
+		SetDataWithRegisterAndNumberAndValues(frame, address, uint16(len(values)), values)
+		return GetException(s.handle(&Request{frame: frame}))
+	}
+
+	tests := []struct {
+		address uint16
+		values  []uint16
+		expect  Exception
+	}{
+		{10, []uint16{1, 2}, Success},
+		{10, []uint16{3}, IllegalDataAddress},
+		// Partially written ranges are rejected as a whole.
+		{11, []uint16{4, 5}, IllegalDataAddress},
+		{12, []uint16{6, 7}, Success},
+		{0, []uint16{8}, Success},
+		{0, []uint16{9}, Success},
+	}
+	for _, test := range tests {
+		if exception := write(test.address, test.values...); exception != test.expect {
+			t.Errorf("%+v: expected %v, got %v", test, test.expect.String(), exception.String())
+		}
+	}
+	if !isEqual([]uint16{9, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 2, 6, 7, 0}, s.HoldingRegisters[0:15]) {
+		t.Errorf("unexpected holding registers %v", s.HoldingRegisters[0:15])
+	}
+
+	s.ResetWriteOnce()
+	if exception := write(10, 3); exception != Success {
+		t.Errorf("expected Success after ResetWriteOnce, got %v", exception.String())
+	}
+	s.Reset()
+	if exception := write(10, 4); exception != Success {
+		t.Errorf("expected Success after Reset, got %v", exception.String())
+	}
+}